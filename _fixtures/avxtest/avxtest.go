@@ -0,0 +1,25 @@
+package main
+
+import "os"
+
+// avxsetup loads pattern into YMM0 and stops at a breakpoint.
+func avxsetup(pattern *[32]byte)
+
+// avx512setup loads pattern into ZMM1 and stops at a breakpoint.
+func avx512setup(pattern *[64]byte)
+
+func main() {
+	var ymm [32]byte
+	for i := range ymm {
+		ymm[i] = byte(i + 1)
+	}
+	avxsetup(&ymm)
+
+	if len(os.Args) > 1 && os.Args[1] == "avx512" {
+		var zmm [64]byte
+		for i := range zmm {
+			zmm[i] = byte(0x80 + i)
+		}
+		avx512setup(&zmm)
+	}
+}
@@ -0,0 +1,15 @@
+#include "textflag.h"
+
+TEXT ·avxsetup(SB),NOSPLIT,$0-8
+	MOVQ pattern+0(FP), AX
+	VMOVDQU (AX), Y0
+	INT $3
+	VZEROUPPER
+	RET
+
+TEXT ·avx512setup(SB),NOSPLIT,$0-8
+	MOVQ pattern+0(FP), AX
+	VMOVDQU64 (AX), Z1
+	INT $3
+	VZEROUPPER
+	RET
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"fmt"
+	"syscall"
+)
+
+func main() {
+	var fds [2]int
+	if err := syscall.Pipe(fds[:]); err != nil {
+		panic(err)
+	}
+	buf := make([]byte, 1)
+	// nothing is ever written to the pipe, this blocks forever
+	n, err := syscall.Read(fds[0], buf)
+	fmt.Println(n, err)
+}
@@ -0,0 +1,27 @@
+package main
+
+/*
+struct bitfields {
+	unsigned int a : 3;
+	int b : 5;
+	unsigned int c : 1;
+	int d;
+	unsigned long long e : 40;
+	union {
+		int i;
+		unsigned char bytes[4];
+	} u;
+	float f;
+};
+
+struct bitfields cbitfields = { 5, -3, 1, 42, 0x123456789a, { .i = 0x01020304 }, 1.5 };
+
+int getd(void) { return cbitfields.d; }
+*/
+import "C"
+
+import "fmt"
+
+func main() {
+	fmt.Println(C.getd())
+}
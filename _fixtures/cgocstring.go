@@ -0,0 +1,21 @@
+package main
+
+/*
+#include <stdio.h>
+#include <stdlib.h>
+
+void printstr(char *s) { printf("%s\n", s); }
+*/
+import "C"
+
+import (
+	"runtime"
+	"unsafe"
+)
+
+func main() {
+	cs := C.CString("hello, world!")
+	runtime.Breakpoint()
+	C.printstr(cs)
+	C.free(unsafe.Pointer(cs))
+}
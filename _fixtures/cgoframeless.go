@@ -0,0 +1,21 @@
+package main
+
+// #define BREAKPOINT asm("int3;")
+//
+// __attribute__((noinline, optimize("omit-frame-pointer")))
+// int frameless(int x) {
+// 	BREAKPOINT;
+// 	return x * 3;
+// }
+//
+// int framelessCaller(int x) {
+// 	int r = frameless(x + 1);
+// 	return r + 1;
+// }
+import "C"
+
+import "fmt"
+
+func main() {
+	fmt.Println(C.framelessCaller(2))
+}
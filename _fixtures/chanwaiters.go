@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+)
+
+func main() {
+	chbuf := make(chan int, 5)
+	chbuf <- 1
+	chbuf <- 2
+	chsend := make(chan int)
+	go func() {
+		chsend <- 1
+	}()
+	chrecv := make(chan int)
+	go func() {
+		<-chrecv
+	}()
+	time.Sleep(100 * time.Millisecond)
+	runtime.Breakpoint()
+	<-chsend
+	chrecv <- 1
+	fmt.Println(<-chbuf, <-chbuf)
+}
@@ -0,0 +1,8 @@
+#include <unistd.h>
+
+int main(void) {
+	for (;;) {
+		sleep(1);
+	}
+	return 0;
+}
@@ -32,7 +32,8 @@ func main() {
 	d := BitFieldType(33)
 	e := ConstType(10)
 	f := BitFieldType(0)
+	g := []ConstType{constOne, ConstType(7), constThree}
 	runtime.Breakpoint()
 	pkg.SomeVar.AnotherMethod(2)
-	fmt.Println(a, b, c, d, e, f, pkg.SomeConst)
+	fmt.Println(a, b, c, d, e, f, g, pkg.SomeConst)
 }
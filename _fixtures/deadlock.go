@@ -0,0 +1,46 @@
+package main
+
+import (
+	"runtime"
+	"sync"
+	"time"
+)
+
+var counter int
+
+func lockBoth(first, second *sync.Mutex, ready *sync.WaitGroup) {
+	first.Lock()
+	ready.Done()
+	ready.Wait()
+	second.Lock()
+	second.Unlock()
+	first.Unlock()
+}
+
+func progress(step1, step2 chan struct{}) {
+	<-step1
+	<-step2
+}
+
+func main() {
+	var a, b sync.Mutex
+	var ready sync.WaitGroup
+	ready.Add(2)
+	go lockBoth(&a, &b, &ready)
+	go lockBoth(&b, &a, &ready)
+	// the progress goroutine waits on step1 when the target stops and on
+	// step2 after it's resumed, it is not stuck.
+	step1, step2 := make(chan struct{}), make(chan struct{})
+	go progress(step1, step2)
+	go func() {
+		time.Sleep(150 * time.Millisecond)
+		close(step1)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	runtime.Breakpoint()
+	// keep the main goroutine running so that the runtime doesn't detect
+	// the deadlock.
+	for {
+		counter++
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import "fmt"
+
+var dummy int
+
+func leaf() {
+	dummy++
+}
+
+func recurse(n int) int {
+	var buf [64]byte
+	buf[n%len(buf)] = byte(n)
+	if n == 0 {
+		leaf()
+		return int(buf[0])
+	}
+	return recurse(n-1) + int(buf[n%len(buf)])
+}
+
+func main() {
+	leaf()
+	fmt.Println(recurse(1000))
+}
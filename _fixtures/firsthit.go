@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+func work(i int, wg *sync.WaitGroup) {
+	fmt.Println(i)
+	wg.Done()
+}
+
+func main() {
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go work(i, &wg)
+	}
+	wg.Wait()
+}
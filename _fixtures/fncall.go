@@ -47,6 +47,10 @@ func (a astruct) VRcvr(x int) string {
 	return fmt.Sprintf("%d + %d = %d", x, a.X, x+a.X)
 }
 
+func (a astruct) Double() int {
+	return a.X * 2
+}
+
 func (pa *astruct) PRcvr(x int) string {
 	return fmt.Sprintf("%d - %d = %d", x, pa.X, x-pa.X)
 }
@@ -113,5 +117,5 @@ func main() {
 	runtime.Breakpoint()
 	call1(one, two)
 	fn2clos(2)
-	fmt.Println(one, two, zero, callpanic, callstacktrace, stringsJoin, intslice, stringslice, comma, a.VRcvr, a.PRcvr, pa, vable_a, vable_pa, pable_pa, fn2clos, fn2glob, fn2valmeth, fn2ptrmeth, fn2nil, ga, escapeArg, a2, square, intcallpanic, onetwothree)
+	fmt.Println(one, two, zero, callpanic, callstacktrace, stringsJoin, intslice, stringslice, comma, a.VRcvr, a.PRcvr, a.Double, pa, vable_a, vable_pa, pable_pa, fn2clos, fn2glob, fn2valmeth, fn2ptrmeth, fn2nil, ga, escapeArg, a2, square, intcallpanic, onetwothree)
 }
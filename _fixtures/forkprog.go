@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"syscall"
+)
+
+//go:noinline
+func child(n int) int {
+	return n + 1
+}
+
+//go:noinline
+func parent(n int) int {
+	return n + 2
+}
+
+func main() {
+	pid, _, errno := syscall.RawSyscall(syscall.SYS_FORK, 0, 0, 0)
+	if errno != 0 {
+		panic(errno)
+	}
+	if pid == 0 {
+		// The child process only has one thread, avoid doing anything that
+		// needs the rest of the runtime.
+		child(1)
+		syscall.RawSyscall(syscall.SYS_EXIT_GROUP, 0, 0, 0)
+	}
+	var status syscall.WaitStatus
+	syscall.Wait4(int(pid), &status, 0, nil)
+	fmt.Println(parent(1), status.ExitStatus())
+}
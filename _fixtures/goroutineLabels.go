@@ -0,0 +1,19 @@
+package main
+
+import (
+	"context"
+	"runtime"
+	"runtime/pprof"
+)
+
+var dummy int
+
+func labeled(ctx context.Context) {
+	runtime.Breakpoint()
+	dummy++
+}
+
+func main() {
+	runtime.Breakpoint()
+	pprof.Do(context.Background(), pprof.Labels("k1", "v1", "k2", "v2"), labeled)
+}
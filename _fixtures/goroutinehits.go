@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+var hits int
+
+func hit(n int) {
+	hits++
+}
+
+func main() {
+	// only one goroutine runs at a time, so that each stop is caused by a
+	// single hit.
+	runtime.GOMAXPROCS(1)
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 4; j++ {
+				hit(i)
+				runtime.Gosched()
+			}
+		}(i)
+	}
+	wg.Wait()
+	fmt.Println(hits)
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+type point struct{ X, Y int }
+
+type segment struct{ A, B point }
+
+func main() {
+	p := &point{3, 4}
+	m1 := map[point]int{{1, 2}: 42}
+	m2 := map[*point]string{p: "p"}
+	m3 := map[segment]bool{{point{1, 2}, point{3, 4}}: true}
+	runtime.Breakpoint()
+	fmt.Println(p, m1, m2, m3)
+}
@@ -0,0 +1,15 @@
+package main
+
+import "fmt"
+
+func countdown(n int) int {
+	if n == 0 {
+		return 0
+	}
+	r := countdown(n - 1)
+	return r + 1
+}
+
+func main() {
+	fmt.Println(countdown(3))
+}
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	_, err := os.Open("/nonexistent/openfail")
+	fmt.Println(err)
+}
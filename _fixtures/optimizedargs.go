@@ -0,0 +1,17 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+//go:noinline
+func product(a, b int) int {
+	c := a * b
+	runtime.Breakpoint()
+	return c
+}
+
+func main() {
+	fmt.Println(product(6, 7))
+}
@@ -0,0 +1,20 @@
+package main
+
+import "runtime"
+
+func handlefirst() {
+	defer func() {
+		runtime.Breakpoint()
+		recover()
+		runtime.Breakpoint()
+	}()
+	panic("second")
+}
+
+func main() {
+	defer func() {
+		recover()
+	}()
+	defer handlefirst()
+	panic("first")
+}
@@ -0,0 +1,15 @@
+package main
+
+import "fmt"
+
+type point struct {
+	x, y int
+}
+
+func manyargs(n int, s string, f float64, pt point, sl []int, b bool) {
+	fmt.Println(n, s, f, pt, sl, b)
+}
+
+func main() {
+	manyargs(3, "three", 3.5, point{1, 2}, []int{4, 5}, true)
+}
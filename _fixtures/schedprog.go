@@ -0,0 +1,12 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func main() {
+	runtime.GOMAXPROCS(3)
+	runtime.Breakpoint()
+	fmt.Println("done")
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+func main() {
+	runtime.LockOSThread()
+	// block SIGUSR1 on this thread and send it to the thread, where it stays
+	// pending.
+	set := uint64(1) << (uint(syscall.SIGUSR1) - 1)
+	const sigBlock = 0
+	if _, _, err := syscall.RawSyscall6(syscall.SYS_RT_SIGPROCMASK, sigBlock, uintptr(unsafe.Pointer(&set)), 0, 8, 0, 0); err != 0 {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	tid := syscall.Gettid()
+	syscall.Tgkill(os.Getpid(), tid, syscall.SIGUSR1)
+	fmt.Println(tid)
+	for {
+		time.Sleep(time.Second)
+	}
+}
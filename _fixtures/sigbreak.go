@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func loop(i int) {
+	fmt.Println("loop", i)
+}
+
+func signaled() {
+	fmt.Println("got signal")
+}
+
+func main() {
+	ch := make(chan os.Signal, 2)
+	signal.Notify(ch, syscall.SIGUSR1, syscall.SIGUSR2)
+	received := 0
+	for i := 0; i < 100; i++ {
+		loop(i)
+		select {
+		case <-ch:
+			signaled()
+			received++
+			if received == 2 {
+				return
+			}
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"runtime"
+	"time"
+)
+
+var counter int
+
+func spin(sleep bool) {
+	for {
+		counter++
+		if sleep {
+			time.Sleep(time.Second)
+		}
+	}
+}
+
+func main() {
+	go spin(false)
+	runtime.Gosched()
+	spin(true)
+}
@@ -0,0 +1,22 @@
+package main
+
+import "fmt"
+
+var sink *int
+
+//go:noinline
+func g() {
+	sink = nil
+}
+
+func f() {
+	p := new(int)
+	n := 5
+	*p = n
+	g()
+	fmt.Println(*p, n)
+}
+
+func main() {
+	f()
+}
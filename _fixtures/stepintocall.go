@@ -0,0 +1,20 @@
+package main
+
+import "fmt"
+
+func f(a, b int) int {
+	return a + b
+}
+
+func g() int {
+	return 1
+}
+
+func h() int {
+	return 2
+}
+
+func main() {
+	x := f(g(), h())
+	fmt.Println(x)
+}
@@ -0,0 +1,15 @@
+package main
+
+import "fmt"
+
+type point struct {
+	x, y int
+}
+
+func multiret(n int) (s string, f float64, pt point, b bool, err error) {
+	return fmt.Sprintf("multiret %d", n), float64(n) + 1.5, point{n, n + 1}, n > 0, nil
+}
+
+func main() {
+	multiret(3)
+}
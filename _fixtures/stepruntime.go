@@ -0,0 +1,9 @@
+package main
+
+import "fmt"
+
+func main() {
+	m := map[string]int{}
+	m["a"] = 1
+	fmt.Println(m)
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+func main() {
+	var mu1, mu2 sync.Mutex
+	mu1.Lock()
+	var wg sync.WaitGroup
+	wg.Add(2)
+	var once1, once2 sync.Once
+	once1.Do(func() {})
+	runtime.Breakpoint()
+	fmt.Println(&mu1, &mu2, &wg, &once1, &once2)
+}
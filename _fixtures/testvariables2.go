@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"go/constant"
 	"math"
@@ -8,6 +9,8 @@ import (
 	"unsafe"
 )
 
+var global1 = 12
+
 type astruct struct {
 	A int
 	B int
@@ -41,6 +44,11 @@ type B struct {
 	ptr *A
 }
 
+type E struct {
+	B
+	x int
+}
+
 type D struct {
 	u1, u2, u3, u4, u5, u6 uint32
 }
@@ -93,6 +101,14 @@ type truncatedMap struct {
 	v []map[string]astruct
 }
 
+type ptrrec *ptrrec
+
+type errloop struct {
+	next error
+}
+
+func (e *errloop) Error() string { return "loop" }
+
 func main() {
 	i1 := 1
 	i2 := 2
@@ -165,6 +181,8 @@ func main() {
 	m2 := map[int]*astruct{1: &astruct{10, 11}}
 	m3 := map[astruct]int{{1, 1}: 42, {2, 2}: 43}
 	up1 := unsafe.Pointer(&i1)
+	pglobal1 := &global1
+	upglobal1 := unsafe.Pointer(&global1)
 	i4 := 800
 	i5 := -3
 	i6 := -500
@@ -200,6 +218,7 @@ func main() {
 	aas[0].aas = aas
 	b := B{A: A{-314}, C: &C{"hello"}, a: A{42}, ptr: &A{1337}}
 	b2 := B{A: A{42}, a: A{47}}
+	d1 := E{B: b2, x: 3}
 	var sd D
 
 	ifacearr := []error{&astruct{}, nil}
@@ -234,6 +253,15 @@ func main() {
 	sliceinf := make([]interface{}, 1)
 	sliceinf[0] = sliceinf
 
+	var ptrrec1 ptrrec
+	ptrrec1 = &ptrrec1
+
+	points := []struct{ X, Y int }{{1, 2}, {3, 4}, {5, 6}, {7, 8}}
+
+	errwrapped := fmt.Errorf("outer: %w", fmt.Errorf("middle: %w", errors.New("inner")))
+	errloop1 := &errloop{}
+	errloop1.next = errloop1
+
 	zsvar := struct{}{}
 	zsslice := make([]struct{}, 3)
 	zsvmap := map[string]struct{}{"testkey": struct{}{}}
@@ -249,6 +277,13 @@ func main() {
 	bytearray := [5]byte{116, 195, 168, 115, 116}
 	runearray := [4]rune{116, 232, 115, 116}
 
+	boolvar := true
+	runevar := 'A'
+
+	capturedInt := 10
+	capturedStr := "captured"
+	closurevar := func() int { return capturedInt + len(capturedStr) }
+
 	longstr := "very long string 0123456789a0123456789b0123456789c0123456789d0123456789e0123456789f0123456789g012345678h90123456789i0123456789j0123456789"
 
 	var nilstruct *astruct = nil
@@ -273,5 +308,5 @@ func main() {
 	}
 
 	runtime.Breakpoint()
-	fmt.Println(i1, i2, i3, p1, amb1, s1, s3, a1, p2, p3, s2, as1, str1, f1, fn1, fn2, nilslice, nilptr, ch1, chnil, m1, mnil, m2, m3, up1, i4, i5, i6, err1, err2, errnil, iface1, iface2, ifacenil, arr1, parr, cpx1, const1, iface3, iface4, recursive1, recursive1.x, iface5, iface2fn1, iface2fn2, bencharr, benchparr, mapinf, mainMenu, b, b2, sd, anonstruct1, anonstruct2, anoniface1, anonfunc, mapanonstruct1, ifacearr, efacearr, ni8, ni16, ni32, pinf, ninf, nan, zsvmap, zsslice, zsvar, tm, errtypednil, emptyslice, emptymap, byteslice, runeslice, bytearray, runearray, longstr, nilstruct, as2, as2.NonPointerRecieverMethod, s4, iface2map)
+	fmt.Println(i1, i2, i3, p1, amb1, s1, s3, a1, p2, p3, s2, as1, str1, f1, fn1, fn2, nilslice, nilptr, ch1, chnil, m1, mnil, m2, m3, up1, i4, i5, i6, err1, err2, errnil, iface1, iface2, ifacenil, arr1, parr, cpx1, const1, iface3, iface4, recursive1, recursive1.x, iface5, iface2fn1, iface2fn2, bencharr, benchparr, mapinf, mainMenu, b, b2, d1, sd, anonstruct1, anonstruct2, anoniface1, anonfunc, mapanonstruct1, ifacearr, efacearr, ni8, ni16, ni32, pinf, ninf, nan, zsvmap, zsslice, zsvar, tm, errtypednil, emptyslice, emptymap, byteslice, runeslice, bytearray, runearray, boolvar, runevar, closurevar, longstr, nilstruct, as2, as2.NonPointerRecieverMethod, s4, iface2map, ptrrec1, points, errwrapped, errloop1, pglobal1, upglobal1)
 }
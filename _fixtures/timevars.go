@@ -0,0 +1,15 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+)
+
+func main() {
+	tm := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	tmptr := &tm
+	d := 90 * time.Second
+	runtime.Breakpoint()
+	fmt.Println(tm, tmptr, d)
+}
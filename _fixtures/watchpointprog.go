@@ -0,0 +1,39 @@
+package main
+
+import "runtime"
+
+var watched int
+
+func double(i int) int {
+	return i * 2
+}
+
+func counter() int {
+	n := 0
+	for i := 0; i < 2; i++ {
+		n += i + 1
+	}
+	return n
+}
+
+func clobber() int {
+	var a [4]int
+	for i := range a {
+		a[i] = i
+	}
+	return a[3]
+}
+
+func main() {
+	for i := 0; i < 3; i++ {
+		watched = double(i)
+	}
+	n := counter()
+	n += clobber()
+	println(watched, n)
+}
+
+func init() {
+	// the watchpoint is set on the debug registers of the main thread
+	runtime.LockOSThread()
+}
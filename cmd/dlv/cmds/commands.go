@@ -107,6 +107,7 @@ func New(docCall bool) *cobra.Command {
 	rpc		Log all RPC messages
 	fncall		Log function call protocol
 	minidump	Log minidump loading
+	ptrace		Log ptrace calls made by the native backend
 Defaults to "debugger" when logging is enabled with --log.`)
 	RootCommand.PersistentFlags().StringVarP(&LogDest, "log-dest", "", "", "Writes logs to the specified file or file descriptor. If the argument is a number it will be interpreted as a file descriptor, otherwise as a file path. This option will also redirect the \"API listening\" message in headless mode.")
 
@@ -1,20 +1,25 @@
 module github.com/go-delve/delve
 
+go 1.27.1
+
 require (
 	github.com/cosiner/argv v0.0.0-20170225145430-13bacc38a0a5
-	github.com/cpuguy83/go-md2man v1.0.8 // indirect
-	github.com/inconshreveable/mousetrap v1.0.0 // indirect
 	github.com/mattn/go-colorable v0.0.0-20170327083344-ded68f7a9561
 	github.com/mattn/go-isatty v0.0.3
 	github.com/peterh/liner v0.0.0-20170317030525-88609521dc4b
 	github.com/pkg/profile v0.0.0-20170413231811-06b906832ed0
-	github.com/russross/blackfriday v0.0.0-20180428102519-11635eb403ff // indirect
 	github.com/sirupsen/logrus v0.0.0-20180523074243-ea8897e79973
 	github.com/spf13/cobra v0.0.0-20170417170307-b6cb39589372
-	github.com/spf13/pflag v0.0.0-20170417173400-9e4c21054fa1 // indirect
 	golang.org/x/arch v0.0.0-20171004143515-077ac972c2e4
-	golang.org/x/crypto v0.0.0-20180614174826-fd5f17ee7299 // indirect
 	golang.org/x/sys v0.0.0-20180614134839-8883426083c0
 	golang.org/x/tools v0.0.0-20181120060634-fc4f04983f62
 	gopkg.in/yaml.v2 v2.0.0-20170407172122-cd8b52f8269e
 )
+
+require (
+	github.com/cpuguy83/go-md2man v1.0.8 // indirect
+	github.com/inconshreveable/mousetrap v1.0.0 // indirect
+	github.com/russross/blackfriday v0.0.0-20180428102519-11635eb403ff // indirect
+	github.com/spf13/pflag v0.0.0-20170417173400-9e4c21054fa1 // indirect
+	golang.org/x/crypto v0.0.0-20180614174826-fd5f17ee7299 // indirect
+)
@@ -54,6 +54,14 @@ type Config struct {
 	// DebugFileDirectories is the list of directories Delve will use
 	// in order to resolve external debug info files.
 	DebugInfoDirectories []string `yaml:"debug-info-directories"`
+
+	// DisassembleFlavor is the assembly syntax used by the disassemble
+	// command, one of "intel" (the default), "gnu" or "go".
+	DisassembleFlavor *string `yaml:"disassemble-flavor,omitempty"`
+
+	// If ShowAllThreads is true continue will print the location of every
+	// thread when the target stops.
+	ShowAllThreads bool `yaml:"show-all-threads"`
 }
 
 // LoadConfig attempts to populate a Config object from the config.yml file.
@@ -221,6 +229,12 @@ substitute-path:
 
 # List of directories to use when searching for separate debug info files.
 debug-info-directories: ["/usr/lib/debug/.build-id"]
+
+# Assembly syntax used by the disassemble command: intel, gnu (AT&T) or go.
+# disassemble-flavor: intel
+
+# Uncomment the following line to make continue print the location of every thread when the program stops.
+# show-all-threads: true
 `)
 	return err
 }
@@ -84,3 +84,20 @@ func (fdes FrameDescriptionEntries) Append(otherFDEs FrameDescriptionEntries) Fr
 	})
 	return r
 }
+
+// AppendMissing appends to fdes the entries of otherFDEs that don't
+// overlap any entry of fdes and returns the result, sorted like Append.
+func (fdes FrameDescriptionEntries) AppendMissing(otherFDEs FrameDescriptionEntries) FrameDescriptionEntries {
+	fdes = fdes.Append(nil)
+	var missing FrameDescriptionEntries
+	for _, fde := range otherFDEs {
+		idx := sort.Search(len(fdes), func(i int) bool {
+			return fdes[i].Begin() >= fde.End()
+		})
+		if idx > 0 && fdes[idx-1].End() > fde.Begin() {
+			continue
+		}
+		missing = append(missing, fde)
+	}
+	return fdes.Append(missing)
+}
@@ -51,6 +51,29 @@ func TestFDEForPC(t *testing.T) {
 	}
 }
 
+func TestAppendMissing(t *testing.T) {
+	fdes := FrameDescriptionEntries{
+		&FrameDescriptionEntry{begin: 50, size: 50},
+		&FrameDescriptionEntry{begin: 10, size: 40},
+	}
+	other := FrameDescriptionEntries{
+		&FrameDescriptionEntry{begin: 0, size: 10},  // before
+		&FrameDescriptionEntry{begin: 40, size: 20}, // overlapping
+		&FrameDescriptionEntry{begin: 60, size: 10}, // contained
+		&FrameDescriptionEntry{begin: 100, size: 5}, // after
+	}
+	r := fdes.AppendMissing(other)
+	expected := []uint64{0, 10, 50, 100}
+	if len(r) != len(expected) {
+		t.Fatalf("wrong number of entries %d, expected %d", len(r), len(expected))
+	}
+	for i := range r {
+		if r[i].Begin() != expected[i] {
+			t.Errorf("entry %d begins at %d, expected %d", i, r[i].Begin(), expected[i])
+		}
+	}
+}
+
 func BenchmarkFDEForPC(b *testing.B) {
 	f, err := os.Open("testdata/frame")
 	if err != nil {
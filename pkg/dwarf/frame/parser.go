@@ -1,11 +1,13 @@
 // Package frame contains data structures and
 // related functions for parsing and searching
-// through Dwarf .debug_frame data.
+// through Dwarf .debug_frame and .eh_frame data.
 package frame
 
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
+	"fmt"
 
 	"github.com/go-delve/delve/pkg/dwarf/util"
 )
@@ -114,6 +116,222 @@ func parseCIE(ctx *parseContext) parsefunc {
 	return parselength
 }
 
+// Pointer encodings used by .eh_frame, see the DWARF Extensions chapter of
+// the Linux Standard Base Core Specification.
+const (
+	ehPeAbsptr  = 0x00
+	ehPeUleb128 = 0x01
+	ehPeUdata2  = 0x02
+	ehPeUdata4  = 0x03
+	ehPeUdata8  = 0x04
+	ehPeSleb128 = 0x09
+	ehPeSdata2  = 0x0a
+	ehPeSdata4  = 0x0b
+	ehPeSdata8  = 0x0c
+	ehPePcrel   = 0x10
+	ehPeOmit    = 0xff
+
+	ehPeFormatMask = 0x0f
+	ehPeApplMask   = 0x70
+)
+
+// ParseEhFrame parses the contents of a .eh_frame section, the variant of
+// .debug_frame emitted by gcc, and returns its FDEs. The FDEs of .eh_frame
+// can use pointers relative to their own address, ehFrameAddr is the
+// address of the section in the executable before staticBase is added.
+// Only 64bit executables are supported.
+func ParseEhFrame(data []byte, order binary.ByteOrder, staticBase, ehFrameAddr uint64) (FrameDescriptionEntries, error) {
+	entries := NewFrameIndex()
+	cies := make(map[int]*ehCIE)
+	for off := 0; off+4 <= len(data); {
+		start := off
+		length := order.Uint32(data[off:])
+		off += 4
+		if length == 0 {
+			// ZERO terminator
+			continue
+		}
+		if length == 0xffffffff {
+			return nil, fmt.Errorf("unsupported 64bit entry at %#x of .eh_frame", start)
+		}
+		end := off + int(length)
+		if length < 4 || end > len(data) {
+			return nil, fmt.Errorf("malformed entry at %#x of .eh_frame", start)
+		}
+		id := order.Uint32(data[off:])
+		buf := bytes.NewBuffer(data[off+4 : end])
+		if id == 0 {
+			cie, err := parseEhCIE(buf, order, length-4, staticBase)
+			if err != nil {
+				return nil, fmt.Errorf("malformed CIE at %#x of .eh_frame: %v", start, err)
+			}
+			cies[start] = cie
+		} else {
+			// the CIE pointer is the distance between the CIE and the CIE
+			// pointer itself.
+			cie := cies[off-int(id)]
+			if cie == nil {
+				return nil, fmt.Errorf("could not find CIE of FDE at %#x of .eh_frame", start)
+			}
+			fde := &FrameDescriptionEntry{Length: length - 4, CIE: cie.CommonInformationEntry, order: order}
+			pos := ehFrameAddr + uint64(end-buf.Len())
+			begin, err := readEncodedPointer(buf, order, cie.ptrEncoding, pos)
+			if err != nil {
+				return nil, fmt.Errorf("malformed FDE at %#x of .eh_frame: %v", start, err)
+			}
+			// the size of the function uses the format of the pointer encoding
+			// but it's not relative to anything.
+			fde.size, err = readEncodedPointer(buf, order, cie.ptrEncoding&ehPeFormatMask, 0)
+			if err != nil {
+				return nil, fmt.Errorf("malformed FDE at %#x of .eh_frame: %v", start, err)
+			}
+			fde.begin = begin + staticBase
+			if cie.hasAugmentationData {
+				n, _ := util.DecodeULEB128(buf)
+				buf.Next(int(n))
+			}
+			fde.Instructions = buf.Bytes()
+			entries = append(entries, fde)
+		}
+		off = end
+	}
+	return entries, nil
+}
+
+// ehCIE is a CIE of .eh_frame with the information, stored in its
+// augmentation, needed to parse its FDEs.
+type ehCIE struct {
+	*CommonInformationEntry
+	ptrEncoding         byte
+	hasAugmentationData bool
+}
+
+func parseEhCIE(buf *bytes.Buffer, order binary.ByteOrder, length uint32, staticBase uint64) (*ehCIE, error) {
+	cie := &ehCIE{CommonInformationEntry: &CommonInformationEntry{Length: length, staticBase: staticBase}}
+	var err error
+	if cie.Version, err = buf.ReadByte(); err != nil {
+		return nil, err
+	}
+	cie.Augmentation, _ = util.ParseString(buf)
+	cie.CodeAlignmentFactor, _ = util.DecodeULEB128(buf)
+	cie.DataAlignmentFactor, _ = util.DecodeSLEB128(buf)
+	if cie.Version == 1 {
+		var reg byte
+		reg, err = buf.ReadByte()
+		cie.ReturnAddressRegister = uint64(reg)
+	} else {
+		cie.ReturnAddressRegister, _ = util.DecodeULEB128(buf)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(cie.Augmentation) > 0 && cie.Augmentation[0] == 'z' {
+		cie.hasAugmentationData = true
+		n, _ := util.DecodeULEB128(buf)
+		if int(n) > buf.Len() {
+			return nil, errors.New("augmentation data too long")
+		}
+		augbuf := bytes.NewBuffer(buf.Next(int(n)))
+		for _, c := range cie.Augmentation[1:] {
+			switch c {
+			case 'R':
+				if cie.ptrEncoding, err = augbuf.ReadByte(); err != nil {
+					return nil, err
+				}
+			case 'L':
+				// the encoding of the LSDA pointer in the FDEs, it is skipped
+				// along with the rest of the augmentation data of the FDE.
+				if _, err = augbuf.ReadByte(); err != nil {
+					return nil, err
+				}
+			case 'P':
+				enc, err := augbuf.ReadByte()
+				if err != nil {
+					return nil, err
+				}
+				// the address of the personality routine is not needed, only
+				// its format matters.
+				if _, err := readEncodedPointer(augbuf, order, enc&ehPeFormatMask, 0); err != nil {
+					return nil, err
+				}
+			case 'S', 'B':
+				// signal frames and ARM64 pointer authentication, no data
+			default:
+				return nil, fmt.Errorf("unsupported augmentation %q", cie.Augmentation)
+			}
+		}
+	} else if cie.Augmentation != "" {
+		return nil, fmt.Errorf("unsupported augmentation %q", cie.Augmentation)
+	}
+
+	cie.InitialInstructions = buf.Bytes()
+	return cie, nil
+}
+
+// readEncodedPointer reads a pointer encoded as specified by enc, pos is
+// the address of the pointer, used by PC relative encodings.
+func readEncodedPointer(buf *bytes.Buffer, order binary.ByteOrder, enc byte, pos uint64) (uint64, error) {
+	if enc == ehPeOmit {
+		return 0, nil
+	}
+	var v uint64
+	readN := func(n int) ([]byte, error) {
+		b := buf.Next(n)
+		if len(b) != n {
+			return nil, errors.New("unexpected end of data")
+		}
+		return b, nil
+	}
+	switch enc & ehPeFormatMask {
+	case ehPeAbsptr, ehPeUdata8, ehPeSdata8:
+		b, err := readN(8)
+		if err != nil {
+			return 0, err
+		}
+		v = order.Uint64(b)
+	case ehPeUleb128:
+		v, _ = util.DecodeULEB128(buf)
+	case ehPeSleb128:
+		n, _ := util.DecodeSLEB128(buf)
+		v = uint64(n)
+	case ehPeUdata2:
+		b, err := readN(2)
+		if err != nil {
+			return 0, err
+		}
+		v = uint64(order.Uint16(b))
+	case ehPeSdata2:
+		b, err := readN(2)
+		if err != nil {
+			return 0, err
+		}
+		v = uint64(int16(order.Uint16(b)))
+	case ehPeUdata4:
+		b, err := readN(4)
+		if err != nil {
+			return 0, err
+		}
+		v = uint64(order.Uint32(b))
+	case ehPeSdata4:
+		b, err := readN(4)
+		if err != nil {
+			return 0, err
+		}
+		v = uint64(int32(order.Uint32(b)))
+	default:
+		return 0, fmt.Errorf("unsupported pointer encoding %#x", enc)
+	}
+	switch enc & ehPeApplMask {
+	case 0:
+	case ehPePcrel:
+		v += pos
+	default:
+		return 0, fmt.Errorf("unsupported pointer encoding %#x", enc)
+	}
+	return v, nil
+}
+
 // DwarfEndian determines the endianness of the DWARF by using the version number field in the debug_info section
 // Trick borrowed from "debug/dwarf".New()
 func DwarfEndian(infoSec []byte) binary.ByteOrder {
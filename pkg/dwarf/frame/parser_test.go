@@ -1,6 +1,7 @@
 package frame_test
 
 import (
+	"bytes"
 	"encoding/binary"
 	"io/ioutil"
 	"os"
@@ -10,6 +11,62 @@ import (
 	"github.com/pkg/profile"
 )
 
+func TestParseEhFrame(t *testing.T) {
+	const (
+		ehFrameAddr = 0x402000
+		staticBase  = 0x1000
+	)
+	var buf bytes.Buffer
+	le := func(v interface{}) { binary.Write(&buf, binary.LittleEndian, v) }
+
+	// CIE with augmentation "zR", FDE pointers are PC relative signed 4 byte
+	// integers (0x1b).
+	le(uint32(20))
+	le(uint32(0))
+	buf.Write([]byte{1, 'z', 'R', 0, 1, 0x78, 16, 1, 0x1b})
+	buf.Write([]byte{0x0c, 7, 8, 0x90, 1, 0, 0}) // def_cfa rsp+8, rip at cfa-8, nops
+
+	// FDE for [0x401000, 0x401020)
+	le(uint32(16))
+	le(uint32(buf.Len())) // distance to the CIE
+	le(int32(0x401000 - (ehFrameAddr + buf.Len())))
+	le(int32(0x20))
+	buf.Write([]byte{0, 0x41, 0x0e, 16}) // no augmentation data, advance_loc 1, def_cfa_offset 16
+
+	le(uint32(0)) // terminator
+
+	fdes, err := frame.ParseEhFrame(buf.Bytes(), binary.LittleEndian, staticBase, ehFrameAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fdes) != 1 {
+		t.Fatalf("expected one FDE got %d", len(fdes))
+	}
+	fde := fdes[0]
+	if fde.Begin() != 0x401000+staticBase || fde.End() != 0x401020+staticBase {
+		t.Fatalf("wrong range of FDE %#x-%#x", fde.Begin(), fde.End())
+	}
+	if fde.CIE.ReturnAddressRegister != 16 || fde.CIE.DataAlignmentFactor != -8 {
+		t.Fatalf("wrong CIE %#v", fde.CIE)
+	}
+	for _, tc := range []struct {
+		pc     uint64
+		offset int64
+	}{
+		{fde.Begin(), 8},
+		{fde.Begin() + 1, 16},
+		{fde.Begin() + 0x10, 16},
+	} {
+		fctxt := fde.EstablishFrame(tc.pc)
+		if fctxt.CFA.Reg != 7 || fctxt.CFA.Offset != tc.offset {
+			t.Errorf("wrong CFA at %#x: %#v", tc.pc, fctxt.CFA)
+		}
+		if rule := fctxt.Regs[16]; rule.Rule != frame.RuleOffset || rule.Offset != -8 {
+			t.Errorf("wrong rule for the return address at %#x: %#v", tc.pc, rule)
+		}
+	}
+}
+
 func BenchmarkParse(b *testing.B) {
 	defer profile.Start(profile.CPUProfile).Stop()
 	f, err := os.Open("testdata/frame")
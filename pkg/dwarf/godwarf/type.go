@@ -26,6 +26,7 @@ const (
 	AttrGoElem          dwarf.Attr = 0x2902
 	AttrGoEmbeddedField dwarf.Attr = 0x2903
 	AttrGoRuntimeType   dwarf.Attr = 0x2904
+	AttrGoClosureOffset dwarf.Attr = 0x2907
 )
 
 // Basic type encodings -- the value for AttrEncoding in a TagBaseType Entry.
@@ -253,6 +254,10 @@ type StructField struct {
 	BitOffset  int64 // within the ByteSize bytes at ByteOffset
 	BitSize    int64 // zero if not a bit field
 	Embedded   bool
+
+	// DataBitOffset is the offset of a bit field from the start of the
+	// struct, in bits, counting from the least significant bit.
+	DataBitOffset int64
 }
 
 func (t *StructType) String() string { return t.stringIntl(make(recCheck)) }
@@ -784,10 +789,30 @@ func readType(d *dwarf.Data, name string, r *dwarf.Reader, off dwarf.Offset, typ
 				f.BitOffset, haveBitOffset = kid.Val(dwarf.AttrBitOffset).(int64)
 				f.BitSize, _ = kid.Val(dwarf.AttrBitSize).(int64)
 				f.Embedded, _ = kid.Val(AttrGoEmbeddedField).(bool)
+				dataBitOffset, haveDataBitOffset := kid.Val(dwarf.AttrDataBitOffset).(int64)
+				if f.BitSize > 0 {
+					switch {
+					case haveDataBitOffset:
+						f.DataBitOffset = dataBitOffset
+					case haveBitOffset:
+						// DWARF 2 counts bits from the most significant bit of
+						// the storage unit, this assumes a little endian target.
+						storage := f.ByteSize
+						if storage == 0 && f.Type != nil {
+							storage = f.Type.Size()
+						}
+						f.DataBitOffset = f.ByteOffset*8 + storage*8 - f.BitOffset - f.BitSize
+					default:
+						f.DataBitOffset = f.ByteOffset * 8
+					}
+				}
 				t.Field = append(t.Field, f)
 
 				bito := f.BitOffset
-				if !haveBitOffset {
+				switch {
+				case haveDataBitOffset:
+					bito = dataBitOffset
+				case !haveBitOffset:
 					bito = f.ByteOffset * 8
 				}
 				if bito == lastFieldBitOffset && t.Kind != "union" {
@@ -13,6 +13,7 @@ type DebugLinePrologue struct {
 	Version        uint16
 	Length         uint32
 	MinInstrLength uint8
+	MaxOpPerInstr  uint8 // only present starting with version 4
 	InitialIsStmt  uint8
 	LineBase       int8
 	LineRange      uint8
@@ -97,6 +98,10 @@ func parseDebugLinePrologue(dbl *DebugLineInfo, buf *bytes.Buffer) {
 	p.Version = binary.LittleEndian.Uint16(buf.Next(2))
 	p.Length = binary.LittleEndian.Uint32(buf.Next(4))
 	p.MinInstrLength = uint8(buf.Next(1)[0])
+	if p.Version >= 4 {
+		// written by C compilers, the Go linker writes version 2
+		p.MaxOpPerInstr = uint8(buf.Next(1)[0])
+	}
 	p.InitialIsStmt = uint8(buf.Next(1)[0])
 	p.LineBase = int8(buf.Next(1)[0])
 	p.LineRange = uint8(buf.Next(1)[0])
@@ -23,6 +23,7 @@ var debugLineErrors = false
 var rpc = false
 var fnCall = false
 var minidump = false
+var ptrace = false
 
 var logOut io.WriteCloser
 
@@ -100,6 +101,17 @@ func MinidumpLogger() *logrus.Entry {
 	return makeLogger(minidump, logrus.Fields{"layer": "core", "kind": "minidump"})
 }
 
+// Ptrace returns true if the ptrace calls of the native backend should be
+// logged.
+func Ptrace() bool {
+	return ptrace
+}
+
+// PtraceLogger returns a logger for the ptrace calls of the native backend.
+func PtraceLogger() *logrus.Entry {
+	return makeLogger(ptrace, logrus.Fields{"layer": "proc", "kind": "ptrace"})
+}
+
 // WriteAPIListeningMessage writes the "API server listening" message in headless mode.
 func WriteAPIListeningMessage(addr string) {
 	if logOut != nil {
@@ -155,6 +167,8 @@ func Setup(logFlag bool, logstr string, logDest string) error {
 			fnCall = true
 		case "minidump":
 			minidump = true
+		case "ptrace":
+			ptrace = true
 		}
 	}
 	return nil
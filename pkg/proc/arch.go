@@ -12,6 +12,9 @@ import (
 // CPU architecture.
 type Arch interface {
 	PtrSize() int
+	// BreakpointInstruction returns the instruction written over the code
+	// of the target to set a software breakpoint, BreakpointSize is its
+	// length. Breakpoints replace exactly BreakpointSize bytes.
 	BreakpointInstruction() []byte
 	BreakpointSize() int
 	DerefTLS() bool
@@ -19,13 +22,18 @@ type Arch interface {
 	RegSize(uint64) int
 	RegistersToDwarfRegisters(bi *BinaryInfo, regs Registers) op.DwarfRegisters
 	GoroutineToDwarfRegisters(*G) op.DwarfRegisters
+	// returnAddress returns the return address of the frame with registers
+	// regs, callFrameRegs are the registers of its caller computed using
+	// the frame unwind context of the frame. Architectures that save the
+	// return address in a register, instead of the stack, read it from
+	// callFrameRegs as well.
+	returnAddress(mem MemoryReadWriter, regs, callFrameRegs *op.DwarfRegisters) (uint64, error)
 }
 
 // AMD64 represents the AMD64 CPU architecture.
 type AMD64 struct {
 	ptrSize                 int
 	breakInstruction        []byte
-	breakInstructionLen     int
 	gStructOffset           uint64
 	hardwareBreakpointUsage []bool
 	goos                    string
@@ -48,15 +56,15 @@ const (
 	amd64DwarfBPRegNum uint64 = 6
 )
 
+// amd64BreakInstruction is the INT3 instruction.
+var amd64BreakInstruction = []byte{0xCC}
+
 // AMD64Arch returns an initialized AMD64
 // struct.
 func AMD64Arch(goos string) *AMD64 {
-	var breakInstr = []byte{0xCC}
-
 	return &AMD64{
 		ptrSize:                 8,
-		breakInstruction:        breakInstr,
-		breakInstructionLen:     len(breakInstr),
+		breakInstruction:        amd64BreakInstruction,
 		hardwareBreakpointUsage: make([]bool, 4),
 		goos:                    goos,
 	}
@@ -77,7 +85,7 @@ func (a *AMD64) BreakpointInstruction() []byte {
 // BreakpointSize returns the size of the
 // breakpoint instruction on this architecture.
 func (a *AMD64) BreakpointSize() int {
-	return a.breakInstructionLen
+	return len(a.breakInstruction)
 }
 
 // DerefTLS returns true if the value of regs.TLS()+GStructOffset() is a
@@ -86,6 +94,22 @@ func (a *AMD64) DerefTLS() bool {
 	return a.goos == "windows"
 }
 
+// returnAddress returns the return address of the frame, the value of RIP
+// in the caller computed from the CFI. If the CFI has no rule for it the
+// return address is read from [RBP+8], where the prologue of functions
+// using frame pointers saves it. If RBP is zero the frame is the last one
+// of the stack and the return address is zero.
+func (a *AMD64) returnAddress(mem MemoryReadWriter, regs, callFrameRegs *op.DwarfRegisters) (uint64, error) {
+	if reg := callFrameRegs.Reg(amd64DwarfIPRegNum); reg != nil {
+		return reg.Uint64Val, nil
+	}
+	bp := regs.BP()
+	if bp == 0 {
+		return 0, nil
+	}
+	return readUintRaw(mem, uintptr(bp+uint64(a.ptrSize)), int64(a.ptrSize))
+}
+
 const (
 	crosscall2SPOffsetBad        = 0x8
 	crosscall2SPOffsetWindows    = 0x118
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"debug/dwarf"
 	"debug/elf"
+	"debug/gosym"
 	"debug/macho"
 	"debug/pe"
 	"encoding/binary"
@@ -50,6 +51,8 @@ type BinaryInfo struct {
 
 	ElfDynamicSection ElfDynamicSection
 
+	isGoBinary bool // the executable was produced by the Go toolchain
+
 	lastModified time.Time // Time the executable of this process was last modified
 
 	closer         io.Closer
@@ -90,6 +93,10 @@ var ErrUnsupportedWindowsArch = errors.New("unsupported architecture of windows/
 // ErrUnsupportedDarwinArch is returned when attempting to debug a binary compiled for an unsupported architecture.
 var ErrUnsupportedDarwinArch = errors.New("unsupported architecture - only darwin/amd64 is supported")
 
+// ErrNotGoBinary is returned when the executable being debugged was not
+// produced by the Go toolchain.
+var ErrNotGoBinary = errors.New("not a Go executable")
+
 // ErrCouldNotDetermineRelocation is an error returned when Delve could not determine the base address of a
 // position independant executable.
 var ErrCouldNotDetermineRelocation = errors.New("could not determine the base address of a PIE")
@@ -98,6 +105,15 @@ var ErrCouldNotDetermineRelocation = errors.New("could not determine the base ad
 // section or find an external debug info file.
 var ErrNoDebugInfoFound = errors.New("could not open debug info")
 
+// ErrNoDebugInfo is returned by operations that need DWARF debug
+// information (for example evaluating variables) when the executable
+// doesn't have any, for example because it was built with -ldflags=-w.
+var ErrNoDebugInfo = errors.New("the executable has no debug information (built with -ldflags=-w?)")
+
+// ErrNotLoaded is the error of a component of an executable in LoadResult
+// that was not loaded because it wasn't needed.
+var ErrNotLoaded = errors.New("not loaded")
+
 const dwarfGoLanguage = 22 // DW_LANG_Go (from DWARF v5, section 7.12, page 231)
 
 type compileUnit struct {
@@ -329,21 +345,50 @@ func (bi *BinaryInfo) LoadBinaryInfo(path string, entryPoint uint64, debugInfoDi
 	return bi.AddImage(path, entryPoint)
 }
 
-func loadBinaryInfo(bi *BinaryInfo, image *Image, path string, entryPoint uint64) error {
+func loadBinaryInfo(bi *BinaryInfo, image *Image, path string, entryPoint uint64) (err error) {
 	var wg sync.WaitGroup
 	defer wg.Wait()
 
+	image.loadResult = LoadResult{ErrNotLoaded, ErrNotLoaded, ErrNotLoaded, ErrNotLoaded, ErrNotLoaded}
 	switch bi.GOOS {
 	case "linux":
 		return loadBinaryInfoElf(bi, image, path, entryPoint, &wg)
-	case "windows":
-		return loadBinaryInfoPE(bi, image, path, entryPoint, &wg)
-	case "darwin":
+	case "windows", "darwin":
+		defer func() {
+			// PE and Mach-O images are only loaded from their DWARF.
+			image.loadResult.Executable, image.loadResult.DWARF = err, err
+		}()
+		if bi.GOOS == "windows" {
+			return loadBinaryInfoPE(bi, image, path, entryPoint, &wg)
+		}
 		return loadBinaryInfoMacho(bi, image, path, entryPoint, &wg)
 	}
 	return errors.New("unsupported operating system")
 }
 
+// LoadResult returns which components of the executable were loaded by
+// LoadBinaryInfo.
+func (bi *BinaryInfo) LoadResult() LoadResult {
+	if len(bi.Images) == 0 {
+		return LoadResult{Executable: errors.New("no executable loaded")}
+	}
+	return bi.Images[0].loadResult
+}
+
+// IsGoBinary returns true if the executable was produced by the Go
+// toolchain.
+func (bi *BinaryInfo) IsGoBinary() bool {
+	return bi.isGoBinary
+}
+
+// HasDWARF returns true if the executable has DWARF debug information.
+// When it doesn't, but the Go symbol table is available, functions and
+// line information are read from the symbol table and operations that
+// need DWARF return ErrNoDebugInfo.
+func (bi *BinaryInfo) HasDWARF() bool {
+	return len(bi.Images) > 0 && bi.Images[0].dwarf != nil
+}
+
 // GStructOffset returns the offset of the G
 // struct in thread local storage.
 func (bi *BinaryInfo) GStructOffset() uint64 {
@@ -375,6 +420,10 @@ func (bi *BinaryInfo) PCToLine(pc uint64) (string, int, *Function) {
 	if fn == nil {
 		return "", 0, nil
 	}
+	if symTable := fn.cu.image.symTable; fn.cu.lineInfo == nil && symTable != nil {
+		f, ln, _ := symTable.PCToLine(pc - fn.cu.image.StaticBase)
+		return f, ln, fn
+	}
 	f, ln := fn.cu.lineInfo.PCToLine(fn.Entry, pc)
 	return f, ln, fn
 }
@@ -401,6 +450,17 @@ func (bi *BinaryInfo) LineToPC(filename string, lineno int) (pc uint64, fn *Func
 			}
 		}
 	}
+	for _, image := range bi.Images {
+		if image.symTable == nil {
+			continue
+		}
+		if pc, _, err := image.symTable.LineToPC(filename, lineno); err == nil {
+			pc += image.StaticBase
+			if fn = bi.PCToFunc(pc); fn != nil {
+				return pc, fn, nil
+			}
+		}
+	}
 	err = fmt.Errorf("could not find %s:%d", filename, lineno)
 	return
 }
@@ -416,6 +476,117 @@ func (bi *BinaryInfo) AllPCsForFileLine(filename string, lineno int) []uint64 {
 	return r
 }
 
+// LinePCs returns, sorted by address, all the addresses of the statements
+// of filename:lineno (the condition of a for loop, for example, is usually
+// compiled to more than one range of instructions).
+// The first instruction of a function inlined at filename:lineno belongs
+// to the inlined function, not to the line, and is not returned.
+func (bi *BinaryInfo) LinePCs(filename string, lineno int) ([]uint64, error) {
+	pcs := bi.AllPCsForFileLine(filename, lineno)
+	if len(pcs) == 0 {
+		// executables without DWARF only have one address per line.
+		if pc, _, err := bi.LineToPC(filename, lineno); err == nil {
+			pcs = append(pcs, pc)
+		}
+	}
+	inlined := make(map[uint64]bool)
+	for _, cu := range bi.compileUnits {
+		for _, ifn := range cu.concreteInlinedFns {
+			inlined[ifn.LowPC] = true
+		}
+	}
+	sort.Slice(pcs, func(i, j int) bool { return pcs[i] < pcs[j] })
+	r := pcs[:0]
+	for _, pc := range pcs {
+		if inlined[pc] || (len(r) > 0 && pc == r[len(r)-1]) {
+			continue
+		}
+		r = append(r, pc)
+	}
+	if len(r) == 0 {
+		return nil, fmt.Errorf("could not find %s:%d", filename, lineno)
+	}
+	return r, nil
+}
+
+// SourcesForPackage returns, sorted, the source files containing the
+// functions whose name starts with prefix, for example "main." or
+// "github.com/go-delve/delve/pkg/proc.".
+func (bi *BinaryInfo) SourcesForPackage(prefix string) ([]string, error) {
+	if prefix == "" {
+		return nil, errors.New("empty package prefix")
+	}
+	files := make(map[string]struct{})
+	for i := range bi.Functions {
+		fn := &bi.Functions[i]
+		if fn.Entry == 0 || !strings.HasPrefix(fn.Name, prefix) {
+			continue
+		}
+		if file, _, _ := bi.PCToLine(fn.Entry); file != "" {
+			files[file] = struct{}{}
+		}
+	}
+	r := []string{}
+	for _, file := range bi.Sources {
+		if _, ok := files[file]; ok {
+			r = append(r, file)
+		}
+	}
+	if len(r) == 0 {
+		return nil, fmt.Errorf("no source files for package prefix %q", prefix)
+	}
+	return r, nil
+}
+
+// packageVarAt returns the name of the package variable containing addr
+// and the offset of addr from its start.
+func (bi *BinaryInfo) packageVarAt(addr uint64) (string, uint64, bool) {
+	i := sort.Search(len(bi.packageVars), func(i int) bool {
+		return bi.packageVars[i].addr > addr
+	}) - 1
+	if i < 0 {
+		return "", 0, false
+	}
+	pv := &bi.packageVars[i]
+	if pv.addr == addr {
+		return pv.name, 0, true
+	}
+	if pv.cu == nil {
+		return "", 0, false
+	}
+	image := pv.cu.image
+	rdr := image.DwarfReader()
+	rdr.Seek(pv.offset)
+	entry, err := rdr.Next()
+	if err != nil || entry == nil {
+		return "", 0, false
+	}
+	typeOff, ok := entry.Val(dwarf.AttrType).(dwarf.Offset)
+	if !ok {
+		return "", 0, false
+	}
+	typ, err := image.Type(typeOff)
+	if err != nil || addr >= pv.addr+uint64(typ.Size()) {
+		return "", 0, false
+	}
+	return pv.name, addr - pv.addr, true
+}
+
+// inlinedCallPCs returns the start addresses of all the inlined calls of
+// the function named fnName, sorted by address.
+func (bi *BinaryInfo) inlinedCallPCs(fnName string) []uint64 {
+	r := []uint64{}
+	for _, cu := range bi.compileUnits {
+		for _, ifn := range cu.concreteInlinedFns {
+			if ifn.Name == fnName {
+				r = append(r, ifn.LowPC)
+			}
+		}
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i] < r[j] })
+	return r
+}
+
 // PCToFunc returns the function containing the given PC address
 func (bi *BinaryInfo) PCToFunc(pc uint64) *Function {
 	i := sort.Search(len(bi.Functions), func(i int) bool {
@@ -452,6 +623,10 @@ type Image struct {
 	dwarfReader *dwarf.Reader
 	loclist     loclistReader
 
+	// symTable is the Go symbol table, only loaded (and used for line
+	// information) if the image doesn't have DWARF.
+	symTable *gosym.Table
+
 	typeCache map[dwarf.Offset]godwarf.Type
 
 	// runtimeTypeToDIE maps between the offset of a runtime._type in
@@ -462,6 +637,30 @@ type Image struct {
 
 	loadErrMu sync.Mutex
 	loadErr   error
+
+	loadResult LoadResult
+}
+
+// LoadResult reports which components of an image were loaded, a nil
+// error means that the component is available. Components are loaded in
+// the order of the fields of LoadResult, a failure only stops the loading
+// of the image if nothing useful can be loaded without that component.
+type LoadResult struct {
+	// Executable is the error opening and parsing the file of the image,
+	// when it's not nil nothing else is loaded.
+	Executable error
+	// BuildInfo is the error reading the module information embedded by
+	// the go command (only read from the executable, not shared libraries).
+	BuildInfo error
+	// DWARF is the error loading the debug informations, from the image or
+	// a separate debug info file.
+	DWARF error
+	// Gosym is the error loading the Go symbol table, which is only loaded
+	// (and is then ErrNotLoaded) when DWARF is unavailable.
+	Gosym error
+	// Symbols is the error reading the ELF symbol table, used to find the
+	// offset of the G struct in thread local storage.
+	Symbols error
 }
 
 // AddImage adds the specified image to bi, loading data asynchronously.
@@ -598,7 +797,7 @@ func (image *Image) loclistInit(data []byte, ptrSz int) {
 func (bi *BinaryInfo) locationExpr(entry reader.Entry, attr dwarf.Attr, pc uint64) ([]byte, string, error) {
 	a := entry.Val(attr)
 	if a == nil {
-		return nil, "", fmt.Errorf("no location attribute %s", attr)
+		return nil, "", &noLocationError{fmt.Sprintf("no location attribute %s", attr)}
 	}
 	if instr, ok := a.([]byte); ok {
 		var descr bytes.Buffer
@@ -612,7 +811,7 @@ func (bi *BinaryInfo) locationExpr(entry reader.Entry, attr dwarf.Attr, pc uint6
 	}
 	instr := bi.loclistEntry(off, pc)
 	if instr == nil {
-		return nil, "", fmt.Errorf("could not find loclist entry at %#x for address %#x", off, pc)
+		return nil, "", &noLocationError{fmt.Sprintf("could not find loclist entry at %#x for address %#x", off, pc)}
 	}
 	var descr bytes.Buffer
 	fmt.Fprintf(&descr, "[%#x:%#x] ", off, pc)
@@ -629,10 +828,24 @@ func (bi *BinaryInfo) Location(entry reader.Entry, attr dwarf.Attr, pc uint64, r
 	if err != nil {
 		return 0, nil, "", err
 	}
+	if len(instr) == 0 {
+		return 0, nil, descr, &noLocationError{"empty location expression"}
+	}
 	addr, pieces, err := op.ExecuteStackProgram(regs, instr)
 	return addr, pieces, descr, err
 }
 
+// noLocationError is returned by Location when the entry does not have a
+// location at the specified address, for variables this means that they
+// have been optimized out.
+type noLocationError struct {
+	msg string
+}
+
+func (err *noLocationError) Error() string {
+	return err.msg
+}
+
 // loclistEntry returns the loclist entry in the loclist starting at off,
 // for address pc.
 func (bi *BinaryInfo) loclistEntry(off int64, pc uint64) []byte {
@@ -692,6 +905,59 @@ func (bi *BinaryInfo) Producer() string {
 	return ""
 }
 
+// Optimized returns true if the main package of the executable was
+// compiled with optimizations or inlining enabled, i.e. without
+// -gcflags='-N -l', in which case the values of some variables may be
+// unavailable or inaccurate.
+// If there is no main package it returns true if any of the Go compile
+// units was optimized.
+func (bi *BinaryInfo) Optimized() bool {
+	if fn := bi.LookupFunc["main.main"]; fn != nil && fn.cu != nil {
+		return fn.Optimized()
+	}
+	for _, cu := range bi.compileUnits {
+		if cu.isgo && cu.optimized {
+			return true
+		}
+	}
+	return false
+}
+
+// BuildInfo returns the module information embedded by the go command in
+// the executable (the .go.buildinfo section): the version of Go, the path
+// of the main module and its dependencies and, if available, the VCS
+// revision it was built from. Frontends can use it to warn users when the
+// executable does not match the checked out source.
+func (bi *BinaryInfo) BuildInfo() (*BuildInfo, error) {
+	if len(bi.Images) == 0 {
+		return nil, errors.New("no executable loaded")
+	}
+	path := bi.Images[0].Path
+	switch bi.GOOS {
+	case "windows":
+		f, err := pe.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return readBuildInfo(peBuildInfoExe{f})
+	case "darwin":
+		f, err := macho.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return readBuildInfo(machoBuildInfoExe{f})
+	default:
+		f, err := elf.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return readBuildInfo(elfBuildInfoExe{f})
+	}
+}
+
 // Type returns the Dwarf type entry at `offset`.
 func (image *Image) Type(offset dwarf.Offset) (godwarf.Type, error) {
 	return godwarf.ReadType(image.dwarf, image.index, offset, image.typeCache)
@@ -797,17 +1063,57 @@ func parseBuildID(exe *elf.File) (string, string, error) {
 
 // loadBinaryInfoElf specifically loads information from an ELF binary.
 func loadBinaryInfoElf(bi *BinaryInfo, image *Image, path string, addr uint64, wg *sync.WaitGroup) error {
-	exe, err := os.OpenFile(path, 0, os.ModePerm)
+	elfFile, err := openElfImage(bi, image, path, addr)
+	image.loadResult.Executable = err
 	if err != nil {
 		return err
 	}
+	if image.index == 0 {
+		_, image.loadResult.BuildInfo = readBuildInfo(elfBuildInfoExe{elfFile})
+	}
+
+	dwarfFile, err := bi.loadDwarfElf(image, elfFile, wg)
+	image.loadResult.DWARF = err
+	if err != nil {
+		if image.index != 0 {
+			return err
+		}
+		// Executables built with -ldflags=-w have no DWARF but they still
+		// have the Go symbol table.
+		image.loadResult.Gosym = bi.loadGosymElf(image, elfFile)
+		if image.loadResult.Gosym != nil {
+			return image.loadResult.Gosym
+		}
+		dwarfFile = elfFile
+	}
+
+	if image.index == 0 {
+		// determine g struct offset only when loading the executable file
+		wg.Add(1)
+		go bi.setGStructOffsetElf(image, dwarfFile, wg)
+	}
+	return nil
+}
+
+// openElfImage opens the ELF file of image and computes its static base.
+func openElfImage(bi *BinaryInfo, image *Image, path string, addr uint64) (*elf.File, error) {
+	exe, err := os.OpenFile(path, 0, os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
 	image.closer = exe
 	elfFile, err := elf.NewFile(exe)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if elfFile.Machine != elf.EM_X86_64 {
-		return ErrUnsupportedLinuxArch
+		return nil, ErrUnsupportedLinuxArch
+	}
+	if image.index == 0 {
+		bi.isGoBinary = elfFile.Section(".gopclntab") != nil || elfFile.Section(".gosymtab") != nil || elfFile.Section(".note.go.buildid") != nil
+		if !bi.isGoBinary {
+			return nil, ErrNotGoBinary
+		}
 	}
 
 	if image.index == 0 {
@@ -819,7 +1125,7 @@ func loadBinaryInfoElf(bi *BinaryInfo, image *Image, path string, addr uint64, w
 		if addr != 0 {
 			image.StaticBase = addr - elfFile.Entry
 		} else if elfFile.Type == elf.ET_DYN {
-			return ErrCouldNotDetermineRelocation
+			return nil, ErrCouldNotDetermineRelocation
 		}
 		if dynsec := elfFile.Section(".dynamic"); dynsec != nil {
 			bi.ElfDynamicSection.Addr = dynsec.Addr + image.StaticBase
@@ -828,59 +1134,238 @@ func loadBinaryInfoElf(bi *BinaryInfo, image *Image, path string, addr uint64, w
 	} else {
 		image.StaticBase = addr
 	}
+	return elfFile, nil
+}
 
+// loadDwarfElf loads the DWARF debug informations of image, from elfFile
+// or from a separate debug info file, and returns the file they were read
+// from. The DWARF of image is only set if all the sections needed could be
+// read.
+func (bi *BinaryInfo) loadDwarfElf(image *Image, elfFile *elf.File, wg *sync.WaitGroup) (*elf.File, error) {
 	dwarfFile := elfFile
-
-	image.dwarf, err = elfFile.DWARF()
+	dwarfData, err := elfFile.DWARF()
 	if err != nil {
 		var sepFile *os.File
-		var serr error
-		sepFile, dwarfFile, serr = bi.openSeparateDebugInfo(image, elfFile, bi.debugInfoDirectories)
-		if serr != nil {
-			return serr
+		sepFile, dwarfFile, err = bi.openSeparateDebugInfo(image, elfFile, bi.debugInfoDirectories)
+		if err != nil {
+			return nil, err
 		}
 		image.sepDebugCloser = sepFile
-		image.dwarf, err = dwarfFile.DWARF()
+		dwarfData, err = dwarfFile.DWARF()
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
-	image.dwarfReader = image.dwarf.Reader()
-
 	debugLineBytes, err := godwarf.GetDebugSectionElf(dwarfFile, "line")
 	if err != nil {
-		return err
+		return nil, err
 	}
+	image.dwarf = dwarfData
+	image.dwarfReader = image.dwarf.Reader()
 	debugLocBytes, _ := godwarf.GetDebugSectionElf(dwarfFile, "loc")
 	image.loclistInit(debugLocBytes, bi.Arch.PtrSize())
 
 	wg.Add(2)
 	go bi.parseDebugFrameElf(image, dwarfFile, wg)
 	go bi.loadDebugInfoMaps(image, debugLineBytes, wg, nil)
-	if image.index == 0 {
-		// determine g struct offset only when loading the executable file
-		wg.Add(1)
-		go bi.setGStructOffsetElf(image, dwarfFile, wg)
+	return dwarfFile, nil
+}
+
+// loadGosymElf loads functions and line information from the Go symbol
+// table of an ELF executable.
+func (bi *BinaryInfo) loadGosymElf(image *Image, exe *elf.File) error {
+	text := exe.Section(".text")
+	if text == nil {
+		return ErrNoDebugInfoFound
+	}
+	var pclndata []byte
+	var err error
+	if pclntab := exe.Section(".gopclntab"); pclntab != nil {
+		pclndata, err = pclntab.Data()
+		if err != nil {
+			return err
+		}
+	} else {
+		// tools that rewrite the executable, and external linking of PIE
+		// executables, can move the pclntab into a different section.
+		pclndata = findPclntabElf(exe)
+		if pclndata == nil {
+			return ErrNoDebugInfoFound
+		}
+	}
+	var symdata []byte
+	if symtab := exe.Section(".gosymtab"); symtab != nil {
+		symdata, err = symtab.Data()
+		if err != nil {
+			return err
+		}
+	}
+	return bi.loadGosym(image, symdata, pclndata, text.Addr)
+}
+
+// pclntabMagics are the magic numbers at the start of the pclntab, one
+// for each version of its format.
+var pclntabMagics = []uint32{0xfffffffb, 0xfffffffa, 0xfffffff0, 0xfffffff1}
+
+// findPclntabElf looks for the pclntab in the allocated sections of exe by
+// its header, it returns the data starting at the header or nil if no
+// pclntab was found.
+func findPclntabElf(exe *elf.File) []byte {
+	for _, sec := range exe.Sections {
+		if sec.Type != elf.SHT_PROGBITS || sec.Flags&elf.SHF_ALLOC == 0 {
+			continue
+		}
+		data, err := sec.Data()
+		if err != nil {
+			continue
+		}
+		if off := findPclntab(data); off >= 0 {
+			return data[off:]
+		}
 	}
 	return nil
 }
 
+// findPclntab returns the offset of the first pclntab header in data, or
+// -1. The header is the magic number, two zero bytes, the instruction
+// size quantum and the pointer size.
+func findPclntab(data []byte) int {
+	const pclntabHeaderSize = 8
+	for off := 0; off+pclntabHeaderSize <= len(data); off += 4 {
+		magic := binary.LittleEndian.Uint32(data[off:])
+		known := false
+		for _, m := range pclntabMagics {
+			if magic == m {
+				known = true
+				break
+			}
+		}
+		if !known || data[off+4] != 0 || data[off+5] != 0 {
+			continue
+		}
+		switch data[off+6] {
+		case 1, 2, 4:
+		default:
+			continue
+		}
+		if data[off+7] == 4 || data[off+7] == 8 {
+			return off
+		}
+	}
+	return -1
+}
+
+func (bi *BinaryInfo) loadGosym(image *Image, symdata, pclndata []byte, textStart uint64) error {
+	symTable, err := newGosymTable(symdata, pclndata, textStart)
+	if err != nil {
+		return fmt.Errorf("could not read Go symbol table: %v", err)
+	}
+	image.symTable = symTable
+
+	if !bi.initialized {
+		bi.types = make(map[string]dwarfRef)
+		bi.consts = make(map[dwarfRef]*constantType)
+		bi.packageMap = make(map[string]string)
+		bi.initialized = true
+	}
+
+	// Functions need a compile unit, since there is no line table all of
+	// them share a single one that is not added to bi.compileUnits.
+	cu := &compileUnit{image: image, isgo: true}
+	for _, fn := range symTable.Funcs {
+		bi.Functions = append(bi.Functions, Function{Name: fn.Name, Entry: fn.Entry + image.StaticBase, End: fn.End + image.StaticBase, cu: cu})
+	}
+	sort.Sort(functionsDebugInfoByEntry(bi.Functions))
+	bi.LookupFunc = make(map[string]*Function)
+	for i := range bi.Functions {
+		bi.LookupFunc[bi.Functions[i].Name] = &bi.Functions[i]
+	}
+
+	bi.Sources = make([]string, 0, len(symTable.Files))
+	for file := range symTable.Files {
+		bi.Sources = append(bi.Sources, file)
+	}
+	sort.Strings(bi.Sources)
+	return nil
+}
+
+// newGosymTable parses the Go symbol table. The debug/gosym package trusts
+// the header of pclntab and can panic, or try to allocate huge amounts of
+// memory, when reading a corrupted table, the header is checked here and
+// panics are converted into errors.
+func newGosymTable(symdata, pclndata []byte, textStart uint64) (symTable *gosym.Table, err error) {
+	const pclntabHeaderSize = 8
+	if len(pclndata) < pclntabHeaderSize {
+		return nil, errors.New("pclntab too short")
+	}
+	ptrSize := int(pclndata[7])
+	if ptrSize != 4 && ptrSize != 8 {
+		return nil, fmt.Errorf("bad pointer size %d in pclntab header", ptrSize)
+	}
+	if len(pclndata) < pclntabHeaderSize+ptrSize {
+		return nil, errors.New("pclntab too short")
+	}
+	var nfunc uint64
+	if ptrSize == 4 {
+		nfunc = uint64(binary.LittleEndian.Uint32(pclndata[pclntabHeaderSize:]))
+	} else {
+		nfunc = binary.LittleEndian.Uint64(pclndata[pclntabHeaderSize:])
+	}
+	if nfunc > uint64(len(pclndata)) {
+		return nil, fmt.Errorf("bad number of functions %d in pclntab header", nfunc)
+	}
+
+	defer func() {
+		if ierr := recover(); ierr != nil {
+			symTable, err = nil, fmt.Errorf("malformed pclntab: %v", ierr)
+		}
+	}()
+	return gosym.NewTable(symdata, gosym.NewLineTable(pclndata, textStart))
+}
+
 func (bi *BinaryInfo) parseDebugFrameElf(image *Image, exe *elf.File, wg *sync.WaitGroup) {
 	defer wg.Done()
 
-	debugFrameData, err := godwarf.GetDebugSectionElf(exe, "frame")
-	if err != nil {
-		image.setLoadError("could not get .debug_frame section: %v", err)
-		return
+	var fdes frame.FrameDescriptionEntries
+	debugFrameData, debugFrameErr := godwarf.GetDebugSectionElf(exe, "frame")
+	if debugFrameErr == nil {
+		debugInfoData, err := godwarf.GetDebugSectionElf(exe, "info")
+		if err != nil {
+			image.setLoadError("could not get .debug_info section: %v", err)
+			return
+		}
+		fdes = frame.Parse(debugFrameData, frame.DwarfEndian(debugInfoData), image.StaticBase)
 	}
-	debugInfoData, err := godwarf.GetDebugSectionElf(exe, "info")
-	if err != nil {
-		image.setLoadError("could not get .debug_info section: %v", err)
+
+	// C code compiled by gcc is only described by .eh_frame, its entries are
+	// used for the code not covered by .debug_frame. Errors parsing it are
+	// only reported when there is no .debug_frame.
+	ehFrameFDEs, ehFrameErr := parseEhFrameElf(image, exe)
+	if debugFrameErr != nil && len(ehFrameFDEs) == 0 {
+		if ehFrameErr != nil {
+			image.setLoadError("could not get .debug_frame section: %v, could not parse .eh_frame section: %v", debugFrameErr, ehFrameErr)
+			return
+		}
+		image.setLoadError("could not get .debug_frame section: %v", debugFrameErr)
 		return
 	}
 
-	bi.frameEntries = bi.frameEntries.Append(frame.Parse(debugFrameData, frame.DwarfEndian(debugInfoData), image.StaticBase))
+	bi.frameEntries = bi.frameEntries.Append(fdes.AppendMissing(ehFrameFDEs))
+}
+
+// parseEhFrameElf returns the FDEs of the .eh_frame section of exe, if it
+// has one.
+func parseEhFrameElf(image *Image, exe *elf.File) (frame.FrameDescriptionEntries, error) {
+	sec := exe.Section(".eh_frame")
+	if sec == nil || sec.Type == elf.SHT_NOBITS {
+		return nil, nil
+	}
+	data, err := sec.Data()
+	if err != nil {
+		return nil, err
+	}
+	return frame.ParseEhFrame(data, exe.ByteOrder, image.StaticBase, sec.Addr)
 }
 
 func (bi *BinaryInfo) setGStructOffsetElf(image *Image, exe *elf.File, wg *sync.WaitGroup) {
@@ -893,8 +1378,19 @@ func (bi *BinaryInfo) setGStructOffsetElf(image *Image, exe *elf.File, wg *sync.
 	//   emitting runtime.tlsg, a TLS symbol, which is relocated to the chosen
 	//   offset in libc's TLS block.
 	symbols, err := exe.Symbols()
+	image.loadResult.Symbols = err
 	if err != nil {
-		image.setLoadError("could not parse ELF symbols: %v", err)
+		image.loadResult.Symbols = fmt.Errorf("could not parse ELF symbols: %v", err)
+	}
+	var tls *elf.Prog
+	for _, prog := range exe.Progs {
+		if prog.Type == elf.PT_TLS {
+			tls = prog
+			break
+		}
+	}
+	if tls == nil {
+		bi.gStructOffset = ^uint64(8) + 1 // -8
 		return
 	}
 	var tlsg *elf.Symbol
@@ -905,19 +1401,18 @@ func (bi *BinaryInfo) setGStructOffsetElf(image *Image, exe *elf.File, wg *sync.
 			break
 		}
 	}
-	if tlsg == nil {
-		bi.gStructOffset = ^uint64(8) + 1 // -8
-		return
-	}
-	var tls *elf.Prog
-	for _, prog := range exe.Progs {
-		if prog.Type == elf.PT_TLS {
-			tls = prog
-			break
+	var tlsgOffset uint64
+	if tlsg != nil {
+		tlsgOffset = tlsg.Value
+	} else if tls.Memsz != uint64(bi.Arch.PtrSize()) {
+		// Without runtime.tlsg (for example in executables stripped with
+		// -ldflags=-s) the G pointer can only be found if it's the only
+		// variable in the TLS block.
+		err := image.loadResult.Symbols
+		if err == nil {
+			err = errors.New("runtime.tlsg not found")
 		}
-	}
-	if tls == nil {
-		bi.gStructOffset = ^uint64(8) + 1 // -8
+		image.setLoadError("could not find the G struct in thread local storage: %v", err)
 		return
 	}
 	memsz := tls.Memsz
@@ -925,7 +1420,7 @@ func (bi *BinaryInfo) setGStructOffsetElf(image *Image, exe *elf.File, wg *sync.
 	memsz = (memsz + uint64(bi.Arch.PtrSize()) - 1) & ^uint64(bi.Arch.PtrSize()-1) // align to pointer-sized-boundary
 	// The TLS register points to the end of the TLS block, which is
 	// tls.Memsz long. runtime.tlsg is an offset from the beginning of that block.
-	bi.gStructOffset = ^(memsz) + 1 + tlsg.Value // -tls.Memsz + tlsg.Value
+	bi.gStructOffset = ^(memsz) + 1 + tlsgOffset // -tls.Memsz + tlsg.Value
 }
 
 // PE ////////////////////////////////////////////////////////////////
@@ -942,6 +1437,17 @@ func loadBinaryInfoPE(bi *BinaryInfo, image *Image, path string, entryPoint uint
 	if peFile.Machine != pe.IMAGE_FILE_MACHINE_AMD64 {
 		return ErrUnsupportedWindowsArch
 	}
+	if image.index == 0 {
+		for _, sym := range peFile.Symbols {
+			if sym.Name == "runtime.pclntab" || sym.Name == "go.buildid" {
+				bi.isGoBinary = true
+				break
+			}
+		}
+		if !bi.isGoBinary {
+			return ErrNotGoBinary
+		}
+	}
 	image.dwarf, err = peFile.DWARF()
 	if err != nil {
 		return err
@@ -1037,6 +1543,12 @@ func loadBinaryInfoMacho(bi *BinaryInfo, image *Image, path string, entryPoint u
 	if exe.Cpu != macho.CpuAmd64 {
 		return ErrUnsupportedDarwinArch
 	}
+	if image.index == 0 {
+		bi.isGoBinary = exe.Section("__gopclntab") != nil || exe.Section("__gosymtab") != nil
+		if !bi.isGoBinary {
+			return ErrNotGoBinary
+		}
+	}
 	image.dwarf, err = exe.DWARF()
 	if err != nil {
 		return err
@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"go/ast"
 	"go/constant"
+	"go/parser"
 	"reflect"
+	"sort"
+	"time"
 )
 
 // Breakpoint represents a breakpoint. Stores information on the break
@@ -18,7 +21,7 @@ type Breakpoint struct {
 	Line         int
 
 	Addr         uint64 // Address breakpoint is set for.
-	OriginalData []byte // If software breakpoint, the data we replace with breakpoint instruction.
+	OriginalData []byte // If software breakpoint, the Arch.BreakpointSize bytes we replace with the breakpoint instruction.
 	Name         string // User defined name of the breakpoint
 	ID           int    // Monotonically increasing ID.
 
@@ -29,9 +32,11 @@ type Breakpoint struct {
 	// breakpoint.
 	Kind BreakpointKind
 
+	// Flags change what Continue and Resume do when the breakpoint is
+	// reached as a user breakpoint.
+	Flags BreakpointFlags
+
 	// Breakpoint information
-	Tracepoint    bool // Tracepoint flag
-	TraceReturn   bool
 	Goroutine     bool     // Retrieve goroutine information
 	Stacktrace    int      // Number of stack frames to retrieve
 	Variables     []string // Variables to evaluate
@@ -39,6 +44,18 @@ type Breakpoint struct {
 	LoadLocals    *LoadConfig
 	HitCount      map[int]uint64 // Number of times a breakpoint has been reached in a certain goroutine
 	TotalHitCount uint64         // Number of times a breakpoint has been reached
+	IgnoreCount   int            // Number of times the breakpoint will be reached without stopping
+	// OncePerGoroutine breakpoints only stop the first time each goroutine
+	// reaches them, later hits are counted in HitCount without stopping.
+	OncePerGoroutine bool
+
+	// SampleVariables are expressions evaluated every time Resume resumes
+	// the target from this tracepoint, their values are appended to
+	// Samples.
+	SampleVariables []string
+	// Samples are the values of SampleVariables recorded at each hit, in
+	// order.
+	Samples []BreakpointSample
 
 	// DeferReturns: when kind == NextDeferBreakpoint this breakpoint
 	// will also check if the caller is runtime.gopanic or if the return
@@ -60,6 +77,19 @@ type Breakpoint struct {
 	returnInfo *returnBreakpointInfo
 }
 
+// BreakpointSample holds the values of the SampleVariables of a
+// tracepoint at one of its hits.
+type BreakpointSample struct {
+	// Time is when the tracepoint was hit.
+	Time time.Time
+	// GoroutineID is the goroutine that hit the tracepoint, 0 if the thread
+	// was not running a goroutine.
+	GoroutineID int
+	// Values are the values of SampleVariables, in the same order. The
+	// values of expressions that could not be evaluated have Unreadable set.
+	Values []*Variable
+}
+
 // BreakpointKind determines the behavior of delve when the
 // breakpoint is reached.
 type BreakpointKind uint16
@@ -81,6 +111,21 @@ const (
 	StepBreakpoint
 )
 
+// BreakpointFlags are composable properties of user breakpoints.
+type BreakpointFlags uint8
+
+const (
+	// BreakpointTemporary breakpoints are cleared by Continue the first
+	// time they are reached by any goroutine.
+	BreakpointTemporary BreakpointFlags = (1 << iota)
+	// BreakpointTracepoint breakpoints stop Continue like other user
+	// breakpoints, Resume records them and resumes the target.
+	BreakpointTracepoint
+	// BreakpointTraceReturn is a BreakpointTracepoint set on a return
+	// instruction of a traced function.
+	BreakpointTraceReturn
+)
+
 func (bp *Breakpoint) String() string {
 	return fmt.Sprintf("Breakpoint %d at %#v %s:%d (%d)", bp.ID, bp.Addr, bp.File, bp.Line, bp.TotalHitCount)
 }
@@ -114,6 +159,24 @@ type returnBreakpointInfo struct {
 	spOffset     int64
 }
 
+// SetCondition parses cond, a Go expression, and sets it as the condition
+// of bp. The condition is evaluated by Continue every time the breakpoint
+// is hit and execution is resumed if it evaluates to false.
+// An empty string removes the condition. If cond can not be parsed an
+// error is returned and the condition of bp is left unchanged.
+func (bp *Breakpoint) SetCondition(cond string) error {
+	if cond == "" {
+		bp.Cond = nil
+		return nil
+	}
+	expr, err := parser.ParseExpr(cond)
+	if err != nil {
+		return err
+	}
+	bp.Cond = expr
+	return nil
+}
+
 // CheckCondition evaluates bp's condition on thread.
 func (bp *Breakpoint) CheckCondition(thread Thread) BreakpointState {
 	bpstate := BreakpointState{Breakpoint: bp, Active: false, Internal: false, CondError: nil}
@@ -124,7 +187,7 @@ func (bp *Breakpoint) CheckCondition(thread Thread) BreakpointState {
 	}
 	nextDeferOk := true
 	if bp.Kind&NextDeferBreakpoint != 0 {
-		frames, err := ThreadStacktrace(thread, 2)
+		frames, err := ThreadStacktrace(thread, 2, true)
 		if err == nil {
 			ispanic := len(frames) >= 3 && frames[2].Current.Fn != nil && frames[2].Current.Fn.Name == "runtime.gopanic"
 			isdeferreturn := false
@@ -169,6 +232,31 @@ func (bp *Breakpoint) IsUser() bool {
 	return bp.Kind&UserBreakpoint != 0
 }
 
+// recordSample evaluates the SampleVariables of bp on thread and appends
+// their values to Samples.
+func (bp *Breakpoint) recordSample(thread Thread) {
+	if len(bp.SampleVariables) == 0 {
+		return
+	}
+	sample := BreakpointSample{Time: time.Now()}
+	if g, _ := GetG(thread); g != nil {
+		sample.GoroutineID = g.ID
+	}
+	scope, scopeErr := GoroutineScope(thread)
+	for _, expr := range bp.SampleVariables {
+		err := scopeErr
+		var v *Variable
+		if err == nil {
+			v, err = scope.EvalVariable(expr, loadFullValue)
+		}
+		if err != nil {
+			v = &Variable{Name: expr, Unreadable: err}
+		}
+		sample.Values = append(sample.Values, v)
+	}
+	bp.Samples = append(bp.Samples, sample)
+}
+
 func evalBreakpointCondition(thread Thread, cond ast.Expr) (bool, error) {
 	if cond == nil {
 		return true, nil
@@ -216,6 +304,28 @@ func NewBreakpointMap() BreakpointMap {
 	}
 }
 
+// Copy returns a copy of bpmap and of all its breakpoints. It is used for
+// processes created with fork, which inherit the breakpoints written in the
+// memory of their parent.
+func (bpmap *BreakpointMap) Copy() BreakpointMap {
+	r := BreakpointMap{
+		M:                           make(map[uint64]*Breakpoint, len(bpmap.M)),
+		breakpointIDCounter:         bpmap.breakpointIDCounter,
+		internalBreakpointIDCounter: bpmap.internalBreakpointIDCounter,
+	}
+	for addr, bp := range bpmap.M {
+		nbp := *bp
+		nbp.OriginalData = append([]byte(nil), bp.OriginalData...)
+		nbp.HitCount = make(map[int]uint64, len(bp.HitCount))
+		for k, v := range bp.HitCount {
+			nbp.HitCount[k] = v
+		}
+		nbp.Samples = append([]BreakpointSample(nil), bp.Samples...)
+		r.M[addr] = &nbp
+	}
+	return r
+}
+
 // ResetBreakpointIDCounter resets the breakpoint ID counter of bpmap.
 func (bpmap *BreakpointMap) ResetBreakpointIDCounter() {
 	bpmap.breakpointIDCounter = 0
@@ -346,6 +456,63 @@ func (bpmap *BreakpointMap) HasInternalBreakpoints() bool {
 	return false
 }
 
+// BreakpointAt returns the breakpoint installed at addr, if any.
+func (bpmap *BreakpointMap) BreakpointAt(addr uint64) (*Breakpoint, bool) {
+	bp, ok := bpmap.M[addr]
+	return bp, ok
+}
+
+// BreakpointsInFunction returns the breakpoints, including internal
+// breakpoints, whose address is inside the function fname, sorted by
+// address. It can be used to find the line breakpoints of a function
+// before clearing its function breakpoint.
+func BreakpointsInFunction(dbp Process, fname string) ([]*Breakpoint, error) {
+	fn := dbp.BinInfo().LookupFunc[fname]
+	if fn == nil {
+		return nil, &ErrFunctionNotFound{fname}
+	}
+	var r []*Breakpoint
+	for addr, bp := range dbp.Breakpoints().M {
+		if addr >= fn.Entry && addr < fn.End {
+			r = append(r, bp)
+		}
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].Addr < r[j].Addr })
+	return r, nil
+}
+
+// WithBreakpointsCleared restores the original instructions under all the
+// breakpoints of dbp, calls fn and writes the breakpoints back, even if fn
+// returns an error. It's meant for operations that read the code of the
+// target directly and should not see breakpoint instructions, like memory
+// dumps. Breakpoints that do not replace the code of the target, for
+// example those set through a gdbserver stub, are left alone.
+func WithBreakpointsCleared(dbp Process, fn func() error) (err error) {
+	if _, err := dbp.Valid(); err != nil {
+		return err
+	}
+	thread := dbp.CurrentThread()
+	var cleared []*Breakpoint
+	defer func() {
+		bpinstr := dbp.BinInfo().Arch.BreakpointInstruction()
+		for _, bp := range cleared {
+			if _, werr := thread.WriteMemory(uintptr(bp.Addr), bpinstr); werr != nil && err == nil {
+				err = fmt.Errorf("could not restore breakpoint at %#x: %v", bp.Addr, werr)
+			}
+		}
+	}()
+	for _, bp := range dbp.Breakpoints().M {
+		if len(bp.OriginalData) == 0 {
+			continue
+		}
+		if _, err := thread.WriteMemory(uintptr(bp.Addr), bp.OriginalData); err != nil {
+			return fmt.Errorf("could not clear breakpoint at %#x: %v", bp.Addr, err)
+		}
+		cleared = append(cleared, bp)
+	}
+	return fn()
+}
+
 // BreakpointState describes the state of a breakpoint in a thread.
 type BreakpointState struct {
 	*Breakpoint
@@ -359,6 +526,31 @@ type BreakpointState struct {
 	CondError error
 }
 
+// CheckIgnoreCount must be called after the hit counts of an active
+// breakpoint have been updated: if the breakpoint has a positive ignore
+// count the count is decremented and bpstate is deactivated, so that the
+// hit is counted but execution does not stop.
+// Hits of internal breakpoints are never ignored.
+func (bpstate *BreakpointState) CheckIgnoreCount() {
+	if bpstate.Breakpoint == nil || !bpstate.Active || bpstate.Internal || bpstate.IgnoreCount <= 0 {
+		return
+	}
+	bpstate.IgnoreCount--
+	bpstate.Active = false
+}
+
+// CheckOncePerGoroutine must be called after the hit count of goroutine
+// goid has been updated: if the breakpoint only stops once per goroutine
+// and goid already reached it bpstate is deactivated.
+func (bpstate *BreakpointState) CheckOncePerGoroutine(goid int) {
+	if bpstate.Breakpoint == nil || !bpstate.Active || bpstate.Internal || !bpstate.OncePerGoroutine {
+		return
+	}
+	if bpstate.HitCount[goid] > 1 {
+		bpstate.Active = false
+	}
+}
+
 // Clear zeros the struct.
 func (bpstate *BreakpointState) Clear() {
 	bpstate.Breakpoint = nil
@@ -378,6 +570,51 @@ func (bpstate *BreakpointState) String() string {
 	return s
 }
 
+// stopAction is what Continue does after a thread stopped in the
+// state described by a BreakpointState.
+type stopAction uint8
+
+const (
+	// stopNoBreakpoint: the thread is not stopped at a breakpoint, this is
+	// a manual stop, a call to runtime.Breakpoint or a stop requested by
+	// an injected function call.
+	stopNoBreakpoint stopAction = iota
+	// stopResume: the breakpoint condition was not met, resume the target.
+	stopResume
+	// stopStepInto: a StepBreakpoint was reached, set a breakpoint on the
+	// destination of the CALL instruction and resume the target.
+	stopStepInto
+	// stopInternal: a NextBreakpoint or NextDeferBreakpoint was reached,
+	// collect the return values, clear internal breakpoints and stop.
+	stopInternal
+	// stopUser: a user breakpoint was reached, stop. Tracepoints also stop
+	// here, resuming after them is left to the client or to Resume.
+	stopUser
+	// stopTemporary: a temporary user breakpoint was reached, clear it and
+	// stop.
+	stopTemporary
+)
+
+// action returns what Continue must do with the thread stopped in state
+// bpstate. Internal breakpoints take precedence over the user breakpoint
+// they overlap with.
+func (bpstate *BreakpointState) action() stopAction {
+	switch {
+	case bpstate.Breakpoint == nil:
+		return stopNoBreakpoint
+	case !bpstate.Active:
+		return stopResume
+	case bpstate.Internal && bpstate.Kind == StepBreakpoint:
+		return stopStepInto
+	case bpstate.Internal:
+		return stopInternal
+	case bpstate.Flags&BreakpointTemporary != 0:
+		return stopTemporary
+	default:
+		return stopUser
+	}
+}
+
 func configureReturnBreakpoint(bi *BinaryInfo, bp *Breakpoint, topframe *Stackframe, retFrameCond ast.Expr) {
 	if topframe.Current.Fn == nil {
 		return
@@ -430,6 +667,12 @@ func (rbpi *returnBreakpointInfo) Collect(thread Thread) []*Variable {
 		return (v.Flags & VariableReturnArgument) != 0
 	})
 
+	if scope.BinInfo.usesRegabi() {
+		// With the register based ABI return values are not written to the
+		// stack, read them from the registers they were assigned to.
+		vars = regabiValues(scope.BinInfo, scope.Mem, scope.Regs, vars)
+	}
+
 	return vars
 }
 
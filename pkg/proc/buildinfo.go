@@ -0,0 +1,293 @@
+package proc
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// BuildInfo is the module information embedded by the go command in an
+// executable, it has the same fields as runtime/debug.BuildInfo.
+type BuildInfo struct {
+	GoVersion string         // Version of Go that produced the executable
+	Path      string         // Package path of the main package
+	Main      BuildModule    // Module containing the main package
+	Deps      []*BuildModule // Dependencies of the main module
+	Settings  []BuildSetting // Other information about the build, like the VCS revision
+}
+
+// BuildModule describes a module of an executable.
+type BuildModule struct {
+	Path    string       // Module path
+	Version string       // Module version
+	Sum     string       // Checksum
+	Replace *BuildModule // Replaced by this module
+}
+
+// BuildSetting is a key/value pair describing one setting that influenced
+// the build, for example vcs.revision.
+type BuildSetting struct {
+	Key, Value string
+}
+
+// Setting returns the value of the build setting key, or the empty string.
+func (info *BuildInfo) Setting(key string) string {
+	for _, s := range info.Settings {
+		if s.Key == key {
+			return s.Value
+		}
+	}
+	return ""
+}
+
+var errNoBuildInfo = errors.New("no module information found in executable")
+
+const (
+	// buildInfoMagic is the start of the header of the .go.buildinfo section.
+	buildInfoMagic = "\xff Go buildinf:"
+	// buildInfoHeaderSize is the size of the header of the .go.buildinfo
+	// section. In its original format (before go 1.18) the header is
+	// followed by pointers to runtime.buildVersion and runtime.modinfo,
+	// since go 1.18 it's followed by the two strings themselves.
+	buildInfoHeaderSize    = 32
+	buildInfoFlagBigEndian = 0x1
+	buildInfoFlagInline    = 0x2
+)
+
+// buildInfoExe is an executable file containing a .go.buildinfo section.
+type buildInfoExe interface {
+	// buildInfoData returns the contents of the .go.buildinfo section,
+	// starting at its header.
+	buildInfoData() ([]byte, error)
+	// readAddr returns size bytes at address addr of the executable.
+	readAddr(addr, size uint64) ([]byte, error)
+}
+
+// readBuildInfo reads the module information embedded in exe. Unlike
+// debug/buildinfo it does not require go 1.18 to build delve.
+func readBuildInfo(exe buildInfoExe) (*BuildInfo, error) {
+	data, err := exe.buildInfoData()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < buildInfoHeaderSize || !strings.HasPrefix(string(data), buildInfoMagic) {
+		return nil, errNoBuildInfo
+	}
+	ptrSize := int(data[len(buildInfoMagic)])
+	flags := data[len(buildInfoMagic)+1]
+
+	var vers, mod string
+	if flags&buildInfoFlagInline != 0 {
+		var ok bool
+		data = data[buildInfoHeaderSize:]
+		if vers, data, ok = readBuildInfoString(data); !ok {
+			return nil, errNoBuildInfo
+		}
+		if mod, _, ok = readBuildInfoString(data); !ok {
+			return nil, errNoBuildInfo
+		}
+	} else {
+		if ptrSize != 4 && ptrSize != 8 {
+			return nil, errNoBuildInfo
+		}
+		var bo binary.ByteOrder = binary.LittleEndian
+		if flags&buildInfoFlagBigEndian != 0 {
+			bo = binary.BigEndian
+		}
+		readPtr := func(b []byte) uint64 {
+			if ptrSize == 4 {
+				return uint64(bo.Uint32(b))
+			}
+			return bo.Uint64(b)
+		}
+		// readString reads the Go string whose header is at addr.
+		readString := func(addr uint64) (string, error) {
+			hdr, err := exe.readAddr(addr, uint64(2*ptrSize))
+			if err != nil {
+				return "", err
+			}
+			s, err := exe.readAddr(readPtr(hdr), readPtr(hdr[ptrSize:]))
+			return string(s), err
+		}
+		off := len(buildInfoMagic) + 2
+		if vers, err = readString(readPtr(data[off:])); err != nil {
+			return nil, fmt.Errorf("could not read go version: %v", err)
+		}
+		if mod, err = readString(readPtr(data[off+ptrSize:])); err != nil {
+			return nil, fmt.Errorf("could not read module information: %v", err)
+		}
+	}
+	if vers == "" {
+		return nil, errNoBuildInfo
+	}
+
+	// The module information is wrapped by two 16 bytes sentinels, see
+	// ModInfoData in cmd/go/internal/modload.
+	if len(mod) >= 33 && mod[len(mod)-17] == '\n' {
+		mod = mod[16 : len(mod)-16]
+	} else {
+		mod = ""
+	}
+
+	info := parseModInfo(mod)
+	info.GoVersion = vers
+	return info, nil
+}
+
+// readBuildInfoString reads a string prefixed by its length as a uvarint.
+func readBuildInfoString(data []byte) (s string, rest []byte, ok bool) {
+	n, sz := binary.Uvarint(data)
+	if sz <= 0 || n > uint64(len(data)-sz) {
+		return "", nil, false
+	}
+	return string(data[sz : sz+int(n)]), data[sz+int(n):], true
+}
+
+// parseModInfo parses the text module information of an executable, see
+// runtime/debug.ParseBuildInfo.
+func parseModInfo(mod string) *BuildInfo {
+	info := &BuildInfo{}
+	var last *BuildModule
+	for _, line := range strings.Split(mod, "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "path":
+			info.Path = fields[1]
+		case "mod", "dep", "=>":
+			m := &BuildModule{Path: fields[1]}
+			if len(fields) > 2 {
+				m.Version = fields[2]
+			}
+			if len(fields) > 3 {
+				m.Sum = fields[3]
+			}
+			switch fields[0] {
+			case "mod":
+				info.Main = *m
+				last = &info.Main
+			case "dep":
+				info.Deps = append(info.Deps, m)
+				last = m
+			case "=>":
+				if last != nil {
+					last.Replace = m
+					last = nil
+				}
+			}
+		case "build":
+			kv := strings.SplitN(fields[1], "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			if k, err := strconv.Unquote(kv[0]); err == nil {
+				kv[0] = k
+			}
+			if v, err := strconv.Unquote(kv[1]); err == nil {
+				kv[1] = v
+			}
+			info.Settings = append(info.Settings, BuildSetting{Key: kv[0], Value: kv[1]})
+		}
+	}
+	return info
+}
+
+type elfBuildInfoExe struct{ f *elf.File }
+
+func (exe elfBuildInfoExe) buildInfoData() ([]byte, error) {
+	sec := exe.f.Section(".go.buildinfo")
+	if sec == nil {
+		return nil, errNoBuildInfo
+	}
+	return sec.Data()
+}
+
+func (exe elfBuildInfoExe) readAddr(addr, size uint64) ([]byte, error) {
+	for _, prog := range exe.f.Progs {
+		if prog.Type == elf.PT_LOAD && prog.Vaddr <= addr && addr+size <= prog.Vaddr+prog.Filesz {
+			buf := make([]byte, size)
+			_, err := prog.ReadAt(buf, int64(addr-prog.Vaddr))
+			return buf, err
+		}
+	}
+	return nil, fmt.Errorf("address %#x not found", addr)
+}
+
+type machoBuildInfoExe struct{ f *macho.File }
+
+func (exe machoBuildInfoExe) buildInfoData() ([]byte, error) {
+	sec := exe.f.Section("__go_buildinfo")
+	if sec == nil {
+		return nil, errNoBuildInfo
+	}
+	return sec.Data()
+}
+
+func (exe machoBuildInfoExe) readAddr(addr, size uint64) ([]byte, error) {
+	for _, load := range exe.f.Loads {
+		seg, ok := load.(*macho.Segment)
+		if ok && seg.Addr <= addr && addr+size <= seg.Addr+seg.Filesz {
+			buf := make([]byte, size)
+			_, err := seg.ReadAt(buf, int64(addr-seg.Addr))
+			return buf, err
+		}
+	}
+	return nil, fmt.Errorf("address %#x not found", addr)
+}
+
+type peBuildInfoExe struct{ f *pe.File }
+
+func (exe peBuildInfoExe) imageBase() uint64 {
+	switch oh := exe.f.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		return uint64(oh.ImageBase)
+	case *pe.OptionalHeader64:
+		return oh.ImageBase
+	}
+	return 0
+}
+
+// buildInfoData returns the data starting at the .go.buildinfo header,
+// which PE executables have, aligned to 16 bytes, in their .data section.
+func (exe peBuildInfoExe) buildInfoData() ([]byte, error) {
+	sec := exe.f.Section(".data")
+	if sec == nil {
+		return nil, errNoBuildInfo
+	}
+	data, err := sec.Data()
+	if err != nil {
+		return nil, err
+	}
+	for off := 0; off < len(data); {
+		i := bytes.Index(data[off:], []byte(buildInfoMagic))
+		if i < 0 {
+			break
+		}
+		if (off+i)%16 == 0 {
+			return data[off+i:], nil
+		}
+		off += i + 1
+	}
+	return nil, errNoBuildInfo
+}
+
+func (exe peBuildInfoExe) readAddr(addr, size uint64) ([]byte, error) {
+	addr -= exe.imageBase()
+	for _, sec := range exe.f.Sections {
+		start := uint64(sec.VirtualAddress)
+		if start <= addr && addr+size <= start+uint64(sec.Size) {
+			buf := make([]byte, size)
+			_, err := sec.ReadAt(buf, int64(addr-start))
+			return buf, err
+		}
+	}
+	return nil, fmt.Errorf("address %#x not found", addr)
+}
@@ -199,7 +199,7 @@ func TestCore(t *testing.T) {
 	var panickingStack []proc.Stackframe
 	for _, g := range gs {
 		t.Logf("Goroutine %d", g.ID)
-		stack, err := g.Stacktrace(10, false)
+		stack, err := g.Stacktrace(10, false, true)
 		if err != nil {
 			t.Errorf("Stacktrace() on goroutine %v = %v", g, err)
 		}
@@ -248,6 +248,35 @@ func TestCore(t *testing.T) {
 	}
 }
 
+func TestCoreReadOnly(t *testing.T) {
+	// Operations that would modify the state of the target must fail on core
+	// files.
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		return
+	}
+	p := withCoreFile(t, "panic", "")
+
+	regs, err := p.CurrentThread().Registers(false)
+	if err != nil {
+		t.Fatalf("Couldn't get current thread registers: %v", err)
+	}
+	if _, err := p.SetBreakpoint(regs.PC(), proc.UserBreakpoint, nil); err != ErrWriteCore {
+		t.Errorf("SetBreakpoint: got %v, want %v", err, ErrWriteCore)
+	}
+	if err := proc.Continue(p); err != ErrContinueCore {
+		t.Errorf("Continue: got %v, want %v", err, ErrContinueCore)
+	}
+	if err := p.StepInstruction(); err != ErrContinueCore {
+		t.Errorf("StepInstruction: got %v, want %v", err, ErrContinueCore)
+	}
+	if _, err := p.CurrentThread().WriteMemory(0, []byte{0}); err != ErrWriteCore {
+		t.Errorf("WriteMemory: got %v, want %v", err, ErrWriteCore)
+	}
+	if err := p.CurrentThread().SetPC(0); err != ErrChangeRegisterCore {
+		t.Errorf("SetPC: got %v, want %v", err, ErrChangeRegisterCore)
+	}
+}
+
 func TestCoreFpRegisters(t *testing.T) {
 	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
 		return
@@ -267,7 +296,7 @@ func TestCoreFpRegisters(t *testing.T) {
 
 	var regs proc.Registers
 	for _, thread := range p.ThreadList() {
-		frames, err := proc.ThreadStacktrace(thread, 10)
+		frames, err := proc.ThreadStacktrace(thread, 10, true)
 		if err != nil {
 			t.Errorf("ThreadStacktrace for %x = %v", thread.ThreadID(), err)
 			continue
@@ -343,7 +372,7 @@ func TestCoreWithEmptyString(t *testing.T) {
 	var mainFrame *proc.Stackframe
 mainSearch:
 	for _, g := range gs {
-		stack, err := g.Stacktrace(10, false)
+		stack, err := g.Stacktrace(10, false, true)
 		assertNoError(err, t, "Stacktrace()")
 		for _, frame := range stack {
 			if frame.Current.Fn != nil && frame.Current.Fn.Name == "main.main" {
@@ -358,11 +387,11 @@ mainSearch:
 	}
 
 	scope := proc.FrameToScope(p.BinInfo(), p.CurrentThread(), nil, *mainFrame)
-	v1, err := scope.EvalVariable("t", proc.LoadConfig{true, 1, 64, 64, -1, 0})
+	v1, err := scope.EvalVariable("t", proc.LoadConfig{true, 1, 64, 64, -1, 0, false, false})
 	assertNoError(err, t, "EvalVariable(t)")
 	assertNoError(v1.Unreadable, t, "unreadable variable 't'")
 	t.Logf("t = %#v\n", v1)
-	v2, err := scope.EvalVariable("s", proc.LoadConfig{true, 1, 64, 64, -1, 0})
+	v2, err := scope.EvalVariable("s", proc.LoadConfig{true, 1, 64, 64, -1, 0, false, false})
 	assertNoError(err, t, "EvalVariable(s)")
 	assertNoError(v2.Unreadable, t, "unreadable variable 's'")
 	t.Logf("s = %#v\n", v2)
@@ -390,7 +419,7 @@ func TestMinidump(t *testing.T) {
 	t.Logf("%d goroutines", len(gs))
 	foundMain, foundTime := false, false
 	for _, g := range gs {
-		stack, err := g.Stacktrace(10, false)
+		stack, err := g.Stacktrace(10, false, true)
 		if err != nil {
 			t.Errorf("Stacktrace() on goroutine %v = %v", g, err)
 		}
@@ -1,6 +1,9 @@
 package proc
 
-import "sort"
+import (
+	"fmt"
+	"sort"
+)
 
 // AsmInstruction represents one assembly instruction.
 type AsmInstruction struct {
@@ -48,6 +51,46 @@ func Disassemble(dbp Process, g *G, startPC, endPC uint64) ([]AsmInstruction, er
 	return disassemble(mem, regs, dbp.Breakpoints(), dbp.BinInfo(), startPC, endPC, false)
 }
 
+// DisassembleFunction disassembles the whole body of function fname, see
+// Disassemble.
+func DisassembleFunction(dbp Process, g *G, fname string) ([]AsmInstruction, error) {
+	fn := dbp.BinInfo().LookupFunc[fname]
+	if fn == nil {
+		return nil, &ErrFunctionNotFound{fname}
+	}
+	if fn.Entry == 0 {
+		return nil, fmt.Errorf("function %s has no code", fname)
+	}
+	return Disassemble(dbp, g, fn.Entry, fn.End)
+}
+
+// CurrentInstruction decodes the instruction at the current PC of the
+// selected goroutine (or of the current thread if the selected goroutine
+// isn't running on a thread). If a breakpoint is set at the current PC the
+// original instruction is returned.
+func CurrentInstruction(dbp Process) (*AsmInstruction, error) {
+	if _, err := dbp.Valid(); err != nil {
+		return nil, err
+	}
+	thread := dbp.CurrentThread()
+	if g := dbp.SelectedGoroutine(); g != nil && g.Thread != nil {
+		thread = g.Thread
+	}
+	regs, err := thread.Registers(false)
+	if err != nil {
+		return nil, err
+	}
+	pc := regs.PC()
+	insts, err := disassemble(thread, regs, dbp.Breakpoints(), dbp.BinInfo(), pc, pc+maxInstructionLength, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(insts) == 0 || insts[0].Inst == nil {
+		return nil, fmt.Errorf("could not decode instruction at %#x", pc)
+	}
+	return &insts[0], nil
+}
+
 func disassemble(memrw MemoryReadWriter, regs Registers, breakpoints *BreakpointMap, bi *BinaryInfo, startPC, endPC uint64, singleInstr bool) ([]AsmInstruction, error) {
 	mem := make([]byte, int(endPC-startPC))
 	_, err := memrw.ReadMemory(mem, uintptr(startPC))
@@ -64,11 +107,10 @@ func disassemble(memrw MemoryReadWriter, regs Registers, breakpoints *Breakpoint
 	}
 
 	for len(mem) > 0 {
-		bp, atbp := breakpoints.M[pc]
+		bp, atbp := breakpoints.BreakpointAt(pc)
 		if atbp {
-			for i := range bp.OriginalData {
-				mem[i] = bp.OriginalData[i]
-			}
+			// the breakpoint instruction can be longer than the rest of mem
+			copy(mem, bp.OriginalData)
 		}
 		file, line, fn := bi.PCToLine(pc)
 		loc := Location{PC: pc, File: file, Line: line, Fn: fn}
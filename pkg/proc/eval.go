@@ -27,6 +27,10 @@ func (scope *EvalScope) EvalExpression(expr string, cfg LoadConfig) (*Variable,
 		// makes sure that the other goroutine won't wait forever if we make a mistake
 		defer close(scope.callCtx.continueRequest)
 	}
+	if !scope.BinInfo.HasDWARF() {
+		scope.callCtx.doReturn(nil, ErrNoDebugInfo)
+		return nil, ErrNoDebugInfo
+	}
 	t, err := parser.ParseExpr(expr)
 	if err != nil {
 		scope.callCtx.doReturn(nil, err)
@@ -7,8 +7,11 @@ import (
 	"fmt"
 	"go/ast"
 	"go/constant"
+	"go/parser"
+	"go/token"
 	"reflect"
 	"sort"
+	"strconv"
 
 	"github.com/go-delve/delve/pkg/dwarf/godwarf"
 	"github.com/go-delve/delve/pkg/dwarf/op"
@@ -44,7 +47,6 @@ const (
 var (
 	errFuncCallUnsupported        = errors.New("function calls not supported by this version of Go")
 	errFuncCallUnsupportedBackend = errors.New("backend does not support function calls")
-	errFuncCallInProgress         = errors.New("cannot call function while another function call is already in progress")
 	errNotACallExpr               = errors.New("not a function call")
 	errNoGoroutine                = errors.New("no goroutine selected")
 	errGoroutineNotRunning        = errors.New("selected goroutine not running")
@@ -54,8 +56,15 @@ var (
 	errNoAddrUnsupported          = errors.New("arguments to a function call must have an address")
 	errNotAGoFunction             = errors.New("not a Go function")
 	errFuncCallNotAllowed         = errors.New("function calls not allowed without using 'call'")
+	errFuncCallInterrupted        = errors.New("the target stopped before the function call returned")
 )
 
+// ErrCallInProgress is returned when a function call is requested while
+// another function call is in progress: by a call in the arguments of a
+// function call or while a function call that hit a breakpoint has not
+// returned yet.
+var ErrCallInProgress = errors.New("cannot call function while another function call is already in progress")
+
 type functionCallState struct {
 	// savedRegs contains the saved registers
 	savedRegs Registers
@@ -118,31 +127,105 @@ func (callCtx *callContext) doReturn(ret *Variable, err error) {
 // Because this can only be done in the current goroutine, unlike
 // EvalExpression, EvalExpressionWithCalls is not a method of EvalScope.
 func EvalExpressionWithCalls(p Process, expr string, retLoadCfg LoadConfig, checkEscape bool) error {
+	scope, continueRequest, err := callScope(p, retLoadCfg, checkEscape)
+	if err != nil {
+		return err
+	}
+
+	go scope.EvalExpression(expr, retLoadCfg)
+
+	return waitCallScope(p, continueRequest)
+}
+
+// SetVariableWithCalls is like EvalScope.SetVariable but allows function
+// calls in 'value'.
+// Assigning a string that isn't already stored in the memory of the target
+// (for example a string literal) is only possible here, since the bytes of
+// the string are allocated by calling runtime.mallocgc, see allocString.
+func SetVariableWithCalls(p Process, name, value string, checkEscape bool) error {
+	scope, continueRequest, err := callScope(p, loadFullValue, checkEscape)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		// makes sure that the other goroutine won't wait forever if we make a mistake
+		defer close(scope.callCtx.continueRequest)
+		err := scope.SetVariable(name, value)
+		scope.callCtx.doReturn(nil, err)
+	}()
+
+	return waitCallScope(p, continueRequest)
+}
+
+// CallFunction calls the function described by expr, a call expression,
+// on the selected goroutine using the function call injection protocol,
+// see EvalExpressionWithCalls, and returns its return value. Functions
+// with more than one return value return a variable without type whose
+// children are the return values. If the called function panics the value
+// passed to panic is returned, with the name "~panic".
+// The runtime restores the registers of the goroutine when the call
+// returns or panics.
+func CallFunction(p Process, expr string) (*Variable, error) {
+	if _, err := p.Valid(); err != nil {
+		return nil, err
+	}
+	t, err := parser.ParseExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := t.(*ast.CallExpr); !ok {
+		return nil, errNotACallExpr
+	}
+	if err := EvalExpressionWithCalls(p, expr, loadFullValue, true); err != nil {
+		return nil, err
+	}
+	if p.Common().continueCompleted != nil {
+		// the called function hit a breakpoint, it will return when the
+		// target is continued.
+		return nil, errFuncCallInterrupted
+	}
+	retvars := p.CurrentThread().Common().ReturnValues(loadFullValue)
+	if len(retvars) == 1 {
+		return retvars[0], nil
+	}
+	r := newVariable("", 0, nil, p.BinInfo(), p.CurrentThread())
+	r.loaded = true
+	r.Children = make([]Variable, len(retvars))
+	for i := range retvars {
+		r.Children[i] = *retvars[i]
+	}
+	return r, nil
+}
+
+// callScope returns a scope for the selected goroutine that can be used to
+// evaluate expressions containing function calls.
+func callScope(p Process, retLoadCfg LoadConfig, checkEscape bool) (*EvalScope, chan continueRequest, error) {
 	bi := p.BinInfo()
 	if !p.Common().fncallEnabled {
-		return errFuncCallUnsupportedBackend
+		return nil, nil, errFuncCallUnsupportedBackend
 	}
 	if p.Common().continueCompleted != nil {
-		return errFuncCallInProgress
+		return nil, nil, ErrCallInProgress
 	}
 
 	dbgcallfn := bi.LookupFunc[debugCallFunctionName]
 	if dbgcallfn == nil {
-		return errFuncCallUnsupported
+		return nil, nil, errFuncCallUnsupported
 	}
 
 	// check that the selected goroutine is running
 	g := p.SelectedGoroutine()
 	if g == nil {
-		return errNoGoroutine
+		return nil, nil, errNoGoroutine
 	}
 	if g.Status != Grunning || g.Thread == nil {
-		return errGoroutineNotRunning
+		return nil, nil, errGoroutineNotRunning
 	}
 
 	scope, err := GoroutineScope(p.CurrentThread())
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	continueRequest := make(chan continueRequest)
@@ -159,8 +242,12 @@ func EvalExpressionWithCalls(p Process, expr string, retLoadCfg LoadConfig, chec
 	p.Common().continueRequest = continueRequest
 	p.Common().continueCompleted = continueCompleted
 
-	go scope.EvalExpression(expr, retLoadCfg)
+	return scope, continueRequest, nil
+}
 
+// waitCallScope waits for the first request of the evaluation started on a
+// scope returned by callScope.
+func waitCallScope(p Process, continueRequest <-chan continueRequest) error {
 	contReq, ok := <-continueRequest
 	if contReq.cont {
 		return Continue(p)
@@ -179,6 +266,9 @@ func finishEvalExpressionWithCalls(p Process, contReq continueRequest, ok bool)
 		} else {
 			err = contReq.err
 		}
+	} else if contReq.ret == nil {
+		// SetVariableWithCalls doesn't return anything
+		p.CurrentThread().Common().returnValues = nil
 	} else if contReq.ret.Addr == 0 && contReq.ret.DwarfType == nil {
 		// this is a variable returned by a function call with multiple return values
 		r := make([]*Variable, len(contReq.ret.Children))
@@ -221,7 +311,7 @@ func (scope *EvalScope) evalFunctionCall(node *ast.CallExpr) (*Variable, error)
 		return nil, errFuncCallUnsupportedBackend
 	}
 	if p.Common().callInProgress {
-		return nil, errFuncCallInProgress
+		return nil, ErrCallInProgress
 	}
 
 	p.Common().callInProgress = true
@@ -344,6 +434,49 @@ func (scope *EvalScope) evalFunctionCall(node *ast.CallExpr) (*Variable, error)
 	}
 }
 
+// allocString allocates the bytes of the string v in the heap of the
+// target, by calling runtime.mallocgc, if they aren't already stored in the
+// memory of the target.
+// The allocated memory isn't referenced by anything until the string is
+// assigned to a variable, this is safe only because the target is stopped
+// until the assignment is completed.
+func allocString(scope *EvalScope, v *Variable) error {
+	if v.Base != 0 || v.Len == 0 {
+		// already allocated
+		return nil
+	}
+	if scope.callCtx == nil {
+		return errors.New("can not allocate a new string without function calls")
+	}
+	val := constant.StringVal(v.Value)
+	mallocv, err := scope.evalFunctionCall(&ast.CallExpr{
+		Fun: &ast.SelectorExpr{
+			X:   &ast.Ident{Name: "runtime"},
+			Sel: &ast.Ident{Name: "mallocgc"},
+		},
+		Args: []ast.Expr{
+			&ast.BasicLit{Kind: token.INT, Value: strconv.Itoa(len(val))},
+			&ast.Ident{Name: "nil"},
+			&ast.Ident{Name: "false"},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if mallocv.Kind != reflect.UnsafePointer || len(mallocv.Children) != 1 {
+		return errors.New("internal error, could not interpret return value of mallocgc call")
+	}
+	base := mallocv.Children[0].Addr
+	if base == 0 {
+		return errors.New("mallocgc returned nil")
+	}
+	if _, err := scope.Mem.WriteMemory(base, []byte(val)); err != nil {
+		return err
+	}
+	v.Base = base
+	return nil
+}
+
 // fncallPanicErr is the error returned if a called function panics
 type fncallPanicErr struct {
 	panicVar *Variable
@@ -403,7 +536,7 @@ func (scope *EvalScope) funcCallEvalExpr(callexpr *ast.CallExpr) (fn *Function,
 	if fnvar.Kind != reflect.Func {
 		return nil, 0, nil, fmt.Errorf("expression %q is not a function", exprToString(callexpr.Fun))
 	}
-	fnvar.loadValue(LoadConfig{false, 0, 0, 0, 0, 0})
+	fnvar.loadValue(LoadConfig{false, 0, 0, 0, 0, 0, false, false})
 	if fnvar.Unreadable != nil {
 		return nil, 0, nil, fnvar.Unreadable
 	}
@@ -647,7 +647,9 @@ func (p *Process) ContinueOnce() (proc.Thread, error) {
 continueLoop:
 	for {
 		tu.Reset()
+		p.common.SetRunning(true)
 		threadID, sig, err = p.conn.resume(sig, &tu)
+		p.common.SetRunning(false)
 		if err != nil {
 			if _, exited := err.(proc.ErrProcessExited); exited {
 				p.exited = true
@@ -1041,6 +1043,9 @@ func (p *Process) SetBreakpoint(addr uint64, kind proc.BreakpointKind, cond ast.
 	if p.exited {
 		return nil, &proc.ErrProcessExited{Pid: p.conn.pid}
 	}
+	if p.common.Running() {
+		return nil, proc.ErrProcessRunning
+	}
 	return p.breakpoints.Set(addr, kind, cond, p.writeBreakpoint)
 }
 
@@ -1049,6 +1054,9 @@ func (p *Process) ClearBreakpoint(addr uint64) (*proc.Breakpoint, error) {
 	if p.exited {
 		return nil, &proc.ErrProcessExited{Pid: p.conn.pid}
 	}
+	if p.common.Running() {
+		return nil, proc.ErrProcessRunning
+	}
 	return p.breakpoints.Clear(addr, func(bp *proc.Breakpoint) error {
 		return p.conn.clearBreakpoint(bp.Addr)
 	})
@@ -1206,6 +1214,9 @@ func (p *Process) setCurrentBreakpoints() error {
 
 // ReadMemory will read into 'data' memory at the address provided.
 func (t *Thread) ReadMemory(data []byte, addr uintptr) (n int, err error) {
+	if t.p.common.Running() {
+		return 0, proc.ErrProcessRunning
+	}
 	err = t.p.conn.readMemory(data, addr)
 	if err != nil {
 		return 0, err
@@ -1215,6 +1226,9 @@ func (t *Thread) ReadMemory(data []byte, addr uintptr) (n int, err error) {
 
 // WriteMemory will write into the memory at 'addr' the data provided.
 func (t *Thread) WriteMemory(addr uintptr, data []byte) (written int, err error) {
+	if t.p.common.Running() {
+		return 0, proc.ErrProcessRunning
+	}
 	return t.p.conn.writeMemory(addr, data)
 }
 
@@ -1585,8 +1599,10 @@ func (t *Thread) SetCurrentBreakpoint() error {
 		if t.CurrentBreakpoint.Breakpoint != nil && t.CurrentBreakpoint.Active {
 			if g, err := proc.GetG(t); err == nil {
 				t.CurrentBreakpoint.HitCount[g.ID]++
+				t.CurrentBreakpoint.CheckOncePerGoroutine(g.ID)
 			}
 			t.CurrentBreakpoint.TotalHitCount++
+			t.CurrentBreakpoint.CheckIgnoreCount()
 		}
 	}
 	return nil
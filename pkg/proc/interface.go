@@ -2,6 +2,8 @@ package proc
 
 import (
 	"go/ast"
+	"io"
+	"sync/atomic"
 )
 
 // Process represents the target of the debugger. This
@@ -11,6 +13,10 @@ import (
 // of Process should not assume they are.
 // There is one exception to this rule: it is safe to call RequestManualStop
 // concurrently with ContinueOnce.
+// Reading and writing memory and setting or clearing breakpoints while
+// ContinueOnce is waiting for the target to stop return ErrProcessRunning.
+// This does not make them safe while ContinueAsync is resuming the target,
+// see ContinueAsync.
 type Process interface {
 	Info
 	ProcessManipulation
@@ -128,6 +134,27 @@ type CommonProcess struct {
 	// This is only used to prevent nested function calls, it should be removed
 	// when we add support for them.
 	callInProgress bool
+
+	// stepIntoHidden is true when Step should also stop inside unexported
+	// runtime functions and code without line information.
+	stepIntoHidden bool
+
+	// stepBudget is the maximum number of steps of a step operation, see
+	// SetStepBudget, zero means defaultStepBudget for single stepping and no
+	// limit for resuming the target.
+	stepBudget int
+
+	// stepOutput is the writer the stop location of step operations is
+	// printed to, see SetStepOutput.
+	stepOutput io.Writer
+
+	// running is not zero while the target is resumed, it's accessed
+	// atomically.
+	running int32
+
+	// continuingAsync is not zero while ContinueAsync is resuming the
+	// target, it's accessed atomically.
+	continuingAsync int32
 }
 
 // NewCommonProcess returns a struct with fields common across
@@ -136,6 +163,60 @@ func NewCommonProcess(fncallEnabled bool) CommonProcess {
 	return CommonProcess{fncallEnabled: fncallEnabled}
 }
 
+// SetRunning records whether the target is resumed. Backends set it while
+// they wait for the target to stop, operations that need the target to be
+// stopped check it and return ErrProcessRunning.
+func (p *CommonProcess) SetRunning(running bool) {
+	var v int32
+	if running {
+		v = 1
+	}
+	atomic.StoreInt32(&p.running, v)
+}
+
+// Running returns true while the target is resumed.
+func (p *CommonProcess) Running() bool {
+	return atomic.LoadInt32(&p.running) != 0
+}
+
+// SetStepIntoHidden controls whether Step stops inside unexported runtime
+// functions and functions without line information. By default these
+// functions are stepped over, enabling this is only useful to debug the
+// runtime itself.
+func (p *CommonProcess) SetStepIntoHidden(enabled bool) {
+	p.stepIntoHidden = enabled
+}
+
+// SetStepBudget sets the maximum number of instructions single stepped by
+// StepUntilOutOfRange, and by Next in functions without line information,
+// and the maximum number of times Next, Step and StepOut resume the target
+// without completing. When the budget is exhausted the operation is
+// interrupted with ErrStepBudgetExceeded. A budget of zero or less restores
+// the default budget, which only limits single stepping: by default Next,
+// Step and StepOut resume the target until they complete.
+func (p *CommonProcess) SetStepBudget(n int) {
+	if n < 0 {
+		n = 0
+	}
+	p.stepBudget = n
+}
+
+// SetStepOutput sets the writer that Next, Step, StepIntoCall and StepOut
+// print the location they stopped at to, as a "Stopped at: ..." line, when
+// they complete without errors. Passing nil, the default, disables the
+// output.
+func (p *CommonProcess) SetStepOutput(w io.Writer) {
+	p.stepOutput = w
+}
+
+// StepBudget returns the step budget set by SetStepBudget.
+func (p *CommonProcess) StepBudget() int {
+	if p.stepBudget == 0 {
+		return defaultStepBudget
+	}
+	return p.stepBudget
+}
+
 // ClearAllGCache clears the cached contents of the cache for runtime.allgs.
 func (p *CommonProcess) ClearAllGCache() {
 	p.allGCache = nil
@@ -10,30 +10,45 @@ const (
 	_AT_ENTRY_AMD64 = 9
 )
 
+// Tags of the entries of the auxiliary vector, see ParseAuxvAMD64.
+const (
+	// AuxvBase is the tag of the address the program interpreter (the
+	// dynamic linker) was loaded at, zero for statically linked executables.
+	AuxvBase = 7
+	// AuxvEntry is the tag of the entry point of the executable.
+	AuxvEntry = _AT_ENTRY_AMD64
+)
+
 // EntryPointFromAuxv searches the elf auxiliary vector for the entry point
 // address.
 // For a description of the auxiliary vector (auxv) format see:
 // System V Application Binary Interface, AMD64 Architecture Processor
 // Supplement, section 3.4.3
 func EntryPointFromAuxvAMD64(auxv []byte) uint64 {
+	return ParseAuxvAMD64(auxv)[_AT_ENTRY_AMD64]
+}
+
+// ParseAuxvAMD64 returns the entries of the elf auxiliary vector as a map
+// from their tag to their value. A truncated vector returns the entries
+// read until the truncation.
+func ParseAuxvAMD64(auxv []byte) map[uint64]uint64 {
 	rd := bytes.NewBuffer(auxv)
+	r := make(map[uint64]uint64)
 
 	for {
 		var tag, val uint64
 		err := binary.Read(rd, binary.LittleEndian, &tag)
 		if err != nil {
-			return 0
+			return r
 		}
 		err = binary.Read(rd, binary.LittleEndian, &val)
 		if err != nil {
-			return 0
+			return r
 		}
 
-		switch tag {
-		case _AT_NULL_AMD64:
-			return 0
-		case _AT_ENTRY_AMD64:
-			return val
+		if tag == _AT_NULL_AMD64 {
+			return r
 		}
+		r[tag] = val
 	}
 }
@@ -322,9 +322,29 @@ type AMD64PtraceFpRegs struct {
 // Manual, Volume 1: Basic Architecture.
 type AMD64Xstate struct {
 	AMD64PtraceFpRegs
-	Xsave    []byte // raw xsave area
-	AvxState bool   // contains AVX state
-	YmmSpace [256]byte
+	Xsave        []byte // raw xsave area
+	Xcr0         uint64 // state components enabled by the kernel, 0 if unknown
+	AvxState     bool   // contains AVX state
+	YmmSpace     [256]byte
+	Avx512State  bool       // contains AVX-512 state
+	OpmaskSpace  [64]byte   // K0-K7
+	ZmmSpace     [512]byte  // upper 256 bits of ZMM0-ZMM15
+	Hi16ZmmSpace [1024]byte // ZMM16-ZMM31
+}
+
+// YMM returns the value of register YMMn, n must be less than 16.
+func (xsave *AMD64Xstate) YMM(n int) []byte {
+	r := make([]byte, 0, 32)
+	r = append(r, xsave.XmmSpace[n*16:(n+1)*16]...)
+	return append(r, xsave.YmmSpace[n*16:(n+1)*16]...)
+}
+
+// ZMM returns the value of register ZMMn, n must be less than 32.
+func (xsave *AMD64Xstate) ZMM(n int) []byte {
+	if n >= 16 {
+		return append([]byte(nil), xsave.Hi16ZmmSpace[(n-16)*64:(n-15)*64]...)
+	}
+	return append(xsave.YMM(n), xsave.ZmmSpace[n*32:(n+1)*32]...)
 }
 
 // Decode decodes an XSAVE area to a list of name/value pairs of registers.
@@ -348,7 +368,16 @@ func (xsave *AMD64Xstate) Decode() (regs []proc.Register) {
 	for i := 0; i < len(xsave.XmmSpace); i += 16 {
 		regs = proc.AppendSSEReg(regs, fmt.Sprintf("XMM%d", i/16), xsave.XmmSpace[i:i+16])
 		if xsave.AvxState {
-			regs = proc.AppendSSEReg(regs, fmt.Sprintf("YMM%d", i/16), xsave.YmmSpace[i:i+16])
+			regs = proc.AppendVectorReg(regs, fmt.Sprintf("YMM%d", i/16), xsave.YMM(i/16))
+		}
+	}
+
+	if xsave.Avx512State {
+		for i := 0; i < 32; i++ {
+			regs = proc.AppendVectorReg(regs, fmt.Sprintf("ZMM%d", i), xsave.ZMM(i))
+		}
+		for i := 0; i < len(xsave.OpmaskSpace); i += 8 {
+			regs = proc.AppendQwordReg(regs, fmt.Sprintf("K%d", i/8), binary.LittleEndian.Uint64(xsave.OpmaskSpace[i:]))
 		}
 	}
 
@@ -360,6 +389,21 @@ const (
 	_XSAVE_HEADER_LEN            = 64
 	_XSAVE_EXTENDED_REGION_START = 576
 	_XSAVE_SSE_REGION_LEN        = 416
+
+	// offsets of the AVX-512 state components in the standard (not
+	// compacted) format of the XSAVE area.
+	_XSAVE_OPMASK_START    = 1088
+	_XSAVE_ZMM_HI256_START = 1152
+	_XSAVE_HI16_ZMM_START  = 1664
+
+	// linux saves XCR0 in the bytes of the legacy region reserved for
+	// software, after a magic number.
+	_XSAVE_SW_RESERVED_START = 464
+	_FP_XSTATE_MAGIC1        = 0x46505853
+
+	// state components, bits of XCR0 and XSTATE_BV.
+	_XSTATE_AVX    = 1 << 2
+	_XSTATE_AVX512 = 1<<5 | 1<<6 | 1<<7
 )
 
 // LinuxX86XstateRead reads a byte array containing an XSAVE area into regset.
@@ -386,14 +430,37 @@ func AMD64XstateRead(xstateargs []byte, readLegacy bool, regset *AMD64Xstate) er
 		return nil
 	}
 
-	if xstate_bv&(1<<2) == 0 {
-		// AVX state not present
-		return nil
+	if sw := xstateargs[_XSAVE_SW_RESERVED_START:]; binary.LittleEndian.Uint32(sw) == _FP_XSTATE_MAGIC1 {
+		regset.Xcr0 = binary.LittleEndian.Uint64(sw[8:])
+	}
+	// A state component can be enabled without being in XSTATE_BV, when its
+	// registers are in their initial state (zero), and its contents in the
+	// XSAVE area are then stale.
+	enabled := func(component uint64) bool {
+		if regset.Xcr0 != 0 {
+			return regset.Xcr0&component == component
+		}
+		return xstate_bv&component != 0
+	}
+	load := func(component uint64, dst []byte, start int) {
+		if xstate_bv&component != 0 && start+len(dst) <= len(xstateargs) {
+			copy(dst, xstateargs[start:])
+		}
 	}
 
-	avxstate := xstateargs[_XSAVE_EXTENDED_REGION_START:]
+	if !enabled(_XSTATE_AVX) {
+		return nil
+	}
 	regset.AvxState = true
-	copy(regset.YmmSpace[:], avxstate[:len(regset.YmmSpace)])
+	load(_XSTATE_AVX, regset.YmmSpace[:], _XSAVE_EXTENDED_REGION_START)
+
+	if !enabled(_XSTATE_AVX512) {
+		return nil
+	}
+	regset.Avx512State = true
+	load(1<<5, regset.OpmaskSpace[:], _XSAVE_OPMASK_START)
+	load(1<<6, regset.ZmmSpace[:], _XSAVE_ZMM_HI256_START)
+	load(1<<7, regset.Hi16ZmmSpace[:], _XSAVE_HI16_ZMM_START)
 
 	return nil
 }
@@ -1,6 +1,7 @@
 package proc
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 
@@ -158,3 +159,34 @@ func (mem *bufferMemoryReadWriter) WriteMemory(addr uintptr, data []byte) (writt
 	copy(mem.buf[addr-fakeAddress:], data)
 	return len(data), nil
 }
+
+// cStringPageSize is the size of the chunks read by ReadCString, reads
+// never cross a page boundary so that a NUL-terminated string ending right
+// before an unmapped page can still be read.
+const cStringPageSize = 0x1000
+
+// ReadCString reads the NUL-terminated string at addr, reading at most max
+// bytes. The returned string does not include the terminating NUL byte and
+// is truncated to max bytes if no NUL byte is found before that.
+func ReadCString(mem MemoryReader, addr uint64, max int) (string, error) {
+	if addr == 0 {
+		return "", errors.New("could not read C string: nil pointer")
+	}
+	r := make([]byte, 0, 64)
+	for len(r) < max {
+		sz := cStringPageSize - int(addr%cStringPageSize)
+		if sz > max-len(r) {
+			sz = max - len(r)
+		}
+		buf := make([]byte, sz)
+		if _, err := mem.ReadMemory(buf, uintptr(addr)); err != nil {
+			return "", fmt.Errorf("could not read C string at %#x: %v", addr, err)
+		}
+		if i := bytes.IndexByte(buf, 0); i >= 0 {
+			return string(append(r, buf[:i]...)), nil
+		}
+		r = append(r, buf...)
+		addr += uint64(sz)
+	}
+	return string(r), nil
+}
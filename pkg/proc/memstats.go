@@ -0,0 +1,85 @@
+package proc
+
+import (
+	"fmt"
+	"go/constant"
+	"reflect"
+	"runtime"
+)
+
+// memStatsField describes how to read a field of runtime.MemStats from the
+// runtime variables of the target. The layout of runtime.memstats changed
+// with most versions of Go, each element of exprs lists the expressions
+// (that will be summed) used by one version, the first one that can be
+// evaluated is used.
+type memStatsField struct {
+	dst   *uint64
+	exprs [][]string
+}
+
+// MemStats returns a summary of the state of the heap of the target,
+// reconstructed from the runtime.memstats and runtime.gcController
+// globals. Only HeapAlloc, HeapSys, NumGC and PauseTotalNs are filled.
+// Since the runtime only computes some of these values when
+// runtime.ReadMemStats is called they are approximations, for example
+// starting with Go 1.16 HeapAlloc also includes objects that became
+// unreachable but have not been swept yet.
+func MemStats(dbp Process) (*runtime.MemStats, error) {
+	if _, err := dbp.Valid(); err != nil {
+		return nil, err
+	}
+	bi := dbp.BinInfo()
+	scope := globalScope(bi, bi.Images[0], dbp.CurrentThread())
+
+	var r runtime.MemStats
+	var numgc uint64
+	fields := []memStatsField{
+		{&r.HeapAlloc, [][]string{
+			{"runtime.memstats.heap_alloc"},         // before Go 1.17
+			{"runtime.gcController.heapLive"},       // Go 1.17 to Go 1.20
+			{"runtime.gcController.heapLive.value"}, // Go 1.21 and later
+		}},
+		{&r.HeapSys, [][]string{
+			{"runtime.memstats.heap_sys"}, // before Go 1.21
+			{"runtime.gcController.heapInUse", "runtime.gcController.heapFree", "runtime.gcController.heapReleased"},
+		}},
+		{&numgc, [][]string{{"runtime.memstats.numgc"}}},
+		{&r.PauseTotalNs, [][]string{{"runtime.memstats.pause_total_ns"}}},
+	}
+
+	for _, field := range fields {
+		var err error
+		for _, exprs := range field.exprs {
+			*field.dst, err = sumUintExprs(scope, exprs)
+			if err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	r.NumGC = uint32(numgc)
+	return &r, nil
+}
+
+func sumUintExprs(scope *EvalScope, exprs []string) (uint64, error) {
+	var r uint64
+	for _, expr := range exprs {
+		v, err := scope.EvalVariable(expr, loadSingleValue)
+		if err != nil {
+			return 0, err
+		}
+		if v.Unreadable != nil {
+			return 0, v.Unreadable
+		}
+		switch v.Kind {
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			n, _ := constant.Uint64Val(v.Value)
+			r += n
+		default:
+			return 0, fmt.Errorf("%s is not an unsigned integer", expr)
+		}
+	}
+	return r, nil
+}
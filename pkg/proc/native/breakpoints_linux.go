@@ -0,0 +1,105 @@
+package native
+
+import (
+	"bytes"
+	"debug/elf"
+	"fmt"
+	"sort"
+)
+
+// ErrBreakpointMismatch is returned by InstalledAddrs when the breakpoint
+// instructions found in the memory of the target don't match the
+// breakpoints tracked by the debugger.
+type ErrBreakpointMismatch struct {
+	// Missing are the addresses of tracked breakpoints whose breakpoint
+	// instruction is not in memory.
+	Missing []uint64
+	// Unexpected are the addresses of breakpoint instructions in the text
+	// section that don't correspond to any tracked breakpoint.
+	Unexpected []uint64
+}
+
+func (err ErrBreakpointMismatch) Error() string {
+	return fmt.Sprintf("breakpoints don't match the memory of the target: missing %#x, unexpected %#x", err.Missing, err.Unexpected)
+}
+
+// InstalledAddrs returns the sorted addresses of the tracked breakpoints
+// whose breakpoint instruction is currently written in the memory of the
+// target.
+// The text section of the executable is compared with its contents on
+// disk so that breakpoint instructions written behind the back of the
+// debugger are also found, if the memory doesn't match the tracked
+// breakpoints ErrBreakpointMismatch is returned along with the installed
+// addresses.
+func (dbp *Process) InstalledAddrs() ([]uint64, error) {
+	if _, err := dbp.Valid(); err != nil {
+		return nil, err
+	}
+	image := dbp.bi.Images[0]
+	exe, err := elf.Open(image.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer exe.Close()
+	text := exe.Section(".text")
+	if text == nil {
+		return nil, fmt.Errorf("could not find .text section of %s", image.Path)
+	}
+	orig, err := text.Data()
+	if err != nil {
+		return nil, err
+	}
+	start := text.Addr + image.StaticBase
+	mem := make([]byte, len(orig))
+	if _, err := dbp.currentThread.ReadMemory(mem, uintptr(start)); err != nil {
+		return nil, err
+	}
+
+	bpinstr := dbp.bi.Arch.BreakpointInstruction()
+	isBreakpoint := func(addr uint64) (bool, error) {
+		if addr >= start && addr-start+uint64(len(bpinstr)) <= uint64(len(mem)) {
+			return bytes.HasPrefix(mem[addr-start:], bpinstr), nil
+		}
+		// breakpoints outside the text section of the executable, for
+		// example in shared libraries, are read one by one.
+		buf := make([]byte, len(bpinstr))
+		if _, err := dbp.currentThread.ReadMemory(buf, uintptr(addr)); err != nil {
+			return false, err
+		}
+		return bytes.Equal(buf, bpinstr), nil
+	}
+
+	var installed []uint64
+	var mismatch ErrBreakpointMismatch
+	for addr := range dbp.breakpoints.M {
+		ok, err := isBreakpoint(addr)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			installed = append(installed, addr)
+		} else {
+			mismatch.Missing = append(mismatch.Missing, addr)
+		}
+	}
+	for off := 0; off+len(bpinstr) <= len(mem); off++ {
+		addr := start + uint64(off)
+		if !bytes.HasPrefix(mem[off:], bpinstr) || bytes.HasPrefix(orig[off:], bpinstr) {
+			continue
+		}
+		if _, tracked := dbp.breakpoints.M[addr]; !tracked {
+			mismatch.Unexpected = append(mismatch.Unexpected, addr)
+		}
+	}
+
+	sortAddrs := func(addrs []uint64) {
+		sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+	}
+	sortAddrs(installed)
+	if len(mismatch.Missing) > 0 || len(mismatch.Unexpected) > 0 {
+		sortAddrs(mismatch.Missing)
+		sortAddrs(mismatch.Unexpected)
+		return installed, mismatch
+	}
+	return installed, nil
+}
@@ -0,0 +1,382 @@
+package native
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	sys "golang.org/x/sys/unix"
+
+	"github.com/go-delve/delve/pkg/proc"
+)
+
+// TargetGroupEventKind is the kind of a TargetGroupEvent.
+type TargetGroupEventKind uint8
+
+const (
+	// ProcessAdded is sent when a process of the group creates a new process
+	// with fork.
+	ProcessAdded TargetGroupEventKind = iota
+	// ProcessRemoved is sent when a process leaves the group, because it
+	// exited or because it replaced its executable with exec.
+	ProcessRemoved
+)
+
+// TargetGroupEvent describes a change in the processes of a TargetGroup.
+type TargetGroupEvent struct {
+	Kind    TargetGroupEventKind
+	Process *Process
+}
+
+// targetGroupEventsBuffer is the size of the buffer of the events channel
+// of a TargetGroup.
+const targetGroupEventsBuffer = 32
+
+// TargetGroup is a group of processes debugged together: a process and
+// all the processes it (and they) create with fork, which are traced
+// automatically and inherit the breakpoints of their parent.
+// Processes that replace their executable with exec are detached.
+type TargetGroup struct {
+	procs  []*Process
+	events chan TargetGroupEvent
+
+	// pending contains wait statuses received while waiting for a
+	// different process of the group.
+	pending []pendingWaitStatus
+	// orphans contains the initial stop of new processes, received before
+	// the fork event of their parent.
+	orphans map[int]*sys.WaitStatus
+}
+
+type pendingWaitStatus struct {
+	dbp    *Process
+	wpid   int
+	status *sys.WaitStatus
+}
+
+// NewTargetGroup creates a group containing dbp and starts tracing the
+// processes created by dbp, which must be stopped.
+func NewTargetGroup(dbp *Process) (*TargetGroup, error) {
+	if _, err := dbp.Valid(); err != nil {
+		return nil, err
+	}
+	if dbp.os.group != nil {
+		return nil, errors.New("process already belongs to a group")
+	}
+	g := &TargetGroup{
+		procs:   []*Process{dbp},
+		events:  make(chan TargetGroupEvent, targetGroupEventsBuffer),
+		orphans: make(map[int]*sys.WaitStatus),
+	}
+	dbp.os.group = g
+	users := 1
+	dbp.ptraceUsers = &users
+	options := dbp.ptraceOptions()
+	for _, th := range dbp.threads {
+		var err error
+		dbp.execPtraceFunc(func() { err = sys.PtraceSetOptions(th.ID, options) })
+		if err != nil {
+			return nil, fmt.Errorf("could not set options for thread %d: %v", th.ID, err)
+		}
+	}
+	return g, nil
+}
+
+// Processes returns the processes of the group, the first one is the
+// process the group was created with (until it exits).
+func (g *TargetGroup) Processes() []*Process {
+	return append([]*Process(nil), g.procs...)
+}
+
+// Events returns a channel where the processes being added to and removed
+// from the group are reported. Events are dropped if they aren't received
+// and the buffer of the channel is full.
+func (g *TargetGroup) Events() <-chan TargetGroupEvent {
+	return g.events
+}
+
+func (g *TargetGroup) sendEvent(kind TargetGroupEventKind, dbp *Process) {
+	select {
+	case g.events <- TargetGroupEvent{Kind: kind, Process: dbp}:
+	default:
+	}
+}
+
+// Continue resumes all the processes of the group until one of them stops,
+// then stops all the other processes. Returns the process that stopped.
+// Processes that exit are removed from the group, the exit of the last
+// process is returned as an error.
+func (g *TargetGroup) Continue() (*Process, error) {
+	for {
+		if len(g.procs) == 0 {
+			return nil, proc.ErrProcessExited{}
+		}
+		for _, dbp := range g.procs {
+			if g.hasPending(dbp) {
+				// dbp was running while another process of the group was
+				// waited on, its wait statuses will be handled first.
+				continue
+			}
+			if err := dbp.resume(); err != nil {
+				return nil, err
+			}
+			dbp.common.ClearAllGCache()
+			for _, th := range dbp.threads {
+				th.CurrentBreakpoint.Clear()
+			}
+		}
+
+		dbp, trapthread, err := g.wait()
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range g.procs {
+			var th *Thread
+			if p == dbp {
+				th = trapthread
+			}
+			if err := p.stop(th); err != nil {
+				return nil, err
+			}
+		}
+		if bp := trapthread.CurrentBreakpoint; bp.Breakpoint != nil && !bp.Active {
+			// breakpoint whose condition isn't met
+			continue
+		}
+		dbp.SwitchThread(trapthread.ID)
+		return dbp, nil
+	}
+}
+
+// wait waits for a thread of any process of the group to stop.
+func (g *TargetGroup) wait() (*Process, *Thread, error) {
+	for {
+		var (
+			dbp    *Process
+			wpid   int
+			status *sys.WaitStatus
+		)
+		if len(g.pending) > 0 {
+			dbp, wpid, status = g.pending[0].dbp, g.pending[0].wpid, g.pending[0].status
+			g.pending = g.pending[1:]
+		} else {
+			var err error
+			wpid, status, err = g.procs[0].wait(-1, 0)
+			if err != nil {
+				return nil, nil, fmt.Errorf("wait err %s", err)
+			}
+			if wpid == 0 {
+				continue
+			}
+			dbp = g.owner(wpid)
+			if dbp == nil {
+				if !status.Exited() && !status.Signaled() {
+					g.orphans[wpid] = status
+				}
+				continue
+			}
+		}
+		th, done, err := dbp.handleWaitStatus(wpid, status, false)
+		if err != nil {
+			switch err.(type) {
+			case proc.ErrProcessExited, proc.ProcessDetachedError:
+				if len(g.procs) > 0 {
+					continue
+				}
+			}
+			return nil, nil, err
+		}
+		if done && th != nil {
+			return dbp, th, nil
+		}
+	}
+}
+
+// Detach detaches from all the processes of the group, optionally killing
+// them. The processes created with fork are detached first.
+func (g *TargetGroup) Detach(kill bool) error {
+	for i := len(g.procs) - 1; i >= 0; i-- {
+		dbp := g.procs[i]
+		if dbp.exited {
+			continue
+		}
+		if err := dbp.stop(nil); err != nil {
+			if _, isexit := err.(proc.ErrProcessExited); isexit {
+				continue
+			}
+			return err
+		}
+		if !dbp.forked {
+			continue
+		}
+		if err := dbp.Detach(false); err != nil {
+			return err
+		}
+		if kill {
+			sys.Kill(dbp.pid, sys.SIGKILL)
+		}
+	}
+	for _, dbp := range g.procs {
+		if !dbp.forked && !dbp.exited {
+			if err := dbp.Detach(kill); err != nil {
+				return err
+			}
+		}
+	}
+	g.procs = nil
+	return nil
+}
+
+// owner returns the process of the group that thread wpid belongs to.
+func (g *TargetGroup) owner(wpid int) *Process {
+	for _, dbp := range g.procs {
+		if _, ok := dbp.threads[wpid]; ok {
+			return dbp
+		}
+	}
+	tgid := threadGroupOf(wpid)
+	for _, dbp := range g.procs {
+		if dbp.pid == tgid {
+			return dbp
+		}
+	}
+	return nil
+}
+
+// dispatch is called by dbp when it receives the wait status of a thread it
+// doesn't know about, if the thread belongs to another process of the
+// group the status is saved for that process and dispatch returns true.
+func (g *TargetGroup) dispatch(dbp *Process, wpid int, status *sys.WaitStatus) bool {
+	owner := g.owner(wpid)
+	switch {
+	case owner == dbp:
+		return false
+	case owner != nil:
+		g.pending = append(g.pending, pendingWaitStatus{owner, wpid, status})
+		return true
+	case !status.Exited() && !status.Signaled() && threadGroupOf(wpid) == wpid:
+		// probably a new process that we haven't seen the fork event of
+		g.orphans[wpid] = status
+		return true
+	}
+	return false
+}
+
+func (g *TargetGroup) hasPending(dbp *Process) bool {
+	for i := range g.pending {
+		if g.pending[i].dbp == dbp {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *TargetGroup) popPending(dbp *Process) (pendingWaitStatus, bool) {
+	for i := range g.pending {
+		if g.pending[i].dbp == dbp {
+			ev := g.pending[i]
+			g.pending = append(g.pending[:i], g.pending[i+1:]...)
+			return ev, true
+		}
+	}
+	return pendingWaitStatus{}, false
+}
+
+// addChild adds to the group the process pid, created by parent with fork.
+// The new process shares the goroutine handling ptrace calls and the binary
+// info of its parent and starts with a copy of its breakpoints.
+func (g *TargetGroup) addChild(parent *Process, pid int, halt bool) error {
+	if _, ok := g.orphans[pid]; ok {
+		delete(g.orphans, pid)
+	} else if _, _, err := parent.waitFast(pid); err != nil {
+		return err
+	}
+
+	child := &Process{
+		pid:            pid,
+		threads:        make(map[int]*Thread),
+		breakpoints:    parent.breakpoints.Copy(),
+		common:         proc.NewCommonProcess(true),
+		os:             &OSProcessDetails{comm: parent.os.comm, group: g},
+		ptraceChan:     parent.ptraceChan,
+		ptraceDoneChan: parent.ptraceDoneChan,
+		bi:             parent.bi,
+		log:            parent.log,
+		memCache:       newMemCache(),
+		forked:         true,
+		ptraceUsers:    parent.ptraceUsers,
+	}
+	*child.ptraceUsers++
+	th, err := child.addThread(pid, false)
+	if err != nil {
+		child.postExit()
+		return err
+	}
+	g.procs = append(g.procs, child)
+	g.sendEvent(ProcessAdded, child)
+	if halt {
+		th.os.running = false
+		return nil
+	}
+	return th.resume()
+}
+
+// removeFromGroup removes dbp from its group, after it exited or was
+// detached.
+func (dbp *Process) removeFromGroup() {
+	g := dbp.os.group
+	if g == nil {
+		return
+	}
+	for i := range g.procs {
+		if g.procs[i] == dbp {
+			g.procs = append(g.procs[:i], g.procs[i+1:]...)
+			g.sendEvent(ProcessRemoved, dbp)
+			break
+		}
+	}
+	pending := g.pending[:0]
+	for _, ev := range g.pending {
+		if ev.dbp != dbp {
+			pending = append(pending, ev)
+		}
+	}
+	g.pending = pending
+}
+
+// threadGroupOf returns the process (thread group) that thread tid belongs
+// to, or -1 if it can not be determined.
+func threadGroupOf(tid int) int {
+	return procStatusField(tid, "Tgid")
+}
+
+// tracerPid returns the ID of the process tracing tid, 0 if it isn't
+// traced, or -1 if it can not be determined.
+func tracerPid(tid int) int {
+	return procStatusField(tid, "TracerPid")
+}
+
+// procStatusField returns the value of the numeric field name of
+// /proc/<tid>/status, or -1 if it can not be read.
+func procStatusField(tid int, name string) int {
+	fh, err := os.Open(fmt.Sprintf("/proc/%d/status", tid))
+	if err != nil {
+		return -1
+	}
+	defer fh.Close()
+	scan := bufio.NewScanner(fh)
+	for scan.Scan() {
+		line := scan.Text()
+		if strings.HasPrefix(line, name+":") {
+			n, err := strconv.Atoi(strings.TrimSpace(line[len(name)+1:]))
+			if err != nil {
+				return -1
+			}
+			return n
+		}
+	}
+	return -1
+}
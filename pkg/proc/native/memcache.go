@@ -0,0 +1,83 @@
+package native
+
+// memCacheChunkSize is the granularity of the memory cache, reads are
+// rounded to multiples of this size.
+const memCacheChunkSize = 64
+
+// memCache memoizes reads of the target's memory while the target is
+// stopped. It must be invalidated every time any thread of the target is
+// resumed, since the target could then modify its own memory.
+type memCache struct {
+	chunks map[uintptr][]byte
+}
+
+func newMemCache() *memCache {
+	return &memCache{chunks: make(map[uintptr][]byte)}
+}
+
+// read reads len(data) bytes at addr into data, using cached chunks when
+// possible. Missing chunks are read with readfn, consecutive missing
+// chunks are fetched with a single call to readfn.
+func (c *memCache) read(data []byte, addr uintptr, readfn func(buf []byte, addr uintptr) error) error {
+	start := addr &^ (memCacheChunkSize - 1)
+	end := (addr + uintptr(len(data)) + memCacheChunkSize - 1) &^ (memCacheChunkSize - 1)
+	if end <= start {
+		// the range wraps around the end of the address space
+		return readfn(data, addr)
+	}
+
+	for chunkAddr := start; chunkAddr < end; {
+		if _, cached := c.chunks[chunkAddr]; cached {
+			chunkAddr += memCacheChunkSize
+			continue
+		}
+		missingEnd := chunkAddr + memCacheChunkSize
+		for missingEnd < end {
+			if _, cached := c.chunks[missingEnd]; cached {
+				break
+			}
+			missingEnd += memCacheChunkSize
+		}
+		buf := make([]byte, missingEnd-chunkAddr)
+		if err := readfn(buf, chunkAddr); err != nil {
+			// The rounded up range could extend into unmapped memory, read
+			// exactly what was requested without caching it.
+			return readfn(data, addr)
+		}
+		for off := uintptr(0); off < uintptr(len(buf)); off += memCacheChunkSize {
+			c.chunks[chunkAddr+off] = buf[off : off+memCacheChunkSize]
+		}
+		chunkAddr = missingEnd
+	}
+
+	for n := 0; n < len(data); {
+		cur := addr + uintptr(n)
+		chunkAddr := cur &^ (memCacheChunkSize - 1)
+		n += copy(data[n:], c.chunks[chunkAddr][cur-chunkAddr:])
+	}
+	return nil
+}
+
+// write updates the cached chunks overlapping the memory written at addr.
+func (c *memCache) write(addr uintptr, data []byte) {
+	start := addr &^ (memCacheChunkSize - 1)
+	end := addr + uintptr(len(data))
+	for chunkAddr := start; chunkAddr < end; chunkAddr += memCacheChunkSize {
+		chunk, cached := c.chunks[chunkAddr]
+		if !cached {
+			continue
+		}
+		if chunkAddr < addr {
+			copy(chunk[addr-chunkAddr:], data)
+		} else {
+			copy(chunk, data[chunkAddr-addr:])
+		}
+	}
+}
+
+// invalidate discards all cached memory.
+func (c *memCache) invalidate() {
+	if len(c.chunks) > 0 {
+		c.chunks = make(map[uintptr][]byte)
+	}
+}
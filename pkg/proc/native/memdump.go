@@ -0,0 +1,125 @@
+package native
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// memoryDumpMagic is written at the beginning of memory dumps produced by
+// DumpMemory.
+const memoryDumpMagic = "DLVMEMDUMP1\n"
+
+// MemoryMapEntry describes one memory mapping of the target.
+type MemoryMapEntry struct {
+	Addr, Size uint64
+
+	Read, Write, Exec bool
+
+	Offset   uint64 // Offset of the mapping in the mapped file
+	Filename string // Name of the mapped file, or a pseudo-path like [heap], empty for anonymous mappings
+}
+
+// MemoryDumpRegion is a region of memory read from a memory dump.
+type MemoryDumpRegion struct {
+	MemoryMapEntry
+	Data []byte
+}
+
+// A memory dump is the string memoryDumpMagic followed by a sequence of
+// regions, each region is a header, encoded as:
+//
+//	addr     uint64
+//	size     uint64
+//	offset   uint64
+//	perms    uint8  (bit 0 read, bit 1 write, bit 2 exec)
+//	namelen  uint16
+//	name     [namelen]byte
+//
+// followed by size bytes of memory contents. Integers are little endian.
+
+const (
+	memoryDumpRead = 1 << iota
+	memoryDumpWrite
+	memoryDumpExec
+)
+
+func writeMemoryDumpRegion(w io.Writer, m *MemoryMapEntry, data []byte) error {
+	if len(m.Filename) > 0xffff {
+		return fmt.Errorf("file name of mapping at %#x too long", m.Addr)
+	}
+	var perms uint8
+	if m.Read {
+		perms |= memoryDumpRead
+	}
+	if m.Write {
+		perms |= memoryDumpWrite
+	}
+	if m.Exec {
+		perms |= memoryDumpExec
+	}
+	hdr := make([]byte, 0, 8*3+1+2+len(m.Filename))
+	hdr = appendUint64(hdr, m.Addr)
+	hdr = appendUint64(hdr, uint64(len(data)))
+	hdr = appendUint64(hdr, m.Offset)
+	hdr = append(hdr, perms, byte(len(m.Filename)), byte(len(m.Filename)>>8))
+	hdr = append(hdr, m.Filename...)
+	if _, err := w.Write(hdr); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+func appendUint64(buf []byte, n uint64) []byte {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], n)
+	return append(buf, b[:]...)
+}
+
+// ReadMemoryDump reads a memory dump produced by DumpMemory.
+func ReadMemoryDump(r io.Reader) ([]MemoryDumpRegion, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(memoryDumpMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != memoryDumpMagic {
+		return nil, errors.New("not a memory dump")
+	}
+
+	var regions []MemoryDumpRegion
+	for {
+		var hdr struct {
+			Addr, Size, Offset uint64
+			Perms              uint8
+			NameLen            uint16
+		}
+		err := binary.Read(br, binary.LittleEndian, &hdr)
+		if err == io.EOF {
+			return regions, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read region header: %v", err)
+		}
+		name := make([]byte, hdr.NameLen)
+		if _, err := io.ReadFull(br, name); err != nil {
+			return nil, fmt.Errorf("could not read name of region at %#x: %v", hdr.Addr, err)
+		}
+		data := make([]byte, hdr.Size)
+		if _, err := io.ReadFull(br, data); err != nil {
+			return nil, fmt.Errorf("could not read contents of region at %#x: %v", hdr.Addr, err)
+		}
+		regions = append(regions, MemoryDumpRegion{
+			MemoryMapEntry: MemoryMapEntry{
+				Addr:     hdr.Addr,
+				Size:     hdr.Size,
+				Read:     hdr.Perms&memoryDumpRead != 0,
+				Write:    hdr.Perms&memoryDumpWrite != 0,
+				Exec:     hdr.Perms&memoryDumpExec != 0,
+				Offset:   hdr.Offset,
+				Filename: string(name),
+			},
+			Data: data,
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package native
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-delve/delve/pkg/proc"
+)
+
+// MemoryMaps returns the memory mappings of the target, as listed by
+// /proc/<pid>/maps.
+func (dbp *Process) MemoryMaps() ([]MemoryMapEntry, error) {
+	if _, err := dbp.Valid(); err != nil {
+		return nil, err
+	}
+	fh, err := os.Open(fmt.Sprintf("/proc/%d/maps", dbp.pid))
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	var r []MemoryMapEntry
+	scan := bufio.NewScanner(fh)
+	for scan.Scan() {
+		m, err := parseMemoryMapLine(scan.Text())
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, m)
+	}
+	return r, scan.Err()
+}
+
+// ErrAddressNotMapped is returned by ReadMemory and WriteMemory, when
+// address validation is enabled, if the accessed range is not entirely
+// covered by memory mappings of the target.
+type ErrAddressNotMapped struct {
+	Addr uint64
+}
+
+func (err ErrAddressNotMapped) Error() string {
+	return fmt.Sprintf("address %#x is not mapped", err.Addr)
+}
+
+// ValidAddress returns true if addr belongs to a memory mapping of the
+// target.
+func (dbp *Process) ValidAddress(addr uint64) bool {
+	return dbp.checkMapped(uintptr(addr), 1) == nil
+}
+
+// SetValidateAddresses enables or disables the validation of the ranges
+// accessed by ReadMemory and WriteMemory against the memory mappings of
+// the target. Validation reads /proc/<pid>/maps on every access that is
+// not served by the memory cache, it's disabled by default.
+func (dbp *Process) SetValidateAddresses(enabled bool) {
+	dbp.validateAddresses = enabled
+}
+
+// checkMapped returns ErrAddressNotMapped if the size bytes starting at
+// addr are not covered by memory mappings of the target.
+func (dbp *Process) checkMapped(addr uintptr, size int) error {
+	maps, err := dbp.MemoryMaps()
+	if err != nil {
+		return err
+	}
+	start, end := uint64(addr), uint64(addr)+uint64(size)
+	if end < start {
+		return ErrAddressNotMapped{Addr: start}
+	}
+	// mappings are listed in ascending address order
+	for i := range maps {
+		m := &maps[i]
+		if start < m.Addr {
+			break
+		}
+		if start < m.Addr+m.Size {
+			start = m.Addr + m.Size
+			if start >= end {
+				return nil
+			}
+		}
+	}
+	return ErrAddressNotMapped{Addr: start}
+}
+
+// MemoryRegion describes the memory mapping containing addr: it returns
+// the name of the mapped file or pseudo-file (for example "[stack]"),
+// "heap" for anonymous writable mappings, where the Go runtime allocates
+// the heap and the stacks of goroutines, or an empty string.
+// The memory mappings are only read once every time the target stops.
+func (t *Thread) MemoryRegion(addr uint64) string {
+	if t.dbp.os.memoryMaps == nil {
+		maps, err := t.dbp.MemoryMaps()
+		if err != nil {
+			return ""
+		}
+		t.dbp.os.memoryMaps = maps
+	}
+	maps := t.dbp.os.memoryMaps
+	for i := range maps {
+		m := &maps[i]
+		if addr < m.Addr || addr >= m.Addr+m.Size {
+			continue
+		}
+		switch {
+		case m.Filename != "":
+			return filepath.Base(m.Filename)
+		case m.Write:
+			return "heap"
+		}
+		return ""
+	}
+	return ""
+}
+
+// parseMemoryMapLine parses a line of /proc/<pid>/maps, for example:
+//
+//	00400000-00452000 r-xp 00000000 08:02 173521      /usr/bin/dbus-daemon
+func parseMemoryMapLine(line string) (MemoryMapEntry, error) {
+	var m MemoryMapEntry
+	fields := strings.Fields(line)
+	if len(fields) < 5 {
+		return m, fmt.Errorf("malformed memory map entry %q", line)
+	}
+	dash := strings.Index(fields[0], "-")
+	if dash < 0 || len(fields[1]) < 3 {
+		return m, fmt.Errorf("malformed memory map entry %q", line)
+	}
+	start, err := strconv.ParseUint(fields[0][:dash], 16, 64)
+	if err != nil {
+		return m, fmt.Errorf("malformed memory map entry %q: %v", line, err)
+	}
+	end, err := strconv.ParseUint(fields[0][dash+1:], 16, 64)
+	if err != nil {
+		return m, fmt.Errorf("malformed memory map entry %q: %v", line, err)
+	}
+	off, err := strconv.ParseUint(fields[2], 16, 64)
+	if err != nil {
+		return m, fmt.Errorf("malformed memory map entry %q: %v", line, err)
+	}
+	m.Addr = start
+	m.Size = end - start
+	m.Read = fields[1][0] == 'r'
+	m.Write = fields[1][1] == 'w'
+	m.Exec = fields[1][2] == 'x'
+	m.Offset = off
+	if len(fields) > 5 {
+		m.Filename = strings.Join(fields[5:], " ")
+	}
+	return m, nil
+}
+
+// DumpMemory writes the contents of every readable memory mapping of the
+// target to w, in the format read by ReadMemoryDump.
+// Mappings of devices and mappings that can not be read (for example
+// [vvar]) are skipped and a warning is logged.
+func (dbp *Process) DumpMemory(w io.Writer) error {
+	if _, err := dbp.Valid(); err != nil {
+		return err
+	}
+	if dbp.common.Running() {
+		return proc.ErrProcessRunning
+	}
+	maps, err := dbp.MemoryMaps()
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, memoryDumpMagic); err != nil {
+		return err
+	}
+	thread := dbp.currentThread
+	for i := range maps {
+		m := &maps[i]
+		if !m.Read {
+			continue
+		}
+		if strings.HasPrefix(m.Filename, "/dev/") {
+			dbp.log.Warnf("skipping device mapping %#x-%#x %s", m.Addr, m.Addr+m.Size, m.Filename)
+			continue
+		}
+		data := make([]byte, m.Size)
+		// the memory cache is bypassed, it would only end up holding a copy
+		// of the whole address space of the target.
+		if err := thread.readMemory(data, uintptr(m.Addr)); err != nil {
+			if _, err := dbp.Valid(); err != nil {
+				return err
+			}
+			dbp.log.Warnf("skipping mapping %#x-%#x %s: %v", m.Addr, m.Addr+m.Size, m.Filename, err)
+			continue
+		}
+		if err := writeMemoryDumpRegion(w, m, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,14 +1,23 @@
 package native
 
 import (
+	"errors"
 	"fmt"
 	"go/ast"
 	"runtime"
 	"sync"
 
+	"github.com/sirupsen/logrus"
+
+	"github.com/go-delve/delve/pkg/logflags"
 	"github.com/go-delve/delve/pkg/proc"
 )
 
+// ErrOperationTimeout is returned by ContinueOnce when the target does not
+// stop before the deadline set with SetOperationTimeout (linux only), the
+// target is left running.
+var ErrOperationTimeout = errors.New("timed out waiting for the target to stop")
+
 // Process represents all of the information the debugger
 // is holding onto regarding the process we are debugging.
 type Process struct {
@@ -41,6 +50,28 @@ type Process struct {
 	manualStopRequested bool
 
 	exited, detached bool
+
+	// log is used to log the ptrace calls made on the target process
+	log *logrus.Entry
+
+	// memCache caches memory reads while the process is stopped, on linux
+	// it saves PtracePeekData calls.
+	memCache *memCache
+	// memCacheDisabled is true if memory reads should not be cached, see
+	// SetMemoryCache.
+	memCacheDisabled bool
+
+	// validateAddresses is true if memory accesses should be checked
+	// against the memory mappings of the target, see SetValidateAddresses.
+	validateAddresses bool
+
+	// forked is true if this process was created with fork by another
+	// process of its TargetGroup.
+	forked bool
+	// ptraceUsers, if not nil, counts the processes sharing the goroutine
+	// handling ptrace calls and the binary info of this process, which are
+	// released when the last one exits.
+	ptraceUsers *int
 }
 
 // New returns an initialized Process struct. Before returning,
@@ -57,11 +88,28 @@ func New(pid int) *Process {
 		ptraceChan:     make(chan func()),
 		ptraceDoneChan: make(chan interface{}),
 		bi:             proc.NewBinaryInfo(runtime.GOOS, runtime.GOARCH),
+		log:            logflags.PtraceLogger(),
+		memCache:       newMemCache(),
 	}
 	go dbp.handlePtraceFuncs()
 	return dbp
 }
 
+// SetLogger replaces the logger used to log the ptrace calls made on the
+// target process, by default logs are only produced when the "ptrace" log
+// output is enabled.
+func (dbp *Process) SetLogger(logger *logrus.Entry) {
+	dbp.log = logger
+}
+
+// SetMemoryCache enables or disables the cache of the memory reads made
+// while the target is stopped, it's enabled by default. The cache is only
+// used on linux.
+func (dbp *Process) SetMemoryCache(enabled bool) {
+	dbp.memCacheDisabled = !enabled
+	dbp.memCache.invalidate()
+}
+
 // BinInfo will return the binary info struct associated with this process.
 func (dbp *Process) BinInfo() *proc.BinaryInfo {
 	return dbp.bi
@@ -227,6 +275,9 @@ func (dbp *Process) writeBreakpoint(addr uint64) (string, int, *proc.Function, [
 // SetBreakpoint sets a breakpoint at addr, and stores it in the process wide
 // break point table.
 func (dbp *Process) SetBreakpoint(addr uint64, kind proc.BreakpointKind, cond ast.Expr) (*proc.Breakpoint, error) {
+	if dbp.common.Running() {
+		return nil, proc.ErrProcessRunning
+	}
 	return dbp.breakpoints.Set(addr, kind, cond, dbp.writeBreakpoint)
 }
 
@@ -235,6 +286,9 @@ func (dbp *Process) ClearBreakpoint(addr uint64) (*proc.Breakpoint, error) {
 	if dbp.exited {
 		return nil, &proc.ErrProcessExited{Pid: dbp.Pid()}
 	}
+	if dbp.common.Running() {
+		return nil, proc.ErrProcessRunning
+	}
 	return dbp.breakpoints.Clear(addr, dbp.currentThread.ClearBreakpoint)
 }
 
@@ -245,8 +299,13 @@ func (dbp *Process) ContinueOnce() (proc.Thread, error) {
 		return nil, &proc.ErrProcessExited{Pid: dbp.Pid()}
 	}
 
-	if err := dbp.resume(); err != nil {
-		return nil, err
+	// after ErrOperationTimeout the target is still running, it's waited
+	// for again without resuming it.
+	if !dbp.common.Running() {
+		if err := dbp.resume(); err != nil {
+			return nil, err
+		}
+		dbp.common.SetRunning(true)
 	}
 
 	dbp.common.ClearAllGCache()
@@ -260,13 +319,66 @@ func (dbp *Process) ContinueOnce() (proc.Thread, error) {
 	}
 
 	trapthread, err := dbp.trapWait(-1)
+	if err == ErrOperationTimeout {
+		return nil, err
+	}
+	dbp.common.SetRunning(false)
 	if err != nil {
 		return nil, err
 	}
 	if err := dbp.stop(trapthread); err != nil {
 		return nil, err
 	}
-	return trapthread, err
+	resume, err := dbp.clearWatchpointsOutOfScope(trapthread)
+	if err != nil {
+		return nil, err
+	}
+	if resume {
+		// the only watchpoints trapthread stopped at were on variables that
+		// went out of scope.
+		return dbp.ContinueOnce()
+	}
+	return trapthread, nil
+}
+
+// ContinueIgnoringBreakpoints resumes the target once with all its
+// breakpoints removed from memory, they are written back when the target
+// stops again, for example because of a signal or a manual stop request.
+// Threads stopped at a breakpoint are resumed without stepping over it and
+// no breakpoint is reported as hit by this stop.
+func (dbp *Process) ContinueIgnoringBreakpoints() (err error) {
+	if _, err := dbp.Valid(); err != nil {
+		return err
+	}
+	bps := dbp.breakpoints.M
+	for _, bp := range bps {
+		if err := dbp.currentThread.ClearBreakpoint(bp); err != nil {
+			return err
+		}
+	}
+	// while the breakpoints are removed stops at their addresses must not
+	// be matched to them.
+	dbp.breakpoints.M = map[uint64]*proc.Breakpoint{}
+	defer func() {
+		dbp.breakpoints.M = bps
+		if dbp.exited {
+			return
+		}
+		for _, bp := range bps {
+			if werr := dbp.writeSoftwareBreakpoint(dbp.currentThread, bp.Addr); werr != nil && err == nil {
+				err = fmt.Errorf("could not restore breakpoint at %#x: %v", bp.Addr, werr)
+			}
+		}
+	}()
+	for _, th := range dbp.threads {
+		th.CurrentBreakpoint.Clear()
+	}
+
+	trapthread, err := dbp.ContinueOnce()
+	if err != nil {
+		return err
+	}
+	return dbp.SwitchThread(trapthread.ThreadID())
 }
 
 // StepInstruction will continue the current thread for exactly
@@ -405,6 +517,12 @@ func (dbp *Process) execPtraceFunc(fn func()) {
 
 func (dbp *Process) postExit() {
 	dbp.exited = true
+	if dbp.ptraceUsers != nil {
+		*dbp.ptraceUsers--
+		if *dbp.ptraceUsers > 0 {
+			return
+		}
+	}
 	close(dbp.ptraceChan)
 	close(dbp.ptraceDoneChan)
 	dbp.bi.Close()
@@ -459,6 +459,10 @@ func (dbp *Process) detach(kill bool) error {
 	return PtraceDetach(dbp.pid, 0)
 }
 
+func (dbp *Process) clearWatchpointsOutOfScope(trapthread *Thread) (bool, error) {
+	return false, nil
+}
+
 func (dbp *Process) EntryPoint() (uint64, error) {
 	//TODO(aarzilli): implement this
 	return 0, nil
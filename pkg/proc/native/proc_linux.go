@@ -41,6 +41,65 @@ const (
 // process details.
 type OSProcessDetails struct {
 	comm string
+
+	// watchpoints are the hardware watchpoints set with SetWatchpoint,
+	// indexed by debug register.
+	watchpoints [numWatchpoints]*watchpoint
+
+	// group is the TargetGroup this process belongs to, if any.
+	group *TargetGroup
+
+	// stopAtClone is set by NextThreadEvent to stop the process when one
+	// of its threads creates a new thread, which is saved in threadEvent.
+	stopAtClone bool
+	threadEvent *ThreadEvent
+
+	// stopAtSignal is set by ContinueUntilSignal to stop the process when
+	// one of its threads receives one of stopSignals (any signal if it's
+	// empty), the signal is saved in stoppedSignal and the thread that
+	// received it in signalThread.
+	stopAtSignal  bool
+	stopSignals   map[syscall.Signal]bool
+	stoppedSignal syscall.Signal
+	signalThread  *Thread
+
+	// attachedThread is the only traced thread of a process attached with
+	// AttachThread, zero if all threads are traced.
+	attachedThread int
+
+	// tracer, if not nil, replaces sysPtracer, see Process.tracer.
+	tracer ptracer
+
+	// memoryMaps caches the memory mappings read by Thread.MemoryRegion
+	// while the process is stopped.
+	memoryMaps []MemoryMapEntry
+
+	// noProcessVM is true if process_vm_readv and process_vm_writev, which
+	// are much faster than ptrace for large transfers, should not be used
+	// to access the memory of the target. It's set if the kernel does not
+	// implement them.
+	noProcessVM bool
+
+	// waitTimeout is the deadline of the waits for the target to stop,
+	// see SetOperationTimeout, pendingWait is the result of a wait that
+	// timed out and is still in progress.
+	waitTimeout time.Duration
+	pendingWait chan waitResult
+}
+
+// waitResult is the result of a call to wait.
+type waitResult struct {
+	wpid   int
+	status *sys.WaitStatus
+	err    error
+}
+
+// ThreadEvent describes the creation of a thread of the target.
+type ThreadEvent struct {
+	// Parent is the thread that created the new thread.
+	Parent *Thread
+	// Thread is the new thread.
+	Thread *Thread
 }
 
 // Launch creates and begins debugging a new process. First entry in
@@ -58,6 +117,10 @@ func Launch(cmd []string, wd string, foreground bool, debugInfoDirs []string) (*
 		return nil, proc.ErrNotExecutable
 	}
 
+	if err := CheckPtracePermissions(); err != nil {
+		return nil, err
+	}
+
 	if !isatty.IsTerminal(os.Stdin.Fd()) {
 		// exec.(*Process).Start will fail if we try to send a process to
 		// foreground but we are not attached to a terminal.
@@ -86,41 +149,305 @@ func Launch(cmd []string, wd string, foreground bool, debugInfoDirs []string) (*
 	}
 	dbp.pid = process.Process.Pid
 	dbp.childProcess = true
-	_, _, err = dbp.wait(process.Process.Pid, 0)
-	if err != nil {
-		return nil, fmt.Errorf("waiting for target execve failed: %s", err)
+	if err := dbp.waitExecStop(); err != nil {
+		process.Process.Kill()
+		process.Wait()
+		return nil, err
 	}
+	// initialize sets the ptrace options of the process, including
+	// PTRACE_O_EXITKILL, before Launch returns.
 	if err = dbp.initialize(cmd[0], debugInfoDirs); err != nil {
+		if err == proc.ErrNotGoBinary {
+			dbp.Detach(true)
+		}
 		return nil, err
 	}
 	return dbp, nil
 }
 
+// waitExecStop waits for the SIGTRAP that stops a process started with
+// PTRACE_TRACEME after its execve and consumes it, so that the first resume
+// of the process does not report it as a stop.
+func (dbp *Process) waitExecStop() error {
+	_, status, err := dbp.wait(dbp.pid, 0)
+	if err != nil {
+		return fmt.Errorf("waiting for target execve failed: %s", err)
+	}
+	switch {
+	case status == nil || status.Exited() || status.Signaled():
+		return errors.New("waiting for target execve failed: the target exited")
+	case !status.Stopped() || status.StopSignal() != sys.SIGTRAP:
+		return fmt.Errorf("waiting for target execve failed: unexpected stop with signal %v", status.StopSignal())
+	}
+	return nil
+}
+
 // Attach to an existing process with the given PID. Once attached, if
 // the DWARF information cannot be found in the binary, Delve will look
 // for external debug files in the directories passed in.
 func Attach(pid int, debugInfoDirs []string) (*Process, error) {
+	dbp, err := AttachNoWait(pid)
+	if err != nil {
+		return nil, err
+	}
+	_, _, err = dbp.wait(dbp.pid, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := dbp.FinishAttach(debugInfoDirs); err != nil {
+		if err == proc.ErrNotGoBinary {
+			dbp.Detach(false)
+		}
+		return nil, err
+	}
+	return dbp, nil
+}
+
+// AttachNoWait attaches to an existing process with the given PID without
+// waiting for the stop caused by the attach, for callers that run their
+// own wait loop.
+// The caller is responsible for reaping the initial stop of the process
+// (for example calling wait4 on pid with the __WALL flag) and must then
+// call FinishAttach before using the returned Process in any other way.
+func AttachNoWait(pid int) (*Process, error) {
+	if err := CheckPtracePermissions(); err != nil {
+		return nil, err
+	}
+
 	dbp := New(pid)
 	dbp.common = proc.NewCommonProcess(true)
 
 	var err error
-	dbp.execPtraceFunc(func() { err = PtraceAttach(dbp.pid) })
+	dbp.log.Debugf("attach pid=%d", dbp.pid)
+	dbp.execPtraceFunc(func() { err = dbp.tracer().Attach(dbp.pid) })
 	if err != nil {
+		return nil, attachError(dbp.pid, err)
+	}
+	return dbp, nil
+}
+
+// AttachThread attaches to the thread tid of process pid, leaving the
+// other threads of the process running and untraced. The thread is
+// attached with PTRACE_SEIZE and stopped with PTRACE_INTERRUPT which,
+// unlike PTRACE_ATTACH, does not send SIGSTOP to the whole process.
+// The returned Process behaves like a process with a single thread, with
+// the following limitations compared to Attach:
+//   - only the attached thread is stopped, resumed and stepped, the other
+//     threads keep running and can change memory while the thread is
+//     stopped
+//   - threads created by the attached thread are not traced
+//   - breakpoints are written to memory shared by all threads, an untraced
+//     thread hitting one is killed by the SIGTRAP, together with the rest
+//     of the process
+//   - goroutines running on untraced threads are reported as if they were
+//     not running on any thread
+//   - the process is considered exited when the attached thread exits
+func AttachThread(pid, tid int, debugInfoDirs []string) (*Process, error) {
+	if err := CheckPtracePermissions(); err != nil {
 		return nil, err
 	}
-	_, _, err = dbp.wait(dbp.pid, 0)
+	if _, err := os.Stat(fmt.Sprintf("/proc/%d/task/%d", pid, tid)); err != nil {
+		return nil, fmt.Errorf("could not find thread %d of process %d: %v", tid, pid, err)
+	}
+
+	dbp := New(pid)
+	dbp.common = proc.NewCommonProcess(true)
+	dbp.os.attachedThread = tid
+
+	var err error
+	dbp.log.Debugf("seize pid=%d tid=%d", pid, tid)
+	dbp.execPtraceFunc(func() { err = dbp.tracer().Seize(tid, dbp.ptraceOptions()) })
 	if err != nil {
+		dbp.postExit()
+		return nil, attachError(pid, err)
+	}
+	dbp.execPtraceFunc(func() { err = dbp.tracer().Interrupt(tid) })
+	if err == nil {
+		_, _, err = dbp.waitFast(tid)
+	}
+	if err != nil {
+		dbp.execPtraceFunc(func() { dbp.tracer().Detach(tid, 0) })
+		dbp.postExit()
+		return nil, err
+	}
+	if err := dbp.FinishAttach(debugInfoDirs); err != nil {
+		if err == proc.ErrNotGoBinary {
+			dbp.Detach(false)
+		}
 		return nil, err
 	}
+	return dbp, nil
+}
 
-	err = dbp.initialize(findExecutable("", dbp.pid), debugInfoDirs)
+// attachPollInterval is how often AttachTimeout checks whether the process
+// stopped after being attached.
+const attachPollInterval = time.Millisecond
+
+// ErrAttachTimeout is returned by AttachTimeout when the process does not
+// stop in time after being attached.
+var ErrAttachTimeout = errors.New("timed out waiting for the process to stop after attach")
+
+// AttachTimeout is like Attach but waits at most timeout for the stop
+// caused by the attach, which may never come, for example if the process
+// is stuck in an uninterruptible sleep. On timeout ErrAttachTimeout is
+// returned and the process is detached, see abortAttach.
+func AttachTimeout(pid int, timeout time.Duration, debugInfoDirs []string) (*Process, error) {
+	dbp, err := AttachNoWait(pid)
 	if err != nil {
-		dbp.Detach(false)
+		return nil, err
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		wpid, _, err := dbp.wait(dbp.pid, sys.WNOHANG)
+		if err != nil {
+			dbp.abortAttach()
+			return nil, err
+		}
+		if wpid != 0 {
+			break
+		}
+		if !time.Now().Before(deadline) {
+			dbp.abortAttach()
+			return nil, ErrAttachTimeout
+		}
+		time.Sleep(attachPollInterval)
+	}
+	if err := dbp.FinishAttach(debugInfoDirs); err != nil {
+		if err == proc.ErrNotGoBinary {
+			dbp.Detach(false)
+		}
 		return nil, err
 	}
 	return dbp, nil
 }
 
+// abortAttach undoes an attach whose initial stop was not received.
+// A process that isn't stopped can not be detached with PTRACE_DETACH: the
+// SIGSTOP sent by the attach, still pending, is discarded by sending
+// SIGCONT and the process is detached in the background as soon as it
+// stops to report the delivery of SIGCONT.
+func (dbp *Process) abortAttach() {
+	var err error
+	dbp.execPtraceFunc(func() { err = dbp.tracer().Detach(dbp.pid, 0) })
+	if err == nil {
+		dbp.postExit()
+		return
+	}
+	sys.Kill(dbp.pid, sys.SIGCONT)
+	go func() {
+		defer dbp.postExit()
+		for {
+			wpid, status, err := dbp.waitFast(dbp.pid)
+			if err != nil || status.Exited() || status.Signaled() {
+				return
+			}
+			if wpid != dbp.pid || !status.Stopped() {
+				continue
+			}
+			dbp.execPtraceFunc(func() { err = dbp.tracer().Detach(dbp.pid, 0) })
+			if err == nil {
+				return
+			}
+		}
+	}()
+}
+
+// waitForPollInterval is how often WaitFor scans /proc for new processes.
+const waitForPollInterval = time.Millisecond
+
+// WaitFor waits for a process running an executable called name to start
+// and attaches to it as soon as it appears. Name can be either the full
+// path of the executable or its base name. Processes that were already
+// running when WaitFor was called are ignored.
+// An error is returned if no matching process starts within timeout.
+func WaitFor(name string, timeout time.Duration, debugInfoDirs []string) (*Process, error) {
+	preexisting := make(map[int]bool)
+	pids, err := listPids()
+	if err != nil {
+		return nil, err
+	}
+	for _, pid := range pids {
+		preexisting[pid] = true
+	}
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		pids, err := listPids()
+		if err != nil {
+			return nil, err
+		}
+		for _, pid := range pids {
+			if preexisting[pid] || !exeMatches(pid, name) {
+				continue
+			}
+			dbp, err := Attach(pid, debugInfoDirs)
+			if err != nil {
+				return nil, fmt.Errorf("could not attach to %s (pid %d): %v", name, pid, err)
+			}
+			return dbp, nil
+		}
+		time.Sleep(waitForPollInterval)
+	}
+	return nil, fmt.Errorf("timed out waiting for %s to start", name)
+}
+
+// listPids returns the IDs of all processes listed in /proc.
+func listPids() ([]int, error) {
+	d, err := os.Open("/proc")
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+	names, err := d.Readdirnames(-1)
+	if err != nil {
+		return nil, err
+	}
+	pids := make([]int, 0, len(names))
+	for _, name := range names {
+		if pid, err := strconv.Atoi(name); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	return pids, nil
+}
+
+// exeMatches returns true if the executable of process pid is name.
+// Processes that have forked but not yet called exec still report the
+// executable of their parent and will match once exec is called.
+func exeMatches(pid int, name string) bool {
+	exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+	if err != nil {
+		return false
+	}
+	if strings.Contains(name, "/") {
+		return exe == name
+	}
+	return filepath.Base(exe) == name
+}
+
+// FinishAttach completes an attach started by AttachNoWait, it must be
+// called after the initial stop of the process has been consumed. If the
+// DWARF information cannot be found in the binary, Delve will look for
+// external debug files in the directories passed in.
+// If initialization fails the process is detached, unless the error is
+// proc.ErrNotGoBinary: in that case the process stays attached and its
+// threads' registers and memory can still be accessed.
+func (dbp *Process) FinishAttach(debugInfoDirs []string) error {
+	path, err := findExecutable("", dbp.pid)
+	if err != nil {
+		dbp.Detach(false)
+		return err
+	}
+	err = dbp.initialize(path, debugInfoDirs)
+	if err != nil {
+		if err != proc.ErrNotGoBinary {
+			dbp.Detach(false)
+		}
+		return err
+	}
+	return nil
+}
+
 func initialize(dbp *Process) error {
 	comm, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/comm", dbp.pid))
 	if err == nil {
@@ -167,9 +494,22 @@ func (dbp *Process) kill() (err error) {
 }
 
 func (dbp *Process) requestManualStop() (err error) {
+	if dbp.os.attachedThread != 0 {
+		// a signal sent to the process could be delivered to one of its
+		// untraced threads.
+		return sys.Tgkill(dbp.pid, dbp.os.attachedThread, sys.SIGSTOP)
+	}
 	return sys.Kill(dbp.pid, sys.SIGTRAP)
 }
 
+// manualStopPending returns true if a manual stop was requested and not
+// yet cleared by CheckAndClearManualStopRequest.
+func (dbp *Process) manualStopPending() bool {
+	dbp.stopMu.Lock()
+	defer dbp.stopMu.Unlock()
+	return dbp.manualStopRequested
+}
+
 // Attach to a newly created thread, and store that thread in our list of
 // known threads.
 func (dbp *Process) addThread(tid int, attach bool) (*Thread, error) {
@@ -179,7 +519,7 @@ func (dbp *Process) addThread(tid int, attach bool) (*Thread, error) {
 
 	var err error
 	if attach {
-		dbp.execPtraceFunc(func() { err = sys.PtraceAttach(tid) })
+		dbp.execPtraceFunc(func() { err = dbp.tracer().Attach(tid) })
 		if err != nil && err != sys.EPERM {
 			// Do not return err if err == EPERM,
 			// we may already be tracing this thread due to
@@ -196,12 +536,13 @@ func (dbp *Process) addThread(tid int, attach bool) (*Thread, error) {
 		}
 	}
 
-	dbp.execPtraceFunc(func() { err = syscall.PtraceSetOptions(tid, syscall.PTRACE_O_TRACECLONE) })
+	options := dbp.ptraceOptions()
+	dbp.execPtraceFunc(func() { err = syscall.PtraceSetOptions(tid, options) })
 	if err == syscall.ESRCH {
 		if _, _, err = dbp.waitFast(tid); err != nil {
 			return nil, fmt.Errorf("error while waiting after adding thread: %d %s", tid, err)
 		}
-		dbp.execPtraceFunc(func() { err = syscall.PtraceSetOptions(tid, syscall.PTRACE_O_TRACECLONE) })
+		dbp.execPtraceFunc(func() { err = syscall.PtraceSetOptions(tid, options) })
 		if err == syscall.ESRCH {
 			return nil, err
 		}
@@ -215,6 +556,11 @@ func (dbp *Process) addThread(tid int, attach bool) (*Thread, error) {
 		dbp: dbp,
 		os:  new(OSSpecificDetails),
 	}
+	if dbp.hasWatchpoints() {
+		if err := dbp.writeWatchpoints(dbp.threads[tid]); err != nil {
+			return nil, err
+		}
+	}
 	if dbp.currentThread == nil {
 		dbp.SwitchThread(tid)
 	}
@@ -222,6 +568,12 @@ func (dbp *Process) addThread(tid int, attach bool) (*Thread, error) {
 }
 
 func (dbp *Process) updateThreadList() error {
+	if dbp.os.attachedThread != 0 {
+		if _, err := dbp.addThread(dbp.os.attachedThread, false); err != nil {
+			return err
+		}
+		return linutil.ElfUpdateSharedObjects(dbp)
+	}
 	tids, _ := filepath.Glob(fmt.Sprintf("/proc/%d/task/*", dbp.pid))
 	for _, tidpath := range tids {
 		tidstr := filepath.Base(tidpath)
@@ -236,11 +588,31 @@ func (dbp *Process) updateThreadList() error {
 	return linutil.ElfUpdateSharedObjects(dbp)
 }
 
-func findExecutable(path string, pid int) string {
-	if path == "" {
-		path = fmt.Sprintf("/proc/%d/exe", pid)
+// findExecutable returns path or, if path is empty, the path of the
+// executable of process pid, after checking that it can be opened.
+func findExecutable(path string, pid int) (string, error) {
+	if path != "" {
+		return path, nil
+	}
+	path = fmt.Sprintf("/proc/%d/exe", pid)
+	fh, err := os.Open(path)
+	if err != nil {
+		return "", executableError(pid, err)
 	}
-	return path
+	fh.Close()
+	return path, nil
+}
+
+// executableError describes the error returned opening the executable of
+// process pid through /proc.
+func executableError(pid int, err error) error {
+	switch {
+	case os.IsNotExist(err):
+		return fmt.Errorf("could not open executable of process %d: the process has exited", pid)
+	case os.IsPermission(err):
+		return fmt.Errorf("could not open executable of process %d: permission denied", pid)
+	}
+	return fmt.Errorf("could not open executable of process %d: %v", pid, err)
 }
 
 func (dbp *Process) trapWait(pid int) (*Thread, error) {
@@ -249,84 +621,335 @@ func (dbp *Process) trapWait(pid int) (*Thread, error) {
 
 func (dbp *Process) trapWaitInternal(pid int, halt bool) (*Thread, error) {
 	for {
-		wpid, status, err := dbp.wait(pid, 0)
+		wpid, status, err := dbp.nextWaitStatus(pid)
+		if err == ErrOperationTimeout {
+			return nil, err
+		}
 		if err != nil {
 			return nil, fmt.Errorf("wait err %s %d", err, pid)
 		}
 		if wpid == 0 {
 			continue
 		}
-		th, ok := dbp.threads[wpid]
-		if ok {
-			th.Status = (*WaitStatus)(status)
+		// handling the wait status reads and writes the memory of the
+		// target, even if the other threads are still running.
+		running := dbp.common.Running()
+		dbp.common.SetRunning(false)
+		th, done, err := dbp.handleWaitStatus(wpid, status, halt)
+		if done || err != nil {
+			return th, err
 		}
-		if status.Exited() {
-			if wpid == dbp.pid {
-				dbp.postExit()
-				return nil, proc.ErrProcessExited{Pid: wpid, Status: status.ExitStatus()}
-			}
-			delete(dbp.threads, wpid)
-			continue
+		dbp.common.SetRunning(running)
+	}
+}
+
+// nextWaitStatus returns the next wait status for pid, wait statuses of
+// this process received while waiting for another process of its
+// TargetGroup are returned first.
+func (dbp *Process) nextWaitStatus(pid int) (int, *sys.WaitStatus, error) {
+	if dbp.os.group != nil && pid == -1 {
+		if ev, ok := dbp.os.group.popPending(dbp); ok {
+			return ev.wpid, ev.status, nil
 		}
-		if status.StopSignal() == sys.SIGTRAP && status.TrapCause() == sys.PTRACE_EVENT_CLONE {
-			// A traced thread has cloned a new thread, grab the pid and
-			// add it to our list of traced threads.
-			var cloned uint
-			dbp.execPtraceFunc(func() { cloned, err = sys.PtraceGetEventMsg(wpid) })
-			if err != nil {
-				if err == sys.ESRCH {
-					// thread died while we were adding it
-					continue
-				}
-				return nil, fmt.Errorf("could not get event message: %s", err)
+	}
+	if dbp.os.waitTimeout > 0 || dbp.os.pendingWait != nil {
+		return dbp.timedWait(pid)
+	}
+	return dbp.wait(pid, 0)
+}
+
+// SetOperationTimeout sets the deadline of each wait for the target to
+// stop after it has been resumed, or zero (the default) to wait forever.
+// When the deadline expires ErrOperationTimeout is returned and the target
+// is left running, the wait continues in the background and its result is
+// reported by the next wait, for example after RequestManualStop.
+func (dbp *Process) SetOperationTimeout(d time.Duration) {
+	dbp.os.waitTimeout = d
+}
+
+// timedWait is wait(pid, 0) with the deadline set by SetOperationTimeout.
+// The result of a wait that timed out is returned before starting a new
+// one, regardless of pid.
+func (dbp *Process) timedWait(pid int) (int, *sys.WaitStatus, error) {
+	ch := dbp.os.pendingWait
+	if ch == nil {
+		ch = make(chan waitResult, 1)
+		go func() {
+			wpid, status, err := dbp.wait(pid, 0)
+			ch <- waitResult{wpid, status, err}
+		}()
+	}
+	var timeout <-chan time.Time
+	if dbp.os.waitTimeout > 0 {
+		timer := time.NewTimer(dbp.os.waitTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case r := <-ch:
+		dbp.os.pendingWait = nil
+		return r.wpid, r.status, r.err
+	case <-timeout:
+		dbp.os.pendingWait = ch
+		return 0, nil, ErrOperationTimeout
+	}
+}
+
+// handleWaitStatus handles the wait status of thread wpid, it returns
+// done == true when the wait is over, either because a thread stopped or
+// because of an error.
+func (dbp *Process) handleWaitStatus(wpid int, status *sys.WaitStatus, halt bool) (_ *Thread, done bool, _ error) {
+	th, ok := dbp.threads[wpid]
+	if ok {
+		th.Status = (*WaitStatus)(status)
+	} else if dbp.os.group != nil && dbp.os.group.dispatch(dbp, wpid, status) {
+		// this wait status belongs to another process of the group
+		return nil, false, nil
+	}
+	// the process is over when its main thread, or the only traced thread,
+	// exits.
+	lastThread := wpid == dbp.pid || wpid == dbp.os.attachedThread
+	if status.Exited() {
+		if lastThread {
+			dbp.postExit()
+			dbp.removeFromGroup()
+			return nil, true, proc.ErrProcessExited{Pid: wpid, Status: status.ExitStatus()}
+		}
+		delete(dbp.threads, wpid)
+		return nil, false, nil
+	}
+	if status.Signaled() {
+		// the thread was terminated by a signal (for example it was killed
+		// by someone else), report it as a negative exit status.
+		if lastThread {
+			dbp.postExit()
+			dbp.removeFromGroup()
+			return nil, true, proc.ErrProcessExited{Pid: wpid, Status: -int(status.Signal())}
+		}
+		delete(dbp.threads, wpid)
+		return nil, false, nil
+	}
+	if status.StopSignal() == sys.SIGTRAP && status.TrapCause() == sys.PTRACE_EVENT_CLONE {
+		// A traced thread has cloned a new thread, grab the pid and
+		// add it to our list of traced threads.
+		var cloned uint
+		var err error
+		dbp.execPtraceFunc(func() { cloned, err = sys.PtraceGetEventMsg(wpid) })
+		if err != nil {
+			if err == sys.ESRCH {
+				// thread died while we were adding it
+				return nil, false, nil
 			}
-			th, err = dbp.addThread(int(cloned), false)
-			if err != nil {
-				if err == sys.ESRCH {
-					// thread died while we were adding it
-					delete(dbp.threads, int(cloned))
-					continue
-				}
-				return nil, err
+			return nil, true, fmt.Errorf("could not get event message: %s", err)
+		}
+		th, err = dbp.addThread(int(cloned), false)
+		if err != nil {
+			if err == sys.ESRCH {
+				// thread died while we were adding it
+				delete(dbp.threads, int(cloned))
+				return nil, false, nil
 			}
-			if halt {
-				th.os.running = false
-				dbp.threads[int(wpid)].os.running = false
-				return nil, nil
+			return nil, true, err
+		}
+		if halt {
+			th.os.running = false
+			dbp.threads[int(wpid)].os.running = false
+			return nil, true, nil
+		}
+		if dbp.os.stopAtClone {
+			parent := dbp.threads[int(wpid)]
+			th.os.running = false
+			parent.os.running = false
+			dbp.os.threadEvent = &ThreadEvent{Parent: parent, Thread: th}
+			return parent, true, nil
+		}
+		if err = th.Continue(); err != nil {
+			if err == sys.ESRCH {
+				// thread died while we were adding it
+				delete(dbp.threads, th.ID)
+				return nil, false, nil
 			}
-			if err = th.Continue(); err != nil {
-				if err == sys.ESRCH {
-					// thread died while we were adding it
-					delete(dbp.threads, th.ID)
-					continue
-				}
-				return nil, fmt.Errorf("could not continue new thread %d %s", cloned, err)
+			return nil, true, fmt.Errorf("could not continue new thread %d %s", cloned, err)
+		}
+		if err = dbp.threads[int(wpid)].Continue(); err != nil {
+			if err != sys.ESRCH {
+				return nil, true, fmt.Errorf("could not continue existing thread %d %s", wpid, err)
 			}
-			if err = dbp.threads[int(wpid)].Continue(); err != nil {
-				if err != sys.ESRCH {
-					return nil, fmt.Errorf("could not continue existing thread %d %s", wpid, err)
-				}
+		}
+		return nil, false, nil
+	}
+	if th != nil && status.StopSignal() == sys.SIGTRAP && status.TrapCause() == sys.PTRACE_EVENT_FORK && dbp.os.group != nil {
+		// A traced thread has created a new process, add it to the group.
+		var forked uint
+		var err error
+		dbp.execPtraceFunc(func() { forked, err = sys.PtraceGetEventMsg(wpid) })
+		if err != nil {
+			if err == sys.ESRCH {
+				return nil, false, nil
 			}
-			continue
+			return nil, true, fmt.Errorf("could not get event message: %s", err)
 		}
-		if th == nil {
-			// Sometimes we get an unknown thread, ignore it?
-			continue
+		if err := dbp.os.group.addChild(dbp, int(forked), halt); err != nil {
+			return nil, true, fmt.Errorf("could not add process %d: %v", forked, err)
 		}
-		if (halt && status.StopSignal() == sys.SIGSTOP) || (status.StopSignal() == sys.SIGTRAP) {
+		if halt {
 			th.os.running = false
-			return th, nil
-		}
-		if th != nil {
-			// TODO(dp) alert user about unexpected signals here.
-			if err := th.resumeWithSig(int(status.StopSignal())); err != nil {
-				if err == sys.ESRCH {
-					return nil, proc.ErrProcessExited{Pid: dbp.pid}
-				}
-				return nil, err
+			return nil, true, nil
+		}
+		if err := th.Continue(); err != nil && err != sys.ESRCH {
+			return nil, true, fmt.Errorf("could not continue existing thread %d %s", wpid, err)
+		}
+		return nil, false, nil
+	}
+	if th != nil && status.StopSignal() == sys.SIGTRAP && status.TrapCause() == sys.PTRACE_EVENT_EXEC && dbp.forked {
+		// A process created with fork replaced its executable, we can't
+		// debug the new executable with the binary info of its parent.
+		dbp.execPtraceFunc(func() { dbp.tracer().Detach(wpid, 0) })
+		dbp.detached = true
+		dbp.postExit()
+		dbp.removeFromGroup()
+		return nil, true, proc.ProcessDetachedError{}
+	}
+	if th == nil {
+		// Sometimes we get an unknown thread, ignore it?
+		return nil, false, nil
+	}
+	debuggerStop := status.StopSignal() == sys.SIGSTOP && th.os.sigstopPending
+	if debuggerStop {
+		th.os.sigstopPending = false
+	}
+	if (halt && status.StopSignal() == sys.SIGSTOP) || (status.StopSignal() == sys.SIGTRAP) {
+		th.os.running = false
+		return th, true, nil
+	}
+	if status.StopSignal() == sys.SIGSTOP && wpid == dbp.os.attachedThread && dbp.manualStopPending() {
+		// the SIGSTOP sent by requestManualStop
+		th.os.running = false
+		return th, true, nil
+	}
+	if debuggerStop {
+		// the SIGSTOP sent by stop to a thread that had already stopped for
+		// another reason, it was not sent by the target and is not delivered
+		// to it.
+		if err := th.resumeWithSig(0); err != nil {
+			if err == sys.ESRCH {
+				return nil, true, proc.ErrProcessExited{Pid: dbp.pid}
+			}
+			return nil, true, err
+		}
+		return nil, false, nil
+	}
+	if sig := syscall.Signal(status.StopSignal()); dbp.os.stopAtSignal && dbp.os.stoppedSignal == 0 && dbp.isStopSignal(sig) {
+		// the signal is delivered when the thread is resumed.
+		th.os.running = false
+		th.os.delayedSignals = append(th.os.delayedSignals, int(sig))
+		dbp.os.stoppedSignal = sig
+		dbp.os.signalThread = th
+		return th, true, nil
+	}
+	// TODO(dp) alert user about unexpected signals here.
+	if err := th.resumeWithSig(int(status.StopSignal())); err != nil {
+		if err == sys.ESRCH {
+			return nil, true, proc.ErrProcessExited{Pid: dbp.pid}
+		}
+		return nil, true, err
+	}
+	return nil, false, nil
+}
+
+// NextThreadEvent resumes the process until one of its threads creates a
+// new thread, then stops the process and returns the new thread and the
+// thread that created it. Breakpoints hit before that are stepped over.
+func (dbp *Process) NextThreadEvent() (*ThreadEvent, error) {
+	dbp.os.stopAtClone = true
+	defer func() {
+		dbp.os.stopAtClone = false
+		dbp.os.threadEvent = nil
+	}()
+	for {
+		if _, err := dbp.ContinueOnce(); err != nil {
+			return nil, err
+		}
+		if ev := dbp.os.threadEvent; ev != nil {
+			dbp.SwitchThread(ev.Parent.ID)
+			return ev, nil
+		}
+		if dbp.CheckAndClearManualStopRequest() {
+			return nil, errors.New("manual stop requested before a thread was created")
+		}
+	}
+}
+
+// ContinueUntilSignal resumes the process, like proc.Continue, until one
+// of its threads receives one of sigs, or any signal if sigs is empty, and
+// returns the signal, which is delivered to the thread when the process
+// is resumed again. The current thread is switched to the thread that
+// received the signal.
+// The SIGSTOPs sent by the debugger to stop the process are not signals
+// received by the target; SIGURG, which the runtime uses to preempt
+// goroutines, is only reported if it's in sigs.
+// User breakpoints are resumed unless stopAtBreakpoints is set. If the
+// process stops for any other reason, for example at a user breakpoint
+// with stopAtBreakpoints set, a manual stop request or a call to
+// runtime.Breakpoint, a zero signal is returned.
+func (dbp *Process) ContinueUntilSignal(stopAtBreakpoints bool, sigs ...syscall.Signal) (syscall.Signal, error) {
+	dbp.os.stopAtSignal = true
+	dbp.os.stopSignals = make(map[syscall.Signal]bool)
+	for _, sig := range sigs {
+		dbp.os.stopSignals[sig] = true
+	}
+	defer func() {
+		dbp.os.stopAtSignal = false
+		dbp.os.stopSignals = nil
+		dbp.os.stoppedSignal = 0
+		dbp.os.signalThread = nil
+	}()
+	for {
+		if err := proc.Continue(dbp); err != nil {
+			return 0, err
+		}
+		if sig := dbp.os.stoppedSignal; sig != 0 {
+			// Continue picks a thread stopped at a breakpoint as the current
+			// thread, the signal could have been received by another one.
+			if err := dbp.SwitchThread(dbp.os.signalThread.ID); err != nil {
+				return 0, err
 			}
+			return sig, nil
+		}
+		bp := dbp.currentThread.CurrentBreakpoint
+		if stopAtBreakpoints || bp.Breakpoint == nil || !bp.Active || !bp.IsUser() {
+			return 0, nil
+		}
+	}
+}
+
+// isStopSignal returns true if sig stops ContinueUntilSignal.
+func (dbp *Process) isStopSignal(sig syscall.Signal) bool {
+	if len(dbp.os.stopSignals) == 0 {
+		return sig != sys.SIGURG
+	}
+	return dbp.os.stopSignals[sig]
+}
+
+// ptraceOptions returns the ptrace options for the threads of the process.
+func (dbp *Process) ptraceOptions() int {
+	options := syscall.PTRACE_O_TRACECLONE
+	if dbp.os.attachedThread != 0 {
+		// threads created by the attached thread are not traced
+		options = 0
+	}
+	if dbp.childProcess {
+		// processes started by the debugger are killed if the debugger dies
+		// without detaching.
+		options |= sys.PTRACE_O_EXITKILL
+	}
+	if dbp.os.group != nil {
+		options |= sys.PTRACE_O_TRACEFORK
+		if dbp.forked {
+			options |= sys.PTRACE_O_TRACEEXEC
 		}
 	}
+	return options
 }
 
 func (dbp *Process) loadProcessInformation() {
@@ -355,14 +978,14 @@ func status(pid int, comm string) rune {
 // waitFast is like wait but does not handle process-exit correctly
 func (dbp *Process) waitFast(pid int) (int, *sys.WaitStatus, error) {
 	var s sys.WaitStatus
-	wpid, err := sys.Wait4(pid, &s, sys.WALL, nil)
+	wpid, err := dbp.tracer().Wait(pid, &s, sys.WALL)
 	return wpid, &s, err
 }
 
 func (dbp *Process) wait(pid, options int) (int, *sys.WaitStatus, error) {
 	var s sys.WaitStatus
 	if (pid != dbp.pid) || (options != 0) {
-		wpid, err := sys.Wait4(pid, &s, sys.WALL|options, nil)
+		wpid, err := dbp.tracer().Wait(pid, &s, sys.WALL|options)
 		return wpid, &s, err
 	}
 	// If we call wait4/waitpid on a thread that is the leader of its group,
@@ -377,7 +1000,7 @@ func (dbp *Process) wait(pid, options int) (int, *sys.WaitStatus, error) {
 	// https://sourceware.org/bugzilla/show_bug.cgi?id=10095
 	// https://sourceware.org/bugzilla/attachment.cgi?id=5685
 	for {
-		wpid, err := sys.Wait4(pid, &s, sys.WNOHANG|sys.WALL|options, nil)
+		wpid, err := dbp.tracer().Wait(pid, &s, sys.WNOHANG|sys.WALL|options)
 		if err != nil {
 			return 0, nil, err
 		}
@@ -391,13 +1014,17 @@ func (dbp *Process) wait(pid, options int) (int, *sys.WaitStatus, error) {
 	}
 }
 
+// exitGuard converts an ESRCH error, returned by ptrace when the target
+// died while we thought it was stopped (for example because it was killed
+// by someone else), into proc.ErrProcessExited, reporting its exit status.
 func (dbp *Process) exitGuard(err error) error {
-	if err != sys.ESRCH {
+	if err != sys.ESRCH || dbp.exited {
 		return err
 	}
 	if status(dbp.pid, dbp.os.comm) == StatusZombie {
-		_, err := dbp.trapWaitInternal(-1, false)
-		return err
+		if _, werr := dbp.trapWaitInternal(-1, false); werr != nil {
+			return werr
+		}
 	}
 
 	return err
@@ -428,7 +1055,9 @@ func (dbp *Process) stop(trapthread *Thread) (err error) {
 		return &proc.ErrProcessExited{Pid: dbp.Pid()}
 	}
 	for _, th := range dbp.threads {
-		if !th.Stopped() {
+		// threads that reported a stop are known to be in a ptrace-stop,
+		// there is no need to read their state from /proc.
+		if th.os.running && !th.Stopped() {
 			if err := th.stop(); err != nil {
 				return dbp.exitGuard(err)
 			}
@@ -464,13 +1093,21 @@ func (dbp *Process) stop(trapthread *Thread) (err error) {
 				return err
 			}
 		}
+		th.os.stopReason = StopNone
+		th.os.watchpointHits = nil
+	}
+	if trapthread != nil {
+		// failing to read the debug registers of a thread that is exiting
+		// doesn't mean that the process couldn't be stopped.
+		trapthread.os.stopReason, _ = trapthread.stopReason()
 	}
 	return nil
 }
 
 func (dbp *Process) detach(kill bool) error {
 	for threadID := range dbp.threads {
-		err := PtraceDetach(threadID, 0)
+		dbp.log.Debugf("detach tid=%d", threadID)
+		err := dbp.tracer().Detach(threadID, 0)
 		if err != nil {
 			return err
 		}
@@ -492,12 +1129,23 @@ func (dbp *Process) detach(kill bool) error {
 // EntryPoint will return the process entry point address, useful for
 // debugging PIEs.
 func (dbp *Process) EntryPoint() (uint64, error) {
-	auxvbuf, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/auxv", dbp.pid))
+	auxv, err := dbp.AuxVector()
 	if err != nil {
-		return 0, fmt.Errorf("could not read auxiliary vector: %v", err)
+		return 0, err
 	}
+	return auxv[linutil.AuxvEntry], nil
+}
 
-	return linutil.EntryPointFromAuxvAMD64(auxvbuf), nil
+// AuxVector returns the auxiliary vector the kernel passed to the process,
+// as a map from tag to value (see linutil.AuxvEntry and linutil.AuxvBase).
+// The difference between the AuxvEntry value and the entry point in the
+// ELF header is the load bias of the executable.
+func (dbp *Process) AuxVector() (map[uint64]uint64, error) {
+	auxvbuf, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/auxv", dbp.pid))
+	if err != nil {
+		return nil, fmt.Errorf("could not read auxiliary vector: %v", err)
+	}
+	return linutil.ParseAuxvAMD64(auxvbuf), nil
 }
 
 func killProcess(pid int) error {
@@ -0,0 +1,68 @@
+package native
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	sys "golang.org/x/sys/unix"
+)
+
+func TestFindExecutableExited(t *testing.T) {
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	_, err := findExecutable("", cmd.Process.Pid)
+	if err == nil || !strings.Contains(err.Error(), "has exited") {
+		t.Fatalf("wrong error for exited process: %v", err)
+	}
+}
+
+func TestFindExecutablePermission(t *testing.T) {
+	err := executableError(1, &os.PathError{Op: "open", Path: "/proc/1/exe", Err: syscall.EACCES})
+	if err == nil || !strings.Contains(err.Error(), "permission denied") || !strings.Contains(err.Error(), "process 1") {
+		t.Fatalf("wrong error for permission denied: %v", err)
+	}
+}
+
+func TestAttachTimeout(t *testing.T) {
+	cmd := exec.Command("sleep", "10")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	// PTRACE_SEIZE attaches without stopping the process, simulating a
+	// process that never stops after PTRACE_ATTACH.
+	realPtraceSyscall := ptraceSyscall
+	defer setPtraceSyscall(func(req int, tid int, addr, data uintptr) syscall.Errno {
+		if req == sys.PTRACE_ATTACH {
+			req = sys.PTRACE_SEIZE
+		}
+		return realPtraceSyscall(req, tid, addr, data)
+	})()
+
+	pid := cmd.Process.Pid
+	_, err := AttachTimeout(pid, 50*time.Millisecond, nil)
+	if err != ErrAttachTimeout {
+		t.Fatalf("expected ErrAttachTimeout, got %v", err)
+	}
+	// the process is detached asynchronously
+	for i := 0; tracerPid(pid) != 0; i++ {
+		if i >= 100 {
+			t.Fatalf("process still traced by %d", tracerPid(pid))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if s := status(pid, "sleep"); s == StatusTraceStop || s == StatusTraceStopT {
+		t.Fatalf("process left stopped (status %c)", s)
+	}
+}
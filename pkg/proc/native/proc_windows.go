@@ -480,6 +480,10 @@ func (dbp *Process) detach(kill bool) error {
 	return _DebugActiveProcessStop(uint32(dbp.pid))
 }
 
+func (dbp *Process) clearWatchpointsOutOfScope(trapthread *Thread) (bool, error) {
+	return false, nil
+}
+
 func (dbp *Process) EntryPoint() (uint64, error) {
 	return dbp.os.entryPoint, nil
 }
@@ -1,7 +1,9 @@
 package native
 
 import (
+	"errors"
 	"syscall"
+	"time"
 	"unsafe"
 
 	sys "golang.org/x/sys/unix"
@@ -9,49 +11,114 @@ import (
 	"github.com/go-delve/delve/pkg/proc/linutil"
 )
 
+// maxPtraceRetries is the number of times a ptrace call interrupted by a
+// signal (EINTR) is retried before giving up.
+const maxPtraceRetries = 5
+
+// ptraceRetryDelay is how long we wait before retrying an interrupted
+// ptrace call for the first time, the delay doubles at every retry.
+const ptraceRetryDelay = time.Millisecond
+
+// ptraceSyscall executes a ptrace system call, it's replaced by tests to
+// simulate failures.
+var ptraceSyscall = func(req int, tid int, addr, data uintptr) syscall.Errno {
+	_, _, err := syscall.Syscall6(syscall.SYS_PTRACE, uintptr(req), uintptr(tid), addr, data, 0, 0)
+	return err
+}
+
+// ptrace calls ptraceSyscall, retrying it if it's interrupted by a signal.
+func ptrace(req int, tid int, addr, data uintptr) error {
+	delay := ptraceRetryDelay
+	for i := 0; ; i++ {
+		err := ptraceSyscall(req, tid, addr, data)
+		switch {
+		case err == syscall.Errno(0):
+			return nil
+		case err != syscall.EINTR || i >= maxPtraceRetries:
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
 // PtraceAttach executes the sys.PtraceAttach call.
 func PtraceAttach(pid int) error {
-	return sys.PtraceAttach(pid)
+	return ptrace(sys.PTRACE_ATTACH, pid, 0, 0)
+}
+
+// PtraceSeize calls ptrace(PTRACE_SEIZE), which attaches to tid without
+// stopping it, setting the given ptrace options.
+func PtraceSeize(tid, options int) error {
+	return ptrace(sys.PTRACE_SEIZE, tid, 0, uintptr(options))
+}
+
+// PtraceInterrupt calls ptrace(PTRACE_INTERRUPT), which stops a thread
+// attached with PtraceSeize.
+func PtraceInterrupt(tid int) error {
+	return ptrace(sys.PTRACE_INTERRUPT, tid, 0, 0)
 }
 
 // PtraceDetach calls ptrace(PTRACE_DETACH).
 func PtraceDetach(tid, sig int) error {
-	_, _, err := sys.Syscall6(sys.SYS_PTRACE, sys.PTRACE_DETACH, uintptr(tid), 1, uintptr(sig), 0, 0)
-	if err != syscall.Errno(0) {
-		return err
-	}
-	return nil
+	return ptrace(sys.PTRACE_DETACH, tid, 1, uintptr(sig))
 }
 
 // PtraceCont executes ptrace PTRACE_CONT
 func PtraceCont(tid, sig int) error {
-	return sys.PtraceCont(tid, sig)
+	return ptrace(sys.PTRACE_CONT, tid, 0, uintptr(sig))
 }
 
 // PtraceSingleStep executes ptrace PTRACE_SINGLE_STEP.
 func PtraceSingleStep(tid int) error {
-	return sys.PtraceSingleStep(tid)
+	return ptrace(sys.PTRACE_SINGLESTEP, tid, 0, 0)
 }
 
 // PtracePokeUser execute ptrace PTRACE_POKE_USER.
 func PtracePokeUser(tid int, off, addr uintptr) error {
-	_, _, err := sys.Syscall6(sys.SYS_PTRACE, sys.PTRACE_POKEUSR, uintptr(tid), uintptr(off), uintptr(addr), 0, 0)
-	if err != syscall.Errno(0) {
-		return err
-	}
-	return nil
+	return ptrace(sys.PTRACE_POKEUSR, tid, off, addr)
 }
 
 // PtracePeekUser execute ptrace PTRACE_PEEK_USER.
 func PtracePeekUser(tid int, off uintptr) (uintptr, error) {
 	var val uintptr
-	_, _, err := syscall.Syscall6(syscall.SYS_PTRACE, syscall.PTRACE_PEEKUSR, uintptr(tid), uintptr(off), uintptr(unsafe.Pointer(&val)), 0, 0)
-	if err != syscall.Errno(0) {
+	if err := ptrace(sys.PTRACE_PEEKUSR, tid, off, uintptr(unsafe.Pointer(&val))); err != nil {
 		return 0, err
 	}
 	return val, nil
 }
 
+// remoteIovec is an iovec describing memory of the target, base is an
+// address in the target and not a Go pointer.
+type remoteIovec struct {
+	base uintptr
+	len  uintptr
+}
+
+// processVM transfers len(buf) bytes between buf and the memory at addr of
+// the process that thread tid belongs to, using process_vm_writev if write
+// is true and process_vm_readv otherwise. It returns the number of bytes
+// transferred, which stops at the first page that can not be accessed.
+// Unlike PTRACE_POKEDATA, process_vm_writev honors the protection of the
+// pages of the target and can not write to read-only mappings.
+func processVM(tid int, buf []byte, addr uintptr, write bool) (int, error) {
+	if len(buf) == 0 {
+		return 0, nil
+	}
+	local := sys.Iovec{Base: &buf[0]}
+	local.SetLen(len(buf))
+	remote := remoteIovec{base: addr, len: uintptr(len(buf))}
+	trap := uintptr(sys.SYS_PROCESS_VM_READV)
+	if write {
+		trap = sys.SYS_PROCESS_VM_WRITEV
+	}
+	n, _, err := syscall.Syscall6(trap, uintptr(tid), uintptr(unsafe.Pointer(&local)), 1, uintptr(unsafe.Pointer(&remote)), 1, 0)
+	if err != syscall.Errno(0) {
+		return 0, err
+	}
+	return int(n), nil
+}
+
 // PtraceGetRegset returns floating point registers of the specified thread
 // using PTRACE.
 // See amd64_linux_fetch_inferior_registers in gdb/amd64-linux-nat.c.html
@@ -82,3 +149,28 @@ func PtraceGetRegset(tid int) (regset linutil.AMD64Xstate, err error) {
 	err = linutil.AMD64XstateRead(regset.Xsave, false, &regset)
 	return regset, err
 }
+
+// PtraceSetFpRegs writes the floating point registers of the specified
+// thread with PTRACE_SETFPREGS.
+func PtraceSetFpRegs(tid int, fpregs *linutil.AMD64PtraceFpRegs) error {
+	_, _, err := syscall.Syscall6(syscall.SYS_PTRACE, sys.PTRACE_SETFPREGS, uintptr(tid), uintptr(0), uintptr(unsafe.Pointer(fpregs)), 0, 0)
+	if err != syscall.Errno(0) {
+		return err
+	}
+	return nil
+}
+
+// PtraceSetRegset writes xsave, an XSAVE area as returned by
+// PtraceGetRegset, to the extended processor state of the specified
+// thread.
+func PtraceSetRegset(tid int, xsave []byte) error {
+	if len(xsave) == 0 {
+		return errors.New("empty XSAVE area")
+	}
+	iov := sys.Iovec{Base: &xsave[0], Len: uint64(len(xsave))}
+	_, _, err := syscall.Syscall6(syscall.SYS_PTRACE, sys.PTRACE_SETREGSET, uintptr(tid), _NT_X86_XSTATE, uintptr(unsafe.Pointer(&iov)), 0, 0)
+	if err != syscall.Errno(0) {
+		return err
+	}
+	return nil
+}
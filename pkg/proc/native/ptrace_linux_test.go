@@ -0,0 +1,62 @@
+package native
+
+import (
+	"syscall"
+	"testing"
+
+	sys "golang.org/x/sys/unix"
+)
+
+// setPtraceSyscall replaces ptraceSyscall with fn, returns a function that
+// restores it.
+func setPtraceSyscall(fn func(req int, tid int, addr, data uintptr) syscall.Errno) func() {
+	old := ptraceSyscall
+	ptraceSyscall = fn
+	return func() { ptraceSyscall = old }
+}
+
+func TestPtraceRetryEINTR(t *testing.T) {
+	calls := 0
+	defer setPtraceSyscall(func(req int, tid int, addr, data uintptr) syscall.Errno {
+		calls++
+		if calls <= 2 {
+			return syscall.EINTR
+		}
+		if req != sys.PTRACE_POKEUSR || tid != 42 || addr != 0x10 || data != 0xbeef {
+			t.Errorf("wrong arguments: %d %d %#x %#x", req, tid, addr, data)
+		}
+		return 0
+	})()
+	if err := PtracePokeUser(42, 0x10, 0xbeef); err != nil {
+		t.Fatalf("PtracePokeUser: %v", err)
+	}
+	if calls != 3 {
+		t.Fatalf("expected 3 calls, got %d", calls)
+	}
+}
+
+func TestPtraceRetryErrors(t *testing.T) {
+	calls := 0
+	defer setPtraceSyscall(func(req int, tid int, addr, data uintptr) syscall.Errno {
+		calls++
+		return syscall.EINTR
+	})()
+	if err := PtraceCont(42, 0); err != syscall.EINTR {
+		t.Fatalf("expected EINTR, got %v", err)
+	}
+	if calls != maxPtraceRetries+1 {
+		t.Fatalf("expected %d calls, got %d", maxPtraceRetries+1, calls)
+	}
+
+	calls = 0
+	defer setPtraceSyscall(func(req int, tid int, addr, data uintptr) syscall.Errno {
+		calls++
+		return syscall.ESRCH
+	})()
+	if err := PtraceSingleStep(42); err != syscall.ESRCH {
+		t.Fatalf("expected ESRCH, got %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("non EINTR errors should not be retried, got %d calls", calls)
+	}
+}
@@ -0,0 +1,76 @@
+package native
+
+import (
+	sys "golang.org/x/sys/unix"
+
+	"github.com/go-delve/delve/pkg/proc/linutil"
+)
+
+// ptracer executes the ptrace requests, and the waits for their results,
+// made by Process on the threads of the target. The default
+// implementation, sysPtracer, calls the kernel, tests replace it to
+// simulate a target without a real process.
+type ptracer interface {
+	Attach(tid int) error
+	// Seize attaches to tid without stopping it, Interrupt stops it.
+	Seize(tid, options int) error
+	Interrupt(tid int) error
+	Cont(tid, sig int) error
+	SingleStep(tid int) error
+	GetRegs(tid int, regs *sys.PtraceRegs) error
+	SetRegs(tid int, regs *sys.PtraceRegs) error
+	SetFpRegs(tid int, fpregs *linutil.AMD64PtraceFpRegs) error
+	// SetXstate writes an XSAVE area, as read by PtraceGetRegset.
+	SetXstate(tid int, xsave []byte) error
+	PeekData(tid int, addr uintptr, out []byte) (int, error)
+	PokeData(tid int, addr uintptr, data []byte) (int, error)
+	Detach(tid, sig int) error
+	// Wait is wait4 without resource usage, options always include
+	// __WALL.
+	Wait(pid int, status *sys.WaitStatus, options int) (int, error)
+}
+
+// sysPtracer implements ptracer with the ptrace and wait4 system calls.
+type sysPtracer struct{}
+
+func (sysPtracer) Attach(tid int) error { return PtraceAttach(tid) }
+
+func (sysPtracer) Seize(tid, options int) error { return PtraceSeize(tid, options) }
+
+func (sysPtracer) Interrupt(tid int) error { return PtraceInterrupt(tid) }
+
+func (sysPtracer) Cont(tid, sig int) error { return PtraceCont(tid, sig) }
+
+func (sysPtracer) SingleStep(tid int) error { return PtraceSingleStep(tid) }
+
+func (sysPtracer) GetRegs(tid int, regs *sys.PtraceRegs) error { return sys.PtraceGetRegs(tid, regs) }
+
+func (sysPtracer) SetRegs(tid int, regs *sys.PtraceRegs) error { return sys.PtraceSetRegs(tid, regs) }
+
+func (sysPtracer) SetFpRegs(tid int, fpregs *linutil.AMD64PtraceFpRegs) error {
+	return PtraceSetFpRegs(tid, fpregs)
+}
+
+func (sysPtracer) SetXstate(tid int, xsave []byte) error { return PtraceSetRegset(tid, xsave) }
+
+func (sysPtracer) PeekData(tid int, addr uintptr, out []byte) (int, error) {
+	return sys.PtracePeekData(tid, addr, out)
+}
+
+func (sysPtracer) PokeData(tid int, addr uintptr, data []byte) (int, error) {
+	return sys.PtracePokeData(tid, addr, data)
+}
+
+func (sysPtracer) Detach(tid, sig int) error { return PtraceDetach(tid, sig) }
+
+func (sysPtracer) Wait(pid int, status *sys.WaitStatus, options int) (int, error) {
+	return sys.Wait4(pid, status, options, nil)
+}
+
+// tracer returns the ptracer used for the threads of dbp.
+func (dbp *Process) tracer() ptracer {
+	if dbp.os.tracer != nil {
+		return dbp.os.tracer
+	}
+	return sysPtracer{}
+}
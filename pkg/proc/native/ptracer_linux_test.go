@@ -0,0 +1,515 @@
+package native
+
+import (
+	"bytes"
+	"fmt"
+	"syscall"
+	"testing"
+	"time"
+
+	sys "golang.org/x/sys/unix"
+
+	"github.com/go-delve/delve/pkg/proc"
+	"github.com/go-delve/delve/pkg/proc/linutil"
+)
+
+const (
+	fakeNOP  = 0x90
+	fakeINT3 = 0xcc
+
+	// fakePid is the pid of the process simulated by fakePtracer, it is
+	// larger than the maximum pid on linux.
+	fakePid = 1 << 30
+)
+
+// fakePtracer simulates a single threaded process executing the one byte
+// instructions NOP and INT3, stored in mem at address base. Threads stop
+// after executing an INT3, the process exits when its thread runs past the
+// end of mem.
+type fakePtracer struct {
+	base uintptr
+	mem  []byte
+	regs map[int]*sys.PtraceRegs
+	// pending are the wait statuses of each thread not yet reported by
+	// Wait.
+	pending map[int][]sys.WaitStatus
+	// log records the requests executed, in order.
+	log []string
+}
+
+func newFakePtracer(base uintptr, mem []byte, pc uintptr) *fakePtracer {
+	return &fakePtracer{
+		base:    base,
+		mem:     mem,
+		regs:    map[int]*sys.PtraceRegs{fakePid: {Rip: uint64(pc)}},
+		pending: make(map[int][]sys.WaitStatus),
+	}
+}
+
+// stopStatus and exitStatus encode wait statuses like the kernel.
+func stopStatus(sig syscall.Signal) sys.WaitStatus { return sys.WaitStatus(0x7f | int(sig)<<8) }
+func exitStatus(code int) sys.WaitStatus           { return sys.WaitStatus(code << 8) }
+
+// step executes the instruction at the PC of tid, it returns false if the
+// thread ran past the end of mem and exited.
+func (f *fakePtracer) step(tid int) (trapped, ok bool) {
+	regs := f.regs[tid]
+	off := uintptr(regs.Rip) - f.base
+	if off >= uintptr(len(f.mem)) {
+		delete(f.regs, tid)
+		f.pending[tid] = append(f.pending[tid], exitStatus(0))
+		return false, false
+	}
+	regs.Rip++
+	return f.mem[off] == fakeINT3, true
+}
+
+func (f *fakePtracer) Attach(tid int) error {
+	f.log = append(f.log, fmt.Sprintf("attach %d", tid))
+	return nil
+}
+
+func (f *fakePtracer) Seize(tid, options int) error {
+	f.log = append(f.log, fmt.Sprintf("seize %d", tid))
+	return nil
+}
+
+func (f *fakePtracer) Interrupt(tid int) error {
+	if f.regs[tid] == nil {
+		return sys.ESRCH
+	}
+	f.log = append(f.log, fmt.Sprintf("interrupt %d", tid))
+	f.pending[tid] = append(f.pending[tid], stopStatus(sys.SIGTRAP))
+	return nil
+}
+
+func (f *fakePtracer) Cont(tid, sig int) error {
+	if f.regs[tid] == nil {
+		return sys.ESRCH
+	}
+	f.log = append(f.log, fmt.Sprintf("cont %#x", f.regs[tid].Rip))
+	for {
+		trapped, ok := f.step(tid)
+		if !ok {
+			return nil
+		}
+		if trapped {
+			f.pending[tid] = append(f.pending[tid], stopStatus(sys.SIGTRAP))
+			return nil
+		}
+	}
+}
+
+func (f *fakePtracer) SingleStep(tid int) error {
+	if f.regs[tid] == nil {
+		return sys.ESRCH
+	}
+	f.log = append(f.log, fmt.Sprintf("step %#x", f.regs[tid].Rip))
+	if _, ok := f.step(tid); ok {
+		f.pending[tid] = append(f.pending[tid], stopStatus(sys.SIGTRAP))
+	}
+	return nil
+}
+
+func (f *fakePtracer) GetRegs(tid int, regs *sys.PtraceRegs) error {
+	if f.regs[tid] == nil {
+		return sys.ESRCH
+	}
+	*regs = *f.regs[tid]
+	return nil
+}
+
+func (f *fakePtracer) SetRegs(tid int, regs *sys.PtraceRegs) error {
+	if f.regs[tid] == nil {
+		return sys.ESRCH
+	}
+	*f.regs[tid] = *regs
+	return nil
+}
+
+func (f *fakePtracer) SetFpRegs(tid int, fpregs *linutil.AMD64PtraceFpRegs) error {
+	if f.regs[tid] == nil {
+		return sys.ESRCH
+	}
+	f.log = append(f.log, "setfpregs")
+	return nil
+}
+
+func (f *fakePtracer) SetXstate(tid int, xsave []byte) error {
+	if f.regs[tid] == nil {
+		return sys.ESRCH
+	}
+	f.log = append(f.log, "setxstate")
+	return nil
+}
+
+func (f *fakePtracer) memory(addr uintptr, n int) ([]byte, error) {
+	if addr < f.base || addr-f.base+uintptr(n) > uintptr(len(f.mem)) {
+		return nil, sys.EIO
+	}
+	return f.mem[addr-f.base:][:n], nil
+}
+
+func (f *fakePtracer) PeekData(tid int, addr uintptr, out []byte) (int, error) {
+	buf, err := f.memory(addr, len(out))
+	if err != nil {
+		return 0, err
+	}
+	return copy(out, buf), nil
+}
+
+func (f *fakePtracer) PokeData(tid int, addr uintptr, data []byte) (int, error) {
+	buf, err := f.memory(addr, len(data))
+	if err != nil {
+		return 0, err
+	}
+	f.log = append(f.log, fmt.Sprintf("poke %#x %x", addr, data))
+	return copy(buf, data), nil
+}
+
+func (f *fakePtracer) Detach(tid, sig int) error {
+	f.log = append(f.log, fmt.Sprintf("detach %d", tid))
+	return nil
+}
+
+func (f *fakePtracer) Wait(pid int, status *sys.WaitStatus, options int) (int, error) {
+	for tid, statuses := range f.pending {
+		if (pid != -1 && pid != tid) || len(statuses) == 0 {
+			continue
+		}
+		*status = statuses[0]
+		f.pending[tid] = statuses[1:]
+		return tid, nil
+	}
+	if options&sys.WNOHANG != 0 {
+		return 0, nil
+	}
+	// waiting would block forever
+	return 0, sys.ECHILD
+}
+
+// newFakeProcess returns a Process whose only thread is simulated by f,
+// it must be released with closeFakeProcess.
+func newFakeProcess(f *fakePtracer) *Process {
+	dbp := New(fakePid)
+	dbp.common = proc.NewCommonProcess(true)
+	dbp.os.tracer = f
+	dbp.threads[fakePid] = &Thread{ID: fakePid, dbp: dbp, os: new(OSSpecificDetails)}
+	dbp.currentThread = dbp.threads[fakePid]
+	return dbp
+}
+
+// closeFakeProcess releases the resources of a process returned by
+// newFakeProcess.
+func closeFakeProcess(dbp *Process) {
+	if !dbp.exited {
+		dbp.postExit()
+	}
+}
+
+func (f *fakePtracer) checkLog(t *testing.T, expected ...string) {
+	t.Helper()
+	if fmt.Sprint(f.log) != fmt.Sprint(expected) {
+		t.Fatalf("wrong requests:\n%q\nexpected:\n%q", f.log, expected)
+	}
+	f.log = nil
+}
+
+func TestFakeStepOverBreakpoint(t *testing.T) {
+	const base = 0x1000
+	mem := []byte{fakeNOP, fakeNOP, fakeNOP, fakeNOP}
+	f := newFakePtracer(base, mem, base+1)
+	dbp := newFakeProcess(f)
+	defer closeFakeProcess(dbp)
+
+	if _, err := dbp.SetBreakpoint(base+1, proc.UserBreakpoint, nil); err != nil {
+		t.Fatal(err)
+	}
+	f.checkLog(t, "poke 0x1001 cc")
+
+	// the breakpoint is removed while the instruction under it is executed
+	// and restored afterwards.
+	th := dbp.currentThread
+	if err := th.StepInstruction(); err != nil {
+		t.Fatal(err)
+	}
+	f.checkLog(t, "poke 0x1001 90", "step 0x1001", "poke 0x1001 cc")
+	if pc, _ := th.PC(); pc != base+2 {
+		t.Fatalf("wrong PC after step %#x", pc)
+	}
+	if mem[1] != fakeINT3 {
+		t.Fatalf("breakpoint not restored: %x", mem)
+	}
+
+	// stepping elsewhere does not touch the breakpoint, FindBreakpoint
+	// also matches the address after a breakpoint so that one is skipped.
+	if err := th.SetPC(base + 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := th.StepInstruction(); err != nil {
+		t.Fatal(err)
+	}
+	f.checkLog(t, "step 0x1003")
+}
+
+func TestFakeStopStoppedThread(t *testing.T) {
+	// stop doesn't signal threads that already reported a stop, the fake
+	// thread can't be signaled and /proc doesn't know about it.
+	const base = 0x1000
+	f := newFakePtracer(base, []byte{fakeNOP}, base)
+	dbp := newFakeProcess(f)
+	defer closeFakeProcess(dbp)
+	if err := dbp.stop(nil); err != nil {
+		t.Fatal(err)
+	}
+	if dbp.currentThread.os.running {
+		t.Fatal("thread marked as running")
+	}
+}
+
+func TestFakeContinueOnce(t *testing.T) {
+	const base = 0x1000
+	mem := make([]byte, 8)
+	for i := range mem {
+		mem[i] = fakeNOP
+	}
+	f := newFakePtracer(base, mem, base)
+	dbp := newFakeProcess(f)
+	defer closeFakeProcess(dbp)
+	for _, addr := range []uint64{base, base + 5} {
+		if _, err := dbp.SetBreakpoint(addr, proc.UserBreakpoint, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.log = nil
+
+	// the thread is stopped at the first breakpoint, it must step over it
+	// before being resumed and stop at the second one.
+	if err := dbp.currentThread.SetCurrentBreakpoint(); err != nil {
+		t.Fatal(err)
+	}
+	trapthread, err := dbp.ContinueOnce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.checkLog(t, "poke 0x1000 90", "step 0x1000", "poke 0x1000 cc", "cont 0x1001")
+	th := trapthread.(*Thread)
+	if pc, _ := th.PC(); pc != base+5 {
+		t.Fatalf("wrong PC after continue %#x", pc)
+	}
+	if bp := th.CurrentBreakpoint.Breakpoint; bp == nil || bp.Addr != base+5 {
+		t.Fatalf("wrong current breakpoint %v", bp)
+	}
+
+	// continuing past the last breakpoint runs the thread off the end of
+	// memory and the process exits.
+	_, err = dbp.ContinueOnce()
+	if _, exited := err.(proc.ErrProcessExited); !exited {
+		t.Fatalf("expected ErrProcessExited, got %v", err)
+	}
+	f.checkLog(t, "poke 0x1005 90", "step 0x1005", "poke 0x1005 cc", "cont 0x1006")
+}
+
+func TestFakeRestoreRegisters(t *testing.T) {
+	const base = 0x1000
+	f := newFakePtracer(base, []byte{fakeNOP, fakeNOP, fakeINT3}, base)
+	f.regs[fakePid].Fs_base = 0x7000
+	dbp := newFakeProcess(f)
+	defer closeFakeProcess(dbp)
+
+	saved := &linutil.AMD64Registers{Regs: &linutil.AMD64PtraceRegs{Rip: base + 2}, Fpregset: &linutil.AMD64Xstate{}}
+	if err := dbp.currentThread.restoreRegisters(saved); err != nil {
+		t.Fatal(err)
+	}
+	if regs := f.regs[fakePid]; regs.Rip != base+2 || regs.Fs_base != 0x7000 {
+		t.Fatalf("wrong registers after restoreRegisters: rip=%#x fs_base=%#x", regs.Rip, regs.Fs_base)
+	}
+	f.checkLog(t, "setfpregs")
+
+	// the XSAVE area, when there is one, replaces the legacy floating point
+	// registers.
+	saved.Fpregset.Xsave = make([]byte, 512)
+	if err := dbp.currentThread.restoreRegisters(saved); err != nil {
+		t.Fatal(err)
+	}
+	f.checkLog(t, "setxstate")
+}
+
+func TestFakeMemoryCacheAttachedThread(t *testing.T) {
+	const base = 0x1000
+	// a whole chunk of the cache
+	mem := bytes.Repeat([]byte{fakeNOP}, memCacheChunkSize)
+	dbp := newFakeProcess(newFakePtracer(base, mem, base))
+	defer closeFakeProcess(dbp)
+	buf := make([]byte, 1)
+	read := func() byte {
+		t.Helper()
+		if _, err := dbp.currentThread.ReadMemory(buf, base); err != nil {
+			t.Fatal(err)
+		}
+		return buf[0]
+	}
+
+	// while the process is stopped the memory is cached.
+	read()
+	mem[0] = fakeINT3
+	if b := read(); b != fakeNOP {
+		t.Fatalf("memory read not cached: %x", b)
+	}
+
+	// threads left running by AttachThread can write the memory while it's
+	// read.
+	dbp.os.attachedThread = fakePid
+	if b := read(); b != fakeINT3 {
+		t.Fatalf("memory read cached with an attached thread: %x", b)
+	}
+}
+
+// blockingPtracer is a fakePtracer whose blocking waits don't return until
+// release is closed.
+type blockingPtracer struct {
+	*fakePtracer
+	waiting chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingPtracer) Wait(pid int, status *sys.WaitStatus, options int) (int, error) {
+	if options&sys.WNOHANG == 0 && b.waiting != nil {
+		close(b.waiting)
+		b.waiting = nil
+		<-b.release
+	}
+	return b.fakePtracer.Wait(pid, status, options)
+}
+
+func TestFakeOperationsWhileRunning(t *testing.T) {
+	const base = 0x1000
+	mem := []byte{fakeNOP, fakeNOP, fakeINT3, fakeNOP}
+	b := &blockingPtracer{newFakePtracer(base, mem, base), make(chan struct{}), make(chan struct{})}
+	dbp := newFakeProcess(b.fakePtracer)
+	defer closeFakeProcess(dbp)
+	dbp.os.tracer = b
+
+	waiting := b.waiting
+	errch := make(chan error)
+	go func() {
+		_, err := dbp.ContinueOnce()
+		errch <- err
+	}()
+	<-waiting
+
+	// the target is running, operations that need it stopped fail.
+	buf := make([]byte, 1)
+	if _, err := dbp.currentThread.ReadMemory(buf, base); err != proc.ErrProcessRunning {
+		t.Errorf("ReadMemory while running: %v", err)
+	}
+	if _, err := dbp.currentThread.WriteMemory(base, []byte{fakeNOP}); err != proc.ErrProcessRunning {
+		t.Errorf("WriteMemory while running: %v", err)
+	}
+	if _, err := dbp.SetBreakpoint(base+3, proc.UserBreakpoint, nil); err != proc.ErrProcessRunning {
+		t.Errorf("SetBreakpoint while running: %v", err)
+	}
+
+	close(b.release)
+	if err := <-errch; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dbp.currentThread.ReadMemory(buf, base); err != nil || buf[0] != fakeNOP {
+		t.Fatalf("ReadMemory after stop: %x %v", buf, err)
+	}
+	if _, err := dbp.SetBreakpoint(base+3, proc.UserBreakpoint, nil); err != nil {
+		t.Fatalf("SetBreakpoint after stop: %v", err)
+	}
+}
+
+func TestFakeOperationTimeout(t *testing.T) {
+	const base = 0x1000
+	mem := []byte{fakeNOP, fakeNOP, fakeINT3, fakeNOP}
+	b := &blockingPtracer{newFakePtracer(base, mem, base), make(chan struct{}), make(chan struct{})}
+	dbp := newFakeProcess(b.fakePtracer)
+	defer closeFakeProcess(dbp)
+	dbp.os.tracer = b
+	dbp.SetOperationTimeout(100 * time.Millisecond)
+
+	// the wait does not return before the deadline.
+	if _, err := dbp.ContinueOnce(); err != ErrOperationTimeout {
+		t.Fatalf("expected ErrOperationTimeout, got %v", err)
+	}
+	if !dbp.common.Running() {
+		t.Fatal("process not marked as running after the timeout")
+	}
+	buf := make([]byte, 1)
+	if _, err := dbp.currentThread.ReadMemory(buf, base); err != proc.ErrProcessRunning {
+		t.Errorf("ReadMemory after the timeout: %v", err)
+	}
+
+	// the stop that arrives after the deadline is not lost, the next wait
+	// reports it.
+	close(b.release)
+	trapthread, err := dbp.ContinueOnce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dbp.common.Running() {
+		t.Fatal("process still marked as running after the stop")
+	}
+	if pc, _ := trapthread.(*Thread).PC(); pc != base+3 {
+		t.Fatalf("wrong PC after the stop %#x", pc)
+	}
+	if dbp.os.pendingWait != nil {
+		t.Fatal("pending wait not cleared")
+	}
+}
+
+// stubARM64 is an architecture whose breakpoint instruction is the four
+// bytes BRK #0 of arm64, it's used to check that breakpoints replace the
+// whole instruction.
+type stubARM64 struct {
+	*proc.AMD64
+}
+
+var arm64BreakInstruction = []byte{0x00, 0x00, 0x20, 0xd4}
+
+func (stubARM64) BreakpointInstruction() []byte { return arm64BreakInstruction }
+func (stubARM64) BreakpointSize() int           { return len(arm64BreakInstruction) }
+
+func TestFakeBreakpointInstructionLength(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		arch proc.Arch
+	}{
+		{"amd64", proc.AMD64Arch("linux")},
+		{"arm64", stubARM64{proc.AMD64Arch("linux")}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			const base = 0x1000
+			mem := []byte{0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17}
+			orig := append([]byte(nil), mem...)
+			f := newFakePtracer(base, mem, base)
+			dbp := newFakeProcess(f)
+			defer closeFakeProcess(dbp)
+			dbp.bi.Arch = tc.arch
+			bpinstr := tc.arch.BreakpointInstruction()
+
+			bp, err := dbp.SetBreakpoint(base+2, proc.UserBreakpoint, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.checkLog(t, fmt.Sprintf("poke 0x1002 %x", bpinstr))
+			if !bytes.Equal(bp.OriginalData, orig[2:2+len(bpinstr)]) {
+				t.Fatalf("wrong original data %x", bp.OriginalData)
+			}
+			if !bytes.Equal(mem[2:2+len(bpinstr)], bpinstr) {
+				t.Fatalf("breakpoint not installed: %x", mem)
+			}
+
+			if _, err := dbp.ClearBreakpoint(base + 2); err != nil {
+				t.Fatal(err)
+			}
+			f.checkLog(t, fmt.Sprintf("poke 0x1002 %x", orig[2:2+len(bpinstr)]))
+			if !bytes.Equal(mem, orig) {
+				t.Fatalf("breakpoint not restored: %x", mem)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package native
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// ptraceScopePath is the path of the setting of the yama security module
+// that restricts the use of ptrace.
+const ptraceScopePath = "/proc/sys/kernel/yama/ptrace_scope"
+
+// capSysPtrace is the number of the CAP_SYS_PTRACE capability.
+const capSysPtrace = 19
+
+// CheckPtracePermissions returns an error if the yama security module
+// settings do not allow this process to use ptrace at all, so that users
+// get an explanation instead of EPERM. If yama is not enabled nil is
+// returned.
+func CheckPtracePermissions() error {
+	scope, ok := readPtraceScope()
+	if !ok {
+		return nil
+	}
+	return ptraceScopeError(scope, hasCapSysPtrace())
+}
+
+func ptraceScopeError(scope int, privileged bool) error {
+	switch {
+	case scope >= 3:
+		return fmt.Errorf("ptrace is disabled on this system (%s is %d), it can only be enabled again by rebooting", ptraceScopePath, scope)
+	case scope == 2 && !privileged:
+		return fmt.Errorf("only processes with the CAP_SYS_PTRACE capability can use ptrace on this system (%s is %d): run as root or set ptrace_scope=0", ptraceScopePath, scope)
+	}
+	return nil
+}
+
+// attachError converts an error returned by ptrace(PTRACE_ATTACH) into a
+// more helpful error if it was caused by the yama restrictions on
+// attaching to processes that are not descendants of the debugger.
+func attachError(pid int, err error) error {
+	if err != syscall.EPERM {
+		return err
+	}
+	scope, ok := readPtraceScope()
+	if !ok || scope != 1 || hasCapSysPtrace() {
+		return err
+	}
+	return fmt.Errorf("could not attach to pid %d: %v: only descendants of the debugger can be attached to on this system (%s is %d): run as root or set ptrace_scope=0", pid, err, ptraceScopePath, scope)
+}
+
+func readPtraceScope() (int, bool) {
+	buf, err := ioutil.ReadFile(ptraceScopePath)
+	if err != nil {
+		return 0, false
+	}
+	scope, err := strconv.Atoi(strings.TrimSpace(string(buf)))
+	if err != nil {
+		return 0, false
+	}
+	return scope, true
+}
+
+// hasCapSysPtrace returns true if the effective capabilities of this
+// process contain CAP_SYS_PTRACE.
+func hasCapSysPtrace() bool {
+	fh, err := os.Open("/proc/self/status")
+	if err != nil {
+		return os.Geteuid() == 0
+	}
+	defer fh.Close()
+	s := bufio.NewScanner(fh)
+	for s.Scan() {
+		line := s.Text()
+		if !strings.HasPrefix(line, "CapEff:") {
+			continue
+		}
+		caps, err := strconv.ParseUint(strings.TrimSpace(line[len("CapEff:"):]), 16, 64)
+		if err != nil {
+			return os.Geteuid() == 0
+		}
+		return caps&(1<<capSysPtrace) != 0
+	}
+	return os.Geteuid() == 0
+}
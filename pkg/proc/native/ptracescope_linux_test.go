@@ -0,0 +1,33 @@
+package native
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPtraceScopeError(t *testing.T) {
+	testcases := []struct {
+		scope      int
+		privileged bool
+		denied     bool
+	}{
+		{0, false, false},
+		{1, false, false},
+		{2, true, false},
+		{2, false, true},
+		{3, true, true},
+	}
+	for _, tc := range testcases {
+		err := ptraceScopeError(tc.scope, tc.privileged)
+		if (err != nil) != tc.denied {
+			t.Errorf("ptrace_scope=%d privileged=%v: unexpected result %v", tc.scope, tc.privileged, err)
+			continue
+		}
+		if err != nil && !strings.Contains(err.Error(), "ptrace_scope") {
+			t.Errorf("ptrace_scope=%d privileged=%v: error does not mention ptrace_scope: %v", tc.scope, tc.privileged, err)
+		}
+	}
+	if err := ptraceScopeError(2, false); !strings.Contains(err.Error(), "run as root or set ptrace_scope=0") {
+		t.Errorf("error does not explain how to fix the problem: %v", err)
+	}
+}
@@ -17,8 +17,8 @@ func (thread *Thread) SetPC(pc uint64) error {
 	}
 	r := ir.(*linutil.AMD64Registers)
 	r.Regs.Rip = pc
-	thread.dbp.execPtraceFunc(func() { err = sys.PtraceSetRegs(thread.ID, (*sys.PtraceRegs)(r.Regs)) })
-	return err
+	thread.dbp.execPtraceFunc(func() { err = thread.dbp.tracer().SetRegs(thread.ID, (*sys.PtraceRegs)(r.Regs)) })
+	return thread.dbp.exitGuard(err)
 }
 
 // SetSP sets RSP to the value specified by 'sp'
@@ -30,8 +30,8 @@ func (thread *Thread) SetSP(sp uint64) (err error) {
 	}
 	r := ir.(*linutil.AMD64Registers)
 	r.Regs.Rsp = sp
-	thread.dbp.execPtraceFunc(func() { err = sys.PtraceSetRegs(thread.ID, (*sys.PtraceRegs)(r.Regs)) })
-	return
+	thread.dbp.execPtraceFunc(func() { err = thread.dbp.tracer().SetRegs(thread.ID, (*sys.PtraceRegs)(r.Regs)) })
+	return thread.dbp.exitGuard(err)
 }
 
 func (thread *Thread) SetDX(dx uint64) (err error) {
@@ -42,8 +42,21 @@ func (thread *Thread) SetDX(dx uint64) (err error) {
 	}
 	r := ir.(*linutil.AMD64Registers)
 	r.Regs.Rdx = dx
-	thread.dbp.execPtraceFunc(func() { err = sys.PtraceSetRegs(thread.ID, (*sys.PtraceRegs)(r.Regs)) })
-	return
+	thread.dbp.execPtraceFunc(func() { err = thread.dbp.tracer().SetRegs(thread.ID, (*sys.PtraceRegs)(r.Regs)) })
+	return thread.dbp.exitGuard(err)
+}
+
+// SetTLSBase sets FS_BASE, the base address of the thread local storage.
+func (thread *Thread) SetTLSBase(base uint64) (err error) {
+	var ir proc.Registers
+	ir, err = registers(thread, false)
+	if err != nil {
+		return err
+	}
+	r := ir.(*linutil.AMD64Registers)
+	r.Regs.Fs_base = base
+	thread.dbp.execPtraceFunc(func() { err = thread.dbp.tracer().SetRegs(thread.ID, (*sys.PtraceRegs)(r.Regs)) })
+	return thread.dbp.exitGuard(err)
 }
 
 func registers(thread *Thread, floatingPoint bool) (proc.Registers, error) {
@@ -51,9 +64,12 @@ func registers(thread *Thread, floatingPoint bool) (proc.Registers, error) {
 		regs linutil.AMD64PtraceRegs
 		err  error
 	)
-	thread.dbp.execPtraceFunc(func() { err = sys.PtraceGetRegs(thread.ID, (*sys.PtraceRegs)(&regs)) })
+	if thread.dbp.exited {
+		return nil, proc.ErrProcessExited{Pid: thread.dbp.pid}
+	}
+	thread.dbp.execPtraceFunc(func() { err = thread.dbp.tracer().GetRegs(thread.ID, (*sys.PtraceRegs)(&regs)) })
 	if err != nil {
-		return nil, err
+		return nil, thread.dbp.exitGuard(err)
 	}
 	r := &linutil.AMD64Registers{&regs, nil, nil}
 	if floatingPoint {
@@ -85,3 +101,64 @@ func (thread *Thread) fpRegisters() (regs []proc.Register, fpregs linutil.AMD64X
 	}
 	return
 }
+
+// RegisterSnapshot contains the general purpose registers of all the
+// threads of a process, see SaveRegisterSnapshot.
+type RegisterSnapshot struct {
+	threads map[int]threadSnapshot
+}
+
+type threadSnapshot struct {
+	regs linutil.AMD64PtraceRegs
+	bp   proc.BreakpointState
+}
+
+// SaveRegisterSnapshot saves the general purpose registers of all the
+// threads of the process, which must be stopped.
+// Only registers are saved: restoring the snapshot does not restore the
+// memory of the process, or any other state of its threads.
+func (dbp *Process) SaveRegisterSnapshot() (*RegisterSnapshot, error) {
+	if _, err := dbp.Valid(); err != nil {
+		return nil, err
+	}
+	snap := &RegisterSnapshot{threads: make(map[int]threadSnapshot, len(dbp.threads))}
+	for _, th := range dbp.threads {
+		var ts threadSnapshot
+		var err error
+		dbp.execPtraceFunc(func() { err = dbp.tracer().GetRegs(th.ID, (*sys.PtraceRegs)(&ts.regs)) })
+		if err != nil {
+			return nil, dbp.exitGuard(err)
+		}
+		ts.bp = th.CurrentBreakpoint
+		snap.threads[th.ID] = ts
+	}
+	return snap, nil
+}
+
+// RestoreRegisterSnapshot sets the general purpose registers of the
+// threads of the process to the values saved in snap. Threads created
+// after the snapshot was taken are left unchanged, it is an error if a
+// thread of the snapshot has exited.
+// The memory of the process is not restored.
+func (dbp *Process) RestoreRegisterSnapshot(snap *RegisterSnapshot) error {
+	if _, err := dbp.Valid(); err != nil {
+		return err
+	}
+	for tid := range snap.threads {
+		if _, ok := dbp.threads[tid]; !ok {
+			return fmt.Errorf("thread %d of the snapshot has exited", tid)
+		}
+	}
+	for tid, ts := range snap.threads {
+		regs := ts.regs
+		var err error
+		dbp.execPtraceFunc(func() { err = dbp.tracer().SetRegs(tid, (*sys.PtraceRegs)(&regs)) })
+		if err != nil {
+			return dbp.exitGuard(err)
+		}
+		dbp.threads[tid].CurrentBreakpoint = ts.bp
+	}
+	dbp.common.ClearAllGCache()
+	dbp.selectedGoroutine, _ = proc.GetG(dbp.currentThread)
+	return nil
+}
@@ -0,0 +1,75 @@
+package native
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	sys "golang.org/x/sys/unix"
+)
+
+// SignalState describes the signals blocked and pending for a thread.
+type SignalState struct {
+	Blocked       []string // Signals blocked by the thread (SigBlk)
+	Pending       []string // Signals pending for the thread (SigPnd)
+	SharedPending []string // Signals pending for the whole process (ShdPnd)
+}
+
+// SignalState returns the signal mask and the pending signals of thread
+// tid, as reported by /proc/<pid>/task/<tid>/status. A signal that stays
+// pending while being blocked is never delivered to the thread.
+func (dbp *Process) SignalState(tid int) (*SignalState, error) {
+	if _, err := dbp.Valid(); err != nil {
+		return nil, err
+	}
+	if _, ok := dbp.threads[tid]; !ok {
+		return nil, fmt.Errorf("unknown thread %d", tid)
+	}
+	fh, err := os.Open(fmt.Sprintf("/proc/%d/task/%d/status", dbp.pid, tid))
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	r := &SignalState{}
+	fields := map[string]*[]string{"SigBlk": &r.Blocked, "SigPnd": &r.Pending, "ShdPnd": &r.SharedPending}
+	scan := bufio.NewScanner(fh)
+	for scan.Scan() {
+		colon := strings.Index(scan.Text(), ":")
+		if colon < 0 {
+			continue
+		}
+		dst := fields[scan.Text()[:colon]]
+		if dst == nil {
+			continue
+		}
+		mask, err := strconv.ParseUint(strings.TrimSpace(scan.Text()[colon+1:]), 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed line %q in status of thread %d", scan.Text(), tid)
+		}
+		*dst = signalNames(mask)
+	}
+	return r, scan.Err()
+}
+
+// signalNames returns the names of the signals in mask, where bit n
+// represents signal n+1.
+func signalNames(mask uint64) []string {
+	var r []string
+	for i := uint(0); i < 64; i++ {
+		if mask&(1<<i) == 0 {
+			continue
+		}
+		sig := syscall.Signal(i + 1)
+		name := sys.SignalName(sig)
+		if name == "" {
+			// real-time signals have no name
+			name = fmt.Sprintf("signal %d", sig)
+		}
+		r = append(r, name)
+	}
+	return r
+}
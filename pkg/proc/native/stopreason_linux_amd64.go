@@ -0,0 +1,102 @@
+package native
+
+import (
+	sys "golang.org/x/sys/unix"
+)
+
+// StopReason is the reason a thread stopped, see Thread.StopReason.
+type StopReason uint8
+
+const (
+	// StopNone is the stop reason of threads that were stopped by the
+	// debugger because another thread stopped.
+	StopNone StopReason = iota
+	// StopBreakpoint is the stop reason of threads stopped by a software
+	// breakpoint set by the debugger.
+	StopBreakpoint
+	// StopWatchpoint is the stop reason of threads stopped by a hardware
+	// watchpoint, set in the debug registers DR0-DR3.
+	StopWatchpoint
+	// StopSignal is the stop reason of threads stopped by a signal,
+	// including SIGTRAP not caused by the debugger (for example
+	// runtime.Breakpoint).
+	StopSignal
+	// StopStep is the stop reason of threads that executed a single
+	// instruction.
+	StopStep
+	// StopExit is the stop reason of threads of processes that exited.
+	StopExit
+)
+
+func (r StopReason) String() string {
+	switch r {
+	case StopNone:
+		return "none"
+	case StopBreakpoint:
+		return "breakpoint"
+	case StopWatchpoint:
+		return "watchpoint"
+	case StopSignal:
+		return "signal"
+	case StopStep:
+		return "step"
+	case StopExit:
+		return "exit"
+	}
+	return "unknown"
+}
+
+// Bits of the debug status register DR6.
+const (
+	dr6Watchpoints = 0xf     // B0-B3, a watchpoint in DR0-DR3 was triggered
+	dr6SingleStep  = 1 << 14 // BS, single step trap
+)
+
+// StopReason returns the reason the thread stopped the last time the
+// process stopped.
+func (t *Thread) StopReason() StopReason {
+	if t.dbp.exited {
+		return StopExit
+	}
+	return t.os.stopReason
+}
+
+// stopReason determines why the thread stopped from its last wait status,
+// the debug status register and its current breakpoint, which must have
+// already been set. Since the kernel never clears DR6 it is cleared here
+// after reading it.
+func (t *Thread) stopReason() (StopReason, error) {
+	t.os.watchpointHits = nil
+	if t.dbp.exited {
+		return StopExit, nil
+	}
+	if t.Status == nil {
+		return StopNone, nil
+	}
+	status := (*sys.WaitStatus)(t.Status)
+	switch {
+	case status.Exited() || status.Signaled():
+		return StopExit, nil
+	case status.StopSignal() != sys.SIGTRAP:
+		return StopSignal, nil
+	}
+	dr6, err := t.PeekUser(DebugRegisterOffset(6))
+	if err != nil {
+		return StopNone, err
+	}
+	if dr6&(dr6Watchpoints|dr6SingleStep) != 0 {
+		if err := t.PokeUser(DebugRegisterOffset(6), 0); err != nil {
+			return StopNone, err
+		}
+	}
+	switch {
+	case dr6&dr6Watchpoints != 0:
+		t.os.watchpointHits, err = t.watchpointHits(dr6)
+		return StopWatchpoint, err
+	case t.CurrentBreakpoint.Breakpoint != nil:
+		return StopBreakpoint, nil
+	case dr6&dr6SingleStep != 0:
+		return StopStep, nil
+	}
+	return StopSignal, nil
+}
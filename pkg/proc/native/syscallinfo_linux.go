@@ -0,0 +1,178 @@
+package native
+
+import (
+	"bytes"
+	"fmt"
+	"syscall"
+
+	sys "golang.org/x/sys/unix"
+
+	"github.com/go-delve/delve/pkg/proc/linutil"
+)
+
+// SyscallInfo describes the system call a thread is executing.
+type SyscallInfo struct {
+	Number uint64    // System call number (orig_rax)
+	Name   string    // Name of the system call, empty if unknown
+	Args   [6]uint64 // Arguments, in the order of the syscall ABI (rdi, rsi, rdx, r10, r8, r9)
+	Ret    int64     // Current value of rax, a negated errno if the call was interrupted or failed
+}
+
+// ErrNotInSyscall is returned by CurrentSyscall when the thread is not
+// stopped inside a system call.
+type ErrNotInSyscall struct {
+	tid int
+}
+
+func (err ErrNotInSyscall) Error() string {
+	return fmt.Sprintf("thread %d is not in a system call", err.tid)
+}
+
+// CurrentSyscall returns the system call thread tid was executing when it
+// was stopped. The system call number is read from orig_rax, which the
+// kernel sets to -1 when the thread entered the kernel for any other
+// reason (for example a breakpoint).
+func (dbp *Process) CurrentSyscall(tid int) (*SyscallInfo, error) {
+	if _, err := dbp.Valid(); err != nil {
+		return nil, err
+	}
+	thread, ok := dbp.threads[tid]
+	if !ok {
+		return nil, fmt.Errorf("unknown thread %d", tid)
+	}
+	ir, err := registers(thread, false)
+	if err != nil {
+		return nil, err
+	}
+	regs := ir.(*linutil.AMD64Registers).Regs
+	if int64(regs.Orig_rax) < 0 {
+		return nil, ErrNotInSyscall{tid}
+	}
+	return &SyscallInfo{
+		Number: regs.Orig_rax,
+		Name:   syscallNames[regs.Orig_rax],
+		Args:   [6]uint64{regs.Rdi, regs.Rsi, regs.Rdx, regs.R10, regs.R8, regs.R9},
+		Ret:    int64(regs.Rax),
+	}, nil
+}
+
+// amd64SyscallInstruction is the SYSCALL instruction.
+var amd64SyscallInstruction = []byte{0x0f, 0x05}
+
+// maxErrno is the largest errno the kernel returns, values of rax between
+// -maxErrno and -1 are errors, see the Linux x86_64 syscall ABI.
+const maxErrno = 4095
+
+// LastSyscallResult returns the result of the system call thread tid just
+// returned from, the thread must be stopped at the instruction following
+// the SYSCALL instruction, for example by a breakpoint.
+// If the system call failed retval is -1 and errno is the error, which
+// the kernel returns in rax negated, otherwise retval is the value of rax
+// and errno is zero.
+func (dbp *Process) LastSyscallResult(tid int) (retval int64, errno syscall.Errno, err error) {
+	if _, err := dbp.Valid(); err != nil {
+		return 0, 0, err
+	}
+	thread, ok := dbp.threads[tid]
+	if !ok {
+		return 0, 0, fmt.Errorf("unknown thread %d", tid)
+	}
+	ir, err := registers(thread, false)
+	if err != nil {
+		return 0, 0, err
+	}
+	regs := ir.(*linutil.AMD64Registers).Regs
+	instr := make([]byte, len(amd64SyscallInstruction))
+	start := regs.Rip - uint64(len(instr))
+	if _, err := thread.ReadMemory(instr, uintptr(start)); err != nil {
+		return 0, 0, err
+	}
+	// a breakpoint on the SYSCALL instruction replaced its first bytes.
+	for _, bp := range dbp.breakpoints.M {
+		for i := range bp.OriginalData {
+			if addr := bp.Addr + uint64(i); addr >= start && addr < regs.Rip {
+				instr[addr-start] = bp.OriginalData[i]
+			}
+		}
+	}
+	if !bytes.Equal(instr, amd64SyscallInstruction) {
+		return 0, 0, fmt.Errorf("thread %d is not stopped after a system call", tid)
+	}
+	ret := int64(regs.Rax)
+	if ret < 0 && ret >= -maxErrno {
+		return -1, syscall.Errno(-ret), nil
+	}
+	return ret, 0, nil
+}
+
+// syscallNames contains the names of the system calls commonly seen in Go
+// programs.
+var syscallNames = map[uint64]string{
+	sys.SYS_READ:              "read",
+	sys.SYS_WRITE:             "write",
+	sys.SYS_OPEN:              "open",
+	sys.SYS_CLOSE:             "close",
+	sys.SYS_STAT:              "stat",
+	sys.SYS_FSTAT:             "fstat",
+	sys.SYS_LSTAT:             "lstat",
+	sys.SYS_POLL:              "poll",
+	sys.SYS_LSEEK:             "lseek",
+	sys.SYS_MMAP:              "mmap",
+	sys.SYS_MPROTECT:          "mprotect",
+	sys.SYS_MUNMAP:            "munmap",
+	sys.SYS_BRK:               "brk",
+	sys.SYS_RT_SIGACTION:      "rt_sigaction",
+	sys.SYS_RT_SIGPROCMASK:    "rt_sigprocmask",
+	sys.SYS_RT_SIGRETURN:      "rt_sigreturn",
+	sys.SYS_IOCTL:             "ioctl",
+	sys.SYS_PREAD64:           "pread64",
+	sys.SYS_PWRITE64:          "pwrite64",
+	sys.SYS_READV:             "readv",
+	sys.SYS_WRITEV:            "writev",
+	sys.SYS_PIPE:              "pipe",
+	sys.SYS_SELECT:            "select",
+	sys.SYS_SCHED_YIELD:       "sched_yield",
+	sys.SYS_MADVISE:           "madvise",
+	sys.SYS_NANOSLEEP:         "nanosleep",
+	sys.SYS_GETPID:            "getpid",
+	sys.SYS_SOCKET:            "socket",
+	sys.SYS_CONNECT:           "connect",
+	sys.SYS_ACCEPT:            "accept",
+	sys.SYS_SENDTO:            "sendto",
+	sys.SYS_RECVFROM:          "recvfrom",
+	sys.SYS_SENDMSG:           "sendmsg",
+	sys.SYS_RECVMSG:           "recvmsg",
+	sys.SYS_BIND:              "bind",
+	sys.SYS_LISTEN:            "listen",
+	sys.SYS_CLONE:             "clone",
+	sys.SYS_FORK:              "fork",
+	sys.SYS_EXECVE:            "execve",
+	sys.SYS_EXIT:              "exit",
+	sys.SYS_WAIT4:             "wait4",
+	sys.SYS_KILL:              "kill",
+	sys.SYS_FCNTL:             "fcntl",
+	sys.SYS_FSYNC:             "fsync",
+	sys.SYS_GETDENTS:          "getdents",
+	sys.SYS_SIGALTSTACK:       "sigaltstack",
+	sys.SYS_ARCH_PRCTL:        "arch_prctl",
+	sys.SYS_GETTID:            "gettid",
+	sys.SYS_TKILL:             "tkill",
+	sys.SYS_FUTEX:             "futex",
+	sys.SYS_SCHED_GETAFFINITY: "sched_getaffinity",
+	sys.SYS_EPOLL_CREATE:      "epoll_create",
+	sys.SYS_GETDENTS64:        "getdents64",
+	sys.SYS_CLOCK_GETTIME:     "clock_gettime",
+	sys.SYS_CLOCK_NANOSLEEP:   "clock_nanosleep",
+	sys.SYS_EXIT_GROUP:        "exit_group",
+	sys.SYS_EPOLL_WAIT:        "epoll_wait",
+	sys.SYS_EPOLL_CTL:         "epoll_ctl",
+	sys.SYS_TGKILL:            "tgkill",
+	sys.SYS_WAITID:            "waitid",
+	sys.SYS_OPENAT:            "openat",
+	sys.SYS_PSELECT6:          "pselect6",
+	sys.SYS_PPOLL:             "ppoll",
+	sys.SYS_EPOLL_PWAIT:       "epoll_pwait",
+	sys.SYS_ACCEPT4:           "accept4",
+	sys.SYS_EPOLL_CREATE1:     "epoll_create1",
+	sys.SYS_PIPE2:             "pipe2",
+}
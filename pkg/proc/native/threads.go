@@ -127,8 +127,10 @@ func (t *Thread) SetCurrentBreakpoint() error {
 		if t.CurrentBreakpoint.Breakpoint != nil && t.CurrentBreakpoint.Active {
 			if g, err := proc.GetG(t); err == nil {
 				t.CurrentBreakpoint.HitCount[g.ID]++
+				t.CurrentBreakpoint.CheckOncePerGoroutine(g.ID)
 			}
 			t.CurrentBreakpoint.TotalHitCount++
+			t.CurrentBreakpoint.CheckIgnoreCount()
 		}
 	}
 	return nil
@@ -114,6 +114,9 @@ func (t *Thread) WriteMemory(addr uintptr, data []byte) (int, error) {
 	if t.dbp.exited {
 		return 0, proc.ErrProcessExited{Pid: t.dbp.pid}
 	}
+	if t.dbp.common.Running() {
+		return 0, proc.ErrProcessRunning
+	}
 	if len(data) == 0 {
 		return 0, nil
 	}
@@ -132,6 +135,9 @@ func (t *Thread) ReadMemory(buf []byte, addr uintptr) (int, error) {
 	if t.dbp.exited {
 		return 0, proc.ErrProcessExited{Pid: t.dbp.pid}
 	}
+	if t.dbp.common.Running() {
+		return 0, proc.ErrProcessRunning
+	}
 	if len(buf) == 0 {
 		return 0, nil
 	}
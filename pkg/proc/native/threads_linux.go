@@ -3,7 +3,6 @@ package native
 import (
 	"fmt"
 	"syscall"
-	"unsafe"
 
 	sys "golang.org/x/sys/unix"
 
@@ -18,6 +17,17 @@ type WaitStatus sys.WaitStatus
 type OSSpecificDetails struct {
 	registers sys.PtraceRegs
 	running   bool
+	// delayedSignals are the signals received while single stepping the
+	// thread, they will be delivered the next time the thread is resumed.
+	delayedSignals []int
+	// sigstopPending is set when stop sent a SIGSTOP to the thread that
+	// was not reported yet.
+	sigstopPending bool
+	// stopReason is the reason the thread stopped, see StopReason.
+	stopReason StopReason
+	// watchpointHits are the watchpoints triggered by the thread, see
+	// WatchpointHits.
+	watchpointHits []WatchpointHit
 }
 
 func (t *Thread) stop() (err error) {
@@ -26,6 +36,7 @@ func (t *Thread) stop() (err error) {
 		err = fmt.Errorf("stop err %s on thread %d", err, t.ID)
 		return
 	}
+	t.os.sigstopPending = true
 	return
 }
 
@@ -37,20 +48,38 @@ func (t *Thread) Stopped() bool {
 }
 
 func (t *Thread) resume() error {
-	return t.resumeWithSig(0)
+	sigs := t.os.delayedSignals
+	t.os.delayedSignals = nil
+	if len(sigs) == 0 {
+		return t.resumeWithSig(0)
+	}
+	// PTRACE_CONT delivers a single signal, the others are sent to the thread
+	// again and will be reported to us, and delivered, after it resumes.
+	for _, sig := range sigs[1:] {
+		if err := sys.Tgkill(t.dbp.pid, t.ID, syscall.Signal(sig)); err != nil {
+			return err
+		}
+	}
+	return t.resumeWithSig(sigs[0])
 }
 
 func (t *Thread) resumeWithSig(sig int) (err error) {
 	t.os.running = true
-	t.dbp.execPtraceFunc(func() { err = PtraceCont(t.ID, sig) })
+	t.dbp.memCache.invalidate()
+	t.dbp.os.memoryMaps = nil
+	t.dbp.log.Debugf("cont tid=%d sig=%d", t.ID, sig)
+	t.dbp.execPtraceFunc(func() { err = t.dbp.tracer().Cont(t.ID, sig) })
 	return
 }
 
 func (t *Thread) singleStep() (err error) {
+	t.dbp.memCache.invalidate()
+	t.dbp.os.memoryMaps = nil
 	for {
-		t.dbp.execPtraceFunc(func() { err = sys.PtraceSingleStep(t.ID) })
+		t.dbp.log.Debugf("singlestep tid=%d", t.ID)
+		t.dbp.execPtraceFunc(func() { err = t.dbp.tracer().SingleStep(t.ID) })
 		if err != nil {
-			return err
+			return t.dbp.exitGuard(err)
 		}
 		wpid, status, err := t.dbp.waitFast(t.ID)
 		if err != nil {
@@ -65,8 +94,17 @@ func (t *Thread) singleStep() (err error) {
 			return proc.ErrProcessExited{Pid: t.dbp.pid, Status: rs}
 		}
 		if wpid == t.ID && status.StopSignal() == sys.SIGTRAP {
+			t.Status = (*WaitStatus)(status)
+			t.os.stopReason, _ = t.stopReason()
 			return nil
 		}
+		if wpid == t.ID && status.Stopped() && status.StopSignal() != sys.SIGSTOP {
+			// The thread received a signal before executing the instruction.
+			// Delivering it now would make us step into the signal handler,
+			// instead we step with no signal and deliver it when the thread is
+			// resumed.
+			t.os.delayedSignals = append(t.os.delayedSignals, int(status.StopSignal()))
+		}
 	}
 }
 
@@ -91,7 +129,7 @@ func (t *Thread) restoreRegisters(savedRegs proc.Registers) error {
 		oldRegs := (*sys.PtraceRegs)(sr.Regs)
 
 		var currentRegs sys.PtraceRegs
-		restoreRegistersErr = sys.PtraceGetRegs(t.ID, &currentRegs)
+		restoreRegistersErr = t.dbp.tracer().GetRegs(t.ID, &currentRegs)
 		if restoreRegistersErr != nil {
 			return
 		}
@@ -99,34 +137,45 @@ func (t *Thread) restoreRegisters(savedRegs proc.Registers) error {
 		oldRegs.Fs_base = currentRegs.Fs_base
 		oldRegs.Gs_base = currentRegs.Gs_base
 
-		restoreRegistersErr = sys.PtraceSetRegs(t.ID, oldRegs)
+		restoreRegistersErr = t.dbp.tracer().SetRegs(t.ID, oldRegs)
 
 		if restoreRegistersErr != nil {
 			return
 		}
 		if sr.Fpregset.Xsave != nil {
-			iov := sys.Iovec{Base: &sr.Fpregset.Xsave[0], Len: uint64(len(sr.Fpregset.Xsave))}
-			_, _, restoreRegistersErr = syscall.Syscall6(syscall.SYS_PTRACE, sys.PTRACE_SETREGSET, uintptr(t.ID), _NT_X86_XSTATE, uintptr(unsafe.Pointer(&iov)), 0, 0)
+			restoreRegistersErr = t.dbp.tracer().SetXstate(t.ID, sr.Fpregset.Xsave)
 			return
 		}
 
-		_, _, restoreRegistersErr = syscall.Syscall6(syscall.SYS_PTRACE, sys.PTRACE_SETFPREGS, uintptr(t.ID), uintptr(0), uintptr(unsafe.Pointer(&sr.Fpregset.AMD64PtraceFpRegs)), 0, 0)
-		return
+		restoreRegistersErr = t.dbp.tracer().SetFpRegs(t.ID, &sr.Fpregset.AMD64PtraceFpRegs)
 	})
-	if restoreRegistersErr == syscall.Errno(0) {
-		restoreRegistersErr = nil
-	}
 	return restoreRegistersErr
 }
 
+// WriteMemory writes the contents of data at addr.
+// PTRACE_POKEDATA can only write whole words, PtracePokeData reads back the
+// words that data only partially covers, at the beginning and the end, and
+// merges them with data so that the bytes surrounding it, for example the
+// instructions around a breakpoint, are preserved.
 func (t *Thread) WriteMemory(addr uintptr, data []byte) (written int, err error) {
 	if t.dbp.exited {
 		return 0, proc.ErrProcessExited{Pid: t.dbp.pid}
 	}
+	if t.dbp.common.Running() {
+		return 0, proc.ErrProcessRunning
+	}
 	if len(data) == 0 {
 		return
 	}
-	t.dbp.execPtraceFunc(func() { written, err = sys.PtracePokeData(t.ID, addr, data) })
+	if t.dbp.validateAddresses {
+		if err := t.dbp.checkMapped(addr, len(data)); err != nil {
+			return 0, err
+		}
+	}
+	t.dbp.log.Debugf("poke tid=%d addr=%#x len=%d", t.ID, addr, len(data))
+	written, err = t.writeMemory(addr, data)
+	t.dbp.memCache.write(addr, data[:written])
+	err = t.dbp.exitGuard(err)
 	return
 }
 
@@ -134,12 +183,68 @@ func (t *Thread) ReadMemory(data []byte, addr uintptr) (n int, err error) {
 	if t.dbp.exited {
 		return 0, proc.ErrProcessExited{Pid: t.dbp.pid}
 	}
+	if t.dbp.common.Running() {
+		return 0, proc.ErrProcessRunning
+	}
 	if len(data) == 0 {
 		return
 	}
-	t.dbp.execPtraceFunc(func() { _, err = sys.PtracePeekData(t.ID, addr, data) })
+	readfn := func(buf []byte, addr uintptr) (err error) {
+		if t.dbp.validateAddresses {
+			if err := t.dbp.checkMapped(addr, len(buf)); err != nil {
+				return err
+			}
+		}
+		t.dbp.log.Debugf("peek tid=%d addr=%#x len=%d", t.ID, addr, len(buf))
+		return t.readMemory(buf, addr)
+	}
+	if t.dbp.memCacheDisabled || t.dbp.os.attachedThread != 0 {
+		// the threads that AttachThread leaves running untraced can modify
+		// the memory of the target at any time.
+		err = readfn(data, addr)
+	} else {
+		err = t.dbp.memCache.read(data, addr, readfn)
+	}
 	if err == nil {
 		n = len(data)
 	}
+	err = t.dbp.exitGuard(err)
 	return
 }
+
+// readMemory reads len(buf) bytes at addr, with process_vm_readv if
+// possible, falling back to PTRACE_PEEKDATA for the bytes it could not
+// read.
+func (t *Thread) readMemory(buf []byte, addr uintptr) (err error) {
+	n := t.processVM(buf, addr, false)
+	if n == len(buf) {
+		return nil
+	}
+	t.dbp.execPtraceFunc(func() { _, err = t.dbp.tracer().PeekData(t.ID, addr+uintptr(n), buf[n:]) })
+	return err
+}
+
+// writeMemory writes data at addr, with process_vm_writev if possible,
+// falling back to PTRACE_POKEDATA for the bytes it could not write, for
+// example because they belong to a read-only mapping.
+func (t *Thread) writeMemory(addr uintptr, data []byte) (written int, err error) {
+	n := t.processVM(data, addr, true)
+	if n == len(data) {
+		return n, nil
+	}
+	t.dbp.execPtraceFunc(func() { written, err = t.dbp.tracer().PokeData(t.ID, addr+uintptr(n), data[n:]) })
+	return n + written, err
+}
+
+func (t *Thread) processVM(buf []byte, addr uintptr, write bool) int {
+	// process_vm_readv and process_vm_writev bypass the ptracer, they can
+	// only be used on real processes.
+	if _, real := t.dbp.tracer().(sysPtracer); !real || t.dbp.os.noProcessVM {
+		return 0
+	}
+	n, err := processVM(t.ID, buf, addr, write)
+	if err == syscall.ENOSYS {
+		t.dbp.os.noProcessVM = true
+	}
+	return n
+}
@@ -0,0 +1,188 @@
+package native
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// startTracee starts a process and attaches to it, returns its main thread
+// and the address and size of its stack mapping and a function that kills
+// it.
+func startTracee(t testing.TB) (*Thread, uint64, uint64, func()) {
+	cmd := exec.Command("sleep", "10")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	dbp, err := AttachNoWait(cmd.Process.Pid)
+	if err != nil {
+		cmd.Process.Kill()
+		t.Fatal(err)
+	}
+	kill := func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+		dbp.postExit()
+	}
+	if _, _, err := dbp.waitFast(dbp.pid); err != nil {
+		kill()
+		t.Fatal(err)
+	}
+	th, err := dbp.addThread(dbp.pid, false)
+	if err != nil {
+		kill()
+		t.Fatal(err)
+	}
+	maps, err := dbp.MemoryMaps()
+	if err != nil {
+		kill()
+		t.Fatal(err)
+	}
+	for _, m := range maps {
+		if m.Filename == "[stack]" {
+			return th, m.Addr, m.Size, kill
+		}
+	}
+	kill()
+	t.Fatal("stack mapping not found")
+	return nil, 0, 0, nil
+}
+
+// withPtraceMemory disables process_vm_readv and process_vm_writev for
+// dbp, returns a function that enables them again.
+func withPtraceMemory(dbp *Process) func() {
+	old := dbp.os.noProcessVM
+	dbp.os.noProcessVM = true
+	return func() { dbp.os.noProcessVM = old }
+}
+
+func TestProcessVMMemory(t *testing.T) {
+	th, stackAddr, stackSize, kill := startTracee(t)
+	defer kill()
+
+	// unaligned ranges at the top and at the bottom of the stack
+	for _, tc := range []struct{ addr, size uint64 }{
+		{stackAddr + stackSize - 4099, 4099},
+		{stackAddr + 3, 17},
+	} {
+		vmbuf := make([]byte, tc.size)
+		if err := th.readMemory(vmbuf, uintptr(tc.addr)); err != nil {
+			t.Fatalf("readMemory(%#x, %d): %v", tc.addr, tc.size, err)
+		}
+		ptracebuf := make([]byte, tc.size)
+		restore := withPtraceMemory(th.dbp)
+		err := th.readMemory(ptracebuf, uintptr(tc.addr))
+		restore()
+		if err != nil {
+			t.Fatalf("readMemory(%#x, %d) with ptrace: %v", tc.addr, tc.size, err)
+		}
+		if !bytes.Equal(vmbuf, ptracebuf) {
+			t.Fatalf("process_vm_readv and ptrace read different data at %#x", tc.addr)
+		}
+	}
+
+	// write with one method and read back with the other one
+	addr := uintptr(stackAddr + 5)
+	data := []byte("process_vm_writev")
+	if n, err := th.writeMemory(addr, data); err != nil || n != len(data) {
+		t.Fatalf("writeMemory: %d %v", n, err)
+	}
+	buf := make([]byte, len(data))
+	restore := withPtraceMemory(th.dbp)
+	err := th.readMemory(buf, addr)
+	if err != nil || !bytes.Equal(buf, data) {
+		restore()
+		t.Fatalf("read back with ptrace %q %v, expected %q", buf, err, data)
+	}
+	data = []byte("ptrace")
+	n, err := th.writeMemory(addr, data)
+	restore()
+	if err != nil || n != len(data) {
+		t.Fatalf("writeMemory with ptrace: %d %v", n, err)
+	}
+	buf = make([]byte, len("process_vm_writev"))
+	if err := th.readMemory(buf, addr); err != nil || string(buf) != "ptraces_vm_writev" {
+		t.Fatalf("read back with process_vm_readv %q %v", buf, err)
+	}
+
+	// process_vm_writev can not write to the text segment, where
+	// breakpoints are written, writeMemory must fall back to ptrace.
+	maps, err := th.dbp.MemoryMaps()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range maps {
+		if !m.Exec || m.Write || m.Filename == "" || m.Filename[0] == '[' {
+			continue
+		}
+		orig := make([]byte, 3)
+		if err := th.readMemory(orig, uintptr(m.Addr+1)); err != nil {
+			t.Fatalf("readMemory(%#x): %v", m.Addr+1, err)
+		}
+		if n, err := th.writeMemory(uintptr(m.Addr+1), []byte{0xcc, 0xcc, 0xcc}); err != nil || n != 3 {
+			t.Fatalf("writeMemory to text segment: %d %v", n, err)
+		}
+		buf := make([]byte, 3)
+		if err := th.readMemory(buf, uintptr(m.Addr+1)); err != nil || !bytes.Equal(buf, []byte{0xcc, 0xcc, 0xcc}) {
+			t.Fatalf("read back from text segment %x %v", buf, err)
+		}
+		th.writeMemory(uintptr(m.Addr+1), orig)
+		break
+	}
+}
+
+func TestValidateAddresses(t *testing.T) {
+	th, stackAddr, stackSize, kill := startTracee(t)
+	defer kill()
+
+	if !th.dbp.ValidAddress(stackAddr) || !th.dbp.ValidAddress(stackAddr+stackSize-1) {
+		t.Fatalf("stack %#x-%#x not valid", stackAddr, stackAddr+stackSize)
+	}
+	if th.dbp.ValidAddress(0) {
+		t.Fatal("address 0 valid")
+	}
+
+	th.dbp.SetValidateAddresses(true)
+	buf := make([]byte, 8)
+	if _, err := th.ReadMemory(buf, uintptr(stackAddr+stackSize-8)); err != nil {
+		t.Fatalf("ReadMemory at the top of the stack: %v", err)
+	}
+	for _, addr := range []uint64{0x8, stackAddr + stackSize - 4} {
+		_, err := th.ReadMemory(buf, uintptr(addr))
+		if _, ok := err.(ErrAddressNotMapped); !ok {
+			t.Fatalf("ReadMemory(%#x): expected ErrAddressNotMapped, got %v", addr, err)
+		}
+		if !strings.Contains(err.Error(), "not mapped") {
+			t.Fatalf("ReadMemory(%#x): unexpected error message %q", addr, err)
+		}
+		if _, err := th.WriteMemory(uintptr(addr), buf); err == nil {
+			t.Fatalf("WriteMemory(%#x) succeeded", addr)
+		}
+	}
+}
+
+func BenchmarkReadMemory(b *testing.B) {
+	th, stackAddr, stackSize, kill := startTracee(b)
+	defer kill()
+	const size = 64 * 1024
+	if stackSize < size {
+		b.Skipf("stack too small: %d", stackSize)
+	}
+	addr := uintptr(stackAddr + stackSize - size)
+	buf := make([]byte, size)
+
+	read := func(b *testing.B) {
+		b.SetBytes(size)
+		for i := 0; i < b.N; i++ {
+			if err := th.readMemory(buf, addr); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	b.Run("process_vm_readv", read)
+	b.Run("ptrace", func(b *testing.B) {
+		defer withPtraceMemory(th.dbp)()
+		read(b)
+	})
+}
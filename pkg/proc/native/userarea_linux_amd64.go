@@ -0,0 +1,60 @@
+package native
+
+import (
+	"fmt"
+
+	"github.com/go-delve/delve/pkg/proc"
+)
+
+// Layout of struct user, see /usr/include/x86_64-linux-gnu/sys/user.h
+const (
+	userAreaSize       = 912 // sizeof(struct user)
+	userDebugRegOffset = 848 // offsetof(struct user, u_debugreg)
+	numDebugRegs       = 8
+)
+
+// DebugRegisterOffset returns the offset of debug register DRi in the user
+// area, to be used with PeekUser and PokeUser.
+func DebugRegisterOffset(i int) uintptr {
+	return uintptr(userDebugRegOffset + i*8)
+}
+
+func checkUserOffset(offset uintptr) error {
+	if offset%8 != 0 || offset > userAreaSize-8 {
+		return fmt.Errorf("invalid user area offset %#x", offset)
+	}
+	return nil
+}
+
+// PeekUser reads the word at offset in the user area of the thread (struct
+// user), which contains, among other things, the debug registers.
+// The offset must be aligned to a word boundary.
+func (t *Thread) PeekUser(offset uintptr) (uint64, error) {
+	if t.dbp.exited {
+		return 0, proc.ErrProcessExited{Pid: t.dbp.pid}
+	}
+	if err := checkUserOffset(offset); err != nil {
+		return 0, err
+	}
+	var val uintptr
+	var err error
+	t.dbp.log.Debugf("peekuser tid=%d offset=%#x", t.ID, offset)
+	t.dbp.execPtraceFunc(func() { val, err = PtracePeekUser(t.ID, offset) })
+	return uint64(val), t.dbp.exitGuard(err)
+}
+
+// PokeUser writes val at offset in the user area of the thread. The kernel
+// only allows writing some fields of the user area, for example the debug
+// registers, the address written to DR0-DR3 must belong to user space.
+func (t *Thread) PokeUser(offset uintptr, val uint64) error {
+	if t.dbp.exited {
+		return proc.ErrProcessExited{Pid: t.dbp.pid}
+	}
+	if err := checkUserOffset(offset); err != nil {
+		return err
+	}
+	var err error
+	t.dbp.log.Debugf("pokeuser tid=%d offset=%#x val=%#x", t.ID, offset, val)
+	t.dbp.execPtraceFunc(func() { err = PtracePokeUser(t.ID, offset, uintptr(val)) })
+	return t.dbp.exitGuard(err)
+}
@@ -0,0 +1,358 @@
+package native
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/go-delve/delve/pkg/proc"
+)
+
+// WatchKind is the kind of memory access that triggers a watchpoint, its
+// value is the R/W field of DR7 for the watchpoint.
+type WatchKind uint8
+
+const (
+	// WatchWrite watchpoints are triggered by writes.
+	WatchWrite WatchKind = 1
+	// WatchReadWrite watchpoints are triggered by reads and writes.
+	WatchReadWrite WatchKind = 3
+)
+
+const (
+	// numWatchpoints is the number of debug registers, DR0-DR3, that hold
+	// the address of a watchpoint.
+	numWatchpoints = 4
+	// maxWatchpointSize is the size of the largest memory area a single
+	// watchpoint can watch.
+	maxWatchpointSize = 8
+)
+
+// watchpoint is a hardware watchpoint set with SetWatchpoint or
+// WatchVariable.
+type watchpoint struct {
+	name string
+	addr uint64
+	size int
+	kind WatchKind
+
+	// varAddr is the address of the watched memory and value its last
+	// known value, read when the watchpoint is set and every time it's hit.
+	varAddr uint64
+	value   []byte
+
+	// frame is the stack frame of the watched variable, nil if it's not a
+	// stack variable.
+	frame *watchFrame
+}
+
+// watchFrame identifies the stack frame of a variable watched by
+// WatchVariable, the watchpoint is cleared when the frame returns.
+type watchFrame struct {
+	goroutineID int
+	cfa         int64
+	fnEntry     uint64
+}
+
+// maxWatchFrameDepth is how deep in the stack of its goroutine the frame of
+// a watched variable is searched.
+const maxWatchFrameDepth = 1000
+
+// WatchpointHit describes a watchpoint triggered by a thread, see
+// Thread.WatchpointHits.
+type WatchpointHit struct {
+	Name     string // Expression passed to WatchVariable or address passed to SetWatchpoint
+	OldValue []byte // Value of the memory when the watchpoint was set or last hit
+	NewValue []byte // Value of the memory after the access
+
+	wp *watchpoint
+}
+
+// dr7 returns the bits of DR7 that enable the i-th watchpoint: the local
+// enable bit Li, the R/Wi field and the LENi field.
+func (wp *watchpoint) dr7(i int) uint64 {
+	var length uint64
+	switch wp.size {
+	case 1:
+		length = 0
+	case 2:
+		length = 1
+	case 4:
+		length = 3
+	case 8:
+		length = 2
+	}
+	return 1<<uint(2*i) | uint64(wp.kind)<<uint(16+4*i) | length<<uint(18+4*i)
+}
+
+// SetWatchpoint sets a hardware watchpoint on the size bytes at addr that
+// stops the target when they are accessed as specified by kind. Every time
+// the watchpoint is hit the previous and the current contents of the
+// memory are reported by Thread.WatchpointHits.
+// At most 8 bytes can be watched, smaller areas are watched by the smallest
+// aligned area of 1, 2, 4 or 8 bytes containing them. At most 4 watchpoints
+// can be set.
+func (dbp *Process) SetWatchpoint(addr uint64, size int, kind WatchKind) error {
+	return dbp.setWatchpoint(fmt.Sprintf("%#x", addr), addr, size, kind, nil)
+}
+
+// WatchVariable sets a hardware watchpoint on the memory of the variable
+// name, evaluated in the topmost frame of the current thread, that stops the
+// target when the variable is accessed as specified by kind. The stop is
+// reported by Thread.StopReason as StopWatchpoint.
+// Variables larger than 8 bytes can not be watched, see SetWatchpoint.
+// The watchpoint on a local variable of the topmost frame is cleared when
+// the frame returns.
+func (dbp *Process) WatchVariable(name string, kind WatchKind) error {
+	if _, err := dbp.Valid(); err != nil {
+		return err
+	}
+	scope, err := proc.ThreadScope(dbp.currentThread)
+	if err != nil {
+		return err
+	}
+	v, err := scope.EvalVariable(name, proc.LoadConfig{})
+	if err != nil {
+		return err
+	}
+	if v.Unreadable != nil {
+		return fmt.Errorf("can not watch %s: %v", name, v.Unreadable)
+	}
+	if v.Addr == 0 || v.Flags&proc.VariableConstant != 0 {
+		return fmt.Errorf("can not watch %s: it has no address", name)
+	}
+	frame, err := dbp.watchedFrame(uint64(v.Addr))
+	if err != nil {
+		return fmt.Errorf("can not watch %s: %v", name, err)
+	}
+	return dbp.setWatchpoint(name, uint64(v.Addr), int(v.RealType.Size()), kind, frame)
+}
+
+// ClearWatchpoint clears the watchpoint on the memory at addr, the address
+// passed to SetWatchpoint or the address of the variable passed to
+// WatchVariable.
+func (dbp *Process) ClearWatchpoint(addr uint64) error {
+	if _, err := dbp.Valid(); err != nil {
+		return err
+	}
+	for i, wp := range dbp.os.watchpoints {
+		if wp != nil && wp.varAddr == addr {
+			dbp.os.watchpoints[i] = nil
+			return dbp.writeAllWatchpoints()
+		}
+	}
+	return fmt.Errorf("no watchpoint at %#x", addr)
+}
+
+// watchedFrame returns the topmost frame of the current goroutine if addr
+// is one of its local variables or arguments, nil otherwise.
+func (dbp *Process) watchedFrame(addr uint64) (*watchFrame, error) {
+	g, err := proc.GetG(dbp.currentThread)
+	if err != nil || g == nil {
+		// no goroutine, for example before the runtime is initialized
+		return nil, nil
+	}
+	frames, err := g.Stacktrace(1, false, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(frames) == 0 || frames[0].Current.Fn == nil {
+		return nil, nil
+	}
+	// arguments are stored in the frame of the caller, like in FrameToScope.
+	hi := uint64(frames[0].Regs.CFA)
+	if len(frames) > 1 && frames[0].SystemStack == frames[1].SystemStack {
+		hi = uint64(frames[1].Regs.CFA)
+	}
+	if addr < frames[0].Regs.SP() || addr >= hi {
+		return nil, nil
+	}
+	return &watchFrame{goroutineID: g.ID, cfa: frames[0].Regs.CFA, fnEntry: frames[0].Current.Fn.Entry}, nil
+}
+
+// inScope returns true if frame is still on the stack of its goroutine.
+// gs are the goroutines of the process.
+func (frame *watchFrame) inScope(gs []*proc.G) bool {
+	for _, g := range gs {
+		if g.ID != frame.goroutineID {
+			continue
+		}
+		frames, err := g.Stacktrace(maxWatchFrameDepth, false, false)
+		if err != nil {
+			// keep the watchpoint if we can't tell
+			return true
+		}
+		for _, f := range frames {
+			if f.Regs.CFA == frame.cfa && f.Current.Fn != nil && f.Current.Fn.Entry == frame.fnEntry {
+				return true
+			}
+		}
+		return false
+	}
+	// the goroutine exited
+	return false
+}
+
+// clearWatchpointsOutOfScope clears the watchpoints on stack variables
+// whose frame returned and removes their hits from trapthread. It returns
+// true if they were the only reason why trapthread stopped, and no other
+// thread is stopped at a breakpoint, in which case the process must be
+// resumed again.
+func (dbp *Process) clearWatchpointsOutOfScope(trapthread *Thread) (bool, error) {
+	var gs []*proc.G
+	cleared := false
+	for i, wp := range dbp.os.watchpoints {
+		if wp == nil || wp.frame == nil {
+			continue
+		}
+		if gs == nil {
+			var err error
+			if gs, _, err = proc.GoroutinesInfo(dbp, 0, 0); err != nil {
+				return false, err
+			}
+		}
+		if wp.frame.inScope(gs) {
+			continue
+		}
+		dbp.os.watchpoints[i] = nil
+		cleared = true
+	}
+	if !cleared {
+		return false, nil
+	}
+	if err := dbp.writeAllWatchpoints(); err != nil {
+		return false, err
+	}
+	if trapthread == nil || trapthread.os.stopReason != StopWatchpoint {
+		return false, nil
+	}
+	hits := trapthread.os.watchpointHits[:0]
+	for _, hit := range trapthread.os.watchpointHits {
+		if dbp.hasWatchpoint(hit.wp) {
+			hits = append(hits, hit)
+		}
+	}
+	trapthread.os.watchpointHits = hits
+	if len(hits) > 0 || dbp.manualStopPending() {
+		return false, nil
+	}
+	trapthread.os.stopReason = StopNone
+	for _, th := range dbp.threads {
+		if th.CurrentBreakpoint.Breakpoint != nil {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// hasWatchpoint returns true if wp is set.
+func (dbp *Process) hasWatchpoint(wp *watchpoint) bool {
+	for _, wp2 := range dbp.os.watchpoints {
+		if wp2 == wp {
+			return true
+		}
+	}
+	return false
+}
+
+func (dbp *Process) setWatchpoint(name string, addr uint64, size int, kind WatchKind, frame *watchFrame) error {
+	if _, err := dbp.Valid(); err != nil {
+		return err
+	}
+	if kind != WatchWrite && kind != WatchReadWrite {
+		return fmt.Errorf("unsupported watchpoint kind %d", kind)
+	}
+	if size <= 0 {
+		return fmt.Errorf("can not watch %s: it has size zero", name)
+	}
+	if size > maxWatchpointSize {
+		return fmt.Errorf("can not watch %s: its size, %d bytes, is larger than the maximum size of a watchpoint, %d bytes", name, size, maxWatchpointSize)
+	}
+	wp := &watchpoint{name: name, addr: addr, size: 1, kind: kind, varAddr: addr, value: make([]byte, size), frame: frame}
+	if _, err := dbp.currentThread.ReadMemory(wp.value, uintptr(addr)); err != nil {
+		return fmt.Errorf("can not watch %s: %v", name, err)
+	}
+	for wp.size < size || (wp.addr+uint64(size)-1)/uint64(wp.size) != wp.addr/uint64(wp.size) {
+		wp.size *= 2
+		if wp.size > maxWatchpointSize {
+			return fmt.Errorf("can not watch %s: not contained in an aligned area of %d bytes", name, maxWatchpointSize)
+		}
+	}
+	wp.addr &^= uint64(wp.size - 1)
+
+	i := 0
+	for i < numWatchpoints && dbp.os.watchpoints[i] != nil {
+		i++
+	}
+	if i >= numWatchpoints {
+		return errors.New("no free hardware watchpoint")
+	}
+	dbp.os.watchpoints[i] = wp
+	if err := dbp.writeAllWatchpoints(); err != nil {
+		dbp.os.watchpoints[i] = nil
+		dbp.writeAllWatchpoints()
+		return err
+	}
+	return nil
+}
+
+// WatchpointHits returns the watchpoints that were triggered by the thread
+// the last time the process stopped, with the contents of the watched
+// memory before and after the access. For read watchpoints the two values
+// are the same.
+func (t *Thread) WatchpointHits() []WatchpointHit {
+	return t.os.watchpointHits
+}
+
+// watchpointHits returns the watchpoints triggered according to the B0-B3
+// bits of dr6 and records the current value of the watched memory.
+func (t *Thread) watchpointHits(dr6 uint64) ([]WatchpointHit, error) {
+	var hits []WatchpointHit
+	for i, wp := range t.dbp.os.watchpoints {
+		if wp == nil || dr6&(1<<uint(i)) == 0 {
+			continue
+		}
+		value := make([]byte, len(wp.value))
+		if _, err := t.ReadMemory(value, uintptr(wp.varAddr)); err != nil {
+			return hits, fmt.Errorf("could not read %s: %v", wp.name, err)
+		}
+		hits = append(hits, WatchpointHit{Name: wp.name, OldValue: wp.value, NewValue: value, wp: wp})
+		wp.value = value
+	}
+	return hits, nil
+}
+
+// hasWatchpoints returns true if any watchpoint is set.
+func (dbp *Process) hasWatchpoints() bool {
+	return dbp.os.watchpoints != [numWatchpoints]*watchpoint{}
+}
+
+// writeAllWatchpoints writes the watchpoints of the process in the debug
+// registers of all its threads.
+func (dbp *Process) writeAllWatchpoints() error {
+	for _, th := range dbp.threads {
+		if err := dbp.writeWatchpoints(th); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeWatchpoints writes the watchpoints of the process in the debug
+// registers of th. Debug registers are per thread and are not inherited by
+// new threads, this is also called for every thread added to the process.
+func (dbp *Process) writeWatchpoints(th *Thread) error {
+	var dr7 uint64
+	for i, wp := range dbp.os.watchpoints {
+		if wp == nil {
+			continue
+		}
+		if err := th.PokeUser(DebugRegisterOffset(i), wp.addr); err != nil {
+			return fmt.Errorf("could not set watchpoint on %s in thread %d: %v", wp.name, th.ID, err)
+		}
+		dr7 |= wp.dr7(i)
+	}
+	if err := th.PokeUser(DebugRegisterOffset(7), dr7); err != nil {
+		return fmt.Errorf("could not enable watchpoints in thread %d: %v", th.ID, err)
+	}
+	return nil
+}
@@ -7,8 +7,12 @@ import (
 	"go/ast"
 	"go/token"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync/atomic"
+
+	"github.com/go-delve/delve/pkg/dwarf/line"
 )
 
 // ErrNotExecutable is returned after attempting to execute a non-executable file
@@ -19,6 +23,10 @@ var ErrNotExecutable = errors.New("not an executable file")
 // only possible on recorded (traced) programs.
 var ErrNotRecorded = errors.New("not a recording")
 
+// ErrProcessRunning is returned when an operation that needs the target to
+// be stopped is called while another goroutine is continuing it.
+var ErrProcessRunning = errors.New("process is running")
+
 const (
 	// UnrecoveredPanic is the name given to the unrecovered panic breakpoint.
 	UnrecoveredPanic = "unrecovered-panic"
@@ -76,6 +84,41 @@ func PostInitializationSetup(p Process, path string, debugInfoDirs []string, wri
 	return nil
 }
 
+// maxInitialLocationDepth is the maximum number of frames InitialLocation
+// will look at to find a frame with a known function.
+const maxInitialLocationDepth = 20
+
+// InitialLocation returns the location where the current thread is
+// stopped, for a process that was just attached to this is the location
+// where the attach stopped it.
+// If the thread is stopped in code that does not belong to any known
+// function (for example the VDSO) the location of the innermost frame
+// with a known function is returned instead. Locations inside the runtime
+// are returned as they are.
+func InitialLocation(dbp Process) (*Location, error) {
+	if _, err := dbp.Valid(); err != nil {
+		return nil, err
+	}
+	thread := dbp.CurrentThread()
+	loc, err := thread.Location()
+	if err != nil {
+		return nil, err
+	}
+	if loc.Fn != nil {
+		return loc, nil
+	}
+	frames, err := ThreadStacktrace(thread, maxInitialLocationDepth, true)
+	if err != nil {
+		return loc, nil
+	}
+	for i := range frames {
+		if frames[i].Call.Fn != nil {
+			return &frames[i].Call, nil
+		}
+	}
+	return loc, nil
+}
+
 // FindFileLocation returns the PC for a given file:line.
 // Assumes that `file` is normalized to lower case and '/' on Windows.
 func FindFileLocation(p Process, fileName string, lineno int) (uint64, error) {
@@ -99,6 +142,42 @@ func (err *ErrFunctionNotFound) Error() string {
 	return fmt.Sprintf("Could not find function %s\n", err.FuncName)
 }
 
+// ErrStepBudgetExceeded is returned when a step operation is interrupted
+// because it did not complete within the step budget of the process, see
+// CommonProcess.SetStepBudget. This usually means that the target is in an
+// infinite loop.
+type ErrStepBudgetExceeded struct {
+	// Op describes the interrupted operation.
+	Op string
+	// Steps is the step budget that was exceeded.
+	Steps int
+	// Location is where the current thread was stopped, nil if it could not
+	// be determined.
+	Location *Location
+}
+
+func (err *ErrStepBudgetExceeded) Error() string {
+	s := fmt.Sprintf("could not %s: step budget of %d steps exceeded", err.Op, err.Steps)
+	if loc := err.Location; loc != nil {
+		if loc.File != "" {
+			s += fmt.Sprintf(" at %s:%d", loc.File, loc.Line)
+		} else {
+			s += fmt.Sprintf(" at %#x", loc.PC)
+		}
+	}
+	return s
+}
+
+// stepBudgetExceeded returns an ErrStepBudgetExceeded for op stopped at the
+// current location of curthread.
+func stepBudgetExceeded(dbp Process, curthread Thread, op string) error {
+	loc, err := curthread.Location()
+	if err != nil {
+		loc = nil
+	}
+	return &ErrStepBudgetExceeded{Op: op, Steps: dbp.Common().StepBudget(), Location: loc}
+}
+
 // FindFunctionLocation finds address of a function's line
 // If firstLine == true is passed FindFunctionLocation will attempt to find the first line of the function
 // If lineOffset is passed FindFunctionLocation will return the address of that line
@@ -106,21 +185,105 @@ func (err *ErrFunctionNotFound) Error() string {
 // Note that setting breakpoints at that address will cause surprising behavior:
 // https://github.com/go-delve/delve/issues/170
 func FindFunctionLocation(p Process, funcName string, firstLine bool, lineOffset int) (uint64, error) {
+	pcs, err := FindFunctionLocations(p, funcName, firstLine, lineOffset)
+	if err != nil {
+		return 0, err
+	}
+	if len(pcs) > 1 {
+		return 0, fmt.Errorf("function %s was inlined in %d places", funcName, len(pcs))
+	}
+	return pcs[0], nil
+}
+
+// FindFunctionLocations is like FindFunctionLocation but it also works for
+// functions that were inlined everywhere they were called and have no
+// out-of-line instance: for those it returns the address of every inlined
+// call.
+func FindFunctionLocations(p Process, funcName string, firstLine bool, lineOffset int) ([]uint64, error) {
 	bi := p.BinInfo()
 	origfn := bi.LookupFunc[funcName]
 	if origfn == nil {
-		return 0, &ErrFunctionNotFound{funcName}
+		return nil, &ErrFunctionNotFound{funcName}
+	}
+
+	if origfn.Entry == 0 {
+		pcs := bi.inlinedCallPCs(funcName)
+		if len(pcs) == 0 {
+			return nil, fmt.Errorf("function %s has no instances", funcName)
+		}
+		if lineOffset > 0 {
+			return nil, fmt.Errorf("can not use a line offset with function %s, it was always inlined", funcName)
+		}
+		return pcs, nil
 	}
 
+	var addr uint64
+	var err error
 	if firstLine {
-		return FirstPCAfterPrologue(p, origfn, false)
+		addr, err = FirstPCAfterPrologue(p, origfn, false)
 	} else if lineOffset > 0 {
 		filename, lineno := origfn.cu.lineInfo.PCToLine(origfn.Entry, origfn.Entry)
-		breakAddr, _, err := bi.LineToPC(filename, lineno+lineOffset)
-		return breakAddr, err
+		addr, _, err = bi.LineToPC(filename, lineno+lineOffset)
+	} else {
+		addr = origfn.Entry
 	}
+	if err != nil {
+		return nil, err
+	}
+	return []uint64{addr}, nil
+}
 
-	return origfn.Entry, nil
+// BreakFirstHit sets a temporary breakpoint on the first line of function
+// fname: the first goroutine that reaches it will stop and the breakpoint
+// will be cleared.
+func BreakFirstHit(dbp Process, fname string) (*Breakpoint, error) {
+	addr, err := FindFunctionLocation(dbp, fname, true, 0)
+	if err != nil {
+		return nil, err
+	}
+	bp, err := dbp.SetBreakpoint(addr, UserBreakpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	bp.Flags |= BreakpointTemporary
+	return bp, nil
+}
+
+// SetRegexBreakpoints sets a user breakpoint, after the prologue, on every
+// function whose name matches the regular expression pattern.
+// Functions where the breakpoint could not be set are skipped, the
+// returned error describes them.
+func SetRegexBreakpoints(p Process, pattern string) ([]*Breakpoint, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression %q: %v", pattern, err)
+	}
+
+	var bps []*Breakpoint
+	var errs []string
+	bi := p.BinInfo()
+	for i := range bi.Functions {
+		fn := &bi.Functions[i]
+		if fn.Entry == 0 || !re.MatchString(fn.Name) {
+			continue
+		}
+		addr, err := FirstPCAfterPrologue(p, fn, false)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", fn.Name, err))
+			continue
+		}
+		bp, err := p.SetBreakpoint(addr, UserBreakpoint, nil)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", fn.Name, err))
+			continue
+		}
+		bps = append(bps, bp)
+	}
+
+	if len(errs) > 0 {
+		return bps, fmt.Errorf("could not set some breakpoints:\n%s", strings.Join(errs, "\n"))
+	}
+	return bps, nil
 }
 
 // FunctionReturnLocations will return a list of addresses corresponding
@@ -152,15 +315,24 @@ func FunctionReturnLocations(p Process, funcName string) ([]uint64, error) {
 
 // Next continues execution until the next source line.
 func Next(dbp Process) (err error) {
+	defer printStop(dbp, &err)
 	if _, err := dbp.Valid(); err != nil {
 		return err
 	}
+	if err := checkNotContinuingAsync(dbp); err != nil {
+		return err
+	}
 	if dbp.Breakpoints().HasInternalBreakpoints() {
 		return fmt.Errorf("next while nexting")
 	}
 
 	if err = next(dbp, false, false); err != nil {
 		dbp.ClearInternalBreakpoints()
+		if loc, lerr := dbp.CurrentThread().Location(); err == line.NoSourceError && lerr == nil && loc.Fn != nil {
+			// There is no line table for the current function (for example
+			// because the executable doesn't have DWARF), run until it returns.
+			_, err = StepUntilOutOfRange(dbp, loc.Fn.Entry, loc.Fn.End)
+		}
 		return
 	}
 
@@ -174,10 +346,20 @@ func Continue(dbp Process) error {
 	if _, err := dbp.Valid(); err != nil {
 		return err
 	}
+	if err := checkNotContinuingAsync(dbp); err != nil {
+		return err
+	}
+	// discard stop requests made while the target was stopped
+	dbp.CheckAndClearManualStopRequest()
+	return continueTarget(dbp)
+}
+
+// continueTarget is Continue without discarding the pending manual stop
+// requests.
+func continueTarget(dbp Process) error {
 	for _, thread := range dbp.ThreadList() {
 		thread.Common().returnValues = nil
 	}
-	dbp.CheckAndClearManualStopRequest()
 	defer func() {
 		// Make sure we clear internal breakpoints if we simultaneously receive a
 		// manual stop request and hit a breakpoint.
@@ -185,13 +367,30 @@ func Continue(dbp Process) error {
 			dbp.ClearInternalBreakpoints()
 		}
 	}()
+	// steps counts the times the target is resumed while a step operation
+	// is in progress, to interrupt it when it can not complete. Unlike
+	// single stepping this is only limited if a budget was set explicitly:
+	// other goroutines hitting the breakpoints of a step operation can
+	// legitimately resume the target any number of times.
+	steps := 0
+	budget := dbp.Common().stepBudget
 	for {
 		if dbp.CheckAndClearManualStopRequest() {
 			dbp.ClearInternalBreakpoints()
 			return nil
 		}
+		if budget > 0 && dbp.Breakpoints().HasInternalBreakpoints() {
+			if steps >= budget {
+				dbp.ClearInternalBreakpoints()
+				return stepBudgetExceeded(dbp, dbp.CurrentThread(), "complete the step")
+			}
+			steps++
+		}
 		trapthread, err := dbp.ContinueOnce()
 		if err != nil {
+			// the command that set the internal breakpoints can not be
+			// completed, don't leave them behind.
+			dbp.ClearInternalBreakpoints()
 			return err
 		}
 
@@ -204,77 +403,29 @@ func Continue(dbp Process) error {
 		curthread := dbp.CurrentThread()
 		curbp := curthread.Breakpoint()
 
-		switch {
-		case curbp.Breakpoint == nil:
-			// runtime.Breakpoint, manual stop or debugCallV1-related stop
-			recorded, _ := dbp.Recorded()
-			if recorded {
-				return conditionErrors(threads)
+		switch curbp.action() {
+		case stopNoBreakpoint:
+			if stop, err := stopWithoutBreakpoint(dbp, curthread, threads); stop {
+				return err
 			}
-
-			loc, err := curthread.Location()
-			if err != nil || loc.Fn == nil {
-				return conditionErrors(threads)
+		case stopResume:
+			// the breakpoint condition was not met, just repeat
+		case stopStepInto:
+			if err := stepIntoCall(dbp, curthread, threads); err != nil {
+				return err
 			}
-
-			switch {
-			case loc.Fn.Name == "runtime.breakpoint":
-				// Single-step current thread until we exit runtime.breakpoint and
-				// runtime.Breakpoint.
-				// On go < 1.8 it was sufficient to single-step twice on go1.8 a change
-				// to the compiler requires 4 steps.
-				if err := stepInstructionOut(dbp, curthread, "runtime.breakpoint", "runtime.Breakpoint"); err != nil {
-					return err
-				}
-				return conditionErrors(threads)
-			case strings.HasPrefix(loc.Fn.Name, debugCallFunctionNamePrefix1) || strings.HasPrefix(loc.Fn.Name, debugCallFunctionNamePrefix2):
-				continueCompleted := dbp.Common().continueCompleted
-				if continueCompleted == nil {
-					return conditionErrors(threads)
-				}
-				continueCompleted <- struct{}{}
-				contReq, ok := <-dbp.Common().continueRequest
-				if !contReq.cont {
-					// only stop execution if the expression evaluation with calls finished
-					err := finishEvalExpressionWithCalls(dbp, contReq, ok)
-					if err != nil {
-						return err
-					}
-					return conditionErrors(threads)
-				}
-			default:
-				return conditionErrors(threads)
+		case stopInternal:
+			curthread.Common().returnValues = curbp.Breakpoint.returnInfo.Collect(curthread)
+			if err := dbp.ClearInternalBreakpoints(); err != nil {
+				return err
 			}
-		case curbp.Active && curbp.Internal:
-			switch curbp.Kind {
-			case StepBreakpoint:
-				// See description of proc.(*Process).next for the meaning of StepBreakpoints
-				if err := conditionErrors(threads); err != nil {
-					return err
-				}
-				regs, err := curthread.Registers(false)
-				if err != nil {
-					return err
-				}
-				pc := regs.PC()
-				text, err := disassemble(curthread, regs, dbp.Breakpoints(), dbp.BinInfo(), pc, pc+maxInstructionLength, true)
-				if err != nil {
-					return err
-				}
-				// here we either set a breakpoint into the destination of the CALL
-				// instruction or we determined that the called function is hidden,
-				// either way we need to resume execution
-				if err = setStepIntoBreakpoint(dbp, text, SameGoroutineCondition(dbp.SelectedGoroutine())); err != nil {
-					return err
-				}
-			default:
-				curthread.Common().returnValues = curbp.Breakpoint.returnInfo.Collect(curthread)
-				if err := dbp.ClearInternalBreakpoints(); err != nil {
-					return err
-				}
-				return conditionErrors(threads)
+			return conditionErrors(threads)
+		case stopTemporary:
+			if err := clearTemporaryBreakpoint(dbp, curthread, threads); err != nil {
+				return err
 			}
-		case curbp.Active:
+			fallthrough
+		case stopUser:
 			onNextGoroutine, err := onNextGoroutine(curthread, dbp.Breakpoints())
 			if err != nil {
 				return err
@@ -289,12 +440,202 @@ func Continue(dbp Process) error {
 				dbp.ClearInternalBreakpoints()
 			}
 			return conditionErrors(threads)
-		default:
-			// not a manual stop, not on runtime.Breakpoint, not on a breakpoint, just repeat
 		}
 	}
 }
 
+// ResumeStop describes the stop Resume returned at.
+type ResumeStop struct {
+	// Thread is the current thread, the one that caused the stop.
+	Thread Thread
+	// Breakpoint is the breakpoint Thread stopped at, nil if the stop was
+	// not caused by a breakpoint, for example a manual stop or a call to
+	// runtime.Breakpoint.
+	Breakpoint *Breakpoint
+	// Tracepoints are the tracepoints hit while resuming, in order.
+	Tracepoints []*Breakpoint
+	// Err is the error that ended the resume, only used by ContinueAsync.
+	Err error
+}
+
+// Resume is like Continue but it does not return when the target stops at
+// tracepoints, every stop where the current thread, and all other threads
+// stopped at a breakpoint, are at a tracepoint resumes the target again.
+// Resume returns at the first stop that must be shown to the user and
+// reports the tracepoints that were hit before it. At every tracepoint hit
+// the SampleVariables of the tracepoint are recorded in its Samples.
+// Like Continue, breakpoints whose condition is false and breakpoints
+// internal to step operations do not stop the target.
+func Resume(dbp Process) (*ResumeStop, error) {
+	if _, err := dbp.Valid(); err != nil {
+		return nil, err
+	}
+	if err := checkNotContinuingAsync(dbp); err != nil {
+		return nil, err
+	}
+	dbp.CheckAndClearManualStopRequest()
+	return resume(dbp)
+}
+
+func resume(dbp Process) (*ResumeStop, error) {
+	r := &ResumeStop{}
+	for {
+		if err := continueTarget(dbp); err != nil {
+			return nil, err
+		}
+		for _, th := range dbp.ThreadList() {
+			if bpstate := th.Breakpoint(); bpstate.Breakpoint != nil && bpstate.Active && isTracepoint(bpstate.Breakpoint) {
+				bpstate.Breakpoint.recordSample(th)
+			}
+		}
+		r.Thread = dbp.CurrentThread()
+		r.Breakpoint = nil
+		if bpstate := r.Thread.Breakpoint(); bpstate.Breakpoint != nil && bpstate.Active {
+			r.Breakpoint = bpstate.Breakpoint
+		}
+		if r.Breakpoint == nil || !isTracepoint(r.Breakpoint) {
+			return r, nil
+		}
+		var hits []*Breakpoint
+		for _, th := range dbp.ThreadList() {
+			bpstate := th.Breakpoint()
+			if bpstate.Breakpoint == nil || !bpstate.Active {
+				continue
+			}
+			if !isTracepoint(bpstate.Breakpoint) {
+				return r, nil
+			}
+			hits = append(hits, bpstate.Breakpoint)
+		}
+		r.Tracepoints = append(r.Tracepoints, hits...)
+	}
+}
+
+func isTracepoint(bp *Breakpoint) bool {
+	return bp.IsUser() && bp.Flags&(BreakpointTracepoint|BreakpointTraceReturn) != 0
+}
+
+// ContinueAsync calls Resume in a new goroutine and sends its result on
+// the returned channel, which is then closed. If Resume fails the error is
+// sent in the Err field of the ResumeStop.
+// Until the result is sent the functions that resume the target, like
+// Continue, Resume, Next and Step, return ErrProcessRunning. Pause is the
+// only other function that can be called before the result is received:
+// the goroutine started by ContinueAsync owns the Process until then and
+// evaluates breakpoint conditions between stops, so setting breakpoints,
+// reading memory or evaluating expressions concurrently is not safe. Use
+// Pause to stop the target.
+func ContinueAsync(dbp Process) <-chan ResumeStop {
+	ch := make(chan ResumeStop, 1)
+	if _, err := dbp.Valid(); err != nil {
+		ch <- ResumeStop{Err: err}
+		close(ch)
+		return ch
+	}
+	common := dbp.Common()
+	if !atomic.CompareAndSwapInt32(&common.continuingAsync, 0, 1) {
+		ch <- ResumeStop{Err: ErrProcessRunning}
+		close(ch)
+		return ch
+	}
+	// stop requests made from now on, by Pause, must stop the target.
+	dbp.CheckAndClearManualStopRequest()
+	go func() {
+		defer close(ch)
+		r, err := resume(dbp)
+		atomic.StoreInt32(&common.continuingAsync, 0)
+		if err != nil {
+			ch <- ResumeStop{Err: err}
+			return
+		}
+		ch <- *r
+	}()
+	return ch
+}
+
+// Pause stops the target resumed by ContinueAsync, the stop is sent on
+// the channel returned by ContinueAsync with a nil Breakpoint. Pause can
+// also stop the target while another goroutine is in any of the functions
+// that resume it.
+func Pause(dbp Process) error {
+	return dbp.RequestManualStop()
+}
+
+// checkNotContinuingAsync returns ErrProcessRunning if ContinueAsync is
+// resuming the target.
+func checkNotContinuingAsync(dbp Process) error {
+	if atomic.LoadInt32(&dbp.Common().continuingAsync) != 0 {
+		return ErrProcessRunning
+	}
+	return nil
+}
+
+// stopWithoutBreakpoint handles a stop of curthread that did not happen at
+// a breakpoint: a manual stop, runtime.Breakpoint or a stop requested by
+// an injected function call. It returns true if Continue must return.
+func stopWithoutBreakpoint(dbp Process, curthread Thread, threads []Thread) (bool, error) {
+	recorded, _ := dbp.Recorded()
+	if recorded {
+		return true, conditionErrors(threads)
+	}
+
+	loc, err := curthread.Location()
+	if err != nil || loc.Fn == nil {
+		return true, conditionErrors(threads)
+	}
+
+	switch {
+	case loc.Fn.Name == "runtime.breakpoint":
+		// Single-step current thread until we exit runtime.breakpoint and
+		// runtime.Breakpoint.
+		// On go < 1.8 it was sufficient to single-step twice on go1.8 a change
+		// to the compiler requires 4 steps.
+		if err := stepInstructionOut(dbp, curthread, "runtime.breakpoint", "runtime.Breakpoint"); err != nil {
+			return true, err
+		}
+		return true, conditionErrors(threads)
+	case strings.HasPrefix(loc.Fn.Name, debugCallFunctionNamePrefix1) || strings.HasPrefix(loc.Fn.Name, debugCallFunctionNamePrefix2):
+		continueCompleted := dbp.Common().continueCompleted
+		if continueCompleted == nil {
+			return true, conditionErrors(threads)
+		}
+		continueCompleted <- struct{}{}
+		contReq, ok := <-dbp.Common().continueRequest
+		if !contReq.cont {
+			// only stop execution if the expression evaluation with calls finished
+			err := finishEvalExpressionWithCalls(dbp, contReq, ok)
+			if err != nil {
+				return true, err
+			}
+			return true, conditionErrors(threads)
+		}
+		return false, nil
+	default:
+		return true, conditionErrors(threads)
+	}
+}
+
+// stepIntoCall handles curthread reaching a StepBreakpoint.
+// See description of proc.(*Process).next for the meaning of StepBreakpoints
+func stepIntoCall(dbp Process, curthread Thread, threads []Thread) error {
+	if err := conditionErrors(threads); err != nil {
+		return err
+	}
+	regs, err := curthread.Registers(false)
+	if err != nil {
+		return err
+	}
+	pc := regs.PC()
+	text, err := disassemble(curthread, regs, dbp.Breakpoints(), dbp.BinInfo(), pc, pc+maxInstructionLength, true)
+	if err != nil {
+		return err
+	}
+	// here we either set a breakpoint into the destination of the CALL
+	// instruction or we determined that the called function is hidden,
+	// either way we need to resume execution
+	return setStepIntoBreakpoint(dbp, text, SameGoroutineCondition(dbp.SelectedGoroutine()))
+}
+
 func conditionErrors(threads []Thread) error {
 	var condErr error
 	for _, th := range threads {
@@ -309,6 +650,33 @@ func conditionErrors(threads []Thread) error {
 	return condErr
 }
 
+// clearTemporaryBreakpoint clears the temporary breakpoint that curthread
+// is stopped at. Other threads that reached the same breakpoint during
+// this stop are no longer considered stopped at it and their hits are not
+// counted.
+func clearTemporaryBreakpoint(dbp Process, curthread Thread, threads []Thread) error {
+	bp := curthread.Breakpoint().Breakpoint
+	if _, err := dbp.ClearBreakpoint(bp.Addr); err != nil {
+		return err
+	}
+	for _, th := range threads {
+		if th == curthread || th.Breakpoint().Breakpoint != bp {
+			continue
+		}
+		if err := th.SetCurrentBreakpoint(); err != nil {
+			return err
+		}
+	}
+	bp.TotalHitCount = 1
+	for goid := range bp.HitCount {
+		delete(bp.HitCount, goid)
+	}
+	if g, err := GetG(curthread); err == nil && g != nil {
+		bp.HitCount[g.ID] = 1
+	}
+	return nil
+}
+
 // pick a new dbp.currentThread, with the following priority:
 // 	- a thread with onTriggeredInternalBreakpoint() == true
 // 	- a thread with onTriggeredBreakpoint() == true (prioritizing trapthread)
@@ -330,12 +698,18 @@ func pickCurrentThread(dbp Process, trapthread Thread, threads []Thread) error {
 	return dbp.SwitchThread(trapthread.ThreadID())
 }
 
+// defaultStepBudget is the step budget used when none is set with
+// CommonProcess.SetStepBudget.
+const defaultStepBudget = 100000
+
 // stepInstructionOut repeatedly calls StepInstruction until the current
 // function is neither fnname1 or fnname2.
 // This function is used to step out of runtime.Breakpoint as well as
 // runtime.debugCallV1.
+// If the function has not returned within the step budget
+// ErrStepBudgetExceeded is returned instead of stepping forever.
 func stepInstructionOut(dbp Process, curthread Thread, fnname1, fnname2 string) error {
-	for {
+	for i := 0; i < dbp.Common().StepBudget(); i++ {
 		if err := curthread.StepInstruction(); err != nil {
 			return err
 		}
@@ -347,14 +721,107 @@ func stepInstructionOut(dbp Process, curthread Thread, fnname1, fnname2 string)
 			return curthread.SetCurrentBreakpoint()
 		}
 	}
+	return stepBudgetExceeded(dbp, curthread, "step out of "+fnname1)
+}
+
+// StepUntilOutOfRange single steps the current thread until its PC leaves
+// the address range [lo, hi) and returns the location where it stopped.
+// Functions called from inside the range are stepped over, like next does,
+// by continuing to a breakpoint on their return address. If the target
+// stops somewhere else while a call is stepped over, for example at a user
+// breakpoint, the location of that stop is returned.
+// If the range is not left within the step budget ErrStepBudgetExceeded
+// is returned, with the location where the thread was stopped, instead of
+// stepping forever.
+func StepUntilOutOfRange(dbp Process, lo, hi uint64) (*Location, error) {
+	if _, err := dbp.Valid(); err != nil {
+		return nil, err
+	}
+	if dbp.Breakpoints().HasInternalBreakpoints() {
+		return nil, fmt.Errorf("next while nexting")
+	}
+	curthread := dbp.CurrentThread()
+	stop := func() (*Location, error) {
+		loc, err := curthread.Location()
+		if err != nil {
+			return nil, err
+		}
+		if g := dbp.SelectedGoroutine(); g != nil {
+			g.CurrentLoc = *loc
+		}
+		return loc, curthread.SetCurrentBreakpoint()
+	}
+	for i := 0; i < dbp.Common().StepBudget(); i++ {
+		regs, err := curthread.Registers(false)
+		if err != nil {
+			return nil, err
+		}
+		pc := regs.PC()
+		if pc < lo || pc >= hi {
+			return stop()
+		}
+		text, err := disassemble(curthread, regs, dbp.Breakpoints(), dbp.BinInfo(), pc, pc+maxInstructionLength, true)
+		if err == nil && len(text) > 0 && text[0].IsCall() {
+			returned, err := stepOverCall(dbp, pc+uint64(len(text[0].Bytes)), regs.SP())
+			if err != nil {
+				return nil, err
+			}
+			// the goroutine could have been moved to a different thread
+			curthread = dbp.CurrentThread()
+			if !returned {
+				return stop()
+			}
+			continue
+		}
+		if err := curthread.StepInstruction(); err != nil {
+			return nil, err
+		}
+	}
+	return nil, stepBudgetExceeded(dbp, curthread, fmt.Sprintf("leave %#x-%#x", lo, hi))
+}
+
+// stepOverCall continues the target until the call made by the current
+// instruction of the selected goroutine, whose return address is retaddr
+// and which is made with the stack pointer at sp, returns. Returns false if
+// the target stopped somewhere else first.
+func stepOverCall(dbp Process, retaddr, sp uint64) (bool, error) {
+	cond := SameGoroutineCondition(dbp.SelectedGoroutine())
+	for {
+		if _, err := dbp.SetBreakpoint(retaddr, NextBreakpoint, cond); err != nil {
+			if _, ok := err.(BreakpointExistsError); !ok {
+				return false, err
+			}
+		}
+		if err := continueTarget(dbp); err != nil {
+			return false, err
+		}
+		regs, err := dbp.CurrentThread().Registers(false)
+		if err != nil {
+			dbp.ClearInternalBreakpoints()
+			return false, err
+		}
+		if regs.PC() != retaddr {
+			dbp.ClearInternalBreakpoints()
+			return false, nil
+		}
+		if regs.SP() == sp {
+			return true, nil
+		}
+		// a recursive call returned to retaddr, the breakpoint was cleared
+		// by continueTarget, set it again.
+	}
 }
 
 // Step will continue until another source line is reached.
 // Will step into functions.
 func Step(dbp Process) (err error) {
+	defer printStop(dbp, &err)
 	if _, err := dbp.Valid(); err != nil {
 		return err
 	}
+	if err := checkNotContinuingAsync(dbp); err != nil {
+		return err
+	}
 	if dbp.Breakpoints().HasInternalBreakpoints() {
 		return fmt.Errorf("next while nexting")
 	}
@@ -371,6 +838,110 @@ func Step(dbp Process) (err error) {
 	return Continue(dbp)
 }
 
+// StepIntoCall continues until the n-th function call (starting from 1)
+// made by the current source line and steps into it. Calls made before
+// it, on the same line, are executed without stopping. If the n-th call is
+// never made (for example because it is in a branch that isn't taken)
+// execution stops on the next line of the function or on its return
+// address, same as Next.
+func StepIntoCall(dbp Process, n int) (err error) {
+	defer printStop(dbp, &err)
+	if _, err := dbp.Valid(); err != nil {
+		return err
+	}
+	if err := checkNotContinuingAsync(dbp); err != nil {
+		return err
+	}
+	if dbp.Breakpoints().HasInternalBreakpoints() {
+		return fmt.Errorf("next while nexting")
+	}
+	if n <= 0 {
+		return errors.New("call number must be positive")
+	}
+
+	selg := dbp.SelectedGoroutine()
+	curthread := dbp.CurrentThread()
+	topframe, retframe, err := topframe(selg, curthread)
+	if err != nil {
+		return err
+	}
+	if topframe.Current.Fn == nil {
+		return &ErrNoSourceForPC{topframe.Current.PC}
+	}
+
+	var thread MemoryReadWriter = curthread
+	var regs Registers
+	if selg != nil && selg.Thread != nil {
+		thread = selg.Thread
+		regs, err = selg.Thread.Registers(false)
+		if err != nil {
+			return err
+		}
+	}
+	fn := topframe.Current.Fn
+	text, err := disassemble(thread, regs, dbp.Breakpoints(), dbp.BinInfo(), fn.Entry, fn.End, false)
+	if err != nil {
+		return err
+	}
+
+	// Calls to unexported runtime functions are inserted by the compiler
+	// (for example runtime.newobject, runtime.convT64) and do not count.
+	var calls []AsmInstruction
+	for _, instr := range text {
+		if instr.Loc.PC < topframe.Current.PC || instr.Loc.File != topframe.Current.File || instr.Loc.Line != topframe.Current.Line || !instr.IsCall() {
+			continue
+		}
+		if instr.DestLoc != nil && instr.DestLoc.Fn != nil && strings.HasPrefix(instr.DestLoc.Fn.Name, "runtime.") && !isExportedRuntime(instr.DestLoc.Fn.Name) {
+			continue
+		}
+		calls = append(calls, instr)
+	}
+	if n > len(calls) {
+		return fmt.Errorf("line %d makes %d function calls", topframe.Current.Line, len(calls))
+	}
+
+	success := false
+	defer func() {
+		if !success {
+			dbp.ClearInternalBreakpoints()
+		}
+	}()
+
+	sameGCond := SameGoroutineCondition(selg)
+	sameFrameCond := andFrameoffCondition(sameGCond, topframe.FrameOffset())
+
+	// When the StepBreakpoint is hit Continue will set a breakpoint on the
+	// destination of the call, see the description of next.
+	if _, err := dbp.SetBreakpoint(calls[n-1].Loc.PC, StepBreakpoint, sameFrameCond); err != nil {
+		if _, ok := err.(BreakpointExistsError); !ok {
+			return err
+		}
+	}
+
+	pcs, err := fn.cu.lineInfo.AllPCsBetween(fn.Entry, fn.End-1, topframe.Current.File, topframe.Current.Line)
+	if err != nil {
+		return err
+	}
+	for _, pc := range pcs {
+		if _, err := dbp.SetBreakpoint(pc, NextBreakpoint, sameFrameCond); err != nil {
+			if _, ok := err.(BreakpointExistsError); !ok {
+				return err
+			}
+		}
+	}
+	if !topframe.Inlined {
+		// the return address could be wrong, if we are unable to set a
+		// breakpoint there it's ok.
+		setReturnBreakpoint(dbp, &topframe, andFrameoffCondition(sameGCond, retframe.FrameOffset()))
+	}
+
+	if bp := curthread.Breakpoint(); bp.Breakpoint == nil {
+		curthread.SetCurrentBreakpoint()
+	}
+	success = true
+	return Continue(dbp)
+}
+
 // SameGoroutineCondition returns an expression that evaluates to true when
 // the current goroutine is g.
 func SameGoroutineCondition(g *G) ast.Expr {
@@ -412,12 +983,70 @@ func andFrameoffCondition(cond ast.Expr, frameoff int64) ast.Expr {
 	}
 }
 
+// ContinueN resumes execution through n breakpoint hits, of any user
+// breakpoint, and returns the breakpoint of the last hit.
+// If the target stops for any other reason (a manual stop request, a call
+// to runtime.Breakpoint...) before the n-th hit ContinueN returns early
+// with a nil breakpoint. If the process exits the error returned by
+// Continue is returned.
+func ContinueN(dbp Process, n int) (*Breakpoint, error) {
+	if n <= 0 {
+		return nil, errors.New("number of breakpoint hits must be positive")
+	}
+	var bp *Breakpoint
+	for i := 0; i < n; i++ {
+		if err := Continue(dbp); err != nil {
+			return nil, err
+		}
+		bpstate := dbp.CurrentThread().Breakpoint()
+		if bpstate.Breakpoint == nil || !bpstate.Active || !bpstate.IsUser() {
+			return nil, nil
+		}
+		bp = bpstate.Breakpoint
+	}
+	return bp, nil
+}
+
+// StepLines calls Step n times and returns the list of source lines it
+// stopped at, omitting locations without source code and inside the
+// runtime. Stepping ends early, without errors, if it is interrupted by a
+// breakpoint.
+func StepLines(dbp Process, n int) ([]*Location, error) {
+	if n <= 0 {
+		return nil, errors.New("number of steps must be positive")
+	}
+	var r []*Location
+	for i := 0; i < n; i++ {
+		if err := Step(dbp); err != nil {
+			return r, err
+		}
+		loc, err := dbp.CurrentThread().Location()
+		if err != nil {
+			return r, err
+		}
+		if loc.Fn != nil && loc.File != "" && !strings.HasPrefix(loc.Fn.Name, "runtime.") {
+			if len(r) == 0 || r[len(r)-1].File != loc.File || r[len(r)-1].Line != loc.Line {
+				r = append(r, loc)
+			}
+		}
+		if dbp.Breakpoints().HasInternalBreakpoints() {
+			// stopped by a breakpoint before the step was completed
+			break
+		}
+	}
+	return r, nil
+}
+
 // StepOut will continue until the current goroutine exits the
 // function currently being executed or a deferred function is executed
-func StepOut(dbp Process) error {
+func StepOut(dbp Process) (err error) {
+	defer printStop(dbp, &err)
 	if _, err := dbp.Valid(); err != nil {
 		return err
 	}
+	if err := checkNotContinuingAsync(dbp); err != nil {
+		return err
+	}
 	if dbp.Breakpoints().HasInternalBreakpoints() {
 		return fmt.Errorf("next while nexting")
 	}
@@ -480,14 +1109,142 @@ func StepOut(dbp Process) error {
 	}
 
 	if topframe.Ret != 0 {
-		bp, err := dbp.SetBreakpoint(topframe.Ret, NextBreakpoint, retFrameCond)
-		if err != nil {
+		if _, err := setReturnBreakpoint(dbp, &topframe, retFrameCond); err != nil {
 			if _, isexists := err.(BreakpointExistsError); !isexists {
 				return err
 			}
 		}
-		if bp != nil {
-			configureReturnBreakpoint(dbp.BinInfo(), bp, &topframe, retFrameCond)
+	}
+
+	if bp := curthread.Breakpoint(); bp.Breakpoint == nil {
+		curthread.SetCurrentBreakpoint()
+	}
+
+	success = true
+	return Continue(dbp)
+}
+
+// StepThread steps exactly one CPU instruction on the thread with the
+// given ID, all other threads will remain stopped. The thread becomes the
+// current thread.
+func StepThread(dbp Process, tid int) error {
+	if _, err := dbp.Valid(); err != nil {
+		return err
+	}
+	if err := dbp.SwitchThread(tid); err != nil {
+		return err
+	}
+	return dbp.StepInstruction()
+}
+
+// printStop prints the location of the current thread to the step output
+// of dbp, if one was set with CommonProcess.SetStepOutput and the step
+// operation that stopped the thread succeeded, that is if *err is nil.
+func printStop(dbp Process, err *error) {
+	w := dbp.Common().stepOutput
+	if w == nil || *err != nil {
+		return
+	}
+	loc, lerr := dbp.CurrentThread().Location()
+	if lerr != nil {
+		return
+	}
+	if loc.Fn == nil {
+		fmt.Fprintf(w, "Stopped at: %#x\n", loc.PC)
+		return
+	}
+	fmt.Fprintf(w, "Stopped at: %s() %s:%d (PC: %#x)\n", loc.Fn.Name, loc.File, loc.Line, loc.PC)
+}
+
+// StepReport describes the state of the target after StepAndReport.
+type StepReport struct {
+	Loc        *Location
+	Inst       *AsmInstruction // the next instruction to execute
+	PC, SP, BP uint64
+}
+
+// StepAndReport steps exactly one CPU instruction, like
+// Process.StepInstruction, and returns the new location, the next
+// instruction and the values of the PC, SP and BP registers.
+func StepAndReport(dbp Process) (*StepReport, error) {
+	if err := dbp.StepInstruction(); err != nil {
+		return nil, err
+	}
+	thread := dbp.CurrentThread()
+	if g := dbp.SelectedGoroutine(); g != nil && g.Thread != nil {
+		thread = g.Thread
+	}
+	loc, err := thread.Location()
+	if err != nil {
+		return nil, err
+	}
+	regs, err := thread.Registers(false)
+	if err != nil {
+		return nil, err
+	}
+	inst, err := CurrentInstruction(dbp)
+	if err != nil {
+		return nil, err
+	}
+	return &StepReport{Loc: loc, Inst: inst, PC: regs.PC(), SP: regs.SP(), BP: regs.BP()}, nil
+}
+
+// maxFuncReturnDepth is the maximum depth of the stack explored by
+// ContinueToFuncReturn.
+const maxFuncReturnDepth = 100
+
+// ContinueToFuncReturn will continue execution until the innermost frame
+// of function fname, in the stack of the current goroutine, returns.
+// Returns an error if fname is not on the stack of the current goroutine.
+func ContinueToFuncReturn(dbp Process, fname string) error {
+	if _, err := dbp.Valid(); err != nil {
+		return err
+	}
+	if err := checkNotContinuingAsync(dbp); err != nil {
+		return err
+	}
+	if dbp.Breakpoints().HasInternalBreakpoints() {
+		return fmt.Errorf("next while nexting")
+	}
+
+	selg := dbp.SelectedGoroutine()
+	curthread := dbp.CurrentThread()
+
+	var frames []Stackframe
+	var err error
+	if selg == nil {
+		if curthread.Blocked() {
+			return ErrThreadBlocked{}
+		}
+		frames, err = ThreadStacktrace(curthread, maxFuncReturnDepth, true)
+	} else {
+		frames, err = selg.Stacktrace(maxFuncReturnDepth, false, true)
+	}
+	if err != nil {
+		return err
+	}
+
+	i := 0
+	for ; i < len(frames); i++ {
+		if !frames[i].Inlined && frames[i].Current.Fn != nil && frames[i].Current.Fn.Name == fname {
+			break
+		}
+	}
+	if i >= len(frames)-1 || frames[i].Ret == 0 {
+		return fmt.Errorf("could not find function %s on the stack", fname)
+	}
+
+	success := false
+	defer func() {
+		if !success {
+			dbp.ClearInternalBreakpoints()
+		}
+	}()
+
+	retFrameCond := andFrameoffCondition(SameGoroutineCondition(selg), frames[i+1].FrameOffset())
+	if _, err := setReturnBreakpoint(dbp, &frames[i], retFrameCond); err != nil {
+		if _, isexists := err.(BreakpointExistsError); !isexists {
+			return err
 		}
 	}
 
@@ -499,6 +1256,70 @@ func StepOut(dbp Process) error {
 	return Continue(dbp)
 }
 
+// ContinueToAddr continues execution until the selected goroutine reaches
+// the instruction at addr, using a temporary breakpoint which is removed
+// before returning. If addr already has a breakpoint it's used instead.
+// Returns the breakpoint the current thread stopped at, which is not the
+// one at addr if another breakpoint was hit first, or nil if the target
+// stopped for a different reason.
+func ContinueToAddr(dbp Process, addr uint64) (*Breakpoint, error) {
+	if _, err := dbp.Valid(); err != nil {
+		return nil, err
+	}
+	if err := checkNotContinuingAsync(dbp); err != nil {
+		return nil, err
+	}
+	if dbp.Breakpoints().HasInternalBreakpoints() {
+		return nil, fmt.Errorf("next while nexting")
+	}
+
+	selg := dbp.SelectedGoroutine()
+	curthread := dbp.CurrentThread()
+
+	bp, err := dbp.SetBreakpoint(addr, NextBreakpoint, SameGoroutineCondition(selg))
+	if err != nil {
+		if _, isexists := err.(BreakpointExistsError); !isexists {
+			return nil, err
+		}
+		bp = dbp.Breakpoints().M[addr]
+	}
+	defer dbp.ClearInternalBreakpoints()
+
+	if bp := curthread.Breakpoint(); bp.Breakpoint == nil {
+		curthread.SetCurrentBreakpoint()
+	}
+
+	if err := Continue(dbp); err != nil {
+		return nil, err
+	}
+	if hitbp := dbp.CurrentThread().Breakpoint().Breakpoint; hitbp != nil {
+		return hitbp, nil
+	}
+	// Continue clears the internal breakpoints, and the breakpoint state of
+	// the threads stopped at them, when it stops at one.
+	if regs, err := dbp.CurrentThread().Registers(false); err == nil && regs.PC() == addr {
+		return bp, nil
+	}
+	return nil, nil
+}
+
+// ContinueAndBacktrace calls Continue and returns the breakpoint the
+// current thread stopped at, or nil if it did not stop at a breakpoint,
+// and the stacktrace of the current thread, up to depth frames. No
+// stacktrace is returned if Continue fails, including when the target
+// exits.
+func ContinueAndBacktrace(dbp Process, depth int) (*Breakpoint, []Stackframe, error) {
+	if err := Continue(dbp); err != nil {
+		return nil, nil, err
+	}
+	curthread := dbp.CurrentThread()
+	frames, err := ThreadStacktrace(curthread, depth, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	return curthread.Breakpoint().Breakpoint, frames, nil
+}
+
 // GoroutinesInfo searches for goroutines starting at index 'start', and
 // returns an array of up to 'count' (or all found elements, if 'count' is 0)
 // G structures representing the information Delve care about from the internal
@@ -510,6 +1331,9 @@ func GoroutinesInfo(dbp Process, start, count int) ([]*G, int, error) {
 	if _, err := dbp.Valid(); err != nil {
 		return nil, -1, err
 	}
+	if !dbp.BinInfo().HasDWARF() {
+		return nil, -1, ErrNoDebugInfo
+	}
 	if dbp.Common().allGCache != nil {
 		// We can't use the cached array to fulfill a subrange request
 		if start == 0 && (count == 0 || count >= len(dbp.Common().allGCache)) {
@@ -659,6 +1483,50 @@ func FindGoroutine(dbp Process, gid int) (*G, error) {
 	return nil, fmt.Errorf("Unknown goroutine %d", gid)
 }
 
+// GoroutineTopFrame returns the location of goroutine gid without
+// computing its stacktrace: the PC of the thread running the goroutine,
+// or the PC saved when it was parked. If there is no such goroutine
+// because the current thread isn't running one the location of the
+// current thread is returned.
+func GoroutineTopFrame(dbp Process, gid int) (*Location, error) {
+	g, err := FindGoroutine(dbp, gid)
+	if err != nil {
+		return nil, err
+	}
+	if g == nil {
+		return dbp.CurrentThread().Location()
+	}
+	loc := g.CurrentLoc
+	return &loc, nil
+}
+
+// GoroutineStackUsage returns the number of bytes of its stack goroutine
+// gid is using (stack.hi minus its SP) and the size of the stack (stack.hi
+// minus stack.lo). The SP of a goroutine running on a thread is read from
+// the thread, unless it's executing on the system stack, the SP saved when
+// it was parked is used otherwise.
+func GoroutineStackUsage(dbp Process, gid int) (used, total uint64, err error) {
+	g, err := FindGoroutine(dbp, gid)
+	if err != nil {
+		return 0, 0, err
+	}
+	if g == nil {
+		return 0, 0, fmt.Errorf("no goroutine running on thread %d", dbp.CurrentThread().ThreadID())
+	}
+	sp := g.SP
+	if g.Thread != nil && !g.SystemStack {
+		regs, err := g.Thread.Registers(false)
+		if err != nil {
+			return 0, 0, err
+		}
+		sp = regs.SP()
+	}
+	if sp < g.stacklo || sp > g.stackhi {
+		return 0, 0, fmt.Errorf("SP %#x of goroutine %d is outside of its stack [%#x, %#x)", sp, g.ID, g.stacklo, g.stackhi)
+	}
+	return g.stackhi - sp, g.stackhi - g.stacklo, nil
+}
+
 // ConvertEvalScope returns a new EvalScope in the context of the
 // specified goroutine ID and stack frame.
 // If deferCall is > 0 the eval scope will be relative to the specified deferred call.
@@ -682,7 +1550,7 @@ func ConvertEvalScope(dbp Process, gid, frame, deferCall int) (*EvalScope, error
 		thread = g.Thread
 	}
 
-	locs, err := g.Stacktrace(frame+1, deferCall > 0)
+	locs, err := g.Stacktrace(frame+1, deferCall > 0, true)
 	if err != nil {
 		return nil, err
 	}
@@ -707,6 +1575,17 @@ func ConvertEvalScope(dbp Process, gid, frame, deferCall int) (*EvalScope, error
 	return FrameToScope(dbp.BinInfo(), thread, g, locs[frame:]...), nil
 }
 
+// EvalInFrame evaluates expr in the scope of the specified stack frame of
+// the selected goroutine, identifiers are resolved using the local
+// variables and arguments of that frame.
+func EvalInFrame(dbp Process, frame int, expr string, cfg LoadConfig) (*Variable, error) {
+	scope, err := ConvertEvalScope(dbp, -1, frame, 0)
+	if err != nil {
+		return nil, err
+	}
+	return scope.EvalVariable(expr, cfg)
+}
+
 // FrameToScope returns a new EvalScope for frames[0].
 // If frames has at least two elements all memory between
 // frames[0].Regs.SP() and frames[1].Regs.CFA will be cached.
@@ -788,7 +1667,7 @@ func FirstPCAfterPrologue(p Process, fn *Function, sameline bool) (uint64, error
 		// Look for the first instruction with the stmt flag set, so that setting a
 		// breakpoint with file:line and with the function name always result on
 		// the same instruction being selected.
-		entryFile, entryLine := fn.cu.lineInfo.PCToLine(fn.Entry, fn.Entry)
+		entryFile, entryLine, _ := p.BinInfo().PCToLine(fn.Entry)
 		if pc, _, err := p.BinInfo().LineToPC(entryFile, entryLine); err == nil && pc >= fn.Entry && pc < fn.End {
 			return pc, nil
 		}
@@ -1,7 +1,11 @@
 package proc
 
 import (
+	"debug/elf"
+	"strings"
 	"testing"
+
+	"github.com/go-delve/delve/pkg/dwarf/op"
 )
 
 func TestIssue554(t *testing.T) {
@@ -12,3 +16,75 @@ func TestIssue554(t *testing.T) {
 		t.Fatalf("should be false")
 	}
 }
+
+func TestLoadGosymMalformed(t *testing.T) {
+	testcases := []struct {
+		name     string
+		pclndata []byte
+	}{
+		{"empty", nil},
+		{"short", []byte{0xf1, 0xff, 0xff, 0xff, 0, 0, 1, 8, 0}},
+		{"bad pointer size", []byte{0xf1, 0xff, 0xff, 0xff, 0, 0, 1, 3, 0, 0, 0, 0}},
+		{"huge function count", []byte{0xf1, 0xff, 0xff, 0xff, 0, 0, 1, 8, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f}},
+	}
+	for _, tc := range testcases {
+		bi := NewBinaryInfo("linux", "amd64")
+		err := bi.loadGosym(&Image{}, nil, tc.pclndata, 0x1000)
+		if err == nil || !strings.HasPrefix(err.Error(), "could not read Go symbol table") {
+			t.Errorf("%s: wrong error %v", tc.name, err)
+		}
+	}
+}
+
+func TestLoadGosymMissingSection(t *testing.T) {
+	bi := NewBinaryInfo("linux", "amd64")
+	if err := bi.loadGosymElf(&Image{}, &elf.File{}); err != ErrNoDebugInfoFound {
+		t.Fatalf("wrong error %v", err)
+	}
+}
+
+func TestBreakpointStopAction(t *testing.T) {
+	user := &Breakpoint{Kind: UserBreakpoint}
+	temp := &Breakpoint{Kind: UserBreakpoint, Flags: BreakpointTemporary}
+	trace := &Breakpoint{Kind: UserBreakpoint, Flags: BreakpointTracepoint}
+	next := &Breakpoint{Kind: NextBreakpoint}
+	step := &Breakpoint{Kind: StepBreakpoint}
+	userStep := &Breakpoint{Kind: UserBreakpoint | StepBreakpoint, Flags: BreakpointTemporary}
+
+	testcases := []struct {
+		name  string
+		state BreakpointState
+		tgt   stopAction
+	}{
+		{"none", BreakpointState{}, stopNoBreakpoint},
+		{"user", BreakpointState{Breakpoint: user, Active: true}, stopUser},
+		{"user inactive", BreakpointState{Breakpoint: user}, stopResume},
+		{"temporary", BreakpointState{Breakpoint: temp, Active: true}, stopTemporary},
+		{"temporary inactive", BreakpointState{Breakpoint: temp}, stopResume},
+		{"tracepoint", BreakpointState{Breakpoint: trace, Active: true}, stopUser},
+		{"next", BreakpointState{Breakpoint: next, Active: true, Internal: true}, stopInternal},
+		{"next inactive", BreakpointState{Breakpoint: next}, stopResume},
+		{"step", BreakpointState{Breakpoint: step, Active: true, Internal: true}, stopStepInto},
+		// an internal breakpoint overlapping a user breakpoint is handled as
+		// internal when its own condition is met and as user otherwise.
+		{"user+step internal", BreakpointState{Breakpoint: userStep, Active: true, Internal: true}, stopInternal},
+		{"user+step user", BreakpointState{Breakpoint: userStep, Active: true}, stopTemporary},
+	}
+	for _, tc := range testcases {
+		if a := tc.state.action(); a != tc.tgt {
+			t.Errorf("%s: got action %d expected %d", tc.name, a, tc.tgt)
+		}
+	}
+}
+
+func TestReturnAddressEndOfStack(t *testing.T) {
+	// without a CFI rule for the return address and with RBP zero the frame
+	// is the last one of the stack, that is not an error.
+	regs := op.DwarfRegisters{PCRegNum: amd64DwarfIPRegNum, SPRegNum: amd64DwarfSPRegNum, BPRegNum: amd64DwarfBPRegNum}
+	regs.AddReg(amd64DwarfIPRegNum, op.DwarfRegisterFromUint64(0x401000))
+	regs.AddReg(amd64DwarfBPRegNum, op.DwarfRegisterFromUint64(0))
+	ret, err := AMD64Arch("linux").returnAddress(nil, &regs, &op.DwarfRegisters{})
+	if err != nil || ret != 0 {
+		t.Fatalf("returnAddress: %#x %v, expected 0 and no error", ret, err)
+	}
+}
@@ -1,11 +1,30 @@
 package proc_test
 
 import (
+	"bufio"
+	"bytes"
+	"debug/elf"
+	"debug/gosym"
+	"encoding/binary"
+	"fmt"
+	"go/constant"
+	"go/token"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 
+	"github.com/sirupsen/logrus"
+	sys "golang.org/x/sys/unix"
+
+	"github.com/go-delve/delve/pkg/proc"
+	"github.com/go-delve/delve/pkg/proc/linutil"
 	"github.com/go-delve/delve/pkg/proc/native"
 	protest "github.com/go-delve/delve/pkg/proc/test"
 )
@@ -21,6 +40,285 @@ func TestLoadingExternalDebugInfo(t *testing.T) {
 	p.Detach(true)
 }
 
+func TestAttachNoWait(t *testing.T) {
+	if testBackend != "native" {
+		return
+	}
+	fixture := protest.BuildFixture("loopprog", 0)
+	cmd := exec.Command(fixture.Path)
+	assertNoError(cmd.Start(), t, "starting fixture")
+	defer cmd.Process.Kill()
+
+	p, err := native.AttachNoWait(cmd.Process.Pid)
+	assertNoError(err, t, "AttachNoWait")
+
+	// consume the stop caused by the attach ourselves
+	var ws sys.WaitStatus
+	_, err = sys.Wait4(cmd.Process.Pid, &ws, sys.WALL, nil)
+	assertNoError(err, t, "Wait4")
+	if !ws.Stopped() {
+		t.Fatalf("process not stopped after attach: %#x", ws)
+	}
+
+	assertNoError(p.FinishAttach([]string{}), t, "FinishAttach")
+	if len(p.ThreadList()) == 0 {
+		t.Fatal("no threads found after FinishAttach")
+	}
+	_, err = setFunctionBreakpoint(p, "main.loop")
+	assertNoError(err, t, "SetBreakpoint")
+	assertNoError(p.Detach(false), t, "Detach")
+}
+
+func TestPtraceLogger(t *testing.T) {
+	if testBackend != "native" {
+		return
+	}
+	fixture := protest.BuildFixture("testprog", 0)
+	p, err := native.Launch([]string{fixture.Path}, ".", false, []string{})
+	assertNoError(err, t, "Launch")
+	defer p.Detach(true)
+
+	var buf bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &buf
+	logger.Level = logrus.DebugLevel
+	p.SetLogger(logrus.NewEntry(logger))
+
+	bp, err := setFunctionBreakpoint(p, "main.helloworld")
+	assertNoError(err, t, "setFunctionBreakpoint()")
+	if out := buf.String(); !strings.Contains(out, "poke") || !strings.Contains(out, fmt.Sprintf("addr=%#x", bp.Addr)) {
+		t.Fatalf("breakpoint write was not logged:\n%s", out)
+	}
+}
+
+func TestSignalWhileStoppedAtBreakpoint(t *testing.T) {
+	if testBackend != "native" {
+		return
+	}
+	// Signals sent to a thread while it is stopped at a breakpoint must not
+	// be lost when the thread steps over the breakpoint.
+	withTestProcess("sigbreak", t, func(p proc.Process, fixture protest.Fixture) {
+		bp, err := setFunctionBreakpoint(p, "main.loop")
+		assertNoError(err, t, "setFunctionBreakpoint(main.loop)")
+		_, err = setFunctionBreakpoint(p, "main.signaled")
+		assertNoError(err, t, "setFunctionBreakpoint(main.signaled)")
+
+		assertNoError(proc.Continue(p), t, "Continue()")
+		if currentPC(p, t) != bp.Addr {
+			t.Fatal("not stopped at main.loop")
+		}
+		assertNoError(sys.Tgkill(p.Pid(), p.CurrentThread().ThreadID(), sys.SIGUSR1), t, "Tgkill(SIGUSR1)")
+		assertNoError(sys.Tgkill(p.Pid(), p.CurrentThread().ThreadID(), sys.SIGUSR2), t, "Tgkill(SIGUSR2)")
+
+		signaled := 0
+		for i := 0; i < 20; i++ {
+			assertNoError(proc.Continue(p), t, "Continue()")
+			loc, err := p.CurrentThread().Location()
+			assertNoError(err, t, "Location()")
+			if loc.Fn != nil && loc.Fn.Name == "main.signaled" {
+				signaled++
+				if signaled == 2 {
+					return
+				}
+			}
+		}
+		t.Fatalf("%d signals out of 2 were delivered", signaled)
+	})
+}
+
+func TestWatchpointValues(t *testing.T) {
+	if testBackend != "native" {
+		t.Skip("only supported by the native backend")
+	}
+	fixture := protest.BuildFixture("watchpointprog", 0)
+	p, err := native.Launch([]string{fixture.Path}, ".", false, []string{})
+	assertNoError(err, t, "Launch")
+	defer p.Detach(true)
+
+	scope, err := proc.ThreadScope(p.CurrentThread())
+	assertNoError(err, t, "ThreadScope")
+	watched, err := scope.EvalVariable("main.watched", normalLoadConfig)
+	assertNoError(err, t, "EvalVariable")
+	assertNoError(p.SetWatchpoint(uint64(watched.Addr), 8, native.WatchWrite), t, "SetWatchpoint")
+
+	// the loop of main writes double(i) to watched for i = 0, 1, 2
+	for _, expected := range [][2]uint64{{0, 0}, {0, 2}, {2, 4}} {
+		trapthread, err := p.ContinueOnce()
+		assertNoError(err, t, "ContinueOnce")
+		hits := trapthread.(*native.Thread).WatchpointHits()
+		if len(hits) != 1 || hits[0].Name != fmt.Sprintf("%#x", watched.Addr) {
+			t.Fatalf("wrong watchpoint hits %v", hits)
+		}
+		oldval, newval := binary.LittleEndian.Uint64(hits[0].OldValue), binary.LittleEndian.Uint64(hits[0].NewValue)
+		if oldval != expected[0] || newval != expected[1] {
+			t.Fatalf("wrong values of watched %d -> %d, expected %d -> %d", oldval, newval, expected[0], expected[1])
+		}
+	}
+}
+
+func TestInitialLocation(t *testing.T) {
+	if testBackend != "native" {
+		return
+	}
+	fixture := protest.BuildFixture("loopprog", 0)
+	cmd := exec.Command(fixture.Path)
+	assertNoError(cmd.Start(), t, "starting fixture")
+	defer cmd.Process.Kill()
+
+	// let the program reach main.loop
+	time.Sleep(500 * time.Millisecond)
+
+	p, err := native.Attach(cmd.Process.Pid, []string{})
+	assertNoError(err, t, "Attach")
+	defer p.Detach(false)
+
+	loc, err := proc.InitialLocation(p)
+	assertNoError(err, t, "InitialLocation")
+	t.Logf("initial location %#x %s:%d %v", loc.PC, loc.File, loc.Line, loc.Fn)
+	if loc.Fn == nil || loc.File == "" || loc.Line == 0 {
+		t.Fatalf("initial location does not have a function or line: %#x %s:%d", loc.PC, loc.File, loc.Line)
+	}
+	regs, err := p.CurrentThread().Registers(false)
+	assertNoError(err, t, "Registers")
+	pc := regs.PC()
+	if fn := p.BinInfo().PCToFunc(pc); fn != nil && loc.PC != pc {
+		t.Fatalf("wrong initial PC %#x, current thread is stopped at %#x (%s)", loc.PC, pc, fn.Name)
+	}
+}
+
+func TestWaitFor(t *testing.T) {
+	if testBackend != "native" {
+		return
+	}
+	fixture := protest.BuildFixture("loopprog", 0)
+	// the process is started after WaitFor, its pid is only read once
+	// cmd.Start has returned.
+	cmd := exec.Command(fixture.Path)
+	started := make(chan error, 1)
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		started <- cmd.Start()
+	}()
+
+	p, err := native.WaitFor(filepath.Base(fixture.Path), 10*time.Second, []string{})
+	assertNoError(<-started, t, "starting fixture")
+	defer cmd.Process.Kill()
+	assertNoError(err, t, "WaitFor")
+	if p.Pid() != cmd.Process.Pid {
+		t.Fatalf("attached to wrong process %d, expected %d", p.Pid(), cmd.Process.Pid)
+	}
+	assertNoError(p.Detach(false), t, "Detach")
+
+	_, err = native.WaitFor(filepath.Base(fixture.Path), 100*time.Millisecond, []string{})
+	if err == nil {
+		t.Fatal("WaitFor did not time out")
+	}
+}
+
+func TestCurrentSyscall(t *testing.T) {
+	if testBackend != "native" {
+		return
+	}
+	withTestProcess("blockedread", t, func(p proc.Process, fixture protest.Fixture) {
+		resumeChan := make(chan struct{}, 1)
+		go func() {
+			<-resumeChan
+			time.Sleep(500 * time.Millisecond)
+			p.RequestManualStop()
+		}()
+		p.ResumeNotify(resumeChan)
+		assertNoError(proc.Continue(p), t, "Continue()")
+
+		np := p.(*native.Process)
+		found := false
+		for _, th := range p.ThreadList() {
+			info, err := np.CurrentSyscall(th.ThreadID())
+			if err != nil {
+				if _, notinsyscall := err.(native.ErrNotInSyscall); !notinsyscall {
+					t.Fatalf("CurrentSyscall(%d): %v", th.ThreadID(), err)
+				}
+				continue
+			}
+			t.Logf("thread %d: %s (%d) %#x", th.ThreadID(), info.Name, info.Number, info.Args)
+			if info.Name == "read" && info.Number == sys.SYS_READ {
+				found = true
+			}
+		}
+		if !found {
+			t.Fatal("could not find thread blocked in read")
+		}
+	})
+}
+
+func TestLastSyscallResult(t *testing.T) {
+	if testBackend != "native" {
+		t.Skip("only supported by the native backend")
+	}
+	withTestProcess("openfail", t, func(p proc.Process, fixture protest.Fixture) {
+		_, err := setFunctionBreakpoint(p, "main.main")
+		assertNoError(err, t, "setFunctionBreakpoint")
+		assertNoError(proc.Continue(p), t, "Continue")
+
+		// stop after the SYSCALL instructions of the function executing the
+		// system calls of package syscall, and at the instructions themselves
+		// to check that their breakpoints are not mistaken for their code.
+		var text []proc.AsmInstruction
+		for _, fname := range []string{"internal/runtime/syscall/linux.Syscall6", "internal/runtime/syscall.Syscall6", "runtime/internal/syscall.Syscall6", "syscall.Syscall6"} {
+			if text, err = proc.DisassembleFunction(p, nil, fname); err == nil {
+				break
+			}
+		}
+		assertNoError(err, t, "DisassembleFunction")
+		atSyscall := map[uint64]bool{}
+		for _, instr := range text {
+			if bytes.Equal(instr.Bytes, []byte{0x0f, 0x05}) {
+				_, err := p.SetBreakpoint(instr.Loc.PC, proc.UserBreakpoint, nil)
+				assertNoError(err, t, "SetBreakpoint")
+				atSyscall[instr.Loc.PC] = true
+				_, err = p.SetBreakpoint(instr.Loc.PC+uint64(len(instr.Bytes)), proc.UserBreakpoint, nil)
+				assertNoError(err, t, "SetBreakpoint")
+			}
+		}
+
+		// the first system call of main that fails is the open of a file
+		// that does not exist.
+		np := p.(*native.Process)
+		for {
+			assertNoError(proc.Continue(p), t, "Continue")
+			if bp := p.CurrentThread().Breakpoint().Breakpoint; bp != nil && atSyscall[bp.Addr] {
+				continue
+			}
+			retval, errno, err := np.LastSyscallResult(p.CurrentThread().ThreadID())
+			assertNoError(err, t, "LastSyscallResult")
+			if errno == 0 {
+				if retval < 0 {
+					t.Fatalf("negative result %d without errno", retval)
+				}
+				continue
+			}
+			if retval != -1 || errno != syscall.ENOENT {
+				t.Fatalf("wrong result %d %v, expected -1 ENOENT", retval, errno)
+			}
+			break
+		}
+
+		if _, _, err := np.LastSyscallResult(p.CurrentThread().ThreadID() + 1<<30); err == nil {
+			t.Fatal("no error for an unknown thread")
+		}
+		_, err = setFunctionBreakpoint(p, "fmt.Println")
+		assertNoError(err, t, "setFunctionBreakpoint")
+		for {
+			assertNoError(proc.Continue(p), t, "Continue")
+			if loc, _ := p.CurrentThread().Location(); loc.Fn != nil && loc.Fn.Name == "fmt.Println" {
+				break
+			}
+		}
+		if _, _, err := np.LastSyscallResult(p.CurrentThread().ThreadID()); err == nil {
+			t.Fatal("no error for a thread not stopped after a system call")
+		}
+	})
+}
+
 func stripAndCopyDebugInfo(f protest.Fixture, t *testing.T) {
 	name := filepath.Base(f.Path)
 	// Copy the debug information to an external file.
@@ -37,3 +335,1013 @@ func stripAndCopyDebugInfo(f protest.Fixture, t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestMemoryCacheInvalidatedByStep(t *testing.T) {
+	if testBackend != "native" {
+		return
+	}
+	withTestProcess("loopprog", t, func(p proc.Process, fixture protest.Fixture) {
+		bp := setFileLineBreakpoint(p, t, fixture.Source, 8)
+		assertNoError(proc.Continue(p), t, "Continue()")
+		_, err := p.ClearBreakpoint(bp.Addr)
+		assertNoError(err, t, "ClearBreakpoint")
+
+		ivar := evalVariable(p, t, "i")
+		before := make([]byte, 8)
+		_, err = p.CurrentThread().ReadMemory(before, ivar.Addr)
+		assertNoError(err, t, "ReadMemory (before)")
+
+		assertNoError(proc.Next(p), t, "Next()")
+
+		after := make([]byte, 8)
+		_, err = p.CurrentThread().ReadMemory(after, ivar.Addr)
+		assertNoError(err, t, "ReadMemory (after)")
+		if bytes.Equal(before, after) {
+			t.Fatalf("memory read after step did not change: %x", after)
+		}
+		if v := evalVariable(p, t, "i"); constant.Compare(v.Value, token.NEQ, constant.BinaryOp(ivar.Value, token.ADD, constant.MakeInt64(1))) {
+			t.Fatalf("wrong value of i after step: %v (before %v)", v.Value, ivar.Value)
+		}
+	})
+}
+
+func BenchmarkArrayPtracePeeks(b *testing.B) {
+	if testBackend != "native" {
+		return
+	}
+	withTestProcess("testvariables2", b, func(p proc.Process, fixture protest.Fixture) {
+		assertNoError(proc.Continue(p), b, "Continue()")
+
+		var buf bytes.Buffer
+		logger := logrus.New()
+		logger.Out = &buf
+		logger.Level = logrus.DebugLevel
+		p.(*native.Process).SetLogger(logrus.NewEntry(logger))
+
+		// the first evaluation with an empty cache must read memory with
+		// fewer calls than an evaluation without the cache.
+		peeks := func(cached bool) int {
+			p.(*native.Process).SetMemoryCache(cached)
+			buf.Reset()
+			evalVariable(p, b, "bencharr")
+			return strings.Count(buf.String(), "peek")
+		}
+		uncached, cached := peeks(false), peeks(true)
+		if cached >= uncached {
+			b.Fatalf("%d PtracePeekData calls with the cache, %d without", cached, uncached)
+		}
+		b.Logf("%d PtracePeekData calls with the cache, %d without", cached, uncached)
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			evalVariable(p, b, "bencharr")
+		}
+	})
+}
+
+func TestNotGoBinary(t *testing.T) {
+	if testBackend != "native" {
+		return
+	}
+	exe := filepath.Join(os.TempDir(), "cloop")
+	buildCmd := exec.Command("cc", "-g", "-o", exe, filepath.Join(protest.FindFixturesDir(), "cloop.c"))
+	if out, err := buildCmd.CombinedOutput(); err != nil {
+		t.Skipf("could not build C fixture: %v\n%s", err, out)
+	}
+	defer os.Remove(exe)
+
+	_, err := native.Launch([]string{exe}, ".", false, []string{})
+	if err != proc.ErrNotGoBinary {
+		t.Fatalf("Launch: expected %v, got %v", proc.ErrNotGoBinary, err)
+	}
+
+	cmd := exec.Command(exe)
+	assertNoError(cmd.Start(), t, "starting fixture")
+	defer cmd.Process.Kill()
+
+	p, err := native.AttachNoWait(cmd.Process.Pid)
+	assertNoError(err, t, "AttachNoWait")
+	var ws sys.WaitStatus
+	_, err = sys.Wait4(cmd.Process.Pid, &ws, sys.WALL, nil)
+	assertNoError(err, t, "Wait4")
+	if err := p.FinishAttach([]string{}); err != proc.ErrNotGoBinary {
+		t.Fatalf("FinishAttach: expected %v, got %v", proc.ErrNotGoBinary, err)
+	}
+	if p.BinInfo().IsGoBinary() {
+		t.Fatal("C program detected as a Go binary")
+	}
+	defer p.Detach(false)
+
+	// registers and memory are still accessible
+	regs, err := p.CurrentThread().Registers(false)
+	assertNoError(err, t, "Registers")
+	buf := make([]byte, 1)
+	_, err = p.CurrentThread().ReadMemory(buf, uintptr(regs.SP()))
+	assertNoError(err, t, "ReadMemory")
+}
+
+func TestKilledOutOfBand(t *testing.T) {
+	if testBackend != "native" {
+		return
+	}
+	// Operations on a target that was killed while stopped should return
+	// ErrProcessExited instead of the ESRCH errors returned by ptrace.
+	withTestProcess("testnextprog", t, func(p proc.Process, fixture protest.Fixture) {
+		_, err := setFunctionBreakpoint(p, "main.helloworld")
+		assertNoError(err, t, "setFunctionBreakpoint()")
+		assertNoError(proc.Continue(p), t, "Continue()")
+		regs, err := p.CurrentThread().Registers(false)
+		assertNoError(err, t, "Registers()")
+
+		assertNoError(sys.Kill(p.Pid(), sys.SIGKILL), t, "Kill")
+		for i := 0; ; i++ {
+			stat, _ := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", p.Pid()))
+			if fields := strings.Fields(string(stat)); len(fields) > 2 && fields[2] == "Z" {
+				break
+			}
+			if i >= 100 {
+				t.Fatalf("process did not die: %s", stat)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		isExited := func(err error) bool {
+			switch err.(type) {
+			case proc.ErrProcessExited, *proc.ErrProcessExited:
+				return true
+			}
+			return false
+		}
+
+		buf := make([]byte, 8)
+		_, err = p.CurrentThread().ReadMemory(buf, uintptr(regs.SP()))
+		if !isExited(err) {
+			t.Fatalf("ReadMemory: expected ErrProcessExited, got %v", err)
+		}
+		if pe := err.(proc.ErrProcessExited); pe.Pid != p.Pid() || pe.Status != -int(sys.SIGKILL) {
+			t.Fatalf("ReadMemory: wrong pid or exit status in %v", err)
+		}
+		_, err = p.CurrentThread().Registers(false)
+		if !isExited(err) {
+			t.Fatalf("Registers: expected ErrProcessExited, got %v", err)
+		}
+		if err := proc.Continue(p); !isExited(err) {
+			t.Fatalf("Continue: expected ErrProcessExited, got %v", err)
+		}
+	})
+}
+
+func TestDumpMemory(t *testing.T) {
+	if testBackend != "native" {
+		return
+	}
+	withTestProcess("testnextprog", t, func(p proc.Process, fixture protest.Fixture) {
+		var buf bytes.Buffer
+		assertNoError(p.(*native.Process).DumpMemory(&buf), t, "DumpMemory()")
+		regions, err := native.ReadMemoryDump(&buf)
+		assertNoError(err, t, "ReadMemoryDump()")
+
+		// The code of main.main must be in the dump and match the memory of
+		// the target.
+		addr := p.BinInfo().LookupFunc["main.main"].Entry
+		expected := make([]byte, 16)
+		_, err = p.CurrentThread().ReadMemory(expected, uintptr(addr))
+		assertNoError(err, t, "ReadMemory()")
+		for _, r := range regions {
+			if addr < r.Addr || addr+uint64(len(expected)) > r.Addr+r.Size {
+				continue
+			}
+			if !r.Exec || r.Filename == "" {
+				t.Errorf("wrong mapping for main.main: %#v", r.MemoryMapEntry)
+			}
+			if got := r.Data[addr-r.Addr:][:len(expected)]; !bytes.Equal(got, expected) {
+				t.Fatalf("contents mismatch at %#x: got %x expected %x", addr, got, expected)
+			}
+			return
+		}
+		t.Fatalf("main.main (%#x) not found in dump", addr)
+	})
+}
+
+func TestPeekPokeUser(t *testing.T) {
+	if testBackend != "native" {
+		return
+	}
+	withTestProcess("testnextprog", t, func(p proc.Process, fixture protest.Fixture) {
+		th := p.CurrentThread().(*native.Thread)
+		dr0 := native.DebugRegisterOffset(0)
+		addr := p.BinInfo().LookupFunc["main.main"].Entry
+
+		assertNoError(th.PokeUser(dr0, addr), t, "PokeUser()")
+		val, err := th.PeekUser(dr0)
+		assertNoError(err, t, "PeekUser()")
+		if val != addr {
+			t.Fatalf("wrong value of DR0 %#x, expected %#x", val, addr)
+		}
+		assertNoError(th.PokeUser(dr0, 0), t, "PokeUser()")
+
+		if _, err := th.PeekUser(dr0 + 1); err == nil {
+			t.Fatal("no error reading unaligned offset")
+		}
+		if _, err := th.PeekUser(native.DebugRegisterOffset(8)); err == nil {
+			t.Fatal("no error reading past the end of the user area")
+		}
+	})
+}
+
+func TestNoDWARF(t *testing.T) {
+	// Executables built with -ldflags=-w have no DWARF but functions and line
+	// information can still be read from the Go symbol table.
+	fixture := protest.BuildFixture("testnextprog", protest.LinkStripDWARF)
+	bi := proc.NewBinaryInfo(runtime.GOOS, runtime.GOARCH)
+	assertNoError(bi.LoadBinaryInfo(fixture.Path, 0, nil), t, "LoadBinaryInfo")
+	if bi.HasDWARF() {
+		t.Fatal("executable built with -ldflags=-w has DWARF")
+	}
+	fn := bi.LookupFunc["main.helloworld"]
+	if fn == nil {
+		t.Fatal("could not find main.helloworld")
+	}
+	if file, line, _ := bi.PCToLine(fn.Entry); file != fixture.Source || line != 13 {
+		t.Errorf("wrong location for main.helloworld: %s:%d", file, line)
+	}
+	pc, pcfn, err := bi.LineToPC(fixture.Source, 14)
+	assertNoError(err, t, "LineToPC")
+	if pcfn != fn || pc < fn.Entry || pc >= fn.End {
+		t.Errorf("wrong address for %s:14: %#x", fixture.Source, pc)
+	}
+}
+
+func TestNoDWARFRenamedPclntab(t *testing.T) {
+	// The pclntab is found by its header when the .gopclntab section has
+	// been renamed.
+	if _, err := exec.LookPath("objcopy"); err != nil {
+		t.Skip("objcopy not installed")
+	}
+	fixture := protest.BuildFixture("testnextprog", protest.LinkStripDWARF)
+	dir, err := ioutil.TempDir("", "renamedpclntab")
+	assertNoError(err, t, "TempDir")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "renamed")
+	if out, err := exec.Command("objcopy", "--rename-section", ".gopclntab=.rodata.pcln", fixture.Path, path).CombinedOutput(); err != nil {
+		t.Fatalf("objcopy: %v\n%s", err, out)
+	}
+	bi := proc.NewBinaryInfo(runtime.GOOS, runtime.GOARCH)
+	assertNoError(bi.LoadBinaryInfo(path, 0, nil), t, "LoadBinaryInfo")
+	fn := bi.LookupFunc["main.helloworld"]
+	if fn == nil {
+		t.Fatal("could not find main.helloworld")
+	}
+	if file, line, _ := bi.PCToLine(fn.Entry); file != fixture.Source || line != 13 {
+		t.Errorf("wrong location for main.helloworld: %s:%d", file, line)
+	}
+}
+
+func TestLineToPCStatements(t *testing.T) {
+	// When DWARF is present LineToPC uses the line table of .debug_line,
+	// which marks statement boundaries, instead of the Go symbol table,
+	// which always returns the first instruction of the line.
+	fixture := protest.BuildFixture("testnextprog", protest.EnableOptimization|protest.EnableInlining)
+	bi := proc.NewBinaryInfo(runtime.GOOS, runtime.GOARCH)
+	assertNoError(bi.LoadBinaryInfo(fixture.Path, 0, nil), t, "LoadBinaryInfo")
+	if !bi.HasDWARF() {
+		t.Fatal("executable has no DWARF")
+	}
+
+	exe, err := elf.Open(fixture.Path)
+	assertNoError(err, t, "elf.Open")
+	defer exe.Close()
+	pclndata, err := exe.Section(".gopclntab").Data()
+	assertNoError(err, t, "reading .gopclntab")
+	symTable, err := gosym.NewTable(nil, gosym.NewLineTable(pclndata, exe.Section(".text").Addr))
+	assertNoError(err, t, "gosym.NewTable")
+
+	differ := 0
+	for line := 1; line <= 60; line++ {
+		pc, _, err := bi.LineToPC(fixture.Source, line)
+		if err != nil {
+			continue
+		}
+		gopc, _, err := symTable.LineToPC(fixture.Source, line)
+		if err != nil || gopc == pc {
+			continue
+		}
+		// the statement is after the first instruction of the line.
+		if _, l, _ := symTable.PCToLine(pc); pc < gopc || l != line {
+			t.Errorf("line %d: statement at %#x, first instruction at %#x", line, pc, gopc)
+		}
+		differ++
+	}
+	if differ == 0 {
+		t.Fatal("no line where the statement is not the first instruction")
+	}
+}
+
+func TestNoDWARFBreakpoint(t *testing.T) {
+	withTestProcessArgs("testnextprog", t, ".", []string{}, protest.LinkStripDWARF, func(p proc.Process, fixture protest.Fixture) {
+		_, err := setFunctionBreakpoint(p, "main.helloworld")
+		assertNoError(err, t, "setFunctionBreakpoint()")
+		assertNoError(proc.Continue(p), t, "Continue()")
+		loc, err := p.CurrentThread().Location()
+		assertNoError(err, t, "Location()")
+		if loc.Fn == nil || loc.Fn.Name != "main.helloworld" || loc.File != fixture.Source {
+			t.Fatalf("stopped at the wrong location %s:%d", loc.File, loc.Line)
+		}
+
+		scope, err := proc.ThreadScope(p.CurrentThread())
+		assertNoError(err, t, "ThreadScope()")
+		if _, err := scope.EvalVariable("j", normalLoadConfig); err != proc.ErrNoDebugInfo {
+			t.Fatalf("expected ErrNoDebugInfo, got %v", err)
+		}
+	})
+}
+
+func TestLoadResult(t *testing.T) {
+	fixture := protest.BuildFixture("testnextprog", 0)
+	bi := proc.NewBinaryInfo(runtime.GOOS, runtime.GOARCH)
+	assertNoError(bi.LoadBinaryInfo(fixture.Path, 0, nil), t, "LoadBinaryInfo")
+	r := bi.LoadResult()
+	if r.Executable != nil || r.BuildInfo != nil || r.DWARF != nil || r.Symbols != nil {
+		t.Fatalf("components missing from a complete executable: %+v", r)
+	}
+	if r.Gosym != proc.ErrNotLoaded {
+		t.Fatalf("Go symbol table loaded with DWARF: %v", r.Gosym)
+	}
+
+	// -ldflags=-s strips both the DWARF and the ELF symbol table, the
+	// executable can still be debugged using the Go symbol table.
+	withTestProcessArgs("testnextprog", t, ".", []string{}, protest.LinkStrip, func(p proc.Process, fixture protest.Fixture) {
+		r := p.BinInfo().LoadResult()
+		if r.Executable != nil || r.BuildInfo != nil || r.Gosym != nil {
+			t.Fatalf("components missing from a stripped executable: %+v", r)
+		}
+		if r.DWARF == nil || r.Symbols == nil {
+			t.Fatalf("stripped components loaded: %+v", r)
+		}
+		_, err := setFunctionBreakpoint(p, "main.helloworld")
+		assertNoError(err, t, "setFunctionBreakpoint()")
+		assertNoError(proc.Continue(p), t, "Continue()")
+		if f, ln := currentLineNumber(p, t); f != fixture.Source || ln != 13 {
+			t.Fatalf("stopped at the wrong location %s:%d", f, ln)
+		}
+	})
+}
+
+func TestTargetGroupFork(t *testing.T) {
+	// Processes created with fork are added to the group and stop at the
+	// breakpoints inherited from their parent.
+	if testBackend != "native" {
+		return
+	}
+	withTestProcess("forkprog", t, func(p proc.Process, fixture protest.Fixture) {
+		g, err := native.NewTargetGroup(p.(*native.Process))
+		assertNoError(err, t, "NewTargetGroup()")
+		defer g.Detach(true)
+		_, err = setFunctionBreakpoint(p, "main.child")
+		assertNoError(err, t, "setFunctionBreakpoint(main.child)")
+		_, err = setFunctionBreakpoint(p, "main.parent")
+		assertNoError(err, t, "setFunctionBreakpoint(main.parent)")
+
+		var childHit, parentHit bool
+		for !childHit || !parentHit {
+			stopped, err := g.Continue()
+			assertNoError(err, t, "Continue()")
+			loc, err := stopped.CurrentThread().Location()
+			assertNoError(err, t, "Location()")
+			t.Logf("process %d stopped at %s", stopped.Pid(), loc.Fn.Name)
+			switch loc.Fn.Name {
+			case "main.child":
+				if stopped.Pid() == p.Pid() {
+					t.Fatal("main.child hit by the parent process")
+				}
+				if len(g.Processes()) != 2 {
+					t.Fatalf("wrong number of processes %d", len(g.Processes()))
+				}
+				select {
+				case ev := <-g.Events():
+					if ev.Kind != native.ProcessAdded || ev.Process != stopped {
+						t.Fatalf("wrong event %#v", ev)
+					}
+				default:
+					t.Fatal("no event for the new process")
+				}
+				childHit = true
+			case "main.parent":
+				if stopped.Pid() != p.Pid() {
+					t.Fatal("main.parent hit by the child process")
+				}
+				if !childHit {
+					t.Fatal("parent stopped before the child")
+				}
+				parentHit = true
+			default:
+				t.Fatalf("unexpected stop at %s", loc.Fn.Name)
+			}
+		}
+	})
+}
+
+func TestAuxVectorPIE(t *testing.T) {
+	// The entry point reported by the kernel in the auxiliary vector must be
+	// the entry point of the ELF header plus the load bias of the executable.
+	if testBackend != "native" {
+		return
+	}
+	fixture := protest.BuildFixture("testnextprog", protest.BuildModePIE)
+	p, err := native.Launch([]string{fixture.Path}, ".", false, []string{})
+	assertNoError(err, t, "Launch")
+	defer p.Detach(true)
+
+	auxv, err := p.AuxVector()
+	assertNoError(err, t, "AuxVector")
+	exe, err := elf.Open(fixture.Path)
+	assertNoError(err, t, "elf.Open")
+	defer exe.Close()
+	if exe.Type != elf.ET_DYN {
+		t.Fatalf("fixture built with -buildmode=pie is not position independent: %v", exe.Type)
+	}
+
+	bias := p.BinInfo().Images[0].StaticBase
+	if bias == 0 {
+		t.Error("no load bias for position independent executable")
+	}
+	if entry := auxv[linutil.AuxvEntry]; entry != exe.Entry+bias {
+		t.Errorf("wrong entry point %#x, expected %#x + %#x", entry, exe.Entry, bias)
+	}
+	for _, prog := range exe.Progs {
+		if prog.Type == elf.PT_INTERP && auxv[linutil.AuxvBase] == 0 {
+			t.Error("no interpreter base for dynamically linked executable")
+		}
+	}
+}
+
+func TestNextThreadEvent(t *testing.T) {
+	if testBackend != "native" {
+		return
+	}
+	fixture := protest.BuildFixture("testthreads", 0)
+	p, err := native.Launch([]string{fixture.Path}, ".", false, []string{})
+	assertNoError(err, t, "Launch")
+	defer p.Detach(true)
+
+	for i := 0; i < 3; i++ {
+		ev, err := p.NextThreadEvent()
+		assertNoError(err, t, "NextThreadEvent")
+		if ev.Thread.ID <= 0 || ev.Thread.ID == ev.Parent.ID {
+			t.Fatalf("bad thread event: new thread %d created by %d", ev.Thread.ID, ev.Parent.ID)
+		}
+		if _, found := p.FindThread(ev.Thread.ID); !found {
+			t.Errorf("new thread %d not in the thread list", ev.Thread.ID)
+		}
+		if _, err := os.Stat(fmt.Sprintf("/proc/%d/task/%d", p.Pid(), ev.Thread.ID)); err != nil {
+			t.Errorf("new thread %d not a task of the target: %v", ev.Thread.ID, err)
+		}
+		if p.CurrentThread().ThreadID() != ev.Parent.ID {
+			t.Errorf("current thread %d is not the thread that created %d", p.CurrentThread().ThreadID(), ev.Thread.ID)
+		}
+	}
+}
+
+func TestRegisterSnapshot(t *testing.T) {
+	if testBackend != "native" {
+		return
+	}
+	fixture := protest.BuildFixture("testnextprog", 0)
+	p, err := native.Launch([]string{fixture.Path}, ".", false, []string{})
+	assertNoError(err, t, "Launch")
+	defer p.Detach(true)
+
+	th := p.CurrentThread()
+	regs, err := th.Registers(false)
+	assertNoError(err, t, "Registers")
+	snap, err := p.SaveRegisterSnapshot()
+	assertNoError(err, t, "SaveRegisterSnapshot")
+
+	for i := 0; i < 5; i++ {
+		assertNoError(th.StepInstruction(), t, "StepInstruction")
+	}
+	if pc := currentPC(p, t); pc == regs.PC() {
+		t.Fatalf("PC did not change after stepping: %#x", pc)
+	}
+
+	assertNoError(p.RestoreRegisterSnapshot(snap), t, "RestoreRegisterSnapshot")
+	if pc := currentPC(p, t); pc != regs.PC() {
+		t.Errorf("wrong PC after restoring the snapshot %#x, expected %#x", pc, regs.PC())
+	}
+	newregs, err := th.Registers(false)
+	assertNoError(err, t, "Registers")
+	if newregs.SP() != regs.SP() {
+		t.Errorf("wrong SP after restoring the snapshot %#x, expected %#x", newregs.SP(), regs.SP())
+	}
+}
+
+func TestStopReason(t *testing.T) {
+	if testBackend != "native" {
+		return
+	}
+	fixture := protest.BuildFixture("watchpointprog", 0)
+	p, err := native.Launch([]string{fixture.Path}, ".", false, []string{})
+	assertNoError(err, t, "Launch")
+	defer p.Detach(true)
+
+	fnentry, err := proc.FindFunctionLocation(p, "main.double", true, 0)
+	assertNoError(err, t, "FindFunctionLocation")
+	_, err = p.SetBreakpoint(fnentry, proc.UserBreakpoint, nil)
+	assertNoError(err, t, "SetBreakpoint")
+
+	// write watchpoint on main.watched: DR0 is the address, DR7 enables it
+	// locally (L0) with R/W0 = 01 (data writes) and LEN0 = 11 (8 bytes).
+	scope, err := proc.ThreadScope(p.CurrentThread())
+	assertNoError(err, t, "ThreadScope")
+	watched, err := scope.EvalVariable("main.watched", normalLoadConfig)
+	assertNoError(err, t, "EvalVariable")
+	th := p.CurrentThread().(*native.Thread)
+	assertNoError(th.PokeUser(native.DebugRegisterOffset(0), uint64(watched.Addr)), t, "PokeUser(DR0)")
+	assertNoError(th.PokeUser(native.DebugRegisterOffset(7), 1|1<<16|3<<18), t, "PokeUser(DR7)")
+
+	for _, expected := range []native.StopReason{native.StopBreakpoint, native.StopWatchpoint, native.StopBreakpoint, native.StopWatchpoint} {
+		trapthread, err := p.ContinueOnce()
+		assertNoError(err, t, "ContinueOnce")
+		if reason := trapthread.(*native.Thread).StopReason(); reason != expected {
+			loc, _ := trapthread.Location()
+			t.Fatalf("wrong stop reason at %#x: %v, expected %v", loc.PC, reason, expected)
+		}
+		for _, other := range p.ThreadList() {
+			if other.ThreadID() != trapthread.ThreadID() && other.(*native.Thread).StopReason() != native.StopNone {
+				t.Errorf("thread %d has stop reason %v", other.ThreadID(), other.(*native.Thread).StopReason())
+			}
+		}
+	}
+
+	assertNoError(th.StepInstruction(), t, "StepInstruction")
+	if reason := th.StopReason(); reason != native.StopStep {
+		t.Errorf("wrong stop reason after StepInstruction: %v", reason)
+	}
+}
+
+func TestWatchVariable(t *testing.T) {
+	if testBackend != "native" {
+		t.Skip("only supported by the native backend")
+	}
+	fixture := protest.BuildFixture("watchpointprog", 0)
+	p, err := native.Launch([]string{fixture.Path}, ".", false, []string{})
+	assertNoError(err, t, "Launch")
+	defer p.Detach(true)
+
+	if err := p.WatchVariable("runtime.buildVersion", native.WatchWrite); err == nil || !strings.Contains(err.Error(), "larger than the maximum size") {
+		t.Fatalf("wrong error watching a string: %v", err)
+	}
+	assertNoError(p.WatchVariable("main.watched", native.WatchWrite), t, "WatchVariable")
+
+	// the loop of main writes double(i) to watched for i = 0, 1, 2
+	for _, expected := range []int64{0, 2, 4} {
+		trapthread, err := p.ContinueOnce()
+		assertNoError(err, t, "ContinueOnce")
+		if reason := trapthread.(*native.Thread).StopReason(); reason != native.StopWatchpoint {
+			loc, _ := trapthread.Location()
+			t.Fatalf("wrong stop reason at %#x: %v", loc.PC, reason)
+		}
+		assertNoError(p.SwitchThread(trapthread.ThreadID()), t, "SwitchThread")
+		if n, _ := constant.Int64Val(evalVariable(p, t, "main.watched").Value); n != expected {
+			t.Fatalf("wrong value of watched %d, expected %d", n, expected)
+		}
+	}
+
+	// clearing the watchpoint frees its debug register.
+	addr := uint64(evalVariable(p, t, "main.watched").Addr)
+	assertNoError(p.ClearWatchpoint(addr), t, "ClearWatchpoint")
+	if err := p.ClearWatchpoint(addr); err == nil {
+		t.Fatal("watchpoint cleared twice")
+	}
+	for i := 0; i < 4; i++ {
+		assertNoError(p.SetWatchpoint(addr+uint64(i), 1, native.WatchWrite), t, fmt.Sprintf("SetWatchpoint(%d)", i))
+	}
+}
+
+func TestWatchVariableOutOfScope(t *testing.T) {
+	if testBackend != "native" {
+		t.Skip("only supported by the native backend")
+	}
+	fixture := protest.BuildFixture("watchpointprog", 0)
+	p, err := native.Launch([]string{fixture.Path}, ".", false, []string{})
+	assertNoError(err, t, "Launch")
+	defer p.Detach(true)
+
+	pc, err := proc.FindFileLocation(p, fixture.Source, 13)
+	assertNoError(err, t, "FindFileLocation")
+	_, err = p.SetBreakpoint(pc, proc.UserBreakpoint, nil)
+	assertNoError(err, t, "SetBreakpoint")
+	assertNoError(proc.Continue(p), t, "Continue")
+	_, err = p.ClearBreakpoint(pc)
+	assertNoError(err, t, "ClearBreakpoint")
+	assertNoError(p.WatchVariable("n", native.WatchWrite), t, "WatchVariable")
+	addr := uint64(evalVariable(p, t, "n").Addr)
+
+	// the loop of counter writes n twice
+	for i := 0; i < 2; i++ {
+		assertNoError(proc.Continue(p), t, "Continue")
+		if reason := p.CurrentThread().(*native.Thread).StopReason(); reason != native.StopWatchpoint {
+			loc, _ := p.CurrentThread().Location()
+			t.Fatalf("wrong stop reason at %s:%d: %v", loc.File, loc.Line, reason)
+		}
+	}
+
+	// after counter returns clobber reuses its frame, the watchpoint is
+	// cleared instead of stopping there.
+	pc, err = proc.FindFileLocation(p, fixture.Source, 33)
+	assertNoError(err, t, "FindFileLocation")
+	_, err = p.SetBreakpoint(pc, proc.UserBreakpoint, nil)
+	assertNoError(err, t, "SetBreakpoint")
+	assertNoError(proc.Continue(p), t, "Continue")
+	if _, ln := currentLineNumber(p, t); ln != 33 {
+		t.Fatalf("stopped at line %d, expected 33", ln)
+	}
+	if err := p.ClearWatchpoint(addr); err == nil {
+		t.Fatal("the watchpoint on n was not cleared")
+	}
+}
+
+func TestAttachThread(t *testing.T) {
+	if testBackend != "native" {
+		t.Skip("only supported by the native backend")
+	}
+	fixture := protest.BuildFixture("loopprog", 0)
+	cmd := exec.Command(fixture.Path)
+	assertNoError(cmd.Start(), t, "starting fixture")
+	defer cmd.Process.Kill()
+	pid := cmd.Process.Pid
+
+	// wait for the runtime to start its other threads
+	var tid int
+	for i := 0; tid == 0; i++ {
+		if i >= 100 {
+			t.Fatal("fixture did not start any thread")
+		}
+		time.Sleep(10 * time.Millisecond)
+		tasks, _ := filepath.Glob(fmt.Sprintf("/proc/%d/task/*", pid))
+		for _, task := range tasks {
+			if n, _ := strconv.Atoi(filepath.Base(task)); n != pid {
+				tid = n
+			}
+		}
+	}
+
+	tracerPid := func(tid int) string {
+		buf, _ := ioutil.ReadFile(fmt.Sprintf("/proc/%d/task/%d/status", pid, tid))
+		for _, line := range strings.Split(string(buf), "\n") {
+			if strings.HasPrefix(line, "TracerPid:") {
+				return strings.TrimSpace(line[len("TracerPid:"):])
+			}
+		}
+		return ""
+	}
+
+	p, err := native.AttachThread(pid, tid, []string{})
+	assertNoError(err, t, "AttachThread")
+	threads := p.ThreadList()
+	if len(threads) != 1 || threads[0].ThreadID() != tid {
+		t.Fatalf("wrong thread list, expected only %d", tid)
+	}
+	regs, err := threads[0].Registers(false)
+	assertNoError(err, t, "Registers")
+	if regs.PC() == 0 {
+		t.Fatal("PC of the attached thread is zero")
+	}
+	if tracerPid(tid) == "0" {
+		t.Fatalf("thread %d not traced", tid)
+	}
+	if tracerPid(pid) != "0" {
+		t.Fatalf("main thread traced by %s", tracerPid(pid))
+	}
+
+	// a manual stop only stops the attached thread, the process isn't
+	// killed by a signal delivered to one of its untraced threads.
+	errChan := make(chan error, 1)
+	go func() {
+		_, err := p.ContinueOnce()
+		errChan <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	assertNoError(p.RequestManualStop(), t, "RequestManualStop")
+	assertNoError(<-errChan, t, "ContinueOnce")
+	if !p.CheckAndClearManualStopRequest() {
+		t.Fatal("manual stop request not recorded")
+	}
+	if err := cmd.Process.Signal(syscall.Signal(0)); err != nil {
+		t.Fatalf("process not running after the manual stop: %v", err)
+	}
+
+	assertNoError(p.Detach(false), t, "Detach")
+	if tracerPid(tid) != "0" {
+		t.Fatalf("thread %d still traced after detach", tid)
+	}
+}
+
+func TestSignalState(t *testing.T) {
+	if testBackend != "native" {
+		t.Skip("only supported by the native backend")
+	}
+	fixture := protest.BuildFixture("sigblock", 0)
+	cmd := exec.Command(fixture.Path)
+	stdout, err := cmd.StdoutPipe()
+	assertNoError(err, t, "StdoutPipe")
+	assertNoError(cmd.Start(), t, "starting fixture")
+	defer cmd.Process.Kill()
+
+	// the fixture prints the ID of the thread blocking SIGUSR1 after
+	// sending the signal to it.
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	assertNoError(err, t, "reading thread ID")
+	tid, err := strconv.Atoi(strings.TrimSpace(line))
+	assertNoError(err, t, "parsing thread ID")
+
+	p, err := native.Attach(cmd.Process.Pid, []string{})
+	assertNoError(err, t, "Attach")
+	defer p.Detach(true)
+
+	ss, err := p.SignalState(tid)
+	assertNoError(err, t, "SignalState")
+	contains := func(names []string, name string) bool {
+		for _, n := range names {
+			if n == name {
+				return true
+			}
+		}
+		return false
+	}
+	if !contains(ss.Blocked, "SIGUSR1") {
+		t.Errorf("SIGUSR1 not blocked: %v", ss.Blocked)
+	}
+	if !contains(ss.Pending, "SIGUSR1") {
+		t.Errorf("SIGUSR1 not pending: %v", ss.Pending)
+	}
+}
+
+func TestContinueUntilSignal(t *testing.T) {
+	if testBackend != "native" {
+		t.Skip("only supported by the native backend")
+	}
+	fixture := protest.BuildFixture("loopprog", 0)
+	p, err := native.Launch([]string{fixture.Path}, ".", false, []string{})
+	assertNoError(err, t, "Launch")
+	defer p.Detach(true)
+
+	// the breakpoint is stepped over, signals other than SIGUSR1 (for
+	// example the SIGURG used by the runtime for preemption) are delivered.
+	_, err = setFunctionBreakpoint(p, "main.loop")
+	assertNoError(err, t, "setFunctionBreakpoint")
+	go func() {
+		time.Sleep(500 * time.Millisecond)
+		syscall.Kill(p.Pid(), syscall.SIGUSR1)
+	}()
+	sig, err := p.ContinueUntilSignal(false, syscall.SIGUSR1)
+	assertNoError(err, t, "ContinueUntilSignal")
+	if sig != syscall.SIGUSR1 {
+		t.Fatalf("stopped by signal %v, expected SIGUSR1", sig)
+	}
+
+	// with stopAtBreakpoints set, the process stops at the next breakpoint.
+	pc, err := proc.FindFileLocation(p, fixture.Source, 8)
+	assertNoError(err, t, "FindFileLocation")
+	_, err = p.SetBreakpoint(pc, proc.UserBreakpoint, nil)
+	assertNoError(err, t, "SetBreakpoint")
+	sig, err = p.ContinueUntilSignal(true, syscall.SIGUSR1)
+	assertNoError(err, t, "ContinueUntilSignal")
+	if sig != 0 {
+		t.Fatalf("stopped by signal %v, expected a breakpoint", sig)
+	}
+	if _, ln := currentLineNumber(p, t); ln != 8 {
+		t.Fatalf("stopped at line %d, expected 8", ln)
+	}
+	_, err = p.ClearBreakpoint(pc)
+	assertNoError(err, t, "ClearBreakpoint")
+
+	// with no signals listed the signal sent to a thread other than the
+	// current one is reported, not the SIGSTOPs used to stop the other
+	// threads or the SIGURGs of the runtime, and the current thread is
+	// switched to the thread that received it.
+	tid := 0
+	for _, th := range p.ThreadList() {
+		if th.ThreadID() != p.CurrentThread().ThreadID() {
+			tid = th.ThreadID()
+			break
+		}
+	}
+	if tid == 0 {
+		t.Fatal("the target has only one thread")
+	}
+	go func() {
+		time.Sleep(500 * time.Millisecond)
+		syscall.Tgkill(p.Pid(), tid, syscall.SIGUSR1)
+	}()
+	sig, err = p.ContinueUntilSignal(false)
+	assertNoError(err, t, "ContinueUntilSignal")
+	if sig != syscall.SIGUSR1 {
+		t.Fatalf("stopped by signal %v, expected SIGUSR1", sig)
+	}
+	if p.CurrentThread().ThreadID() != tid {
+		t.Fatalf("current thread %d, expected %d", p.CurrentThread().ThreadID(), tid)
+	}
+}
+
+func TestContinueIgnoringBreakpoints(t *testing.T) {
+	if testBackend != "native" {
+		t.Skip("only supported by the native backend")
+	}
+	fixture := protest.BuildFixture("loopprog", 0)
+	p, err := native.Launch([]string{fixture.Path}, ".", false, []string{})
+	assertNoError(err, t, "Launch")
+	defer p.Detach(true)
+
+	pc, err := proc.FindFileLocation(p, fixture.Source, 8)
+	assertNoError(err, t, "FindFileLocation")
+	bp, err := p.SetBreakpoint(pc, proc.UserBreakpoint, nil)
+	assertNoError(err, t, "SetBreakpoint")
+	assertNoError(proc.Continue(p), t, "Continue")
+	if bp.TotalHitCount != 1 {
+		t.Fatalf("wrong hit count %d", bp.TotalHitCount)
+	}
+
+	// the loop runs past the breakpoint until the manual stop.
+	go func() {
+		time.Sleep(500 * time.Millisecond)
+		p.RequestManualStop()
+	}()
+	assertNoError(p.ContinueIgnoringBreakpoints(), t, "ContinueIgnoringBreakpoints")
+	if bp.TotalHitCount != 1 {
+		t.Fatalf("breakpoint hit while ignoring breakpoints, hit count %d", bp.TotalHitCount)
+	}
+
+	// the breakpoint is armed again.
+	assertNoError(proc.Continue(p), t, "Continue")
+	if _, ln := currentLineNumber(p, t); ln != 8 || bp.TotalHitCount != 2 {
+		t.Fatalf("stopped at line %d with hit count %d, expected line 8 and hit count 2", ln, bp.TotalHitCount)
+	}
+	i := evalVariable(p, t, "i")
+	if n, _ := constant.Int64Val(i.Value); n <= 100000 {
+		t.Fatalf("loop did not run while ignoring breakpoints, i = %d", n)
+	}
+}
+
+func TestInstalledAddrs(t *testing.T) {
+	if testBackend != "native" {
+		t.Skip("only supported by the native backend")
+	}
+	fixture := protest.BuildFixture("loopprog", 0)
+	p, err := native.Launch([]string{fixture.Path}, ".", false, []string{})
+	assertNoError(err, t, "Launch")
+	defer p.Detach(true)
+
+	pc, err := proc.FindFileLocation(p, fixture.Source, 8)
+	assertNoError(err, t, "FindFileLocation")
+	bp, err := p.SetBreakpoint(pc, proc.UserBreakpoint, nil)
+	assertNoError(err, t, "SetBreakpoint")
+	assertNoError(proc.Continue(p), t, "Continue")
+
+	// the breakpoints set by Launch, on unrecovered panics and fatal
+	// errors, are also installed.
+	contains := func(addrs []uint64, addr uint64) bool {
+		for _, a := range addrs {
+			if a == addr {
+				return true
+			}
+		}
+		return false
+	}
+	addrs, err := p.InstalledAddrs()
+	assertNoError(err, t, "InstalledAddrs")
+	if len(addrs) != len(p.Breakpoints().M) || !contains(addrs, bp.Addr) {
+		t.Fatalf("wrong installed addresses %#x, breakpoint at %#x", addrs, bp.Addr)
+	}
+
+	// restore the original instruction of the breakpoint and write a
+	// breakpoint instruction at the entry of main.main, without telling
+	// the debugger.
+	_, err = p.CurrentThread().WriteMemory(uintptr(bp.Addr), bp.OriginalData)
+	assertNoError(err, t, "WriteMemory")
+	mainpc, err := proc.FindFunctionLocation(p, "main.main", false, 0)
+	assertNoError(err, t, "FindFunctionLocation")
+	_, err = p.CurrentThread().WriteMemory(uintptr(mainpc), p.BinInfo().Arch.BreakpointInstruction())
+	assertNoError(err, t, "WriteMemory")
+
+	addrs, err = p.InstalledAddrs()
+	mismatch, ok := err.(native.ErrBreakpointMismatch)
+	if !ok {
+		t.Fatalf("expected ErrBreakpointMismatch, got %v", err)
+	}
+	if len(addrs) != len(p.Breakpoints().M)-1 || contains(addrs, bp.Addr) {
+		t.Fatalf("wrong installed addresses %#x", addrs)
+	}
+	if len(mismatch.Missing) != 1 || mismatch.Missing[0] != bp.Addr {
+		t.Fatalf("wrong missing addresses %#x, expected [%#x]", mismatch.Missing, bp.Addr)
+	}
+	if len(mismatch.Unexpected) != 1 || mismatch.Unexpected[0] != mainpc {
+		t.Fatalf("wrong unexpected addresses %#x, expected [%#x]", mismatch.Unexpected, mainpc)
+	}
+}
+
+// cpuHasFlags returns true if the CPU has all the features in flags, as
+// listed in /proc/cpuinfo.
+func cpuHasFlags(flags ...string) bool {
+	buf, err := ioutil.ReadFile("/proc/cpuinfo")
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(buf), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "flags" {
+			continue
+		}
+		have := make(map[string]bool)
+		for _, flag := range fields[2:] {
+			have[flag] = true
+		}
+		for _, flag := range flags {
+			if !have[flag] {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func TestAVXRegisters(t *testing.T) {
+	if !cpuHasFlags("avx") {
+		t.Skip("CPU does not support AVX")
+	}
+	avx512 := cpuHasFlags("avx512f")
+	args := []string{}
+	if avx512 {
+		args = append(args, "avx512")
+	}
+	withTestProcessArgs("avxtest/", t, ".", args, 0, func(p proc.Process, fixture protest.Fixture) {
+		findReg := func(name string) []byte {
+			regs, err := p.CurrentThread().Registers(true)
+			assertNoError(err, t, "Registers")
+			for _, reg := range regs.Slice(true) {
+				if reg.Name == name {
+					return reg.Bytes
+				}
+			}
+			t.Fatalf("register %s not found", name)
+			return nil
+		}
+
+		// the fixture stops after loading 1, 2, ..., 32 into YMM0.
+		assertNoError(proc.Continue(p), t, "Continue()")
+		expected := make([]byte, 32)
+		for i := range expected {
+			expected[i] = byte(i + 1)
+		}
+		if ymm0 := findReg("YMM0"); !bytes.Equal(ymm0, expected) {
+			t.Fatalf("wrong YMM0 %x, expected %x", ymm0, expected)
+		}
+		if xmm0 := findReg("XMM0"); !bytes.Equal(xmm0, expected[:16]) {
+			t.Fatalf("wrong XMM0 %x, expected %x", xmm0, expected[:16])
+		}
+
+		if !avx512 {
+			return
+		}
+		// and then after loading 0x80, 0x81, ..., 0xbf into ZMM1.
+		assertNoError(proc.Continue(p), t, "Continue()")
+		expected = make([]byte, 64)
+		for i := range expected {
+			expected[i] = byte(0x80 + i)
+		}
+		if zmm1 := findReg("ZMM1"); !bytes.Equal(zmm1, expected) {
+			t.Fatalf("wrong ZMM1 %x, expected %x", zmm1, expected)
+		}
+	})
+}
+
+func TestLaunchExecStop(t *testing.T) {
+	// Launch must return with the target stopped at the first instruction
+	// after execve, the first Continue must then stop at main.main and not
+	// at the SIGTRAP of the execve.
+	if testBackend != "native" {
+		t.Skip("only supported by the native backend")
+	}
+	fixture := protest.BuildFixture("testnextprog", 0)
+	p, err := native.Launch([]string{fixture.Path}, ".", false, []string{})
+	assertNoError(err, t, "Launch")
+	defer p.Detach(true)
+
+	auxv, err := p.AuxVector()
+	assertNoError(err, t, "AuxVector")
+	if pc := currentPC(p, t); pc != auxv[linutil.AuxvEntry] && pc != auxv[linutil.AuxvBase] {
+		t.Errorf("target stopped at %#x after Launch, not at the entry point", pc)
+	}
+
+	bp, err := setFunctionBreakpoint(p, "main.main")
+	assertNoError(err, t, "setFunctionBreakpoint")
+	assertNoError(proc.Continue(p), t, "Continue()")
+	if th := p.CurrentThread(); th.Breakpoint().Breakpoint != bp {
+		loc, _ := th.Location()
+		t.Fatalf("first Continue stopped at %v, expected breakpoint at main.main", loc)
+	}
+	if bp.TotalHitCount != 1 {
+		t.Fatalf("wrong hit count %d", bp.TotalHitCount)
+	}
+}
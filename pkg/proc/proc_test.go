@@ -2,6 +2,10 @@ package proc_test
 
 import (
 	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"go/ast"
@@ -29,7 +33,7 @@ import (
 	protest "github.com/go-delve/delve/pkg/proc/test"
 )
 
-var normalLoadConfig = proc.LoadConfig{true, 1, 64, 64, -1, 0}
+var normalLoadConfig = proc.LoadConfig{true, 1, 64, 64, -1, 0, false, false}
 var testBackend, buildMode string
 
 func init() {
@@ -313,6 +317,122 @@ func TestBreakpointInSeparateGoRoutine(t *testing.T) {
 	})
 }
 
+func TestStepThread(t *testing.T) {
+	if testBackend == "rr" {
+		return
+	}
+	withTestProcess("testthreads", t, func(p proc.Process, fixture protest.Fixture) {
+		_, err := setFunctionBreakpoint(p, "main.anotherthread")
+		assertNoError(err, t, "setFunctionBreakpoint()")
+		assertNoError(proc.Continue(p), t, "Continue()")
+
+		threadPCs := func() map[int]uint64 {
+			r := make(map[int]uint64)
+			for _, th := range p.ThreadList() {
+				regs, err := th.Registers(false)
+				assertNoError(err, t, "Registers")
+				r[th.ThreadID()] = regs.PC()
+			}
+			return r
+		}
+
+		if err := proc.StepThread(p, -1); err == nil {
+			t.Fatal("StepThread on a non-existent thread did not return an error")
+		}
+
+		tid := p.CurrentThread().ThreadID()
+		before := threadPCs()
+		assertNoError(proc.StepThread(p, tid), t, "StepThread()")
+		after := threadPCs()
+
+		if p.CurrentThread().ThreadID() != tid {
+			t.Fatalf("current thread changed to %d after stepping %d", p.CurrentThread().ThreadID(), tid)
+		}
+		for id, pc := range before {
+			if id == tid {
+				if after[id] == pc {
+					t.Fatalf("PC of thread %d did not change after StepThread: %#x", id, pc)
+				}
+			} else if after[id] != pc {
+				t.Fatalf("PC of thread %d changed while stepping thread %d: %#x -> %#x", id, tid, pc, after[id])
+			}
+		}
+	})
+}
+
+func TestSetRegexBreakpoints(t *testing.T) {
+	withTestProcess("testnextprog", t, func(p proc.Process, fixture protest.Fixture) {
+		bps, err := proc.SetRegexBreakpoints(p, `^main\.(sleepytime|helloworld|testnext)$`)
+		assertNoError(err, t, "SetRegexBreakpoints()")
+		found := map[string]bool{}
+		for _, bp := range bps {
+			found[bp.FunctionName] = true
+			if bp.Kind != proc.UserBreakpoint {
+				t.Fatalf("wrong kind for breakpoint on %s: %v", bp.FunctionName, bp.Kind)
+			}
+		}
+		if len(bps) != 3 || !found["main.sleepytime"] || !found["main.helloworld"] || !found["main.testnext"] {
+			t.Fatalf("wrong breakpoints set: %v", found)
+		}
+
+		// breakpoints already exist
+		bps, err = proc.SetRegexBreakpoints(p, `^main\.helloworld$`)
+		if err == nil || len(bps) != 0 {
+			t.Fatalf("expected error setting breakpoint twice, got %v %v", bps, err)
+		}
+
+		if _, err := proc.SetRegexBreakpoints(p, `main\.(`); err == nil {
+			t.Fatal("invalid regular expression did not return an error")
+		}
+
+		assertNoError(proc.Continue(p), t, "Continue()")
+		if loc, _ := p.CurrentThread().Location(); loc.Fn == nil || !found[loc.Fn.Name] {
+			t.Fatalf("stopped at wrong location %v", loc)
+		}
+	})
+}
+
+func TestTLSBase(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcess("testthreads", t, func(p proc.Process, fixture protest.Fixture) {
+		_, err := setFunctionBreakpoint(p, "main.anotherthread")
+		assertNoError(err, t, "setFunctionBreakpoint()")
+		assertNoError(proc.Continue(p), t, "Continue()")
+
+		for _, th := range p.ThreadList() {
+			tls, err := proc.TLSBase(p, th.ThreadID())
+			assertNoError(err, t, fmt.Sprintf("TLSBase(%d)", th.ThreadID()))
+			if tls == 0 {
+				t.Fatalf("TLS base of thread %d is zero", th.ThreadID())
+			}
+		}
+
+		if _, err := proc.TLSBase(p, -1); err == nil {
+			t.Fatal("TLSBase on a non-existent thread did not return an error")
+		}
+
+		// the TLS base is changed and restored before the thread runs again.
+		tid := p.CurrentThread().ThreadID()
+		tls, err := proc.TLSBase(p, tid)
+		assertNoError(err, t, "TLSBase")
+		err = proc.SetTLSBase(p, tid, tls+8)
+		if testBackend != "native" || runtime.GOOS != "linux" {
+			if err != proc.ErrTLSBaseUnsupported {
+				t.Fatalf("expected ErrTLSBaseUnsupported, got %v", err)
+			}
+			return
+		}
+		assertNoError(err, t, "SetTLSBase")
+		if newtls, _ := proc.TLSBase(p, tid); newtls != tls+8 {
+			t.Fatalf("wrong TLS base after SetTLSBase %#x, expected %#x", newtls, tls+8)
+		}
+		assertNoError(proc.SetTLSBase(p, tid, tls), t, "SetTLSBase (restore)")
+		if newtls, _ := proc.TLSBase(p, tid); newtls != tls {
+			t.Fatalf("TLS base not restored %#x, expected %#x", newtls, tls)
+		}
+	})
+}
+
 func TestBreakpointWithNonExistantFunction(t *testing.T) {
 	withTestProcess("testprog", t, func(p proc.Process, fixture protest.Fixture) {
 		_, err := p.SetBreakpoint(0, proc.UserBreakpoint, nil)
@@ -619,6 +739,18 @@ func TestNextFunctionReturn(t *testing.T) {
 	testseq("testnextprog", contNext, testcases, "main.helloworld", t)
 }
 
+func TestNextFunctionReturnRecursive(t *testing.T) {
+	// Calling Next on the last statement of a recursive function must stop
+	// in the caller's frame, not in the next call of the same function.
+	testseq2(t, "nextreturn", "", []seqTest{
+		{contContinue, 7},
+		{contNext, 9},
+		{contNext, 10},
+		{contNext, 9},
+		{contNext, 10},
+	})
+}
+
 func TestNextFunctionReturnDefer(t *testing.T) {
 	var testcases []nextTest
 
@@ -692,7 +824,7 @@ func TestRuntimeBreakpoint(t *testing.T) {
 }
 
 func returnAddress(thread proc.Thread) (uint64, error) {
-	locations, err := proc.ThreadStacktrace(thread, 2)
+	locations, err := proc.ThreadStacktrace(thread, 2, true)
 	if err != nil {
 		return 0, err
 	}
@@ -845,7 +977,7 @@ func TestStacktrace(t *testing.T) {
 
 		for i := range stacks {
 			assertNoError(proc.Continue(p), t, "Continue()")
-			locations, err := proc.ThreadStacktrace(p.CurrentThread(), 40)
+			locations, err := proc.ThreadStacktrace(p.CurrentThread(), 40, true)
 			assertNoError(err, t, "Stacktrace()")
 
 			if len(locations) != len(stacks[i])+2 {
@@ -873,7 +1005,7 @@ func TestStacktrace2(t *testing.T) {
 	withTestProcess("retstack", t, func(p proc.Process, fixture protest.Fixture) {
 		assertNoError(proc.Continue(p), t, "Continue()")
 
-		locations, err := proc.ThreadStacktrace(p.CurrentThread(), 40)
+		locations, err := proc.ThreadStacktrace(p.CurrentThread(), 40, true)
 		assertNoError(err, t, "Stacktrace()")
 		if !stackMatch([]loc{{-1, "main.f"}, {16, "main.main"}}, locations, false) {
 			for i := range locations {
@@ -883,7 +1015,7 @@ func TestStacktrace2(t *testing.T) {
 		}
 
 		assertNoError(proc.Continue(p), t, "Continue()")
-		locations, err = proc.ThreadStacktrace(p.CurrentThread(), 40)
+		locations, err = proc.ThreadStacktrace(p.CurrentThread(), 40, true)
 		assertNoError(err, t, "Stacktrace()")
 		if !stackMatch([]loc{{-1, "main.g"}, {17, "main.main"}}, locations, false) {
 			for i := range locations {
@@ -917,6 +1049,68 @@ func stackMatch(stack []loc, locations []proc.Stackframe, skipRuntime bool) bool
 	return i >= len(stack)
 }
 
+func TestStacktraceStackBounds(t *testing.T) {
+	// The stack trace of a goroutine should end on runtime.goexit, the top of
+	// its stack, and all its frames should be between stack.lo and stack.hi.
+	protest.AllowRecording(t)
+	withTestProcess("stacktraceprog", t, func(p proc.Process, fixture protest.Fixture) {
+		_, err := setFunctionBreakpoint(p, "main.stacktraceme")
+		assertNoError(err, t, "setFunctionBreakpoint()")
+		assertNoError(proc.Continue(p), t, "Continue()")
+
+		lo, _ := constant.Uint64Val(evalVariable(p, t, "runtime.curg.stack.lo").Value)
+		hi, _ := constant.Uint64Val(evalVariable(p, t, "runtime.curg.stack.hi").Value)
+
+		g, err := proc.GetG(p.CurrentThread())
+		assertNoError(err, t, "GetG()")
+		frames, err := g.Stacktrace(100, false, true)
+		assertNoError(err, t, "Stacktrace()")
+		for i, frame := range frames {
+			if frame.Err != nil {
+				t.Fatalf("frame %d: %v", i, frame.Err)
+			}
+			if cfa := uint64(frame.Regs.CFA); cfa < lo || cfa > hi {
+				t.Fatalf("frame %d (%s:%d) outside of the stack [%#x, %#x]: %#x", i, frame.Call.File, frame.Call.Line, lo, hi, cfa)
+			}
+		}
+		if last := frames[len(frames)-1]; last.Current.Fn == nil || last.Current.Fn.Name != "runtime.goexit" {
+			t.Fatalf("stack trace does not end with runtime.goexit: %v", last.Current.Fn)
+		}
+	})
+}
+
+func TestStacktraceSystemStack(t *testing.T) {
+	// When the target is stopped inside a runtime function running on the
+	// system stack (g0) the stack trace should contain the frames of the
+	// system stack followed by the frames of the goroutine stack.
+	protest.AllowRecording(t)
+	withTestProcess("testnextprog", t, func(p proc.Process, fixture protest.Fixture) {
+		_, err := setFunctionBreakpoint(p, "runtime.park_m")
+		assertNoError(err, t, "setFunctionBreakpoint()")
+		for i := 0; i < 100; i++ {
+			assertNoError(proc.Continue(p), t, "Continue()")
+			g, err := proc.GetG(p.CurrentThread())
+			assertNoError(err, t, "GetG()")
+			frames, err := g.Stacktrace(100, false, true)
+			assertNoError(err, t, "Stacktrace()")
+			for j, frame := range frames {
+				if frame.Err != nil {
+					t.Fatalf("frame %d: %v", j, frame.Err)
+				}
+			}
+			if m := stacktraceCheck(t, []string{"!runtime.park_m", "!runtime.mcall", "runtime.gopark", "main.main"}, frames); m == nil {
+				// Some other goroutine parked, try again.
+				continue
+			}
+			if last := frames[len(frames)-1]; last.Current.Fn == nil || last.Current.Fn.Name != "runtime.goexit" {
+				t.Fatalf("stack trace does not end with runtime.goexit: %v", last.Current.Fn)
+			}
+			return
+		}
+		t.Fatal("main goroutine never parked")
+	})
+}
+
 func TestStacktraceGoroutine(t *testing.T) {
 	mainStack := []loc{{14, "main.stacktraceme"}, {29, "main.main"}}
 	if goversion.VersionAfterOrEqual(runtime.Version(), 1, 11) {
@@ -942,7 +1136,7 @@ func TestStacktraceGoroutine(t *testing.T) {
 		mainCount := 0
 
 		for i, g := range gs {
-			locations, err := g.Stacktrace(40, false)
+			locations, err := g.Stacktrace(40, false, true)
 			if err != nil {
 				// On windows we do not have frame information for goroutines doing system calls.
 				t.Logf("Could not retrieve goroutine stack for goid=%d: %v", g.ID, err)
@@ -1108,7 +1302,7 @@ func TestIssue239(t *testing.T) {
 }
 
 func findFirstNonRuntimeFrame(p proc.Process) (proc.Stackframe, error) {
-	frames, err := proc.ThreadStacktrace(p.CurrentThread(), 10)
+	frames, err := proc.ThreadStacktrace(p.CurrentThread(), 10, true)
 	if err != nil {
 		return proc.Stackframe{}, err
 	}
@@ -1259,7 +1453,7 @@ func TestFrameEvaluation(t *testing.T) {
 		found := make([]bool, 10)
 		for _, g := range gs {
 			frame := -1
-			frames, err := g.Stacktrace(10, false)
+			frames, err := g.Stacktrace(10, false, true)
 			if err != nil {
 				t.Logf("could not stacktrace goroutine %d: %v\n", g.ID, err)
 				continue
@@ -1316,6 +1510,130 @@ func TestFrameEvaluation(t *testing.T) {
 	})
 }
 
+func TestEvalInFrame(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcess("goroutinestackprog", t, func(p proc.Process, fixture protest.Fixture) {
+		_, err := setFunctionBreakpoint(p, "main.stacktraceme")
+		assertNoError(err, t, "setFunctionBreakpoint")
+		assertNoError(proc.Continue(p), t, "Continue()")
+		assertNoError(proc.Continue(p), t, "Continue()")
+
+		// stacktraceme, func3, func2, func1, main
+		// The argument of func3 is not read after its call to stacktraceme,
+		// with the register based calling convention it's never saved on the
+		// stack and can't be evaluated in frame 1.
+		for _, tc := range []struct {
+			frame    int
+			expr     string
+			expected int64
+		}{
+			{1, "dummy", 1},
+			{2, "n", 2},
+			{3, "n + 1", 2},
+			{4, "n", 0},
+		} {
+			v, err := proc.EvalInFrame(p, tc.frame, tc.expr, normalLoadConfig)
+			assertNoError(err, t, fmt.Sprintf("EvalInFrame(%d, %q)", tc.frame, tc.expr))
+			if n, _ := constant.Int64Val(v.Value); n != tc.expected {
+				t.Errorf("EvalInFrame(%d, %q) = %d, expected %d", tc.frame, tc.expr, n, tc.expected)
+			}
+		}
+
+		if _, err := proc.EvalInFrame(p, 100, "n", normalLoadConfig); err == nil {
+			t.Error("no error evaluating in a frame that does not exist")
+		}
+	})
+}
+
+func TestAllThreadLocations(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcess("goroutinestackprog", t, func(p proc.Process, fixture protest.Fixture) {
+		_, err := setFunctionBreakpoint(p, "main.stacktraceme")
+		assertNoError(err, t, "setFunctionBreakpoint")
+		assertNoError(proc.Continue(p), t, "Continue()")
+
+		locs, err := proc.AllThreadLocations(p)
+		assertNoError(err, t, "AllThreadLocations()")
+		threads := p.ThreadList()
+		if len(locs) != len(threads) {
+			t.Fatalf("got %d locations for %d threads", len(locs), len(threads))
+		}
+		inruntime := 0
+		for _, th := range threads {
+			loc := locs[th.ThreadID()]
+			if loc == nil || loc.Fn == nil {
+				t.Fatalf("no location for thread %d: %v", th.ThreadID(), loc)
+			}
+			t.Logf("thread %d at %#x %s:%d %s", th.ThreadID(), loc.PC, loc.File, loc.Line, loc.Fn.Name)
+			if strings.HasPrefix(loc.Fn.Name, "runtime.") {
+				inruntime++
+			}
+		}
+		if loc := locs[p.CurrentThread().ThreadID()]; loc.Fn.Name != "main.stacktraceme" {
+			t.Errorf("current thread in %s, expected main.stacktraceme", loc.Fn.Name)
+		}
+		if len(threads) > 1 && inruntime == 0 {
+			t.Errorf("no thread parked in the runtime")
+		}
+	})
+}
+
+func TestSwitchGoroutineParkedFrame(t *testing.T) {
+	// After switching to a parked goroutine its stack and arguments are read
+	// using the registers saved in its g struct.
+	protest.AllowRecording(t)
+	withTestProcess("goroutinestackprog", t, func(p proc.Process, fixture protest.Fixture) {
+		_, err := setFunctionBreakpoint(p, "main.stacktraceme")
+		assertNoError(err, t, "setFunctionBreakpoint")
+		assertNoError(proc.Continue(p), t, "Continue()")
+
+		gs, _, err := proc.GoroutinesInfo(p, 0, 0)
+		assertNoError(err, t, "GoroutinesInfo")
+		for _, g := range gs {
+			if g.Thread != nil {
+				continue
+			}
+			frames, err := g.Stacktrace(10, false, true)
+			if err != nil {
+				continue
+			}
+			frame := -1
+			for i := range frames {
+				if frames[i].Call.Fn != nil && frames[i].Call.Fn.Name == "main.agoroutine" {
+					frame = i
+					break
+				}
+			}
+			if frame < 0 {
+				continue
+			}
+
+			assertNoError(p.SwitchGoroutine(g.ID), t, "SwitchGoroutine()")
+			if selg := p.SelectedGoroutine(); selg == nil || selg.ID != g.ID {
+				t.Fatalf("wrong selected goroutine %v, expected %d", selg, g.ID)
+			}
+			scope, err := proc.ConvertEvalScope(p, -1, frame, 0)
+			assertNoError(err, t, "ConvertEvalScope()")
+			if scope.Fn == nil || scope.Fn.Name != "main.agoroutine" {
+				t.Fatalf("wrong scope function %v", scope.Fn)
+			}
+			args, err := scope.FunctionArguments(normalLoadConfig)
+			assertNoError(err, t, "FunctionArguments()")
+			for _, arg := range args {
+				if arg.Name != "i" {
+					continue
+				}
+				if n, _ := constant.Int64Val(arg.Value); n < 0 || n >= 10 {
+					t.Fatalf("wrong value of i for goroutine %d: %d", g.ID, n)
+				}
+				return
+			}
+			t.Fatalf("argument i not found in %v", args)
+		}
+		t.Fatal("could not find a parked goroutine running main.agoroutine")
+	})
+}
+
 func TestPointerSetting(t *testing.T) {
 	withTestProcess("testvariables2", t, func(p proc.Process, fixture protest.Fixture) {
 		assertNoError(proc.Continue(p), t, "Continue() returned an error")
@@ -1430,84 +1748,359 @@ func TestBreakpointCounts(t *testing.T) {
 	})
 }
 
-func BenchmarkArray(b *testing.B) {
-	// each bencharr struct is 128 bytes, bencharr is 64 elements long
-	protest.AllowRecording(b)
-	b.SetBytes(int64(64 * 128))
-	withTestProcess("testvariables2", b, func(p proc.Process, fixture protest.Fixture) {
-		assertNoError(proc.Continue(p), b, "Continue()")
-		for i := 0; i < b.N; i++ {
-			evalVariable(p, b, "bencharr")
+func TestBreakpointPreservesNeighboringBytes(t *testing.T) {
+	// Software breakpoints are shorter than a word, writing them must not
+	// modify the bytes around them.
+	withTestProcess("increment", t, func(p proc.Process, fixture protest.Fixture) {
+		if p, ok := p.(*native.Process); ok {
+			// Read the memory of the target, not what the cache remembers
+			// writing to it.
+			p.SetMemoryCache(false)
+		}
+		text, err := proc.DisassembleFunction(p, nil, "main.Increment")
+		assertNoError(err, t, "DisassembleFunction")
+		mem := p.CurrentThread()
+		bpinstr := p.BinInfo().Arch.BreakpointInstruction()
+
+		readAround := func(addr uint64) []byte {
+			buf := make([]byte, 24)
+			_, err := mem.ReadMemory(buf, uintptr(addr-8))
+			assertNoError(err, t, "ReadMemory")
+			return buf
+		}
+
+		for _, instr := range text {
+			pc := instr.Loc.PC
+			before := readAround(pc)
+			_, err := p.SetBreakpoint(pc, proc.UserBreakpoint, nil)
+			assertNoError(err, t, "SetBreakpoint")
+			during := readAround(pc)
+			_, err = p.ClearBreakpoint(pc)
+			assertNoError(err, t, "ClearBreakpoint")
+			after := readAround(pc)
+
+			for i := range before {
+				if i >= 8 && i < 8+len(bpinstr) {
+					if during[i] != bpinstr[i-8] {
+						t.Errorf("%#x: breakpoint not written at offset %d: %x", pc, i-8, during)
+					}
+				} else if during[i] != before[i] {
+					t.Errorf("%#x: byte at offset %d modified by SetBreakpoint: %x -> %x", pc, i-8, before, during)
+				}
+				if after[i] != before[i] {
+					t.Errorf("%#x: byte at offset %d not restored by ClearBreakpoint: %x -> %x", pc, i-8, before, after)
+				}
+			}
 		}
 	})
 }
 
-const doTestBreakpointCountsWithDetection = false
+func TestBreakpointIgnoreCount(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcess("loopprog", t, func(p proc.Process, fixture protest.Fixture) {
+		bp := setFileLineBreakpoint(p, t, fixture.Source, 8)
+		bp.IgnoreCount = 3
+		assertNoError(proc.Continue(p), t, "Continue()")
 
-func TestBreakpointCountsWithDetection(t *testing.T) {
-	if !doTestBreakpointCountsWithDetection {
-		return
-	}
-	m := map[int64]int64{}
+		// the first three hits are ignored, we stop on the fourth one
+		if bp.TotalHitCount != 4 {
+			t.Fatalf("wrong TotalHitCount %d, expected 4", bp.TotalHitCount)
+		}
+		if bp.IgnoreCount != 0 {
+			t.Fatalf("wrong IgnoreCount %d, expected 0", bp.IgnoreCount)
+		}
+		checkValue := func(name string, expected int64) {
+			v := evalVariable(p, t, name)
+			if n, _ := constant.Int64Val(v.Value); n != expected {
+				t.Fatalf("wrong value for %s: %d, expected %d", name, n, expected)
+			}
+		}
+		checkValue("i", 3)
+
+		// once the ignore count is exhausted every hit stops
+		assertNoError(proc.Continue(p), t, "Continue()")
+		checkValue("i", 4)
+	})
+}
+
+func TestBreakpointOncePerGoroutine(t *testing.T) {
 	protest.AllowRecording(t)
-	withTestProcess("bpcountstest", t, func(p proc.Process, fixture protest.Fixture) {
-		addr, _, err := p.BinInfo().LineToPC(fixture.Source, 12)
-		assertNoError(err, t, "LineToPC")
-		bp, err := p.SetBreakpoint(addr, proc.UserBreakpoint, nil)
-		assertNoError(err, t, "SetBreakpoint()")
+	withTestProcess("goroutinehits", t, func(p proc.Process, fixture protest.Fixture) {
+		bp, err := setFunctionBreakpoint(p, "main.hit")
+		assertNoError(err, t, "setFunctionBreakpoint")
+		bp.OncePerGoroutine = true
 
+		// three goroutines call main.hit four times each, each goroutine
+		// stops once.
+		seen := make(map[int]bool)
 		for {
-			if err := proc.Continue(p); err != nil {
-				if _, exited := err.(proc.ErrProcessExited); exited {
-					break
-				}
-				assertNoError(err, t, "Continue()")
+			err := proc.Continue(p)
+			if _, exited := err.(proc.ErrProcessExited); exited {
+				break
 			}
-			for _, th := range p.ThreadList() {
-				if bp := th.Breakpoint(); bp.Breakpoint == nil {
-					continue
-				}
-				scope, err := proc.GoroutineScope(th)
-				assertNoError(err, t, "Scope()")
-				v, err := scope.EvalVariable("i", normalLoadConfig)
-				assertNoError(err, t, "evalVariable")
-				i, _ := constant.Int64Val(v.Value)
-				v, err = scope.EvalVariable("id", normalLoadConfig)
-				assertNoError(err, t, "evalVariable")
-				id, _ := constant.Int64Val(v.Value)
-				m[id] = i
+			assertNoError(err, t, "Continue()")
+			g := p.SelectedGoroutine()
+			if seen[g.ID] {
+				t.Fatalf("goroutine %d stopped twice", g.ID)
 			}
-
-			total := int64(0)
-			for i := range m {
-				total += m[i] + 1
+			seen[g.ID] = true
+			if bp.HitCount[g.ID] != 1 {
+				t.Fatalf("wrong hit count %d for goroutine %d", bp.HitCount[g.ID], g.ID)
 			}
-
-			if uint64(total) != bp.TotalHitCount {
-				t.Fatalf("Mismatched total count %d %d\n", total, bp.TotalHitCount)
+		}
+		if len(seen) != 3 {
+			t.Fatalf("wrong number of stops %d, expected 3", len(seen))
+		}
+		if bp.TotalHitCount != 12 {
+			t.Fatalf("wrong TotalHitCount %d, expected 12", bp.TotalHitCount)
+		}
+		for goid := range seen {
+			if bp.HitCount[goid] != 4 {
+				t.Errorf("wrong hit count %d for goroutine %d, expected 4", bp.HitCount[goid], goid)
 			}
 		}
+	})
+}
 
-		t.Logf("TotalHitCount: %d", bp.TotalHitCount)
-		if bp.TotalHitCount != 200 {
-			t.Fatalf("Wrong TotalHitCount for the breakpoint (%d)", bp.TotalHitCount)
+func TestContinueN(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcess("loopprog", t, func(p proc.Process, fixture protest.Fixture) {
+		bp := setFileLineBreakpoint(p, t, fixture.Source, 8)
+
+		_, err := proc.ContinueN(p, 0)
+		if err == nil {
+			t.Fatal("ContinueN(0) did not return an error")
 		}
 
-		if len(bp.HitCount) != 2 {
-			t.Fatalf("Wrong number of goroutines for breakpoint (%d)", len(bp.HitCount))
+		hitbp, err := proc.ContinueN(p, 4)
+		assertNoError(err, t, "ContinueN(4)")
+		if hitbp != bp {
+			t.Fatalf("wrong breakpoint returned by ContinueN: %v", hitbp)
+		}
+		if bp.TotalHitCount != 4 {
+			t.Fatalf("wrong TotalHitCount %d, expected 4", bp.TotalHitCount)
 		}
+		// the breakpoint is before the increment, i is 3 on the fourth hit
+		if n, _ := constant.Int64Val(evalVariable(p, t, "i").Value); n != 3 {
+			t.Fatalf("wrong value for i: %d, expected 3", n)
+		}
+	})
+}
 
-		for _, v := range bp.HitCount {
-			if v != 100 {
-				t.Fatalf("Wrong HitCount for breakpoint (%v)", bp.HitCount)
+func TestStepLines(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcess("steplines", t, func(p proc.Process, fixture protest.Fixture) {
+		// newer compilers attribute the first instruction after the prologue
+		// to the line of the declaration of main, start from the first line
+		// of its body instead.
+		setFileBreakpoint(p, t, fixture, 6)
+		assertNoError(proc.Continue(p), t, "Continue()")
+		assertLineNumber(p, t, 6, "Continue()")
+
+		locs, err := proc.StepLines(p, 8)
+		assertNoError(err, t, "StepLines()")
+		var lines []int
+		for _, loc := range locs {
+			if loc.File != fixture.Source {
+				t.Fatalf("stepped into %s:%d", loc.File, loc.Line)
 			}
+			lines = append(lines, loc.Line)
+		}
+		expected := []int{7, 8, 7, 8, 7, 8, 7, 10}
+		if !reflect.DeepEqual(lines, expected) {
+			t.Fatalf("wrong lines %v, expected %v", lines, expected)
 		}
 	})
 }
 
-func BenchmarkArrayPointer(b *testing.B) {
-	// each bencharr struct is 128 bytes, benchparr is an array of 64 pointers to bencharr
-	// each read will read 64 bencharr structs plus the 64 pointers of benchparr
+func TestExportTrace(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcess("testnextprog", t, func(p proc.Process, fixture protest.Fixture) {
+		path := filepath.Join(os.TempDir(), fmt.Sprintf("delve-trace-%d.json", os.Getpid()))
+		defer os.Remove(path)
+		assertNoError(proc.ExportTrace(p, []string{"main.sleepytime"}, path), t, "ExportTrace")
+
+		buf, err := ioutil.ReadFile(path)
+		assertNoError(err, t, "ReadFile")
+		var trace struct {
+			TraceEvents []proc.TraceEvent `json:"traceEvents"`
+		}
+		assertNoError(json.Unmarshal(buf, &trace), t, "Unmarshal")
+		t.Logf("trace: %s", buf)
+
+		var phases []string
+		for i, ev := range trace.TraceEvents {
+			if ev.Name != "main.sleepytime" {
+				t.Fatalf("unexpected event %#v", ev)
+			}
+			if ev.Phase == "E" && (i == 0 || ev.Time < trace.TraceEvents[i-1].Time) {
+				t.Fatalf("end event %#v before begin event", ev)
+			}
+			phases = append(phases, ev.Phase)
+		}
+		if !reflect.DeepEqual(phases, []string{"B", "E", "B", "E"}) {
+			t.Fatalf("wrong events %v", phases)
+		}
+	})
+}
+
+func TestStepIntoCall(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcess("stepintocall", t, func(p proc.Process, fixture protest.Fixture) {
+		setFileLineBreakpoint(p, t, fixture.Source, 18)
+		assertNoError(proc.Continue(p), t, "Continue()")
+		assertLineNumber(p, t, 18, "Continue()")
+
+		if err := proc.StepIntoCall(p, 4); err == nil {
+			t.Fatal("StepIntoCall(4) did not return an error")
+		}
+
+		assertNoError(proc.StepIntoCall(p, 2), t, "StepIntoCall(2)")
+		loc, err := p.CurrentThread().Location()
+		assertNoError(err, t, "Location()")
+		if loc.Fn == nil || loc.Fn.Name != "main.h" {
+			t.Fatalf("wrong function after StepIntoCall(2): %v", loc.Fn)
+		}
+		// StepIntoCall stops after the prologue, like Step, which depending
+		// on the compiler is on line 13 or 14.
+		pc, err := proc.FindFunctionLocation(p, "main.h", true, 0)
+		assertNoError(err, t, "FindFunctionLocation(main.h)")
+		if loc.PC != pc {
+			t.Fatalf("StepIntoCall(2) stopped at %#x %s:%d, expected %#x", loc.PC, loc.File, loc.Line, pc)
+		}
+	})
+}
+
+func TestTrace(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcess("testnextprog", t, func(p proc.Process, fixture protest.Fixture) {
+		var buf bytes.Buffer
+		assertNoError(proc.Trace(context.Background(), p, []string{"main.sleepytime", "main.helloworld"}, &buf), t, "Trace")
+		t.Logf("output:\n%s", buf.String())
+
+		var calls []string
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) != 3 {
+				t.Fatalf("malformed line %q", line)
+			}
+			if _, err := time.Parse(time.RFC3339Nano, fields[0]); err != nil {
+				t.Fatalf("malformed timestamp in %q: %v", line, err)
+			}
+			if fields[1] != "goroutine(1)" {
+				t.Fatalf("wrong goroutine in %q", line)
+			}
+			calls = append(calls, fields[2])
+		}
+		expected := []string{"main.sleepytime", "main.sleepytime", "main.helloworld"}
+		if !reflect.DeepEqual(calls, expected) {
+			t.Fatalf("wrong calls %v, expected %v", calls, expected)
+		}
+	})
+}
+
+func TestTraceCancel(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcess("loopprog", t, func(p proc.Process, fixture protest.Fixture) {
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+		var buf bytes.Buffer
+		err := proc.Trace(ctx, p, []string{"main.loop"}, &buf)
+		if err != context.DeadlineExceeded {
+			t.Fatalf("wrong error %v, expected %v", err, context.DeadlineExceeded)
+		}
+		if n := strings.Count(buf.String(), "main.loop"); n != 1 {
+			t.Fatalf("main.loop traced %d times, expected 1:\n%s", n, buf.String())
+		}
+		for _, bp := range p.Breakpoints().M {
+			if bp.Flags&proc.BreakpointTracepoint != 0 {
+				t.Fatalf("tracepoint was not removed: %v", bp)
+			}
+		}
+		if p.CheckAndClearManualStopRequest() {
+			t.Fatal("stop request left pending by Trace")
+		}
+	})
+}
+
+func BenchmarkArray(b *testing.B) {
+	// each bencharr struct is 128 bytes, bencharr is 64 elements long
+	protest.AllowRecording(b)
+	b.SetBytes(int64(64 * 128))
+	withTestProcess("testvariables2", b, func(p proc.Process, fixture protest.Fixture) {
+		assertNoError(proc.Continue(p), b, "Continue()")
+		for i := 0; i < b.N; i++ {
+			evalVariable(p, b, "bencharr")
+		}
+	})
+}
+
+const doTestBreakpointCountsWithDetection = false
+
+func TestBreakpointCountsWithDetection(t *testing.T) {
+	if !doTestBreakpointCountsWithDetection {
+		return
+	}
+	m := map[int64]int64{}
+	protest.AllowRecording(t)
+	withTestProcess("bpcountstest", t, func(p proc.Process, fixture protest.Fixture) {
+		addr, _, err := p.BinInfo().LineToPC(fixture.Source, 12)
+		assertNoError(err, t, "LineToPC")
+		bp, err := p.SetBreakpoint(addr, proc.UserBreakpoint, nil)
+		assertNoError(err, t, "SetBreakpoint()")
+
+		for {
+			if err := proc.Continue(p); err != nil {
+				if _, exited := err.(proc.ErrProcessExited); exited {
+					break
+				}
+				assertNoError(err, t, "Continue()")
+			}
+			for _, th := range p.ThreadList() {
+				if bp := th.Breakpoint(); bp.Breakpoint == nil {
+					continue
+				}
+				scope, err := proc.GoroutineScope(th)
+				assertNoError(err, t, "Scope()")
+				v, err := scope.EvalVariable("i", normalLoadConfig)
+				assertNoError(err, t, "evalVariable")
+				i, _ := constant.Int64Val(v.Value)
+				v, err = scope.EvalVariable("id", normalLoadConfig)
+				assertNoError(err, t, "evalVariable")
+				id, _ := constant.Int64Val(v.Value)
+				m[id] = i
+			}
+
+			total := int64(0)
+			for i := range m {
+				total += m[i] + 1
+			}
+
+			if uint64(total) != bp.TotalHitCount {
+				t.Fatalf("Mismatched total count %d %d\n", total, bp.TotalHitCount)
+			}
+		}
+
+		t.Logf("TotalHitCount: %d", bp.TotalHitCount)
+		if bp.TotalHitCount != 200 {
+			t.Fatalf("Wrong TotalHitCount for the breakpoint (%d)", bp.TotalHitCount)
+		}
+
+		if len(bp.HitCount) != 2 {
+			t.Fatalf("Wrong number of goroutines for breakpoint (%d)", len(bp.HitCount))
+		}
+
+		for _, v := range bp.HitCount {
+			if v != 100 {
+				t.Fatalf("Wrong HitCount for breakpoint (%v)", bp.HitCount)
+			}
+		}
+	})
+}
+
+func BenchmarkArrayPointer(b *testing.B) {
+	// each bencharr struct is 128 bytes, benchparr is an array of 64 pointers to bencharr
+	// each read will read 64 bencharr structs plus the 64 pointers of benchparr
 	protest.AllowRecording(b)
 	b.SetBytes(int64(64*128 + 64*8))
 	withTestProcess("testvariables2", b, func(p proc.Process, fixture protest.Fixture) {
@@ -1600,130 +2193,608 @@ func TestPointerLoops(t *testing.T) {
 	})
 }
 
-func BenchmarkLocalVariables(b *testing.B) {
-	protest.AllowRecording(b)
-	withTestProcess("testvariables", b, func(p proc.Process, fixture protest.Fixture) {
-		assertNoError(proc.Continue(p), b, "Continue() returned an error")
-		scope, err := proc.GoroutineScope(p.CurrentThread())
-		assertNoError(err, b, "Scope()")
-		for i := 0; i < b.N; i++ {
-			_, err := scope.LocalVariables(normalLoadConfig)
-			assertNoError(err, b, "LocalVariables()")
+func TestLoadConfigLimits(t *testing.T) {
+	// The limits in LoadConfig must be respected by every kind of variable
+	// and the variables must be marked as truncated when they are reached.
+	protest.AllowRecording(t)
+	withTestProcess("testvariables2", t, func(p proc.Process, fixture protest.Fixture) {
+		assertNoError(proc.Continue(p), t, "Continue()")
+		cfg := proc.LoadConfig{FollowPointers: true, MaxVariableRecurse: 1, MaxStringLen: 3, MaxArrayValues: 2, MaxStructFields: -1}
+
+		eval := func(expr string) *proc.Variable {
+			t.Helper()
+			scope, err := proc.GoroutineScope(p.CurrentThread())
+			assertNoError(err, t, "GoroutineScope()")
+			v, err := scope.EvalVariable(expr, cfg)
+			assertNoError(err, t, fmt.Sprintf("EvalVariable(%s)", expr))
+			return v
 		}
-	})
-}
 
-func TestCondBreakpoint(t *testing.T) {
-	protest.AllowRecording(t)
-	withTestProcess("parallel_next", t, func(p proc.Process, fixture protest.Fixture) {
-		addr, _, err := p.BinInfo().LineToPC(fixture.Source, 9)
-		assertNoError(err, t, "LineToPC")
-		bp, err := p.SetBreakpoint(addr, proc.UserBreakpoint, nil)
-		assertNoError(err, t, "SetBreakpoint()")
-		bp.Cond = &ast.BinaryExpr{
-			Op: token.EQL,
-			X:  &ast.Ident{Name: "n"},
-			Y:  &ast.BasicLit{Kind: token.INT, Value: "7"},
+		if v := eval("str1"); v.Len != 11 || len(constant.StringVal(v.Value)) != cfg.MaxStringLen {
+			t.Errorf("str1: expected %d characters of 11, got %q (len %d)", cfg.MaxStringLen, constant.StringVal(v.Value), v.Len)
 		}
 
-		assertNoError(proc.Continue(p), t, "Continue()")
+		for _, expr := range []string{"s1", "a1", "m1"} {
+			v := eval(expr)
+			if len(v.Children) != cfg.MaxArrayValues && !(v.Kind == reflect.Map && len(v.Children) == 2*cfg.MaxArrayValues) {
+				t.Errorf("%s: wrong number of children %d", expr, len(v.Children))
+			}
+			if v.Len <= int64(cfg.MaxArrayValues) {
+				t.Errorf("%s: not marked as truncated, length %d", expr, v.Len)
+			}
+		}
 
-		nvar := evalVariable(p, t, "n")
+		// c1.pb.a.A is at depth 2 (c1.pb is followed without increasing depth)
+		v := eval("c1")
+		pb := v.Children[0]
+		if len(pb.Children) != 1 || len(pb.Children[0].Children) != 1 {
+			t.Fatalf("c1.pb not loaded: %v", pb)
+		}
+		if a := pb.Children[0].Children[0]; a.Len != 2 || len(a.Children) != 0 {
+			t.Errorf("c1.pb.a: expected unloaded struct with two fields, got %d of %d", len(a.Children), a.Len)
+		}
 
-		n, _ := constant.Int64Val(nvar.Value)
-		if n != 7 {
-			t.Fatalf("Stoppend on wrong goroutine %d\n", n)
+		// pointer to itself
+		v = eval("ptrrec1")
+		depth := 0
+		for len(v.Children) > 0 && !v.OnlyAddr {
+			v = &v.Children[0]
+			depth++
+			if depth > 10 {
+				t.Fatal("ptrrec1: pointer loop not stopped")
+			}
+		}
+		if !v.OnlyAddr {
+			t.Errorf("ptrrec1: last pointer not marked as truncated")
 		}
 	})
 }
 
-func TestCondBreakpointError(t *testing.T) {
-	protest.AllowRecording(t)
-	withTestProcess("parallel_next", t, func(p proc.Process, fixture protest.Fixture) {
-		addr, _, err := p.BinInfo().LineToPC(fixture.Source, 9)
-		assertNoError(err, t, "LineToPC")
-		bp, err := p.SetBreakpoint(addr, proc.UserBreakpoint, nil)
-		assertNoError(err, t, "SetBreakpoint()")
-		bp.Cond = &ast.BinaryExpr{
-			Op: token.EQL,
-			X:  &ast.Ident{Name: "nonexistentvariable"},
-			Y:  &ast.BasicLit{Kind: token.INT, Value: "7"},
+func TestLinePCs(t *testing.T) {
+	// The condition of the for loop at testnextprog.go:23 is compiled at the
+	// start and at the end of the body of the loop.
+	withTestProcess("testnextprog", t, func(p proc.Process, fixture protest.Fixture) {
+		pcs, err := p.BinInfo().LinePCs(fixture.Source, 23)
+		assertNoError(err, t, "LinePCs")
+		if len(pcs) < 2 {
+			t.Fatalf("expected at least two addresses for line 23, got %#x", pcs)
 		}
-
-		err = proc.Continue(p)
-		if err == nil {
-			t.Fatalf("No error on first Continue()")
+		for i, pc := range pcs {
+			if i > 0 && pc <= pcs[i-1] {
+				t.Errorf("addresses not sorted: %#x", pcs)
+			}
+			if _, ln, _ := p.BinInfo().PCToLine(pc); ln != 23 {
+				t.Errorf("address %#x belongs to line %d", pc, ln)
+			}
 		}
-
-		if err.Error() != "error evaluating expression: could not find symbol value for nonexistentvariable" && err.Error() != "multiple errors evaluating conditions" {
-			t.Fatalf("Unexpected error on first Continue(): %v", err)
+		if _, err := p.BinInfo().LinePCs(fixture.Source, 1000); err == nil {
+			t.Error("no error for a line without code")
 		}
+	})
+}
 
-		bp.Cond = &ast.BinaryExpr{
-			Op: token.EQL,
-			X:  &ast.Ident{Name: "n"},
-			Y:  &ast.BasicLit{Kind: token.INT, Value: "7"},
+func TestSourcesForPackage(t *testing.T) {
+	withTestProcess("testnextprog", t, func(p proc.Process, fixture protest.Fixture) {
+		files, err := p.BinInfo().SourcesForPackage("main.")
+		assertNoError(err, t, "SourcesForPackage(main.)")
+		if len(files) != 1 || files[0] != fixture.Source {
+			t.Fatalf("wrong files for package main: %q", files)
+		}
+		files, err = p.BinInfo().SourcesForPackage("runtime.")
+		assertNoError(err, t, "SourcesForPackage(runtime.)")
+		for _, file := range files {
+			if file == fixture.Source {
+				t.Errorf("%s returned for package runtime", file)
+			}
 		}
+		if _, err := p.BinInfo().SourcesForPackage("nonexistent."); err == nil {
+			t.Error("no error for a package without functions")
+		}
+	})
+}
 
-		err = proc.Continue(p)
-		if err != nil {
-			if _, exited := err.(proc.ErrProcessExited); !exited {
-				t.Fatalf("Unexpected error on second Continue(): %v", err)
+func TestStepAndReport(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcess("testnextprog", t, func(p proc.Process, fixture protest.Fixture) {
+		_, err := setFunctionBreakpoint(p, "main.helloworld")
+		assertNoError(err, t, "setFunctionBreakpoint()")
+		assertNoError(proc.Continue(p), t, "Continue()")
+		for i := 0; i < 3; i++ {
+			rep, err := proc.StepAndReport(p)
+			assertNoError(err, t, "StepAndReport()")
+			regs, err := p.CurrentThread().Registers(false)
+			assertNoError(err, t, "Registers()")
+			if rep.PC != regs.PC() || rep.SP != regs.SP() || rep.BP != regs.BP() || rep.Loc.PC != regs.PC() {
+				t.Fatalf("wrong registers in report %#x %#x %#x (loc %#x), expected %#x %#x %#x", rep.PC, rep.SP, rep.BP, rep.Loc.PC, regs.PC(), regs.SP(), regs.BP())
 			}
-		} else {
-			nvar := evalVariable(p, t, "n")
+			text, err := proc.Disassemble(p, nil, rep.PC, rep.PC+maxInstructionLength)
+			assertNoError(err, t, "Disassemble()")
+			if rep.Inst.Loc.PC != rep.PC || rep.Inst.Text(proc.IntelFlavour, p.BinInfo()) != text[0].Text(proc.IntelFlavour, p.BinInfo()) {
+				t.Fatalf("wrong instruction at %#x: %q, expected %q", rep.PC, rep.Inst.Text(proc.IntelFlavour, p.BinInfo()), text[0].Text(proc.IntelFlavour, p.BinInfo()))
+			}
+		}
+	})
+}
 
-			n, _ := constant.Int64Val(nvar.Value)
-			if n != 7 {
-				t.Fatalf("Stoppend on wrong goroutine %d\n", n)
+func TestSchedSummary(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcess("schedprog", t, func(p proc.Process, fixture protest.Fixture) {
+		assertNoError(proc.Continue(p), t, "Continue()")
+		sched, err := proc.SchedSummary(p)
+		assertNoError(err, t, "SchedSummary()")
+		t.Logf("runqsize %d nmidle %d npidle %d", sched.RunqSize, sched.NMIdle, sched.NPIdle)
+		ps, err := proc.Processors(p)
+		assertNoError(err, t, "Processors()")
+		if sched.RunqSize < 0 || sched.NMIdle < 0 || sched.NPIdle < 0 {
+			t.Fatalf("negative counters %#v", sched)
+		}
+		idle := 0
+		for _, pp := range ps {
+			if pp.Status == proc.Pidle {
+				idle++
 			}
 		}
+		// the P running the current goroutine isn't idle. Every P in the idle
+		// list is _Pidle but a P is marked _Pidle, by releasep, before it's
+		// added to the list, some idle Ps may not be counted yet.
+		if sched.NPIdle >= len(ps) || sched.NPIdle > idle {
+			t.Fatalf("wrong number of idle Ps %d, %d of %d Ps are idle", sched.NPIdle, idle, len(ps))
+		}
 	})
 }
 
-func TestIssue356(t *testing.T) {
-	// slice with a typedef does not get printed correctly
+func TestGOMAXPROCS(t *testing.T) {
 	protest.AllowRecording(t)
-	withTestProcess("testvariables2", t, func(p proc.Process, fixture protest.Fixture) {
-		assertNoError(proc.Continue(p), t, "Continue() returned an error")
-		mmvar := evalVariable(p, t, "mainMenu")
-		if mmvar.Kind != reflect.Slice {
-			t.Fatalf("Wrong kind for mainMenu: %v\n", mmvar.Kind)
+	withTestProcess("schedprog", t, func(p proc.Process, fixture protest.Fixture) {
+		assertNoError(proc.Continue(p), t, "Continue()")
+		n, err := proc.GOMAXPROCS(p)
+		assertNoError(err, t, "GOMAXPROCS()")
+		if n != 3 {
+			t.Fatalf("wrong GOMAXPROCS %d, expected 3", n)
+		}
+		ncpu, err := proc.NumCPU(p)
+		assertNoError(err, t, "NumCPU()")
+		if ncpu != runtime.NumCPU() {
+			t.Fatalf("wrong NumCPU %d, expected %d", ncpu, runtime.NumCPU())
 		}
 	})
 }
 
-func TestStepIntoFunction(t *testing.T) {
-	withTestProcess("teststep", t, func(p proc.Process, fixture protest.Fixture) {
-		// Continue until breakpoint
-		assertNoError(proc.Continue(p), t, "Continue() returned an error")
-		// Step into function
-		assertNoError(proc.Step(p), t, "Step() returned an error")
-		// We should now be inside the function.
-		loc, err := p.CurrentThread().Location()
-		if err != nil {
-			t.Fatal(err)
+func TestCallFunction(t *testing.T) {
+	protest.MustSupportFunctionCalls(t, testBackend)
+	withTestProcess("fncall", t, func(p proc.Process, fixture protest.Fixture) {
+		assertNoError(proc.Continue(p), t, "Continue()")
+		regs, err := p.CurrentThread().Registers(false)
+		assertNoError(err, t, "Registers()")
+		pc, sp := regs.PC(), regs.SP()
+
+		v, err := proc.CallFunction(p, "a.Double()")
+		assertNoError(err, t, "CallFunction()")
+		if v.Unreadable != nil {
+			t.Fatalf("could not read return value: %v", v.Unreadable)
 		}
-		if loc.Fn.Name != "main.callme" {
-			t.Fatalf("expected to be within the 'callme' function, was in %s instead", loc.Fn.Name)
+		if n, _ := constant.Int64Val(v.Value); n != 6 {
+			t.Fatalf("wrong return value %v, expected 6", v.Value)
 		}
-		if !strings.Contains(loc.File, "teststep") {
-			t.Fatalf("debugger stopped at incorrect location: %s:%d", loc.File, loc.Line)
+
+		regs, err = p.CurrentThread().Registers(false)
+		assertNoError(err, t, "Registers()")
+		if regs.PC() != pc || regs.SP() != sp {
+			t.Fatalf("registers not restored: pc %#x sp %#x, expected %#x %#x", regs.PC(), regs.SP(), pc, sp)
 		}
-		if loc.Line != 8 {
-			t.Fatalf("debugger stopped at incorrect line: %d", loc.Line)
+
+		_, err = proc.CallFunction(p, "a.Double(1)")
+		if err == nil {
+			t.Fatalf("expected error calling a.Double with too many arguments")
+		}
+		if _, err := proc.CallFunction(p, "a.X"); err == nil {
+			t.Fatalf("expected error for an expression that isn't a call")
 		}
 	})
 }
 
-func TestIssue384(t *testing.T) {
-	// Crash related to reading uninitialized memory, introduced by the memory prefetching optimization
+func TestCallFunctionInProgress(t *testing.T) {
+	protest.MustSupportFunctionCalls(t, testBackend)
+	withTestProcess("fncall", t, func(p proc.Process, fixture protest.Fixture) {
+		assertNoError(proc.Continue(p), t, "Continue()")
+		regs, err := p.CurrentThread().Registers(false)
+		assertNoError(err, t, "Registers()")
+		pc, sp := regs.PC(), regs.SP()
 
-	ver, _ := goversion.Parse(runtime.Version())
-	if ver.Major < 0 || ver.AfterOrEqual(goversion.GoVersion{1, 10, -1, 0, 0, ""}) {
-		// go 1.10 emits DW_AT_decl_line and we won't be able to evaluate 'st'
-		// which is declared after line 13.
-		t.Skip("can not evaluate not-yet-declared variables with go 1.10")
+		// calls in the arguments of a call are nested calls
+		if _, err := proc.CallFunction(p, "square(square(2))"); err != proc.ErrCallInProgress {
+			t.Fatalf("expected ErrCallInProgress for nested call, got %v", err)
+		}
+
+		// a call that hits a breakpoint is in progress until it returns
+		bp, err := setFunctionBreakpoint(p, "main.square")
+		assertNoError(err, t, "setFunctionBreakpoint()")
+		if _, err := proc.CallFunction(p, "square(2)"); err == nil {
+			t.Fatal("call returned through a breakpoint")
+		}
+		if _, err := proc.CallFunction(p, "a.Double()"); err != proc.ErrCallInProgress {
+			t.Fatalf("expected ErrCallInProgress while stopped inside a call, got %v", err)
+		}
+		_, err = p.ClearBreakpoint(bp.Addr)
+		assertNoError(err, t, "ClearBreakpoint()")
+		assertNoError(proc.Continue(p), t, "Continue()")
+
+		// the registers are restored after calls that panic too
+		v, err := proc.CallFunction(p, "callpanic()")
+		assertNoError(err, t, "CallFunction(callpanic)")
+		if v.Name != "~panic" {
+			t.Fatalf("expected panic value, got %s", v.Name)
+		}
+		regs, err = p.CurrentThread().Registers(false)
+		assertNoError(err, t, "Registers()")
+		if regs.PC() != pc || regs.SP() != sp {
+			t.Fatalf("registers not restored: pc %#x sp %#x, expected %#x %#x", regs.PC(), regs.SP(), pc, sp)
+		}
+
+		// once the calls are over other calls can be made
+		v, err = proc.CallFunction(p, "a.Double()")
+		assertNoError(err, t, "CallFunction(a.Double)")
+		if n, _ := constant.Int64Val(v.Value); n != 6 {
+			t.Fatalf("wrong return value %v, expected 6", v.Value)
+		}
+	})
+}
+
+func TestGoroutineAncestors(t *testing.T) {
+	if !goversion.VersionAfterOrEqual(runtime.Version(), 1, 11) {
+		t.Skip("not supported on Go <= 1.10")
+	}
+	savedGodebug := os.Getenv("GODEBUG")
+	os.Setenv("GODEBUG", "tracebackancestors=100")
+	defer os.Setenv("GODEBUG", savedGodebug)
+	withTestProcess("testnextprog", t, func(p proc.Process, fixture protest.Fixture) {
+		_, err := setFunctionBreakpoint(p, "main.testgoroutine")
+		assertNoError(err, t, "setFunctionBreakpoint()")
+		assertNoError(proc.Continue(p), t, "Continue()")
+		ancestors, err := proc.GoroutineAncestors(p, -1)
+		assertNoError(err, t, "GoroutineAncestors()")
+		if len(ancestors) != 1 {
+			t.Fatalf("expected one ancestor, got %d", len(ancestors))
+		}
+		mainFound := false
+		for _, frame := range ancestors[0] {
+			if frame.Current.Fn != nil && frame.Current.Fn.Name == "main.main" {
+				mainFound = true
+			}
+		}
+		if !mainFound {
+			t.Fatalf("main.main not found in the stack of the ancestor")
+		}
+	})
+
+	os.Setenv("GODEBUG", "")
+	withTestProcess("testnextprog", t, func(p proc.Process, fixture protest.Fixture) {
+		_, err := setFunctionBreakpoint(p, "main.testgoroutine")
+		assertNoError(err, t, "setFunctionBreakpoint()")
+		assertNoError(proc.Continue(p), t, "Continue()")
+		ancestors, err := proc.GoroutineAncestors(p, -1)
+		assertNoError(err, t, "GoroutineAncestors()")
+		if len(ancestors) != 0 {
+			t.Fatalf("expected no ancestors with tracebackancestors disabled, got %d", len(ancestors))
+		}
+	})
+}
+
+func TestGoroutineLabels(t *testing.T) {
+	withTestProcess("goroutineLabels", t, func(p proc.Process, fixture protest.Fixture) {
+		assertNoError(proc.Continue(p), t, "Continue()")
+		g, err := proc.GetG(p.CurrentThread())
+		assertNoError(err, t, "GetG()")
+		if labels := g.Labels(); labels != nil {
+			t.Errorf("labels before pprof.Do: %v", labels)
+		}
+
+		assertNoError(proc.Continue(p), t, "Continue()")
+		g, err = proc.GetG(p.CurrentThread())
+		assertNoError(err, t, "GetG()")
+		labels := g.Labels()
+		if len(labels) != 2 || labels["k1"] != "v1" || labels["k2"] != "v2" {
+			t.Errorf("wrong labels inside pprof.Do: %v", labels)
+		}
+
+		gs, _, err := proc.GoroutinesInfo(p, 0, 0)
+		assertNoError(err, t, "GoroutinesInfo")
+		for _, other := range gs {
+			if other.ID != g.ID && other.Labels() != nil {
+				t.Errorf("goroutine %d has labels %v", other.ID, other.Labels())
+			}
+		}
+	})
+}
+
+func TestStepUntilOutOfRange(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcess("testnextprog", t, func(p proc.Process, fixture protest.Fixture) {
+		_, err := setFunctionBreakpoint(p, "main.helloworld")
+		assertNoError(err, t, "setFunctionBreakpoint")
+		assertNoError(proc.Continue(p), t, "Continue")
+		frames, err := proc.ThreadStacktrace(p.CurrentThread(), 2, true)
+		assertNoError(err, t, "ThreadStacktrace")
+		fn := p.BinInfo().LookupFunc["main.helloworld"]
+		loc, err := proc.StepUntilOutOfRange(p, fn.Entry, fn.End)
+		assertNoError(err, t, "StepUntilOutOfRange")
+		// the call to fmt.Println is stepped over, main.helloworld is left
+		// by returning to main.testnext.
+		if loc.Fn == nil || loc.Fn.Name != "main.testnext" || loc.PC != frames[1].Current.PC {
+			t.Fatalf("wrong location after leaving main.helloworld: %#x %s:%d, expected the return address %#x", loc.PC, loc.File, loc.Line, frames[1].Current.PC)
+		}
+		if pc := currentPC(p, t); pc != loc.PC {
+			t.Errorf("current PC %#x does not match the returned location %#x", pc, loc.PC)
+		}
+	})
+}
+
+func TestNestedInterfaces(t *testing.T) {
+	// The concrete type of every error in a chain of wrapped errors is
+	// resolved, their contents are loaded up to MaxVariableRecurse.
+	protest.AllowRecording(t)
+	withTestProcess("testvariables2", t, func(p proc.Process, fixture protest.Fixture) {
+		assertNoError(proc.Continue(p), t, "Continue()")
+		scope, err := proc.GoroutineScope(p.CurrentThread())
+		assertNoError(err, t, "GoroutineScope()")
+
+		// errchain returns the concrete types of the errors wrapped by v and
+		// the innermost error.
+		errchain := func(v *proc.Variable) ([]string, *proc.Variable) {
+			var types []string
+			for v != nil && v.Kind == reflect.Interface && len(v.Children) == 1 {
+				data := &v.Children[0]
+				types = append(types, data.TypeString())
+				if len(data.Children) != 1 || len(data.Children[0].Children) == 0 {
+					return types, data
+				}
+				var next *proc.Variable
+				for i := range data.Children[0].Children {
+					if field := &data.Children[0].Children[i]; field.Name == "err" {
+						next = field
+					}
+				}
+				if next == nil {
+					return types, data
+				}
+				v = next
+			}
+			return types, v
+		}
+
+		cfg := proc.LoadConfig{FollowPointers: true, MaxVariableRecurse: 3, MaxStringLen: 64, MaxArrayValues: 64, MaxStructFields: -1}
+		v, err := scope.EvalVariable("errwrapped", cfg)
+		assertNoError(err, t, "EvalVariable(errwrapped)")
+		types, inner := errchain(v)
+		if fmt.Sprint(types) != "[*fmt.wrapError *fmt.wrapError *errors.errorString]" {
+			t.Fatalf("wrong error chain %v", types)
+		}
+		if len(inner.Children) != 1 || len(inner.Children[0].Children) != 1 || constant.StringVal(inner.Children[0].Children[0].Value) != "inner" {
+			t.Errorf("innermost error not loaded: %#v", inner)
+		}
+
+		// with a lower limit the types of the errors past the limit are still
+		// resolved but their contents aren't loaded
+		cfg.MaxVariableRecurse = 1
+		v, err = scope.EvalVariable("errwrapped", cfg)
+		assertNoError(err, t, "EvalVariable(errwrapped)")
+		if types, _ := errchain(v); len(types) < 2 || types[0] != "*fmt.wrapError" || types[1] != "*fmt.wrapError" {
+			t.Errorf("wrong error chain with MaxVariableRecurse 1: %v", types)
+		}
+
+		// errors that wrap themselves don't loop forever
+		cfg.MaxVariableRecurse = 10
+		_, err = scope.EvalVariable("errloop1", cfg)
+		assertNoError(err, t, "EvalVariable(errloop1)")
+	})
+}
+
+func TestSliceOfStructs(t *testing.T) {
+	// Elements of a slice of structs are loaded with all their fields, from
+	// the address of the backing array plus index * element size.
+	protest.AllowRecording(t)
+	withTestProcess("testvariables2", t, func(p proc.Process, fixture protest.Fixture) {
+		assertNoError(proc.Continue(p), t, "Continue()")
+		scope, err := proc.GoroutineScope(p.CurrentThread())
+		assertNoError(err, t, "GoroutineScope()")
+		cfg := proc.LoadConfig{FollowPointers: true, MaxVariableRecurse: 1, MaxStringLen: 64, MaxArrayValues: 3, MaxStructFields: -1}
+		v, err := scope.EvalVariable("points", cfg)
+		assertNoError(err, t, "EvalVariable(points)")
+		if v.Len != 4 || len(v.Children) != cfg.MaxArrayValues {
+			t.Fatalf("wrong number of elements %d of %d", len(v.Children), v.Len)
+		}
+		for i := range v.Children {
+			elem := &v.Children[i]
+			if elem.Addr != v.Base+uintptr(i)*uintptr(elem.RealType.Size()) {
+				t.Errorf("element %d: wrong address %#x", i, elem.Addr)
+			}
+			if len(elem.Children) != 2 {
+				t.Fatalf("element %d: wrong number of fields %d", i, len(elem.Children))
+			}
+			for j, name := range []string{"X", "Y"} {
+				f := elem.Children[j]
+				n, _ := constant.Int64Val(f.Value)
+				if f.Name != name || n != int64(2*i+j+1) {
+					t.Errorf("element %d: wrong field %s = %d", i, f.Name, n)
+				}
+			}
+		}
+	})
+}
+
+func TestVariableRawBytes(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcess("testvariables2", t, func(p proc.Process, fixture protest.Fixture) {
+		assertNoError(proc.Continue(p), t, "Continue()")
+		scope, err := proc.GoroutineScope(p.CurrentThread())
+		assertNoError(err, t, "GoroutineScope()")
+		if v := evalVariable(p, t, "i1"); v.RawBytes != nil {
+			t.Errorf("i1: raw bytes read without LoadRawBytes: %#v", v.RawBytes)
+		}
+		cfg := normalLoadConfig
+		cfg.LoadRawBytes = true
+		for _, tc := range []struct {
+			expr string
+			val  int64
+		}{{"i1", 1}, {"i6", -500}} {
+			v, err := scope.EvalVariable(tc.expr, cfg)
+			assertNoError(err, t, fmt.Sprintf("EvalVariable(%q)", tc.expr))
+			var buf [8]byte
+			binary.LittleEndian.PutUint64(buf[:], uint64(tc.val))
+			if !bytes.Equal(v.RawBytes, buf[:]) {
+				t.Errorf("%s: wrong raw bytes %#v (expected %#v)", tc.expr, v.RawBytes, buf[:])
+			}
+		}
+	})
+}
+
+func BenchmarkLocalVariables(b *testing.B) {
+	protest.AllowRecording(b)
+	withTestProcess("testvariables", b, func(p proc.Process, fixture protest.Fixture) {
+		assertNoError(proc.Continue(p), b, "Continue() returned an error")
+		scope, err := proc.GoroutineScope(p.CurrentThread())
+		assertNoError(err, b, "Scope()")
+		for i := 0; i < b.N; i++ {
+			_, err := scope.LocalVariables(normalLoadConfig)
+			assertNoError(err, b, "LocalVariables()")
+		}
+	})
+}
+
+func TestCondBreakpoint(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcess("parallel_next", t, func(p proc.Process, fixture protest.Fixture) {
+		addr, _, err := p.BinInfo().LineToPC(fixture.Source, 9)
+		assertNoError(err, t, "LineToPC")
+		bp, err := p.SetBreakpoint(addr, proc.UserBreakpoint, nil)
+		assertNoError(err, t, "SetBreakpoint()")
+		bp.Cond = &ast.BinaryExpr{
+			Op: token.EQL,
+			X:  &ast.Ident{Name: "n"},
+			Y:  &ast.BasicLit{Kind: token.INT, Value: "7"},
+		}
+
+		assertNoError(proc.Continue(p), t, "Continue()")
+
+		nvar := evalVariable(p, t, "n")
+
+		n, _ := constant.Int64Val(nvar.Value)
+		if n != 7 {
+			t.Fatalf("Stoppend on wrong goroutine %d\n", n)
+		}
+	})
+}
+
+func TestSetCondition(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcess("parallel_next", t, func(p proc.Process, fixture protest.Fixture) {
+		bp := setFileLineBreakpoint(p, t, fixture.Source, 9)
+		if err := bp.SetCondition("n =="); err == nil {
+			t.Fatal("no error setting a malformed condition")
+		}
+		if bp.Cond != nil {
+			t.Fatal("malformed condition was set")
+		}
+		assertNoError(bp.SetCondition("n == 7"), t, "SetCondition()")
+
+		assertNoError(proc.Continue(p), t, "Continue()")
+
+		nvar := evalVariable(p, t, "n")
+
+		n, _ := constant.Int64Val(nvar.Value)
+		if n != 7 {
+			t.Fatalf("Stoppend on wrong goroutine %d\n", n)
+		}
+	})
+}
+
+func TestCondBreakpointError(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcess("parallel_next", t, func(p proc.Process, fixture protest.Fixture) {
+		addr, _, err := p.BinInfo().LineToPC(fixture.Source, 9)
+		assertNoError(err, t, "LineToPC")
+		bp, err := p.SetBreakpoint(addr, proc.UserBreakpoint, nil)
+		assertNoError(err, t, "SetBreakpoint()")
+		bp.Cond = &ast.BinaryExpr{
+			Op: token.EQL,
+			X:  &ast.Ident{Name: "nonexistentvariable"},
+			Y:  &ast.BasicLit{Kind: token.INT, Value: "7"},
+		}
+
+		err = proc.Continue(p)
+		if err == nil {
+			t.Fatalf("No error on first Continue()")
+		}
+
+		if err.Error() != "error evaluating expression: could not find symbol value for nonexistentvariable" && err.Error() != "multiple errors evaluating conditions" {
+			t.Fatalf("Unexpected error on first Continue(): %v", err)
+		}
+
+		bp.Cond = &ast.BinaryExpr{
+			Op: token.EQL,
+			X:  &ast.Ident{Name: "n"},
+			Y:  &ast.BasicLit{Kind: token.INT, Value: "7"},
+		}
+
+		err = proc.Continue(p)
+		if err != nil {
+			if _, exited := err.(proc.ErrProcessExited); !exited {
+				t.Fatalf("Unexpected error on second Continue(): %v", err)
+			}
+		} else {
+			nvar := evalVariable(p, t, "n")
+
+			n, _ := constant.Int64Val(nvar.Value)
+			if n != 7 {
+				t.Fatalf("Stoppend on wrong goroutine %d\n", n)
+			}
+		}
+	})
+}
+
+func TestIssue356(t *testing.T) {
+	// slice with a typedef does not get printed correctly
+	protest.AllowRecording(t)
+	withTestProcess("testvariables2", t, func(p proc.Process, fixture protest.Fixture) {
+		assertNoError(proc.Continue(p), t, "Continue() returned an error")
+		mmvar := evalVariable(p, t, "mainMenu")
+		if mmvar.Kind != reflect.Slice {
+			t.Fatalf("Wrong kind for mainMenu: %v\n", mmvar.Kind)
+		}
+	})
+}
+
+func TestStepIntoFunction(t *testing.T) {
+	withTestProcess("teststep", t, func(p proc.Process, fixture protest.Fixture) {
+		// Continue until breakpoint
+		assertNoError(proc.Continue(p), t, "Continue() returned an error")
+		// Step into function
+		assertNoError(proc.Step(p), t, "Step() returned an error")
+		// We should now be inside the function.
+		loc, err := p.CurrentThread().Location()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loc.Fn.Name != "main.callme" {
+			t.Fatalf("expected to be within the 'callme' function, was in %s instead", loc.Fn.Name)
+		}
+		if !strings.Contains(loc.File, "teststep") {
+			t.Fatalf("debugger stopped at incorrect location: %s:%d", loc.File, loc.Line)
+		}
+		if loc.Line != 8 {
+			t.Fatalf("debugger stopped at incorrect line: %d", loc.Line)
+		}
+	})
+}
+
+func TestIssue384(t *testing.T) {
+	// Crash related to reading uninitialized memory, introduced by the memory prefetching optimization
+
+	ver, _ := goversion.Parse(runtime.Version())
+	if ver.Major < 0 || ver.AfterOrEqual(goversion.GoVersion{1, 10, -1, 0, 0, ""}) {
+		// go 1.10 emits DW_AT_decl_line and we won't be able to evaluate 'st'
+		// which is declared after line 13.
+		t.Skip("can not evaluate not-yet-declared variables with go 1.10")
 	}
 
 	protest.AllowRecording(t)
@@ -1747,7 +2818,7 @@ func TestIssue332_Part1(t *testing.T) {
 		assertNoError(err, t, "SetBreakpoint()")
 		assertNoError(proc.Continue(p), t, "Continue()")
 		assertNoError(proc.Next(p), t, "first Next()")
-		locations, err := proc.ThreadStacktrace(p.CurrentThread(), 2)
+		locations, err := proc.ThreadStacktrace(p.CurrentThread(), 2, true)
 		assertNoError(err, t, "Stacktrace()")
 		if locations[0].Call.Fn == nil {
 			t.Fatalf("Not on a function")
@@ -1777,7 +2848,7 @@ func TestIssue332_Part2(t *testing.T) {
 		// step until we enter changeMe
 		for {
 			assertNoError(proc.Step(p), t, "Step()")
-			locations, err := proc.ThreadStacktrace(p.CurrentThread(), 2)
+			locations, err := proc.ThreadStacktrace(p.CurrentThread(), 2, true)
 			assertNoError(err, t, "Stacktrace()")
 			if locations[0].Call.Fn == nil {
 				t.Fatalf("Not on a function")
@@ -1863,9 +2934,96 @@ func TestPackageVariables(t *testing.T) {
 	})
 }
 
-func TestIssue149(t *testing.T) {
-	ver, _ := goversion.Parse(runtime.Version())
-	if ver.Major > 0 && !ver.AfterOrEqual(goversion.GoVersion{1, 7, -1, 0, 0, ""}) {
+func TestEvalGlobal(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcessArgs("testargs", t, ".", []string{"test", "pass flag"}, 0, func(p proc.Process, fixture protest.Fixture) {
+		_, err := setFunctionBreakpoint(p, "main.main")
+		assertNoError(err, t, "setFunctionBreakpoint()")
+		assertNoError(proc.Continue(p), t, "Continue()")
+		scope, err := proc.GoroutineScope(p.CurrentThread())
+		assertNoError(err, t, "GoroutineScope()")
+
+		v, err := scope.EvalGlobal("os.Args", normalLoadConfig)
+		assertNoError(err, t, "EvalGlobal(os.Args)")
+		if v.Kind != reflect.Slice || v.RealType.String() != "[]string" {
+			t.Fatalf("wrong type of os.Args: %v %s", v.Kind, v.RealType)
+		}
+		args := make([]string, len(v.Children))
+		for i := range v.Children {
+			args[i] = constant.StringVal(v.Children[i].Value)
+		}
+		if len(args) != 3 || args[0] != fixture.Path || args[1] != "test" || args[2] != "pass flag" {
+			t.Fatalf("wrong value of os.Args: %q", args)
+		}
+
+		// variables of packages other than main, and package paths with
+		// more than one element, are found
+		v, err = scope.EvalGlobal("runtime.buildVersion", normalLoadConfig)
+		assertNoError(err, t, "EvalGlobal(runtime.buildVersion)")
+		if s := constant.StringVal(v.Value); !strings.HasPrefix(s, "go") && !strings.HasPrefix(s, "devel") {
+			t.Fatalf("wrong value of runtime.buildVersion %q", s)
+		}
+		if _, err := scope.EvalGlobal("internal/bytealg.MaxLen", normalLoadConfig); err != nil {
+			t.Fatalf("EvalGlobal(internal/bytealg.MaxLen): %v", err)
+		}
+		if _, err := scope.EvalGlobal("os.NotAVariable", normalLoadConfig); err == nil {
+			t.Fatal("no error for a variable that does not exist")
+		}
+	})
+}
+
+func TestFunctionArgumentsOptimizedOut(t *testing.T) {
+	// Arguments that are dead at the current PC have no location in
+	// optimized binaries, they must still be returned, with their name and
+	// type, by FunctionArguments.
+	protest.AllowRecording(t)
+	withTestProcessArgs("optimizedargs", t, ".", []string{}, protest.EnableOptimization, func(p proc.Process, fixture protest.Fixture) {
+		assertNoError(proc.Continue(p), t, "Continue()")
+		scope, err := proc.GoroutineScope(p.CurrentThread())
+		assertNoError(err, t, "GoroutineScope()")
+		if scope.Fn == nil || scope.Fn.Name != "main.product" {
+			t.Fatalf("wrong function %v", scope.Fn)
+		}
+		args, err := scope.FunctionArguments(normalLoadConfig)
+		assertNoError(err, t, "FunctionArguments()")
+
+		expected := map[string]int64{"a": 6, "b": 7}
+		optimizedOut := 0
+		for _, arg := range args {
+			if arg.Flags&proc.VariableReturnArgument != 0 {
+				continue
+			}
+			val, ok := expected[arg.Name]
+			if !ok {
+				t.Errorf("unexpected argument %s", arg.Name)
+				continue
+			}
+			delete(expected, arg.Name)
+			if arg.DwarfType == nil || arg.DwarfType.String() != "int" {
+				t.Errorf("wrong type for %s: %v", arg.Name, arg.DwarfType)
+			}
+			if arg.Flags&proc.VariableOptimizedOut != 0 {
+				t.Logf("%s optimized out: %v", arg.Name, arg.Unreadable)
+				optimizedOut++
+				continue
+			}
+			assertNoError(arg.Unreadable, t, "reading "+arg.Name)
+			if n, _ := constant.Int64Val(arg.Value); n != val {
+				t.Errorf("wrong value for %s: %d, expected %d", arg.Name, n, val)
+			}
+		}
+		if len(expected) != 0 {
+			t.Errorf("missing arguments %v", expected)
+		}
+		if optimizedOut == 0 {
+			t.Skip("the compiler did not optimize out any argument of main.product")
+		}
+	})
+}
+
+func TestIssue149(t *testing.T) {
+	ver, _ := goversion.Parse(runtime.Version())
+	if ver.Major > 0 && !ver.AfterOrEqual(goversion.GoVersion{1, 7, -1, 0, 0, ""}) {
 		return
 	}
 	// setting breakpoint on break statement
@@ -1947,7 +3105,7 @@ func TestIssue462(t *testing.T) {
 		}()
 
 		assertNoError(proc.Continue(p), t, "Continue()")
-		_, err := proc.ThreadStacktrace(p.CurrentThread(), 40)
+		_, err := proc.ThreadStacktrace(p.CurrentThread(), 40, true)
 		assertNoError(err, t, "Stacktrace()")
 	})
 }
@@ -1979,7 +3137,7 @@ func TestNextParked(t *testing.T) {
 				if g.Thread != nil {
 					continue
 				}
-				frames, _ := g.Stacktrace(5, false)
+				frames, _ := g.Stacktrace(5, false, true)
 				for _, frame := range frames {
 					// line 11 is the line where wg.Done is called
 					if frame.Current.Fn != nil && frame.Current.Fn.Name == "main.sayhi" && frame.Current.Line < 11 {
@@ -2032,7 +3190,7 @@ func TestStepParked(t *testing.T) {
 		}
 
 		t.Logf("Parked g is: %v\n", parkedg)
-		frames, _ := parkedg.Stacktrace(20, false)
+		frames, _ := parkedg.Stacktrace(20, false, true)
 		for _, frame := range frames {
 			name := ""
 			if frame.Call.Fn != nil {
@@ -2325,6 +3483,87 @@ func TestStepOut(t *testing.T) {
 	testseq2(t, "testnextprog", "main.helloworld", []seqTest{{contContinue, 13}, {contStepout, 35}})
 }
 
+func TestStepOutReturnAddress(t *testing.T) {
+	// StepOut should stop exactly on the return address of the function, in
+	// the frame of its caller.
+	protest.AllowRecording(t)
+	withTestProcess("testnextprog", t, func(p proc.Process, fixture protest.Fixture) {
+		_, err := setFunctionBreakpoint(p, "main.helloworld")
+		assertNoError(err, t, "setFunctionBreakpoint()")
+		assertNoError(proc.Continue(p), t, "Continue()")
+
+		frames, err := proc.ThreadStacktrace(p.CurrentThread(), 2, true)
+		assertNoError(err, t, "ThreadStacktrace()")
+		ret, callerCFA := frames[0].Ret, frames[1].Regs.CFA
+
+		assertNoError(proc.StepOut(p), t, "StepOut()")
+		frames, err = proc.ThreadStacktrace(p.CurrentThread(), 0, true)
+		assertNoError(err, t, "ThreadStacktrace()")
+		if frames[0].Current.PC != ret || frames[0].Regs.CFA != callerCFA {
+			t.Fatalf("stopped at %#x (CFA %#x) expected %#x (CFA %#x)", frames[0].Current.PC, frames[0].Regs.CFA, ret, callerCFA)
+		}
+		if frames[0].Current.Fn == nil || frames[0].Current.Fn.Name != "main.testnext" {
+			t.Fatalf("wrong function after StepOut: %v", frames[0].Current.Fn)
+		}
+	})
+}
+
+func TestStepOutFramePointer(t *testing.T) {
+	if runtime.GOARCH != "amd64" {
+		t.Skip("amd64 only")
+	}
+	// On amd64 the return address found by the stack iterator, and used by
+	// StepOut, is the one saved at [RBP+8] by the prologue of functions using
+	// frame pointers.
+	protest.AllowRecording(t)
+	withTestProcess("testnextprog", t, func(p proc.Process, fixture protest.Fixture) {
+		_, err := setFunctionBreakpoint(p, "main.helloworld")
+		assertNoError(err, t, "setFunctionBreakpoint()")
+		assertNoError(proc.Continue(p), t, "Continue()")
+
+		regs, err := p.CurrentThread().Registers(false)
+		assertNoError(err, t, "Registers()")
+		buf := make([]byte, 8)
+		_, err = p.CurrentThread().ReadMemory(buf, uintptr(regs.BP()+8))
+		assertNoError(err, t, "ReadMemory()")
+		ret := binary.LittleEndian.Uint64(buf)
+
+		frames, err := proc.ThreadStacktrace(p.CurrentThread(), 1, true)
+		assertNoError(err, t, "ThreadStacktrace()")
+		if frames[0].Ret != ret {
+			t.Fatalf("return address %#x, expected %#x", frames[0].Ret, ret)
+		}
+
+		assertNoError(proc.StepOut(p), t, "StepOut()")
+		loc, err := p.CurrentThread().Location()
+		assertNoError(err, t, "Location()")
+		if loc.PC != ret {
+			t.Fatalf("stopped at %#x, expected %#x", loc.PC, ret)
+		}
+	})
+}
+
+func TestContinueToFuncReturn(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcess("stacktraceprog", t, func(p proc.Process, fixture protest.Fixture) {
+		_, err := setFunctionBreakpoint(p, "main.stacktraceme")
+		assertNoError(err, t, "setFunctionBreakpoint()")
+
+		assertNoError(proc.Continue(p), t, "Continue() 1")
+		if err := proc.ContinueToFuncReturn(p, "main.func2"); err == nil {
+			t.Fatal("ContinueToFuncReturn(main.func2) did not return an error while main.func2 was not on the stack")
+		}
+
+		assertNoError(proc.Continue(p), t, "Continue() 2")
+		assertNoError(proc.ContinueToFuncReturn(p, "main.func2"), t, "ContinueToFuncReturn(main.func2)")
+		loc, err := p.CurrentThread().Location()
+		assertNoError(err, t, "Location()")
+		if loc.Fn == nil || loc.Fn.Name != "main.main" {
+			t.Fatalf("wrong location after ContinueToFuncReturn: %s:%d (%v)", loc.File, loc.Line, loc.Fn)
+		}
+	})
+}
+
 func TestStepConcurrentDirect(t *testing.T) {
 	protest.AllowRecording(t)
 	withTestProcess("teststepconcurrent", t, func(p proc.Process, fixture protest.Fixture) {
@@ -2363,7 +3602,7 @@ func TestStepConcurrentDirect(t *testing.T) {
 					// loop exited
 					break
 				}
-				frames, err := proc.ThreadStacktrace(p.CurrentThread(), 20)
+				frames, err := proc.ThreadStacktrace(p.CurrentThread(), 20, true)
 				if err != nil {
 					t.Errorf("Could not get stacktrace of goroutine %d\n", p.SelectedGoroutine().ID)
 				} else {
@@ -2498,6 +3737,41 @@ func TestStepOutDeferReturnAndDirectCall(t *testing.T) {
 
 const maxInstructionLength uint64 = 15
 
+func TestCurrentInstruction(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcess("testprog", t, func(p proc.Process, fixture protest.Fixture) {
+		bp, err := setFunctionBreakpoint(p, "main.helloworld")
+		assertNoError(err, t, "setFunctionBreakpoint()")
+		assertNoError(proc.Continue(p), t, "Continue()")
+
+		pc := currentPC(p, t)
+		if pc != bp.Addr {
+			t.Fatalf("not stopped at breakpoint: %#x %#x", pc, bp.Addr)
+		}
+
+		check := func(atbp bool) {
+			inst, err := proc.CurrentInstruction(p)
+			assertNoError(err, t, "CurrentInstruction()")
+			text, err := proc.Disassemble(p, nil, pc, pc+maxInstructionLength)
+			assertNoError(err, t, "Disassemble()")
+			if inst.Loc.PC != pc || !inst.AtPC || inst.Breakpoint != atbp {
+				t.Fatalf("wrong instruction %#v at %#x (breakpoint: %v)", inst.Loc, pc, atbp)
+			}
+			if !bytes.Equal(inst.Bytes, text[0].Bytes) {
+				t.Fatalf("instruction mismatch %x %x", inst.Bytes, text[0].Bytes)
+			}
+			if inst.Text(proc.IntelFlavour, p.BinInfo()) != text[0].Text(proc.IntelFlavour, p.BinInfo()) {
+				t.Fatalf("instruction mismatch %q %q", inst.Text(proc.IntelFlavour, p.BinInfo()), text[0].Text(proc.IntelFlavour, p.BinInfo()))
+			}
+		}
+
+		check(true)
+		_, err = p.ClearBreakpoint(bp.Addr)
+		assertNoError(err, t, "ClearBreakpoint()")
+		check(false)
+	})
+}
+
 func TestStepOnCallPtrInstr(t *testing.T) {
 	protest.AllowRecording(t)
 	withTestProcess("teststepprog", t, func(p proc.Process, fixture protest.Fixture) {
@@ -2671,7 +3945,7 @@ func BenchmarkTrace(b *testing.B) {
 			assertNoError(proc.Continue(p), b, "Continue()")
 			s, err := proc.GoroutineScope(p.CurrentThread())
 			assertNoError(err, b, "Scope()")
-			_, err = s.FunctionArguments(proc.LoadConfig{false, 0, 64, 0, 3, 0})
+			_, err = s.FunctionArguments(proc.LoadConfig{false, 0, 64, 0, 3, 0, false, false})
 			assertNoError(err, b, "FunctionArguments()")
 		}
 		b.StopTimer()
@@ -2755,7 +4029,7 @@ func TestStacktraceWithBarriers(t *testing.T) {
 				goid, _ := constant.Int64Val(goidVar.Value)
 
 				if g := getg(int(goid), gs); g != nil {
-					stack, err := g.Stacktrace(50, false)
+					stack, err := g.Stacktrace(50, false, true)
 					assertNoError(err, t, fmt.Sprintf("Stacktrace(goroutine = %d)", goid))
 					for _, frame := range stack {
 						if frame.Current.Fn != nil && frame.Current.Fn.Name == "main.bottomUpTree" {
@@ -2781,7 +4055,7 @@ func TestStacktraceWithBarriers(t *testing.T) {
 		for _, goid := range stackBarrierGoids {
 			g := getg(goid, gs)
 
-			stack, err := g.Stacktrace(200, false)
+			stack, err := g.Stacktrace(200, false, true)
 			assertNoError(err, t, "Stacktrace()")
 
 			// Check that either main.main or main.main.func1 appear in the
@@ -3169,12 +4443,16 @@ func TestAttachStripped(t *testing.T) {
 
 	t.Logf("error is %v", err)
 
-	if err == nil {
-		p.Detach(true)
-		t.Fatalf("expected error after attach, got nothing")
-	} else {
+	// executables stripped with -s keep the Go symbol table, they can be
+	// debugged without DWARF.
+	if err != nil {
 		cmd.Process.Kill()
+		t.Fatalf("could not attach to a stripped executable: %v", err)
+	}
+	if p.BinInfo().HasDWARF() {
+		t.Errorf("stripped executable has DWARF")
 	}
+	p.Detach(true)
 	os.Remove(fixture.Path)
 }
 
@@ -3330,7 +4608,7 @@ func TestCgoStacktrace(t *testing.T) {
 				}
 			}
 
-			frames, err := g.Stacktrace(100, false)
+			frames, err := g.Stacktrace(100, false, true)
 			assertNoError(err, t, fmt.Sprintf("Stacktrace at iteration step %d", itidx))
 
 			t.Logf("iteration step %d", itidx)
@@ -3361,7 +4639,7 @@ func TestCgoStacktrace(t *testing.T) {
 			}
 
 			// also check that ThreadStacktrace produces the same list of frames
-			threadFrames, err := proc.ThreadStacktrace(p.CurrentThread(), 100)
+			threadFrames, err := proc.ThreadStacktrace(p.CurrentThread(), 100, true)
 			assertNoError(err, t, fmt.Sprintf("ThreadStacktrace at iteration step %d", itidx))
 
 			if len(threadFrames) != len(frames) {
@@ -3409,6 +4687,102 @@ func TestCgoSources(t *testing.T) {
 	})
 }
 
+func TestCgoFrameArguments(t *testing.T) {
+	// the arguments of C frames are read from the debug info of their C
+	// compilation unit.
+	withTestProcess("cgostacktest/", t, func(p proc.Process, fixture protest.Fixture) {
+		helloc := filepath.Join(fixture.BuildDir, "hello.c")
+		setFileLineBreakpoint(p, t, helloc, 13)
+		assertNoError(proc.Continue(p), t, "Continue") // runtime.Breakpoint in main.main
+		assertNoError(proc.Continue(p), t, "Continue")
+
+		frames, err := proc.ThreadStacktrace(p.CurrentThread(), 20, true)
+		assertNoError(err, t, "ThreadStacktrace")
+		logStacktrace(t, p.BinInfo(), frames)
+		m := stacktraceCheck(t, []string{"C.helloworld", "main.main"}, frames)
+		if m == nil {
+			t.Fatal("C frame not found in the stacktrace")
+		}
+		cframe, goframe := frames[m[0]], frames[m[1]]
+		if !cframe.IsC() || goframe.IsC() {
+			t.Errorf("wrong IsC for C.helloworld (%v) and main.main (%v)", cframe.IsC(), goframe.IsC())
+		}
+		if !frameInFile(cframe, "hello.c") || cframe.Current.Line != 13 {
+			t.Errorf("C frame at %s:%d, expected hello.c:13", cframe.Current.File, cframe.Current.Line)
+		}
+
+		scope := proc.FrameToScope(p.BinInfo(), p.CurrentThread(), nil, frames[m[0]:]...)
+		args, err := scope.FunctionArguments(normalLoadConfig)
+		assertNoError(err, t, "FunctionArguments")
+		if len(args) != 1 || args[0].Name != "x" {
+			t.Fatalf("wrong arguments of C.helloworld %v", args)
+		}
+		if x, _ := constant.Int64Val(args[0].Value); x != 2 {
+			t.Errorf("wrong value of x: %v", args[0].Value)
+		}
+	})
+}
+
+func TestCgoFramelessStacktrace(t *testing.T) {
+	// C.frameless doesn't save the frame pointer, its caller can only be
+	// found using the CFI in .eh_frame.
+	withTestProcess("cgoframeless", t, func(p proc.Process, fixture protest.Fixture) {
+		assertNoError(proc.Continue(p), t, "Continue")
+		frames, err := proc.ThreadStacktrace(p.CurrentThread(), 20, true)
+		assertNoError(err, t, "ThreadStacktrace")
+		logStacktrace(t, p.BinInfo(), frames)
+		if frames[0].Current.Fn == nil || frames[0].Current.Fn.Name != "C.frameless" {
+			t.Fatalf("not stopped in C.frameless")
+		}
+		if m := stacktraceCheck(t, []string{"C.frameless", "C.framelessCaller", "main.main"}, frames); m == nil || m[1] != 1 {
+			t.Fatalf("caller of C.frameless not found in the stacktrace")
+		}
+	})
+}
+
+func TestCgoBitFields(t *testing.T) {
+	// reads a C struct containing bit fields and a union
+	withTestProcess("cgobitfields", t, func(p proc.Process, fixture protest.Fixture) {
+		scope, err := proc.ThreadScope(p.CurrentThread())
+		assertNoError(err, t, "ThreadScope")
+		v, err := scope.EvalVariable("C.cbitfields", normalLoadConfig)
+		assertNoError(err, t, "EvalVariable(C.cbitfields)")
+		if v.Kind != reflect.Struct || len(v.Children) != 7 {
+			t.Fatalf("wrong variable %s with %d children", v.Kind, len(v.Children))
+		}
+		for i, tc := range []struct {
+			name  string
+			value string
+		}{
+			{"a", "5"},
+			{"b", "-3"},
+			{"c", "1"},
+			{"d", "42"},
+			{"e", "78187493530"},
+		} {
+			f := v.Children[i]
+			if f.Name != tc.name || f.Unreadable != nil || f.Value == nil || f.Value.ExactString() != tc.value {
+				t.Errorf("field %d: expected %s = %s, got %s = %v (%v)", i, tc.name, tc.value, f.Name, f.Value, f.Unreadable)
+			}
+		}
+		u := v.Children[5]
+		if u.Kind != reflect.Struct || len(u.Children) != 2 {
+			t.Fatalf("wrong union %s with %d children", u.Kind, len(u.Children))
+		}
+		if x, _ := constant.Int64Val(u.Children[0].Value); x != 0x01020304 {
+			t.Errorf("wrong value of u.i: %#x", x)
+		}
+		for i, b := range u.Children[1].Children {
+			if x, _ := constant.Uint64Val(b.Value); x != uint64(4-i) {
+				t.Errorf("wrong value of u.bytes[%d]: %d", i, x)
+			}
+		}
+		if x, _ := constant.Float64Val(v.Children[6].Value); x != 1.5 {
+			t.Errorf("wrong value of f: %g", x)
+		}
+	})
+}
+
 func TestSystemstackStacktrace(t *testing.T) {
 	// check that we can follow a stack switch initiated by runtime.systemstack()
 	withTestProcess("panic", t, func(p proc.Process, fixture protest.Fixture) {
@@ -3418,7 +4792,7 @@ func TestSystemstackStacktrace(t *testing.T) {
 		assertNoError(proc.Continue(p), t, "second continue")
 		g, err := proc.GetG(p.CurrentThread())
 		assertNoError(err, t, "GetG")
-		frames, err := g.Stacktrace(100, false)
+		frames, err := g.Stacktrace(100, false, true)
 		assertNoError(err, t, "stacktrace")
 		logStacktrace(t, p.BinInfo(), frames)
 		m := stacktraceCheck(t, []string{"!runtime.startpanic_m", "runtime.gopanic", "main.main"}, frames)
@@ -3453,7 +4827,7 @@ func TestSystemstackOnRuntimeNewstack(t *testing.T) {
 				break
 			}
 		}
-		frames, err := g.Stacktrace(100, false)
+		frames, err := g.Stacktrace(100, false, true)
 		assertNoError(err, t, "stacktrace")
 		logStacktrace(t, p.BinInfo(), frames)
 		m := stacktraceCheck(t, []string{"!runtime.newstack", "main.main"}, frames)
@@ -3470,7 +4844,7 @@ func TestIssue1034(t *testing.T) {
 		_, err := setFunctionBreakpoint(p, "main.main")
 		assertNoError(err, t, "setFunctionBreakpoint()")
 		assertNoError(proc.Continue(p), t, "Continue()")
-		frames, err := p.SelectedGoroutine().Stacktrace(10, false)
+		frames, err := p.SelectedGoroutine().Stacktrace(10, false, true)
 		assertNoError(err, t, "Stacktrace")
 		scope := proc.FrameToScope(p.BinInfo(), p.CurrentThread(), nil, frames[2:]...)
 		args, _ := scope.FunctionArguments(normalLoadConfig)
@@ -3617,6 +4991,62 @@ func TestDisassembleGlobalVars(t *testing.T) {
 	})
 }
 
+func TestBuildInfo(t *testing.T) {
+	if !goversion.VersionAfterOrEqual(runtime.Version(), 1, 13) {
+		t.Skip("module information is only embedded in executables since go 1.13")
+	}
+	fixture := protest.BuildFixture("buildtest/", 0)
+	bi := proc.NewBinaryInfo(runtime.GOOS, runtime.GOARCH)
+	assertNoError(bi.LoadBinaryInfo(fixture.Path, 0, nil), t, "LoadBinaryInfo")
+	info, err := bi.BuildInfo()
+	assertNoError(err, t, "BuildInfo")
+	t.Logf("%v", info)
+	if info.Main.Path != "github.com/go-delve/delve" {
+		t.Errorf("wrong main module path %q", info.Main.Path)
+	}
+	if info.Path != "github.com/go-delve/delve/_fixtures/buildtest" {
+		t.Errorf("wrong package path %q", info.Path)
+	}
+	if info.GoVersion != runtime.Version() {
+		t.Errorf("wrong go version %q, expected %q", info.GoVersion, runtime.Version())
+	}
+}
+
+func TestDisassembleFunction(t *testing.T) {
+	withTestProcess("increment", t, func(p proc.Process, fixture protest.Fixture) {
+		fn := p.BinInfo().LookupFunc["main.Increment"]
+		_, err := p.SetBreakpoint(fn.Entry, proc.UserBreakpoint, nil)
+		assertNoError(err, t, "SetBreakpoint")
+
+		text, err := proc.DisassembleFunction(p, nil, "main.Increment")
+		assertNoError(err, t, "DisassembleFunction")
+		if len(text) == 0 {
+			t.Fatal("no instructions")
+		}
+		size := 0
+		for i, instr := range text {
+			size += len(instr.Bytes)
+			if instr.Loc.Fn == nil || instr.Loc.Fn.Name != "main.Increment" {
+				t.Errorf("instruction %d at %#x: wrong function %v", i, instr.Loc.PC, instr.Loc.Fn)
+			}
+			if instr.Loc.File != fixture.Source || instr.Loc.Line < 6 || instr.Loc.Line > 14 {
+				t.Errorf("instruction %d at %#x: wrong location %s:%d", i, instr.Loc.PC, instr.Loc.File, instr.Loc.Line)
+			}
+			if instr.Breakpoint != (i == 0) {
+				t.Errorf("instruction %d at %#x: wrong breakpoint annotation %v", i, instr.Loc.PC, instr.Breakpoint)
+			}
+		}
+		if uint64(size) != fn.End-fn.Entry {
+			t.Errorf("disassembled %d bytes, function is %d bytes long", size, fn.End-fn.Entry)
+		}
+
+		_, err = proc.DisassembleFunction(p, nil, "main.nonexistent")
+		if _, isnotfound := err.(*proc.ErrFunctionNotFound); !isnotfound {
+			t.Errorf("wrong error for nonexistent function: %v", err)
+		}
+	})
+}
+
 func checkFrame(frame proc.Stackframe, fnname, file string, line int, inlined bool) error {
 	if frame.Call.Fn == nil || frame.Call.Fn.Name != fnname {
 		return fmt.Errorf("wrong function name: %s", fnname)
@@ -3695,7 +5125,7 @@ func TestInlinedStacktraceAndVariables(t *testing.T) {
 
 		// first inlined call
 		assertNoError(proc.Continue(p), t, "Continue")
-		frames, err := proc.ThreadStacktrace(p.CurrentThread(), 20)
+		frames, err := proc.ThreadStacktrace(p.CurrentThread(), 20, true)
 		assertNoError(err, t, "ThreadStacktrace")
 		t.Logf("Stacktrace:\n")
 		for i := range frames {
@@ -3722,7 +5152,7 @@ func TestInlinedStacktraceAndVariables(t *testing.T) {
 
 		// second inlined call
 		assertNoError(proc.Continue(p), t, "Continue")
-		frames, err = proc.ThreadStacktrace(p.CurrentThread(), 20)
+		frames, err = proc.ThreadStacktrace(p.CurrentThread(), 20, true)
 		assertNoError(err, t, "ThreadStacktrace (2)")
 		t.Logf("Stacktrace 2:\n")
 		for i := range frames {
@@ -3846,6 +5276,65 @@ func TestInlineBreakpoint(t *testing.T) {
 	})
 }
 
+func TestInlineFunctionBreakpoint(t *testing.T) {
+	// We should be able to set a breakpoint on a function that was inlined
+	// everywhere it was called and see the inlined frame when it is hit.
+	if ver, _ := goversion.Parse(runtime.Version()); ver.Major >= 0 && !ver.AfterOrEqual(goversion.GoVersion{1, 10, -1, 0, 0, ""}) {
+		// Versions of go before 1.10 do not have DWARF information for inlined calls
+		t.Skip("inlining not supported")
+	}
+	withTestProcessArgs("testinline", t, ".", []string{}, protest.EnableInlining|protest.EnableOptimization, func(p proc.Process, fixture protest.Fixture) {
+		pcs, err := proc.FindFunctionLocations(p, "main.inlineThis", true, 0)
+		assertNoError(err, t, "FindFunctionLocations(main.inlineThis)")
+		if len(pcs) != 2 {
+			t.Fatalf("wrong number of locations for main.inlineThis: %#x", pcs)
+		}
+		for _, pc := range pcs {
+			_, err = p.SetBreakpoint(pc, proc.UserBreakpoint, nil)
+			assertNoError(err, t, "SetBreakpoint")
+		}
+
+		for _, callLine := range []int{18, 19} {
+			assertNoError(proc.Continue(p), t, "Continue()")
+			frames, err := proc.ThreadStacktrace(p.CurrentThread(), 5, true)
+			assertNoError(err, t, "ThreadStacktrace")
+			if len(frames) < 2 {
+				t.Fatalf("stacktrace too short: %d frames", len(frames))
+			}
+			if frames[0].Call.Fn == nil || frames[0].Call.Fn.Name != "main.inlineThis" || !frames[0].Inlined {
+				t.Errorf("wrong first frame: %v inlined=%v", frames[0].Call.Fn, frames[0].Inlined)
+			}
+			if err := checkFrame(frames[1], "main.main", fixture.Source, callLine, false); err != nil {
+				t.Errorf("wrong second frame: %v", err)
+			}
+		}
+	})
+}
+
+func TestLinePCsInlinedCall(t *testing.T) {
+	// The first instruction of an inlined call belongs to the inlined
+	// function, LinePCs must not return it for the line of the call.
+	if ver, _ := goversion.Parse(runtime.Version()); ver.Major >= 0 && !ver.AfterOrEqual(goversion.GoVersion{1, 10, -1, 0, 0, ""}) {
+		// Versions of go before 1.10 do not have DWARF information for inlined calls
+		t.Skip("inlining not supported")
+	}
+	withTestProcessArgs("testinline", t, ".", []string{}, protest.EnableInlining|protest.EnableOptimization, func(p proc.Process, fixture protest.Fixture) {
+		inlined, err := proc.FindFunctionLocations(p, "main.inlineThis", false, 0)
+		assertNoError(err, t, "FindFunctionLocations(main.inlineThis)")
+		for _, callLine := range []int{18, 19} {
+			pcs, err := p.BinInfo().LinePCs(fixture.Source, callLine)
+			assertNoError(err, t, fmt.Sprintf("LinePCs(%d)", callLine))
+			for _, pc := range pcs {
+				for _, ipc := range inlined {
+					if pc == ipc {
+						t.Errorf("line %d: address %#x of an inlined call returned", callLine, pc)
+					}
+				}
+			}
+		}
+	})
+}
+
 func TestIssue951(t *testing.T) {
 	if ver, _ := goversion.Parse(runtime.Version()); ver.Major >= 0 && !ver.AfterOrEqual(goversion.GoVersion{1, 9, -1, 0, 0, ""}) {
 		t.Skip("scopes not implemented in <=go1.8")
@@ -3920,6 +5409,116 @@ func TestMapLoadConfigWithReslice(t *testing.T) {
 	})
 }
 
+func TestStepOutReturnABI(t *testing.T) {
+	// Return values are read from the stack before Go 1.17 and from
+	// registers (both integer and floating point) on Go 1.17 and later.
+	if !goversion.VersionAfterOrEqual(runtime.Version(), 1, 12) {
+		t.Skip("return variables are not in definition order on 1.11 and earlier")
+	}
+	regabi := goversion.VersionAfterOrEqual(runtime.Version(), 1, 17) && runtime.GOARCH == "amd64"
+	t.Logf("register ABI: %v", regabi)
+	withTestProcess("stepoutretabi", t, func(p proc.Process, fixture protest.Fixture) {
+		_, err := setFunctionBreakpoint(p, "main.multiret")
+		assertNoError(err, t, "SetBreakpoint")
+		assertNoError(proc.Continue(p), t, "Continue")
+		assertNoError(proc.StepOut(p), t, "StepOut")
+		ret := p.CurrentThread().Common().ReturnValues(normalLoadConfig)
+
+		names := []string{"s", "f", "pt", "b", "err"}
+		if len(ret) != len(names) {
+			t.Fatalf("wrong number of return values %v", ret)
+		}
+		for i := range names {
+			if ret[i].Name != names[i] {
+				t.Fatalf("return value %d: wrong name %s, expected %s", i, ret[i].Name, names[i])
+			}
+			if ret[i].Unreadable != nil {
+				t.Fatalf("return value %s unreadable: %v", ret[i].Name, ret[i].Unreadable)
+			}
+		}
+		if s := constant.StringVal(ret[0].Value); s != "multiret 3" {
+			t.Errorf("(s) bad return value %q", s)
+		}
+		if f, _ := constant.Float64Val(ret[1].Value); f != 4.5 {
+			t.Errorf("(f) bad return value %g", f)
+		}
+		if len(ret[2].Children) != 2 {
+			t.Fatalf("(pt) bad return value %v", ret[2].Children)
+		}
+		x, _ := constant.Int64Val(ret[2].Children[0].Value)
+		y, _ := constant.Int64Val(ret[2].Children[1].Value)
+		if x != 3 || y != 4 {
+			t.Errorf("(pt) bad return value {%d, %d}", x, y)
+		}
+		if !constant.BoolVal(ret[3].Value) {
+			t.Errorf("(b) bad return value false")
+		}
+		if ret[4].Kind != reflect.Interface || len(ret[4].Children) != 1 || ret[4].Children[0].Addr != 0 {
+			t.Errorf("(err) bad return value, expected nil interface")
+		}
+	})
+}
+
+func TestFunctionArgumentsAtEntry(t *testing.T) {
+	// At the entry point of a function, before its prologue, the arguments
+	// are still in the registers (on Go 1.17 and later) or at the top of the
+	// stack and must be read correctly.
+	withTestProcess("regabiargs", t, func(p proc.Process, fixture protest.Fixture) {
+		addr, err := proc.FindFunctionLocation(p, "main.manyargs", false, 0)
+		assertNoError(err, t, "FindFunctionLocation")
+		_, err = p.SetBreakpoint(addr, proc.UserBreakpoint, nil)
+		assertNoError(err, t, "SetBreakpoint")
+		assertNoError(proc.Continue(p), t, "Continue")
+		if pc := currentPC(p, t); pc != addr {
+			t.Fatalf("not stopped at function entry %#x: %#x", addr, pc)
+		}
+
+		scope, err := proc.GoroutineScope(p.CurrentThread())
+		assertNoError(err, t, "GoroutineScope")
+		args, err := scope.FunctionArguments(normalLoadConfig)
+		assertNoError(err, t, "FunctionArguments")
+
+		names := []string{"n", "s", "f", "pt", "sl", "b"}
+		if len(args) != len(names) {
+			t.Fatalf("wrong number of arguments %d", len(args))
+		}
+		for i, arg := range args {
+			if arg.Name != names[i] {
+				t.Fatalf("argument %d: wrong name %s, expected %s", i, arg.Name, names[i])
+			}
+			if arg.Unreadable != nil {
+				t.Fatalf("argument %s unreadable: %v", arg.Name, arg.Unreadable)
+			}
+		}
+		if n, _ := constant.Int64Val(args[0].Value); n != 3 {
+			t.Errorf("(n) bad value %d", n)
+		}
+		if s := constant.StringVal(args[1].Value); s != "three" {
+			t.Errorf("(s) bad value %q", s)
+		}
+		if f, _ := constant.Float64Val(args[2].Value); f != 3.5 {
+			t.Errorf("(f) bad value %g", f)
+		}
+		if len(args[3].Children) != 2 {
+			t.Fatalf("(pt) bad value %v", args[3].Children)
+		}
+		x, _ := constant.Int64Val(args[3].Children[0].Value)
+		y, _ := constant.Int64Val(args[3].Children[1].Value)
+		if x != 1 || y != 2 {
+			t.Errorf("(pt) bad value {%d, %d}", x, y)
+		}
+		if args[4].Len != 2 || len(args[4].Children) != 2 {
+			t.Fatalf("(sl) bad value %v", args[4])
+		}
+		if e, _ := constant.Int64Val(args[4].Children[1].Value); e != 5 {
+			t.Errorf("(sl) bad value of sl[1] %d", e)
+		}
+		if !constant.BoolVal(args[5].Value) {
+			t.Errorf("(b) bad value false")
+		}
+	})
+}
+
 func TestStepOutReturn(t *testing.T) {
 	ver, _ := goversion.Parse(runtime.Version())
 	if ver.Major >= 0 && !ver.AfterOrEqual(goversion.GoVersion{1, 10, -1, 0, 0, ""}) {
@@ -4005,7 +5604,7 @@ func TestIssue1264(t *testing.T) {
 func TestReadDefer(t *testing.T) {
 	withTestProcess("deferstack", t, func(p proc.Process, fixture protest.Fixture) {
 		assertNoError(proc.Continue(p), t, "Continue")
-		frames, err := p.SelectedGoroutine().Stacktrace(10, true)
+		frames, err := p.SelectedGoroutine().Stacktrace(10, true, true)
 		assertNoError(err, t, "Stacktrace")
 
 		logStacktrace(t, p.BinInfo(), frames)
@@ -4018,49 +5617,528 @@ func TestReadDefer(t *testing.T) {
 			// main.call3 (defers nothing, topmost defer main.f2)
 			{0, "main.f2", []string{}},
 
-			// main.call2 (defers main.f2, main.f3, topmost defer main.f2)
-			{1, "main.f2", []string{"main.f2", "main.f3"}},
+			// main.call2 (defers main.f2, main.f3, topmost defer main.f2)
+			{1, "main.f2", []string{"main.f2", "main.f3"}},
+
+			// main.call1 (defers main.f1, main.f2, topmost defer main.f1)
+			{2, "main.f1", []string{"main.f1", "main.f2"}},
+
+			// main.main (defers nothing)
+			{3, "", []string{}}}
+
+		defercheck := func(d *proc.Defer, deferName, tgt string, frameIdx int) {
+			if d == nil {
+				t.Fatalf("expected %q as %s of frame %d, got nothing", tgt, deferName, frameIdx)
+			}
+			if d.Unreadable != nil {
+				t.Fatalf("expected %q as %s of frame %d, got unreadable defer: %v", tgt, deferName, frameIdx, d.Unreadable)
+			}
+			_, _, dfn := p.BinInfo().PCToLine(d.DeferredPC)
+			if dfn == nil {
+				t.Fatalf("expected %q as %s of frame %d, got %#x", tgt, deferName, frameIdx, d.DeferredPC)
+			}
+			if dfn.Name != tgt {
+				t.Fatalf("expected %q as %s of frame %d, got %q", tgt, deferName, frameIdx, dfn.Name)
+			}
+		}
+
+		for _, example := range examples {
+			frame := &frames[example.frameIdx]
+
+			if example.topmostDefer != "" {
+				defercheck(frame.TopmostDefer, "topmost defer", example.topmostDefer, example.frameIdx)
+			}
+
+			if len(example.defers) != len(frames[example.frameIdx].Defers) {
+				t.Fatalf("expected %d defers for %d, got %v", len(example.defers), example.frameIdx, frame.Defers)
+			}
+
+			for deferIdx := range example.defers {
+				defercheck(frame.Defers[deferIdx], fmt.Sprintf("defer %d", deferIdx), example.defers[deferIdx], example.frameIdx)
+			}
+		}
+	})
+}
+
+func TestDefers(t *testing.T) {
+	withTestProcess("deferstack", t, func(p proc.Process, fixture protest.Fixture) {
+		assertNoError(proc.Continue(p), t, "Continue")
+		defers, err := proc.Defers(p, -1)
+		assertNoError(err, t, "Defers")
+
+		var names []string
+		for _, d := range defers {
+			if d.Unreadable != nil {
+				t.Fatalf("unreadable defer: %v", d.Unreadable)
+			}
+			if d.DeferredFn == nil {
+				t.Fatalf("could not resolve deferred function %#x", d.DeferredPC)
+			}
+			names = append(names, d.DeferredFn.Name)
+		}
+		// deferred calls are executed in LIFO order
+		expected := []string{"main.f2", "main.f3", "main.f1", "main.f2"}
+		if !reflect.DeepEqual(names, expected) {
+			t.Fatalf("wrong defers %v, expected %v", names, expected)
+		}
+	})
+}
+
+func TestPanicChain(t *testing.T) {
+	withTestProcess("panicchain", t, func(p proc.Process, fixture protest.Fixture) {
+		assertNoError(proc.Continue(p), t, "Continue")
+		panics, err := proc.PanicChain(p, -1)
+		assertNoError(err, t, "PanicChain")
+
+		var args []string
+		for _, pnc := range panics {
+			if pnc.Unreadable != nil {
+				t.Fatalf("unreadable panic: %v", pnc.Unreadable)
+			}
+			if pnc.Recovered {
+				t.Errorf("panic %v marked as recovered", pnc.Arg)
+			}
+			if len(pnc.Arg.Children) != 1 {
+				t.Fatalf("could not read panic argument %v", pnc.Arg)
+			}
+			args = append(args, constant.StringVal(pnc.Arg.Children[0].Value))
+		}
+		expected := []string{"second", "first"}
+		if !reflect.DeepEqual(args, expected) {
+			t.Fatalf("wrong panics %v, expected %v", args, expected)
+		}
+	})
+}
+
+func TestContinueToAddr(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcess("testnextprog", t, func(p proc.Process, fixture protest.Fixture) {
+		text, err := proc.DisassembleFunction(p, nil, "main.helloworld")
+		assertNoError(err, t, "DisassembleFunction")
+		if len(text) < 3 {
+			t.Fatalf("main.helloworld too short: %d instructions", len(text))
+		}
+		// an instruction that is neither the entry point nor a statement
+		// the debugger would stop at.
+		addr := text[len(text)/2].Loc.PC
+
+		bp, err := proc.ContinueToAddr(p, addr)
+		assertNoError(err, t, "ContinueToAddr")
+		if bp == nil || bp.Addr != addr {
+			t.Fatalf("stopped at wrong breakpoint %v", bp)
+		}
+		if pc := currentPC(p, t); pc != addr {
+			t.Fatalf("wrong PC %#x, expected %#x", pc, addr)
+		}
+		if p.Breakpoints().HasInternalBreakpoints() {
+			t.Fatal("temporary breakpoint not removed")
+		}
+
+		// a user breakpoint at the address is kept
+		addr, _, err = p.BinInfo().LineToPC(fixture.Source, 42)
+		assertNoError(err, t, "LineToPC")
+		_, err = p.SetBreakpoint(addr, proc.UserBreakpoint, nil)
+		assertNoError(err, t, "SetBreakpoint")
+		bp, err = proc.ContinueToAddr(p, addr)
+		assertNoError(err, t, "ContinueToAddr")
+		if bp == nil || !bp.IsUser() {
+			t.Fatalf("stopped at wrong breakpoint %v", bp)
+		}
+		if _, ok := p.Breakpoints().M[addr]; !ok {
+			t.Fatal("user breakpoint removed")
+		}
+	})
+}
+
+func TestContinueAndBacktrace(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcess("testnextprog", t, func(p proc.Process, fixture protest.Fixture) {
+		bp, err := setFunctionBreakpoint(p, "main.helloworld")
+		assertNoError(err, t, "setFunctionBreakpoint")
+		hitbp, frames, err := proc.ContinueAndBacktrace(p, 10)
+		assertNoError(err, t, "ContinueAndBacktrace")
+		if hitbp != bp {
+			t.Fatalf("stopped at wrong breakpoint %v", hitbp)
+		}
+		expected, err := proc.ThreadStacktrace(p.CurrentThread(), 10, true)
+		assertNoError(err, t, "ThreadStacktrace")
+		if len(frames) != len(expected) {
+			t.Fatalf("got %d frames expected %d", len(frames), len(expected))
+		}
+		for i := range frames {
+			if frames[i].Current.PC != expected[i].Current.PC || frames[i].Regs.CFA != expected[i].Regs.CFA {
+				t.Errorf("frame %d: got %#x %#x expected %#x %#x", i, frames[i].Current.PC, frames[i].Regs.CFA, expected[i].Current.PC, expected[i].Regs.CFA)
+			}
+		}
+
+		_, err = p.ClearBreakpoint(bp.Addr)
+		assertNoError(err, t, "ClearBreakpoint")
+		_, frames, err = proc.ContinueAndBacktrace(p, 10)
+		if _, exited := err.(proc.ErrProcessExited); !exited {
+			t.Fatalf("expected ErrProcessExited, got %v", err)
+		}
+		if frames != nil {
+			t.Fatalf("stacktrace returned after exit: %v", frames)
+		}
+	})
+}
+
+func TestResume(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcess("testnextprog", t, func(p proc.Process, fixture protest.Fixture) {
+		var tracepoints []*proc.Breakpoint
+		for _, fname := range []string{"main.testnext", "main.sleepytime"} {
+			bp, err := setFunctionBreakpoint(p, fname)
+			assertNoError(err, t, "setFunctionBreakpoint")
+			bp.Flags |= proc.BreakpointTracepoint
+			tracepoints = append(tracepoints, bp)
+		}
+		bp, err := setFunctionBreakpoint(p, "main.helloworld")
+		assertNoError(err, t, "setFunctionBreakpoint")
+
+		// main.testnext calls main.sleepytime twice before main.helloworld
+		stop, err := proc.Resume(p)
+		assertNoError(err, t, "Resume")
+		if stop.Breakpoint != bp {
+			t.Fatalf("stopped at wrong breakpoint %v", stop.Breakpoint)
+		}
+		if stop.Thread.ThreadID() != p.CurrentThread().ThreadID() {
+			t.Fatalf("wrong thread %d, current thread %d", stop.Thread.ThreadID(), p.CurrentThread().ThreadID())
+		}
+		expected := []*proc.Breakpoint{tracepoints[0], tracepoints[1], tracepoints[1]}
+		if len(stop.Tracepoints) != len(expected) {
+			t.Fatalf("wrong tracepoint hits %v", stop.Tracepoints)
+		}
+		for i := range expected {
+			if stop.Tracepoints[i] != expected[i] {
+				t.Fatalf("wrong tracepoint hit %d: %s, expected %s", i, stop.Tracepoints[i].FunctionName, expected[i].FunctionName)
+			}
+		}
+		if loc, err := p.CurrentThread().Location(); err != nil || loc.Fn == nil || loc.Fn.Name != "main.helloworld" {
+			t.Fatalf("wrong location %v %v", loc, err)
+		}
+	})
+}
+
+func TestContinueAsync(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcess("loopprog", t, func(p proc.Process, fixture protest.Fixture) {
+		resumeChan := make(chan struct{}, 1)
+		p.ResumeNotify(resumeChan)
+		stopChan := proc.ContinueAsync(p)
+		<-resumeChan
+
+		// the target can not be resumed again while it is running
+		if err := proc.Continue(p); err != proc.ErrProcessRunning {
+			t.Fatalf("expected ErrProcessRunning from Continue, got %v", err)
+		}
+		if stop := <-proc.ContinueAsync(p); stop.Err != proc.ErrProcessRunning {
+			t.Fatalf("expected ErrProcessRunning from ContinueAsync, got %v", stop.Err)
+		}
+
+		time.Sleep(100 * time.Millisecond)
+		assertNoError(proc.Pause(p), t, "Pause")
+		stop, ok := <-stopChan
+		if !ok {
+			t.Fatal("channel closed without a stop")
+		}
+		assertNoError(stop.Err, t, "ContinueAsync")
+		if stop.Breakpoint != nil {
+			t.Fatalf("stopped at breakpoint %v", stop.Breakpoint)
+		}
+		if _, ok := <-stopChan; ok {
+			t.Fatal("more than one stop sent")
+		}
+		if _, err := p.CurrentThread().Registers(false); err != nil {
+			t.Fatalf("target not stopped: %v", err)
+		}
+
+		// once stopped the target can be resumed normally
+		bp, err := setFunctionBreakpoint(p, "fmt.Println")
+		assertNoError(err, t, "setFunctionBreakpoint")
+		assertNoError(proc.Continue(p), t, "Continue")
+		if th := p.CurrentThread(); th.Breakpoint().Breakpoint != bp {
+			t.Fatalf("stopped at wrong breakpoint %v", th.Breakpoint().Breakpoint)
+		}
+	})
+}
+
+func TestStacktraceInlined(t *testing.T) {
+	if ver, _ := goversion.Parse(runtime.Version()); ver.Major >= 0 && !ver.AfterOrEqual(goversion.GoVersion{1, 10, -1, 0, 0, ""}) {
+		// Versions of go before 1.10 do not have DWARF information for inlined calls
+		t.Skip("inlining not supported")
+	}
+	protest.AllowRecording(t)
+	withTestProcessArgs("testinline", t, ".", []string{}, protest.EnableInlining, func(p proc.Process, fixture protest.Fixture) {
+		pcs := p.BinInfo().AllPCsForFileLine(fixture.Source, 7)
+		if len(pcs) < 2 {
+			t.Fatalf("expected at least two locations for %s:%d (got %d: %#x)", fixture.Source, 7, len(pcs), pcs)
+		}
+		for _, pc := range pcs {
+			_, err := p.SetBreakpoint(pc, proc.UserBreakpoint, nil)
+			assertNoError(err, t, fmt.Sprintf("SetBreakpoint(%#x)", pc))
+		}
+
+		assertNoError(proc.Continue(p), t, "Continue")
+
+		// the inlined call and the function containing it are both listed
+		frames, err := proc.ThreadStacktrace(p.CurrentThread(), 20, true)
+		assertNoError(err, t, "ThreadStacktrace")
+		if err := checkFrame(frames[0], "main.inlineThis", fixture.Source, 7, true); err != nil {
+			t.Fatalf("Wrong frame 0: %v", err)
+		}
+		if err := checkFrame(frames[1], "main.main", fixture.Source, 18, false); err != nil {
+			t.Fatalf("Wrong frame 1: %v", err)
+		}
+
+		// without inlined calls the first frame is main.main, at the line of
+		// the inlined function its PC belongs to
+		threadFrames, err := proc.ThreadStacktrace(p.CurrentThread(), 20, false)
+		assertNoError(err, t, "ThreadStacktrace")
+		gFrames, err := p.SelectedGoroutine().Stacktrace(20, false, false)
+		assertNoError(err, t, "Stacktrace")
+		for _, frames := range [][]proc.Stackframe{threadFrames, gFrames} {
+			if err := checkFrame(frames[0], "main.main", fixture.Source, 7, false); err != nil {
+				t.Fatalf("Wrong frame 0: %v", err)
+			}
+			for i := range frames {
+				if frames[i].Inlined {
+					t.Fatalf("inlined frame %d returned", i)
+				}
+			}
+		}
+	})
+}
+
+func TestGoroutineTopFrame(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcess("goroutinestackprog", t, func(p proc.Process, fixture protest.Fixture) {
+		_, err := setFunctionBreakpoint(p, "main.stacktraceme")
+		assertNoError(err, t, "setFunctionBreakpoint")
+		assertNoError(proc.Continue(p), t, "Continue")
+
+		loc, err := proc.GoroutineTopFrame(p, p.SelectedGoroutine().ID)
+		assertNoError(err, t, "GoroutineTopFrame")
+		if loc.Fn == nil || loc.Fn.Name != "main.stacktraceme" {
+			t.Fatalf("wrong top frame for the current goroutine %#x %v", loc.PC, loc.Fn)
+		}
+
+		gs, _, err := proc.GoroutinesInfo(p, 0, 0)
+		assertNoError(err, t, "GoroutinesInfo")
+		found := 0
+		for _, g := range gs {
+			// goroutines started by the go statement running agoroutine.
+			if goloc := g.Go(); goloc.File != fixture.Source || goloc.Line != 23 {
+				continue
+			}
+			found++
+			// agoroutine is blocked sending to done.
+			loc, err := proc.GoroutineTopFrame(p, g.ID)
+			assertNoError(err, t, "GoroutineTopFrame")
+			if loc.PC != g.PC || loc.Fn == nil || loc.Fn.Name != "runtime.gopark" {
+				t.Errorf("wrong top frame for goroutine %d %#x %v", g.ID, loc.PC, loc.Fn)
+			}
+			if uloc := g.UserCurrent(); uloc.File != fixture.Source || uloc.Line != 9 {
+				t.Errorf("goroutine %d blocked at %s:%d", g.ID, uloc.File, uloc.Line)
+			}
+		}
+		if found == 0 {
+			t.Fatal("no goroutine running main.agoroutine")
+		}
+	})
+}
+
+func TestGoroutineStackUsage(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcess("deeprecursion", t, func(p proc.Process, fixture protest.Fixture) {
+		_, err := setFunctionBreakpoint(p, "main.leaf")
+		assertNoError(err, t, "setFunctionBreakpoint")
+
+		usage := func() (used, total uint64) {
+			used, total, err := proc.GoroutineStackUsage(p, p.SelectedGoroutine().ID)
+			assertNoError(err, t, "GoroutineStackUsage")
+			if used == 0 || used > total {
+				t.Fatalf("wrong stack usage %d of %d", used, total)
+			}
+			return used, total
+		}
+
+		// leaf is called by main first and then at the bottom of recurse.
+		assertNoError(proc.Continue(p), t, "Continue")
+		used1, _ := usage()
+		assertNoError(proc.Continue(p), t, "Continue")
+		used2, _ := usage()
+		if used2 < used1+1000*64 {
+			t.Fatalf("used stack did not grow in recurse: %d -> %d", used1, used2)
+		}
+	})
+}
+
+func TestStackMap(t *testing.T) {
+	if !goversion.VersionAfterOrEqual(runtime.Version(), 1, 18) {
+		t.Skip("stack maps can only be read from executables built with go 1.18 or later")
+	}
+	withTestProcess("stackmapprog", t, func(p proc.Process, fixture protest.Fixture) {
+		_, err := setFunctionBreakpoint(p, "main.g")
+		assertNoError(err, t, "setFunctionBreakpoint")
+		assertNoError(proc.Continue(p), t, "Continue")
+
+		frames, err := proc.ThreadStacktrace(p.CurrentThread(), 2, true)
+		assertNoError(err, t, "ThreadStacktrace")
+		if len(frames) < 2 || frames[1].Current.Fn == nil || frames[1].Current.Fn.Name != "main.f" {
+			t.Fatalf("wrong caller %v", frames)
+		}
+		// stack maps of callers are looked up at their return address.
+		info, err := proc.StackMap(p, frames[1].Current.PC)
+		assertNoError(err, t, "StackMap")
+		if info.Function.Name != "main.f" || info.Index < 0 {
+			t.Fatalf("wrong stack map info %#v", info)
+		}
+
+		scope, err := proc.ConvertEvalScope(p, -1, 1, 0)
+		assertNoError(err, t, "ConvertEvalScope")
+		isPointer := func(name string) bool {
+			v, err := scope.EvalVariable(name, normalLoadConfig)
+			assertNoError(err, t, "EvalVariable("+name+")")
+			slot := (int64(v.Addr) - frames[1].Regs.CFA - info.LocalsOffset) / int64(p.BinInfo().Arch.PtrSize())
+			// the compiler places the variables without pointers below the
+			// area described by the bitmap.
+			if slot < 0 || slot >= int64(len(info.Locals)) {
+				return false
+			}
+			return info.Locals[slot]
+		}
+		if !isPointer("p") {
+			t.Errorf("p is not a pointer in the stack map %v", info.Locals)
+		}
+		if isPointer("n") {
+			t.Errorf("n is a pointer in the stack map %v", info.Locals)
+		}
+	})
+}
+
+func TestWithBreakpointsCleared(t *testing.T) {
+	withTestProcess("testnextprog", t, func(p proc.Process, fixture protest.Fixture) {
+		bp, err := setFunctionBreakpoint(p, "main.helloworld")
+		assertNoError(err, t, "setFunctionBreakpoint")
+		if len(bp.OriginalData) == 0 {
+			t.Skip("backend does not write breakpoints into memory")
+		}
+		readInstr := func() []byte {
+			buf := make([]byte, len(bp.OriginalData))
+			_, err := p.CurrentThread().ReadMemory(buf, uintptr(bp.Addr))
+			assertNoError(err, t, "ReadMemory")
+			return buf
+		}
+		bpinstr := p.BinInfo().Arch.BreakpointInstruction()
+
+		errFn := errors.New("fn failed")
+		err = proc.WithBreakpointsCleared(p, func() error {
+			if buf := readInstr(); !bytes.Equal(buf, bp.OriginalData) {
+				t.Errorf("breakpoint not cleared: %x, original data %x", buf, bp.OriginalData)
+			}
+			return errFn
+		})
+		if err != errFn {
+			t.Fatalf("wrong error %v", err)
+		}
+		if buf := readInstr(); !bytes.Equal(buf[:len(bpinstr)], bpinstr) {
+			t.Fatalf("breakpoint not restored: %x", buf)
+		}
+		if _, ok := p.Breakpoints().M[bp.Addr]; !ok {
+			t.Fatal("breakpoint removed")
+		}
+	})
+}
 
-			// main.call1 (defers main.f1, main.f2, topmost defer main.f1)
-			{2, "main.f1", []string{"main.f1", "main.f2"}},
+func TestTypeByName(t *testing.T) {
+	withTestProcess("testvariables2", t, func(p proc.Process, fixture protest.Fixture) {
+		typ, err := p.BinInfo().TypeByName("main.B")
+		assertNoError(err, t, "TypeByName(main.B)")
+		if typ.Name != "main.B" || typ.Kind != reflect.Struct || typ.Size != 32 {
+			t.Fatalf("wrong type %s %v size %d", typ.Name, typ.Kind, typ.Size)
+		}
+		expected := []proc.TypeField{
+			{Name: "A", Type: "main.A", Offset: 0, Size: 8},
+			{Name: "C", Type: "*main.C", Offset: 8, Size: 8},
+			{Name: "a", Type: "main.A", Offset: 16, Size: 8},
+			{Name: "ptr", Type: "*main.A", Offset: 24, Size: 8},
+		}
+		if !reflect.DeepEqual(typ.Fields, expected) {
+			t.Fatalf("wrong fields %v, expected %v", typ.Fields, expected)
+		}
 
-			// main.main (defers nothing)
-			{3, "", []string{}}}
+		typ, err = p.BinInfo().TypeByName("*main.astruct")
+		assertNoError(err, t, "TypeByName(*main.astruct)")
+		if typ.Kind != reflect.Ptr || typ.Elem != "main.astruct" || typ.Size != 8 {
+			t.Fatalf("wrong pointer type %s %v elem %s size %d", typ.Name, typ.Kind, typ.Elem, typ.Size)
+		}
 
-		defercheck := func(d *proc.Defer, deferName, tgt string, frameIdx int) {
-			if d == nil {
-				t.Fatalf("expected %q as %s of frame %d, got nothing", tgt, deferName, frameIdx)
-			}
-			if d.Unreadable != nil {
-				t.Fatalf("expected %q as %s of frame %d, got unreadable defer: %v", tgt, deferName, frameIdx, d.Unreadable)
-			}
-			_, _, dfn := p.BinInfo().PCToLine(d.DeferredPC)
-			if dfn == nil {
-				t.Fatalf("expected %q as %s of frame %d, got %#x", tgt, deferName, frameIdx, d.DeferredPC)
-			}
-			if dfn.Name != tgt {
-				t.Fatalf("expected %q as %s of frame %d, got %q", tgt, deferName, frameIdx, dfn.Name)
-			}
+		if _, err := p.BinInfo().TypeByName("main.nonexistent"); err == nil {
+			t.Fatal("no error for a type that doesn't exist")
 		}
+	})
+}
 
-		for _, example := range examples {
-			frame := &frames[example.frameIdx]
+func TestBinaryOptimized(t *testing.T) {
+	for _, tc := range []struct {
+		flags     protest.BuildFlags
+		optimized bool
+	}{
+		{0, false},
+		{protest.EnableOptimization, true},
+		{protest.EnableOptimization | protest.EnableInlining, true},
+	} {
+		fixture := protest.BuildFixture("testnextprog", tc.flags)
+		bi := proc.NewBinaryInfo(runtime.GOOS, runtime.GOARCH)
+		assertNoError(bi.LoadBinaryInfo(fixture.Path, 0, nil), t, "LoadBinaryInfo")
+		if bi.Optimized() != tc.optimized {
+			t.Errorf("flags %#x: Optimized() = %v, expected %v (producer %q)", tc.flags, bi.Optimized(), tc.optimized, bi.Producer())
+		}
+	}
+}
 
-			if example.topmostDefer != "" {
-				defercheck(frame.TopmostDefer, "topmost defer", example.topmostDefer, example.frameIdx)
+func TestPanicRecovered(t *testing.T) {
+	withTestProcess("panicchain", t, func(p proc.Process, fixture protest.Fixture) {
+		// the second breakpoint is after the call to recover in the function
+		// deferred by handlefirst, which recovers the most recent panic.
+		assertNoError(proc.Continue(p), t, "Continue")
+		assertNoError(proc.Continue(p), t, "Continue")
+		panics, err := proc.PanicChain(p, -1)
+		assertNoError(err, t, "PanicChain")
+		if len(panics) != 2 {
+			t.Fatalf("wrong number of panics %d", len(panics))
+		}
+		for i, recovered := range []bool{true, false} {
+			if panics[i].Unreadable != nil {
+				t.Fatalf("unreadable panic: %v", panics[i].Unreadable)
 			}
-
-			if len(example.defers) != len(frames[example.frameIdx].Defers) {
-				t.Fatalf("expected %d defers for %d, got %v", len(example.defers), example.frameIdx, frame.Defers)
+			if panics[i].Recovered != recovered {
+				t.Errorf("panic %d: recovered %v, expected %v", i, panics[i].Recovered, recovered)
 			}
-
-			for deferIdx := range example.defers {
-				defercheck(frame.Defers[deferIdx], fmt.Sprintf("defer %d", deferIdx), example.defers[deferIdx], example.frameIdx)
+			if panics[i].Aborted {
+				t.Errorf("panic %d marked as aborted", i)
 			}
 		}
 	})
 }
 
+func TestMemStats(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcess("testvariables2", t, func(p proc.Process, fixture protest.Fixture) {
+		assertNoError(proc.Continue(p), t, "Continue()")
+		stats, err := proc.MemStats(p)
+		assertNoError(err, t, "MemStats()")
+		t.Logf("HeapAlloc=%d HeapSys=%d NumGC=%d PauseTotalNs=%d", stats.HeapAlloc, stats.HeapSys, stats.NumGC, stats.PauseTotalNs)
+		if stats.HeapAlloc == 0 {
+			t.Errorf("HeapAlloc is zero")
+		}
+		if stats.HeapSys < stats.HeapAlloc {
+			t.Errorf("HeapSys (%d) is smaller than HeapAlloc (%d)", stats.HeapSys, stats.HeapAlloc)
+		}
+	})
+}
+
 func TestNextUnknownInstr(t *testing.T) {
 	if !goversion.VersionAfterOrEqual(runtime.Version(), 1, 10) {
 		t.Skip("versions of Go before 1.10 can't assemble the instruction VPUNPCKLWD")
@@ -4199,7 +6277,7 @@ func TestIssue1469(t *testing.T) {
 				t.Logf("too many threads running goroutine %d", gid)
 				for _, thread := range gid2thread[gid] {
 					t.Logf("\tThread %d", thread.ThreadID())
-					frames, err := proc.ThreadStacktrace(thread, 20)
+					frames, err := proc.ThreadStacktrace(thread, 20, true)
 					if err != nil {
 						t.Logf("\t\tcould not get stacktrace %v", err)
 					}
@@ -4366,3 +6444,428 @@ func TestPluginStepping(t *testing.T) {
 		{contNext, "plugin2.go:26"},
 		{contNext, "plugintest2.go:42"}})
 }
+
+func TestSchedulerStructs(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcess("schedprog", t, func(p proc.Process, fixture protest.Fixture) {
+		assertNoError(proc.Continue(p), t, "Continue()")
+
+		ps, err := proc.Processors(p)
+		assertNoError(err, t, "Processors()")
+		if len(ps) != 3 {
+			t.Fatalf("wrong number of Ps, expected 3 (GOMAXPROCS) got %d", len(ps))
+		}
+		for _, pp := range ps {
+			t.Logf("P %d status %d runq %d m %d", pp.ID, pp.Status, pp.RunqLen, pp.M)
+		}
+
+		ms, err := proc.Threads(p)
+		assertNoError(err, t, "Threads()")
+		found := false
+		for _, m := range ms {
+			t.Logf("M %d thread %d curg %d p %d", m.ID, m.ThreadID, m.CurG, m.P)
+			if m.CurG == p.SelectedGoroutine().ID {
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("could not find M running goroutine %d", p.SelectedGoroutine().ID)
+		}
+	})
+}
+
+func TestReadCString(t *testing.T) {
+	if os.Getenv("CGO_ENABLED") == "" {
+		return
+	}
+	protest.AllowRecording(t)
+	withTestProcess("cgocstring", t, func(p proc.Process, fixture protest.Fixture) {
+		assertNoError(proc.Continue(p), t, "Continue()")
+		cs := evalVariable(p, t, "cs")
+		if len(cs.Children) != 1 {
+			t.Fatalf("could not dereference cs: %#v", cs)
+		}
+		addr := uint64(cs.Children[0].Addr)
+
+		s, err := proc.ReadCString(p.CurrentThread(), addr, 100)
+		assertNoError(err, t, "ReadCString")
+		if s != "hello, world!" {
+			t.Fatalf("wrong string read: %q", s)
+		}
+
+		s, err = proc.ReadCString(p.CurrentThread(), addr, 5)
+		assertNoError(err, t, "ReadCString (truncated)")
+		if s != "hello" {
+			t.Fatalf("wrong truncated string read: %q", s)
+		}
+
+		if _, err := proc.ReadCString(p.CurrentThread(), 0, 100); err == nil {
+			t.Fatal("expected error reading nil C string")
+		}
+		if _, err := proc.ReadCString(p.CurrentThread(), 0x10, 100); err == nil {
+			t.Fatal("expected error reading C string from unmapped memory")
+		}
+	})
+}
+
+func TestBreakFirstHit(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcess("firsthit", t, func(p proc.Process, fixture protest.Fixture) {
+		bp, err := proc.BreakFirstHit(p, "main.work")
+		assertNoError(err, t, "BreakFirstHit")
+		assertNoError(proc.Continue(p), t, "Continue()")
+
+		if curbp := p.CurrentThread().Breakpoint(); curbp.Breakpoint != bp {
+			t.Fatalf("not stopped at first hit breakpoint: %v", curbp.Breakpoint)
+		}
+		if _, ok := p.Breakpoints().M[bp.Addr]; ok {
+			t.Fatal("temporary breakpoint not cleared after first hit")
+		}
+		stopped := 0
+		for _, th := range p.ThreadList() {
+			if thbp := th.Breakpoint(); thbp.Breakpoint == bp && thbp.Active {
+				stopped++
+			}
+		}
+		if stopped != 1 || bp.TotalHitCount != 1 {
+			t.Fatalf("expected exactly one stop, got %d threads stopped (hit count %d)", stopped, bp.TotalHitCount)
+		}
+
+		err = proc.Continue(p)
+		if _, exited := err.(proc.ErrProcessExited); !exited {
+			t.Fatalf("expected process to exit after clearing the breakpoint: %v", err)
+		}
+	})
+}
+
+func TestBreakpointFlagsBehavior(t *testing.T) {
+	// User breakpoints stop and are kept, temporary breakpoints stop and
+	// are cleared, Resume does not stop at tracepoints, breakpoints whose
+	// condition is false never stop and internal breakpoints stop and are
+	// cleared.
+	protest.AllowRecording(t)
+	withTestProcess("testnextprog", t, func(p proc.Process, fixture protest.Fixture) {
+		user, err := setFunctionBreakpoint(p, "main.sleepytime")
+		assertNoError(err, t, "setFunctionBreakpoint(main.sleepytime)")
+		trace, err := setFunctionBreakpoint(p, "main.helloworld")
+		assertNoError(err, t, "setFunctionBreakpoint(main.helloworld)")
+		trace.Flags |= proc.BreakpointTracepoint
+		temp, err := proc.BreakFirstHit(p, "main.testgoroutine")
+		assertNoError(err, t, "BreakFirstHit(main.testgoroutine)")
+		cond := setFileBreakpoint(p, t, fixture, 24)
+		cond.Cond = &ast.Ident{Name: "false"}
+
+		// line 24 is executed before each call of main.sleepytime
+		for i := 0; i < 2; i++ {
+			assertNoError(proc.Continue(p), t, "Continue()")
+			if bp := p.CurrentThread().Breakpoint().Breakpoint; bp != user {
+				t.Fatalf("hit %d: stopped at %v instead of main.sleepytime", i, bp)
+			}
+		}
+
+		sr, err := proc.Resume(p)
+		assertNoError(err, t, "Resume()")
+		if sr.Breakpoint != temp {
+			t.Fatalf("stopped at %v instead of main.testgoroutine", sr.Breakpoint)
+		}
+		if len(sr.Tracepoints) != 1 || sr.Tracepoints[0] != trace {
+			t.Fatalf("wrong tracepoints %v", sr.Tracepoints)
+		}
+		if _, ok := p.Breakpoints().M[temp.Addr]; ok {
+			t.Fatal("temporary breakpoint not cleared")
+		}
+		for _, bp := range []*proc.Breakpoint{user, trace, cond} {
+			if _, ok := p.Breakpoints().M[bp.Addr]; !ok {
+				t.Fatalf("breakpoint %v cleared", bp)
+			}
+		}
+
+		assertNoError(proc.Next(p), t, "Next()")
+		if p.Breakpoints().HasInternalBreakpoints() {
+			t.Fatal("internal breakpoints not cleared after Next")
+		}
+	})
+}
+
+func TestBreakpointAt(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcess("testprog", t, func(p proc.Process, fixture protest.Fixture) {
+		bp, err := setFunctionBreakpoint(p, "main.helloworld")
+		assertNoError(err, t, "setFunctionBreakpoint()")
+
+		found, ok := p.Breakpoints().BreakpointAt(bp.Addr)
+		if !ok || found != bp {
+			t.Fatalf("wrong breakpoint at %#x: %v %v", bp.Addr, found, ok)
+		}
+		if found, ok := p.Breakpoints().BreakpointAt(bp.Addr + 1); ok {
+			t.Fatalf("unexpected breakpoint at %#x: %v", bp.Addr+1, found)
+		}
+
+		_, err = p.ClearBreakpoint(bp.Addr)
+		assertNoError(err, t, "ClearBreakpoint()")
+		if found, ok := p.Breakpoints().BreakpointAt(bp.Addr); ok {
+			t.Fatalf("breakpoint still found at %#x after clearing: %v", bp.Addr, found)
+		}
+	})
+}
+
+func TestBreakpointsInFunction(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcess("testnextprog", t, func(p proc.Process, fixture protest.Fixture) {
+		fnbp, err := setFunctionBreakpoint(p, "main.testnext")
+		assertNoError(err, t, "setFunctionBreakpoint()")
+		linebp := setFileLineBreakpoint(p, t, fixture.Source, 24)
+		_, err = setFunctionBreakpoint(p, "main.helloworld")
+		assertNoError(err, t, "setFunctionBreakpoint()")
+
+		bps, err := proc.BreakpointsInFunction(p, "main.testnext")
+		assertNoError(err, t, "BreakpointsInFunction()")
+		if len(bps) != 2 || bps[0] != fnbp || bps[1] != linebp {
+			t.Fatalf("wrong breakpoints in main.testnext %v, expected %v and %v", bps, fnbp, linebp)
+		}
+
+		if _, err := proc.BreakpointsInFunction(p, "main.nonexistent"); err == nil {
+			t.Fatal("expected error for nonexistent function")
+		}
+	})
+}
+
+func TestGoroutineWaitReason(t *testing.T) {
+	// The goroutines started by chanwaiters are blocked on a channel send
+	// and a channel receive respectively.
+	protest.AllowRecording(t)
+	withTestProcess("chanwaiters", t, func(p proc.Process, fixture protest.Fixture) {
+		assertNoError(proc.Continue(p), t, "Continue()")
+		gs, _, err := proc.GoroutinesInfo(p, 0, 0)
+		assertNoError(err, t, "GoroutinesInfo")
+		found := map[string]bool{}
+		for _, g := range gs {
+			startfn := g.StartLoc().Fn
+			if startfn == nil {
+				continue
+			}
+			var wantReason string
+			var wantLine int
+			switch startfn.Name {
+			case "main.main.func1":
+				wantReason, wantLine = "chan send", 14
+			case "main.main.func2":
+				wantReason, wantLine = "chan receive", 18
+			default:
+				continue
+			}
+			found[startfn.Name] = true
+			if status := g.StatusString(); status != "waiting" {
+				t.Errorf("goroutine %d (%s): wrong status %q", g.ID, startfn.Name, status)
+			}
+			if g.WaitReason != wantReason {
+				t.Errorf("goroutine %d (%s): wrong wait reason %q, expected %q", g.ID, startfn.Name, g.WaitReason, wantReason)
+			}
+			if goloc := g.Go(); goloc.Line != wantLine {
+				t.Errorf("goroutine %d (%s): wrong go statement location %s:%d, expected line %d", g.ID, startfn.Name, goloc.File, goloc.Line, wantLine)
+			}
+		}
+		if len(found) != 2 {
+			t.Fatalf("could not find all goroutines: %v", found)
+		}
+	})
+}
+
+func TestGoroutineStatus(t *testing.T) {
+	for _, tc := range []struct {
+		status uint64
+		want   string
+	}{
+		{proc.Grunning, "running"},
+		{proc.Gwaiting, "waiting"},
+		{0x1000 | proc.Gwaiting, "waiting"}, // gscan bit set
+		{proc.Gpreempted, "preempted"},
+		{100, "status(100)"},
+	} {
+		if s := (&proc.G{Status: tc.status}).StatusString(); s != tc.want {
+			t.Errorf("status %#x: got %q, expected %q", tc.status, s, tc.want)
+		}
+	}
+
+	protest.AllowRecording(t)
+	withTestProcess("chanwaiters", t, func(p proc.Process, fixture protest.Fixture) {
+		assertNoError(proc.Continue(p), t, "Continue()")
+		// the main goroutine is stopped at runtime.Breakpoint on its thread
+		if g := p.SelectedGoroutine(); g == nil || g.StatusString() != "running" {
+			t.Fatalf("wrong status of the selected goroutine %#v", g)
+		}
+		gs, _, err := proc.GoroutinesInfo(p, 0, 0)
+		assertNoError(err, t, "GoroutinesInfo")
+		found := false
+		for _, g := range gs {
+			if startfn := g.StartLoc().Fn; startfn != nil && startfn.Name == "main.main.func1" {
+				found = true
+				if status := g.StatusString(); status != "waiting" {
+					t.Errorf("goroutine %d blocked on a channel send: wrong status %q", g.ID, status)
+				}
+			}
+		}
+		if !found {
+			t.Fatal("could not find goroutine blocked on a channel send")
+		}
+	})
+}
+
+func TestStepOverRuntimeCall(t *testing.T) {
+	// Stepping over a map assignment must not stop inside runtime.mapassign.
+	testseq2(t, "stepruntime", "", []seqTest{
+		{contContinue, 7},
+		{contStep, 8},
+	})
+}
+
+func TestStepIntoHidden(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcess("stepruntime", t, func(p proc.Process, fixture protest.Fixture) {
+		setFileLineBreakpoint(p, t, fixture.Source, 7)
+		assertNoError(proc.Continue(p), t, "Continue()")
+		p.Common().SetStepIntoHidden(true)
+		assertNoError(proc.Step(p), t, "Step()")
+		loc, err := p.CurrentThread().Location()
+		assertNoError(err, t, "Location()")
+		if loc.Fn == nil || !strings.HasPrefix(loc.Fn.Name, "runtime.mapassign") {
+			t.Fatalf("Step did not stop inside runtime.mapassign: %s:%d %v", loc.File, loc.Line, loc.Fn)
+		}
+	})
+}
+
+func TestStepBudget(t *testing.T) {
+	// The goroutine started by spinloop loops forever inside main.spin, the
+	// main goroutine sleeps inside the same loop.
+	protest.AllowRecording(t)
+	withTestProcess("spinloop", t, func(p proc.Process, fixture protest.Fixture) {
+		setFileLineBreakpoint(p, t, fixture.Source, 14)
+		assertNoError(proc.Continue(p), t, "Continue()")
+		assertLineNumber(p, t, 14, "Continue()")
+
+		checkBudgetErr := func(err error, steps int, op string) {
+			t.Helper()
+			budgetErr, ok := err.(*proc.ErrStepBudgetExceeded)
+			if !ok {
+				t.Fatalf("%s: expected ErrStepBudgetExceeded, got %v", op, err)
+			}
+			if budgetErr.Steps != steps {
+				t.Fatalf("%s: wrong step budget %d, expected %d", op, budgetErr.Steps, steps)
+			}
+			if loc := budgetErr.Location; loc == nil || loc.Fn == nil || loc.Fn.Name != "main.spin" {
+				t.Fatalf("%s: wrong location %v, expected main.spin", op, budgetErr.Location)
+			}
+		}
+
+		// while the main goroutine sleeps the other goroutine keeps hitting
+		// the breakpoints set by Next.
+		p.Common().SetStepBudget(100)
+		checkBudgetErr(proc.Next(p), 100, "Next()")
+		if p.Breakpoints().HasInternalBreakpoints() {
+			t.Fatal("internal breakpoints left after exceeding the step budget")
+		}
+
+		// the current thread is now the one running the infinite loop.
+		fn := p.BinInfo().LookupFunc["main.spin"]
+		p.Common().SetStepBudget(1000)
+		_, err := proc.StepUntilOutOfRange(p, fn.Entry, fn.End)
+		checkBudgetErr(err, 1000, "StepUntilOutOfRange()")
+	})
+}
+
+func TestTracepointSamples(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcess("testnextprog", t, func(p proc.Process, fixture protest.Fixture) {
+		tp := setFileLineBreakpoint(p, t, fixture.Source, 24)
+		tp.Flags |= proc.BreakpointTracepoint
+		tp.SampleVariables = []string{"i", "nonexistent"}
+		_, err := setFunctionBreakpoint(p, "main.helloworld")
+		assertNoError(err, t, "setFunctionBreakpoint")
+
+		// the loop of main.testnext breaks out when i is 2
+		_, err = proc.Resume(p)
+		assertNoError(err, t, "Resume")
+		if len(tp.Samples) != 3 {
+			t.Fatalf("wrong number of samples %d, expected 3", len(tp.Samples))
+		}
+		for i, sample := range tp.Samples {
+			if len(sample.Values) != 2 {
+				t.Fatalf("wrong number of values in sample %d: %d", i, len(sample.Values))
+			}
+			v := sample.Values[0]
+			if v.Unreadable != nil {
+				t.Fatalf("sample %d: could not read i: %v", i, v.Unreadable)
+			}
+			if n, _ := constant.Int64Val(v.Value); n != int64(i) {
+				t.Fatalf("sample %d: wrong value of i %d", i, n)
+			}
+			if sample.Values[1].Unreadable == nil {
+				t.Fatalf("sample %d: expected nonexistent to be unreadable", i)
+			}
+			if sample.GoroutineID != 1 {
+				t.Fatalf("sample %d: wrong goroutine %d", i, sample.GoroutineID)
+			}
+			if i > 0 && sample.Time.Before(tp.Samples[i-1].Time) {
+				t.Fatalf("sample %d recorded before sample %d", i, i-1)
+			}
+		}
+	})
+}
+
+func TestStuckGoroutines(t *testing.T) {
+	// The two goroutines started by deadlock each hold one mutex while
+	// waiting for the other one, the main goroutine keeps running and the
+	// goroutine running main.progress waits at two different places.
+	protest.AllowRecording(t)
+	withTestProcess("deadlock", t, func(p proc.Process, fixture protest.Fixture) {
+		assertNoError(proc.Continue(p), t, "Continue()")
+		gs, err := proc.StuckGoroutines(p, 200*time.Millisecond)
+		assertNoError(err, t, "StuckGoroutines")
+		if len(gs) != 2 {
+			for _, g := range gs {
+				t.Logf("goroutine %d %s %v", g.ID, g.WaitReason, g.UserCurrent())
+			}
+			t.Fatalf("wrong number of stuck goroutines %d, expected 2", len(gs))
+		}
+		for _, g := range gs {
+			frames, err := g.Stacktrace(20, false, true)
+			assertNoError(err, t, "Stacktrace")
+			found := false
+			for _, frame := range frames {
+				if frame.Call.Fn != nil && frame.Call.Fn.Name == "main.lockBoth" {
+					found = frame.Call.Line == 15
+					break
+				}
+			}
+			if !found {
+				t.Fatalf("goroutine %d is not blocked at line 15 of main.lockBoth", g.ID)
+			}
+		}
+	})
+}
+
+func TestStepOutput(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcess("testnextprog", t, func(p proc.Process, fixture protest.Fixture) {
+		setFileLineBreakpoint(p, t, fixture.Source, 24)
+		assertNoError(proc.Continue(p), t, "Continue()")
+
+		var buf bytes.Buffer
+		p.Common().SetStepOutput(&buf)
+		assertNoError(proc.Next(p), t, "Next()")
+		expected := fmt.Sprintf("Stopped at: main.testnext() %s:26 (PC: %#x)\n", fixture.Source, currentPC(p, t))
+		if buf.String() != expected {
+			t.Fatalf("wrong step output %q, expected %q", buf.String(), expected)
+		}
+
+		// Continue doesn't print anything, neither do step operations once
+		// the output is disabled.
+		buf.Reset()
+		assertNoError(proc.Continue(p), t, "Continue()")
+		p.Common().SetStepOutput(nil)
+		assertNoError(proc.Next(p), t, "Next()")
+		if buf.Len() != 0 {
+			t.Fatalf("unexpected step output %q", buf.String())
+		}
+	})
+}
@@ -0,0 +1,143 @@
+package proc
+
+import (
+	"github.com/go-delve/delve/pkg/dwarf/godwarf"
+	"github.com/go-delve/delve/pkg/dwarf/op"
+	"github.com/go-delve/delve/pkg/goversion"
+)
+
+// Registers used by the register based calling convention introduced in
+// Go 1.17 on amd64, in assignment order, as DWARF register numbers.
+// See $GOROOT/src/cmd/compile/abi-internal.md
+var (
+	amd64RegabiIntRegs   = []int{0 /* RAX */, 3 /* RBX */, 2 /* RCX */, 5 /* RDI */, 4 /* RSI */, 8, 9, 10, 11}
+	amd64RegabiFloatRegs = []int{17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31} // XMM0 to XMM14
+)
+
+// usesRegabi returns true if the target was compiled with a version of Go
+// that passes arguments and return values in registers.
+func (bi *BinaryInfo) usesRegabi() bool {
+	if _, isamd64 := bi.Arch.(*AMD64); !isamd64 {
+		return false
+	}
+	producer := bi.Producer()
+	return producer != "" && goversion.ProducerAfterOrEqual(producer, 1, 17)
+}
+
+// regabiPiece is a part of a value assigned to a register.
+type regabiPiece struct {
+	regnum int   // DWARF register number
+	size   int64 // number of bytes of the register used
+	off    int64 // offset of the piece inside the value
+}
+
+// regabiAssigner implements the register assignment algorithm of the Go
+// internal ABI.
+type regabiAssigner struct {
+	intRegs, floatRegs int
+	pieces             []regabiPiece
+}
+
+// assign assigns registers to a value of type typ, returns false if the
+// value does not fit in the remaining registers, in which case it is
+// passed on the stack and no registers are consumed.
+func (a *regabiAssigner) assign(typ godwarf.Type) bool {
+	saved := *a
+	if !a.assignIntl(typ, 0) {
+		*a = saved
+		return false
+	}
+	return true
+}
+
+func (a *regabiAssigner) assignIntl(typ godwarf.Type, off int64) bool {
+	typ = resolveTypedef(typ)
+	switch t := typ.(type) {
+	case *godwarf.FloatType:
+		return a.floatReg(t.ByteSize, off)
+	case *godwarf.ComplexType:
+		return a.floatReg(t.ByteSize/2, off) && a.floatReg(t.ByteSize/2, off+t.ByteSize/2)
+	case *godwarf.StringType, *godwarf.InterfaceType:
+		return a.intReg(8, off) && a.intReg(8, off+8)
+	case *godwarf.SliceType:
+		return a.intReg(8, off) && a.intReg(8, off+8) && a.intReg(8, off+16)
+	case *godwarf.ArrayType:
+		switch t.Count {
+		case 0:
+			return true
+		case 1:
+			return a.assignIntl(t.Type, off)
+		default:
+			return false
+		}
+	case *godwarf.StructType:
+		for _, field := range t.Field {
+			if !a.assignIntl(field.Type, off+field.ByteOffset) {
+				return false
+			}
+		}
+		return true
+	default:
+		// integers, booleans, pointers, maps, channels and functions
+		if typ.Size() == 0 {
+			return true
+		}
+		if typ.Size() > 8 {
+			return false
+		}
+		return a.intReg(typ.Size(), off)
+	}
+}
+
+func (a *regabiAssigner) intReg(size, off int64) bool {
+	if a.intRegs >= len(amd64RegabiIntRegs) {
+		return false
+	}
+	a.pieces = append(a.pieces, regabiPiece{amd64RegabiIntRegs[a.intRegs], size, off})
+	a.intRegs++
+	return true
+}
+
+func (a *regabiAssigner) floatReg(size, off int64) bool {
+	if a.floatRegs >= len(amd64RegabiFloatRegs) {
+		return false
+	}
+	a.pieces = append(a.pieces, regabiPiece{amd64RegabiFloatRegs[a.floatRegs], size, off})
+	a.floatRegs++
+	return true
+}
+
+// regabiValues replaces the variables in vars, read from the stack, with
+// the values the register ABI placed in regs. The variables must be either
+// all the arguments or all the return values of a function, in declaration
+// order. Values passed on the stack are left untouched.
+func regabiValues(bi *BinaryInfo, mem MemoryReadWriter, regs op.DwarfRegisters, vars []*Variable) []*Variable {
+	var a regabiAssigner
+	r := make([]*Variable, len(vars))
+	for i, v := range vars {
+		r[i] = v
+		npieces := len(a.pieces)
+		if !a.assign(v.DwarfType) {
+			continue
+		}
+		data := make([]byte, v.DwarfType.Size())
+		for _, piece := range a.pieces[npieces:] {
+			reg := regs.Bytes(uint64(piece.regnum))
+			if int64(len(reg)) < piece.size {
+				// register not available (for example floating point
+				// registers could not be read), keep the stack value.
+				data = nil
+				break
+			}
+			copy(data[piece.off:], reg[:piece.size])
+		}
+		if data == nil {
+			continue
+		}
+		cmem := &compositeMemory{realmem: mem, regs: regs, data: data}
+		nv := newVariable(v.Name, fakeAddress, v.DwarfType, bi, cmem)
+		nv.Flags = v.Flags
+		r[i] = nv
+	}
+	return r
+}
@@ -170,6 +170,18 @@ func AppendSSEReg(regs []Register, name string, xmm []byte) []Register {
 	return append(regs, Register{name, xmm, out.String()})
 }
 
+// AppendVectorReg appends a vector register wider than 128 bits (YMM and
+// ZMM registers) to regs, value is the contents of the register in little
+// endian order.
+func AppendVectorReg(regs []Register, name string, value []byte) []Register {
+	var out bytes.Buffer
+	out.WriteString("0x")
+	for i := len(value) - 1; i >= 0; i-- {
+		fmt.Fprintf(&out, "%02x", value[i])
+	}
+	return append(regs, Register{name, value, out.String()})
+}
+
 // ErrUnknownRegister is returned when the value of an unknown
 // register is requested.
 var ErrUnknownRegister = errors.New("unknown register")
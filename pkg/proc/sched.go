@@ -0,0 +1,387 @@
+package proc
+
+import (
+	"errors"
+	"fmt"
+	"go/constant"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// P status, from: src/runtime/runtime2.go
+const (
+	Pidle    uint64 = iota // 0
+	Prunning               // 1
+	Psyscall               // 2
+	Pgcstop                // 3
+	Pdead                  // 4
+)
+
+// M represents a runtime M structure, an OS thread managed by the Go
+// scheduler (at least the fields that Delve is interested in).
+type M struct {
+	ID       int    // ID of the M (m.id)
+	ThreadID int    // ID of the OS thread (m.procid)
+	CurG     int    // ID of the goroutine running on this M, 0 if none
+	P        int    // ID of the P attached to this M, -1 if none
+	Addr     uint64 // Address of the runtime.m structure
+
+	Unreadable error // could not read the M struct
+}
+
+// P represents a runtime P structure, a processor of the Go scheduler (at
+// least the fields that Delve is interested in).
+type P struct {
+	ID      int    // ID of the P (p.id)
+	Status  uint64 // Status of the P (one of Pidle, Prunning, ...)
+	RunqLen int    // Number of goroutines in the local run queue of the P, including runnext
+	M       int    // ID of the M attached to this P, -1 if none
+	Addr    uint64 // Address of the runtime.p structure
+
+	Unreadable error // could not read the P struct
+}
+
+// SchedInfo contains global counters of the Go scheduler, read from
+// runtime.sched.
+type SchedInfo struct {
+	RunqSize int // Number of goroutines in the global run queue
+	NMIdle   int // Number of idle Ms waiting for work
+	NPIdle   int // Number of idle Ps
+}
+
+// loadSchedConfig is the load configuration used to read runtime.m and
+// runtime.p structures, only the top level fields are needed.
+var loadSchedConfig = LoadConfig{false, 0, 64, 0, -1, 0, false, false}
+
+// Threads returns the list of Ms (OS threads) known to the Go scheduler,
+// read by following runtime.allm.
+func Threads(dbp Process) ([]*M, error) {
+	if _, err := dbp.Valid(); err != nil {
+		return nil, err
+	}
+	bi := dbp.BinInfo()
+	scope := globalScope(bi, bi.Images[0], dbp.CurrentThread())
+	allm, err := scope.findGlobal("runtime.allm")
+	if err != nil {
+		return nil, err
+	}
+
+	var r []*M
+	mvar := allm.maybeDereference()
+	for mvar.Addr != 0 && mvar.Unreadable == nil {
+		mvar.loadValue(loadSchedConfig)
+		if mvar.Unreadable != nil {
+			r = append(r, &M{Addr: uint64(mvar.Addr), Unreadable: mvar.Unreadable})
+			break
+		}
+		r = append(r, mvar.parseM(dbp))
+		next := mvar.fieldVariable("alllink")
+		if next == nil {
+			break
+		}
+		mvar = next.maybeDereference()
+	}
+	return r, nil
+}
+
+// Processors returns the list of Ps of the Go scheduler, read from
+// runtime.allp. Dead Ps are not returned.
+func Processors(dbp Process) ([]*P, error) {
+	if _, err := dbp.Valid(); err != nil {
+		return nil, err
+	}
+	bi := dbp.BinInfo()
+	mem := dbp.CurrentThread()
+	scope := globalScope(bi, bi.Images[0], mem)
+	allp, err := scope.findGlobal("runtime.allp")
+	if err != nil {
+		return nil, err
+	}
+	// allp is a slice starting with Go 1.10, an array before that.
+	allp.loadValue(LoadConfig{false, 0, 0, 0, 0, 0, false, false})
+	if allp.Unreadable != nil {
+		return nil, allp.Unreadable
+	}
+	ptyp, err := bi.findType("runtime.p")
+	if err != nil {
+		return nil, err
+	}
+
+	var r []*P
+	for i := int64(0); i < allp.Len; i++ {
+		paddr, err := readUintRaw(mem, allp.Base+uintptr(i*int64(bi.Arch.PtrSize())), int64(bi.Arch.PtrSize()))
+		if err != nil {
+			return nil, err
+		}
+		if paddr == 0 {
+			continue
+		}
+		pvar := newVariable("", uintptr(paddr), ptyp, bi, mem)
+		pvar.loadValue(loadSchedConfig)
+		if pvar.Unreadable != nil {
+			r = append(r, &P{Addr: paddr, Unreadable: pvar.Unreadable})
+			continue
+		}
+		p := pvar.parseP(dbp)
+		if p.Status != Pdead {
+			r = append(r, p)
+		}
+	}
+	return r, nil
+}
+
+// SchedSummary returns the length of the global run queue of the Go
+// scheduler and the number of idle Ms and Ps.
+func SchedSummary(dbp Process) (*SchedInfo, error) {
+	if _, err := dbp.Valid(); err != nil {
+		return nil, err
+	}
+	bi := dbp.BinInfo()
+	scope := globalScope(bi, bi.Images[0], dbp.CurrentThread())
+	sched, err := scope.findGlobal("runtime.sched")
+	if err != nil {
+		return nil, err
+	}
+	r := &SchedInfo{}
+	runqsize, ok := schedInt(sched, "runqsize")
+	if !ok {
+		// Go 1.25 and later keep the size of the global run queue in the
+		// queue itself.
+		if runq, _ := sched.structMember("runq"); runq != nil {
+			runqsize, ok = schedInt(runq, "size")
+		}
+	}
+	if !ok {
+		return nil, errors.New("could not read the size of the global run queue")
+	}
+	r.RunqSize = int(runqsize)
+	for _, f := range []struct {
+		name string
+		dst  *int
+	}{
+		{"nmidle", &r.NMIdle},
+		{"npidle", &r.NPIdle},
+	} {
+		n, ok := schedInt(sched, f.name)
+		if !ok {
+			return nil, fmt.Errorf("could not read runtime.sched.%s", f.name)
+		}
+		*f.dst = int(n)
+	}
+	return r, nil
+}
+
+// GOMAXPROCS returns the maximum number of Ps that can execute Go code
+// simultaneously, read from runtime.gomaxprocs. If the variable can not be
+// found the number of Ps in runtime.allp is returned.
+func GOMAXPROCS(dbp Process) (int, error) {
+	n, err := runtimeGlobalInt(dbp, "runtime.gomaxprocs")
+	if err == nil {
+		return n, nil
+	}
+	ps, perr := Processors(dbp)
+	if perr != nil {
+		return 0, err
+	}
+	return len(ps), nil
+}
+
+// NumCPU returns the number of CPUs the target could use when it started,
+// read from runtime.ncpu (runtime.numCPUStartup in Go 1.25 and later).
+func NumCPU(dbp Process) (int, error) {
+	n, err := runtimeGlobalInt(dbp, "runtime.ncpu")
+	if err != nil {
+		if n2, err2 := runtimeGlobalInt(dbp, "runtime.numCPUStartup"); err2 == nil {
+			return n2, nil
+		}
+	}
+	return n, err
+}
+
+// StuckGoroutines returns the goroutines that are likely deadlocked: the
+// goroutines waiting with the same wait reason, parked at the same
+// location of the code that called into the runtime (see G.UserCurrent), in
+// two snapshots of the goroutines taken before and after resuming the target
+// for interval. Goroutines started by the runtime are not reported since
+// they are parked most of the time.
+// A goroutine that is woken up and parked again at the same place between
+// the two snapshots is also reported.
+// If the target stops on its own before interval expires, for example at a
+// breakpoint, the second snapshot is taken at that stop.
+func StuckGoroutines(dbp Process, interval time.Duration) ([]*G, error) {
+	if _, err := dbp.Valid(); err != nil {
+		return nil, err
+	}
+	before, _, err := GoroutinesInfo(dbp, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	type waitState struct {
+		reason string
+		pc     uint64
+	}
+	waiting := map[int]waitState{}
+	for _, g := range before {
+		if g.Unreadable == nil && g.Status&^gscan == Gwaiting {
+			waiting[g.ID] = waitState{g.WaitReason, g.UserCurrent().PC}
+		}
+	}
+
+	stopChan := ContinueAsync(dbp)
+	var stop ResumeStop
+	select {
+	case stop = <-stopChan:
+	case <-time.After(interval):
+		if err := Pause(dbp); err != nil {
+			return nil, err
+		}
+		stop = <-stopChan
+	}
+	if stop.Err != nil {
+		return nil, stop.Err
+	}
+
+	after, _, err := GoroutinesInfo(dbp, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	var r []*G
+	for _, g := range after {
+		if g.Unreadable != nil || g.Status&^gscan != Gwaiting || isSystemGoroutine(g) {
+			continue
+		}
+		// the PC of a parked goroutine is always in runtime.gopark
+		if w, ok := waiting[g.ID]; ok && w.reason == g.WaitReason && w.pc == g.UserCurrent().PC {
+			r = append(r, g)
+		}
+	}
+	return r, nil
+}
+
+// isSystemGoroutine returns true if g was started by the runtime, like the
+// workers of the garbage collector.
+func isSystemGoroutine(g *G) bool {
+	fn := g.StartLoc().Fn
+	return fn != nil && strings.HasPrefix(fn.Name, "runtime.") && fn.Name != "runtime.main"
+}
+
+// runtimeGlobalInt reads the integer global variable name.
+func runtimeGlobalInt(dbp Process, name string) (int, error) {
+	if _, err := dbp.Valid(); err != nil {
+		return 0, err
+	}
+	bi := dbp.BinInfo()
+	scope := globalScope(bi, bi.Images[0], dbp.CurrentThread())
+	v, err := scope.findGlobal(name)
+	if err != nil {
+		return 0, err
+	}
+	v.loadValue(loadSingleValue)
+	if v.Unreadable != nil {
+		return 0, v.Unreadable
+	}
+	if v.Value == nil || v.Value.Kind() != constant.Int {
+		return 0, fmt.Errorf("%s is not an integer", name)
+	}
+	n, _ := constant.Int64Val(v.Value)
+	return int(n), nil
+}
+
+// schedInt reads the integer field name of v, the value of fields with an
+// atomic type (for example atomic.Int32) is read from the field wrapped by
+// the atomic type.
+func schedInt(v *Variable, name string) (int64, bool) {
+	f := v.loadFieldNamed(name)
+	if f != nil && f.Kind == reflect.Struct {
+		if value := f.fieldVariable("value"); value != nil {
+			// runtime/internal/atomic
+			f = value
+		} else {
+			// sync/atomic
+			f = f.fieldVariable("v")
+		}
+	}
+	if f == nil || f.Value == nil {
+		return 0, false
+	}
+	n, _ := constant.Int64Val(f.Value)
+	return n, true
+}
+
+func (v *Variable) parseM(dbp Process) *M {
+	m := &M{P: -1, Addr: uint64(v.Addr)}
+	if idvar := v.fieldVariable("id"); idvar != nil && idvar.Value != nil {
+		id, _ := constant.Int64Val(idvar.Value)
+		m.ID = int(id)
+	}
+	if procidvar := v.fieldVariable("procid"); procidvar != nil && procidvar.Value != nil {
+		procid, _ := constant.Int64Val(procidvar.Value)
+		m.ThreadID = int(procid)
+	}
+	if curg := v.fieldVariable("curg"); curg != nil {
+		if gvar := curg.maybeDereference(); gvar.Addr != 0 {
+			if goid := gvar.loadFieldNamed("goid"); goid != nil {
+				id, _ := constant.Int64Val(goid.Value)
+				m.CurG = int(id)
+			}
+		}
+	}
+	if pvar := v.fieldVariable("p"); pvar != nil && pvar.Value != nil {
+		paddr, _ := constant.Uint64Val(pvar.Value)
+		if id, err := schedStructID(dbp, "runtime.p", paddr); err == nil {
+			m.P = id
+		}
+	}
+	return m
+}
+
+func (v *Variable) parseP(dbp Process) *P {
+	p := &P{M: -1, Addr: uint64(v.Addr)}
+	if idvar := v.fieldVariable("id"); idvar != nil && idvar.Value != nil {
+		id, _ := constant.Int64Val(idvar.Value)
+		p.ID = int(id)
+	}
+	if statusvar := v.fieldVariable("status"); statusvar != nil && statusvar.Value != nil {
+		p.Status, _ = constant.Uint64Val(statusvar.Value)
+	}
+	var runqhead, runqtail uint64
+	if headvar := v.fieldVariable("runqhead"); headvar != nil && headvar.Value != nil {
+		runqhead, _ = constant.Uint64Val(headvar.Value)
+	}
+	if tailvar := v.fieldVariable("runqtail"); tailvar != nil && tailvar.Value != nil {
+		runqtail, _ = constant.Uint64Val(tailvar.Value)
+	}
+	p.RunqLen = int(uint32(runqtail - runqhead))
+	if runnext := v.fieldVariable("runnext"); runnext != nil && runnext.Value != nil {
+		if g, _ := constant.Uint64Val(runnext.Value); g != 0 {
+			p.RunqLen++
+		}
+	}
+	if mvar := v.fieldVariable("m"); mvar != nil && mvar.Value != nil {
+		maddr, _ := constant.Uint64Val(mvar.Value)
+		if id, err := schedStructID(dbp, "runtime.m", maddr); err == nil {
+			p.M = id
+		}
+	}
+	return p
+}
+
+// schedStructID reads the id field of the runtime.m or runtime.p structure
+// at addr.
+func schedStructID(dbp Process, typename string, addr uint64) (int, error) {
+	if addr == 0 {
+		return 0, errors.New("nil pointer")
+	}
+	typ, err := dbp.BinInfo().findType(typename)
+	if err != nil {
+		return 0, err
+	}
+	v := newVariable("", uintptr(addr), typ, dbp.BinInfo(), dbp.CurrentThread())
+	idvar := v.loadFieldNamed("id")
+	if idvar == nil {
+		return 0, errors.New("could not read id")
+	}
+	id, _ := constant.Int64Val(idvar.Value)
+	return int(id), nil
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"go/constant"
+	"reflect"
 	"strings"
 
 	"github.com/go-delve/delve/pkg/dwarf/frame"
@@ -91,9 +92,20 @@ func (frame *Stackframe) FramePointerOffset() int64 {
 	return int64(frame.Regs.BP()) - int64(frame.stackHi)
 }
 
+// IsC returns true if the function of the frame was compiled from C code,
+// for example the C functions of a cgo program. The arguments and local
+// variables of C frames are read from the debug info of their C
+// compilation unit.
+func (frame *Stackframe) IsC() bool {
+	return frame.Current.Fn != nil && frame.Current.Fn.cu != nil && !frame.Current.Fn.cu.isgo
+}
+
 // ThreadStacktrace returns the stack trace for thread.
 // Note the locations in the array are return addresses not call addresses.
-func ThreadStacktrace(thread Thread, depth int) ([]Stackframe, error) {
+// If includeInlined is true each physical frame is preceded by a frame for
+// each inlined call it's executing, otherwise only physical frames are
+// returned and their location is the one of their PC.
+func ThreadStacktrace(thread Thread, depth int, includeInlined bool) ([]Stackframe, error) {
 	g, _ := GetG(thread)
 	if g == nil {
 		regs, err := thread.Registers(true)
@@ -101,9 +113,9 @@ func ThreadStacktrace(thread Thread, depth int) ([]Stackframe, error) {
 			return nil, err
 		}
 		it := newStackIterator(thread.BinInfo(), thread, thread.BinInfo().Arch.RegistersToDwarfRegisters(thread.BinInfo(), regs), 0, nil, -1, nil)
-		return it.stacktrace(depth)
+		return it.stacktrace(depth, includeInlined)
 	}
-	return g.Stacktrace(depth, false)
+	return g.Stacktrace(depth, false, includeInlined)
 }
 
 func (g *G) stackIterator() (*stackIterator, error) {
@@ -124,12 +136,13 @@ func (g *G) stackIterator() (*stackIterator, error) {
 
 // Stacktrace returns the stack trace for a goroutine.
 // Note the locations in the array are return addresses not call addresses.
-func (g *G) Stacktrace(depth int, readDefers bool) ([]Stackframe, error) {
+// See ThreadStacktrace for the meaning of includeInlined.
+func (g *G) Stacktrace(depth int, readDefers, includeInlined bool) ([]Stackframe, error) {
 	it, err := g.stackIterator()
 	if err != nil {
 		return nil, err
 	}
-	frames, err := it.stacktrace(depth)
+	frames, err := it.stacktrace(depth, includeInlined)
 	if err != nil {
 		return nil, err
 	}
@@ -159,6 +172,7 @@ type stackIterator struct {
 	err   error
 
 	stackhi        uint64
+	stacklo        uint64
 	systemstack    bool
 	stackBarrierPC uint64
 	stkbar         []savedLR
@@ -195,10 +209,11 @@ func newStackIterator(bi *BinaryInfo, mem MemoryReadWriter, regs op.DwarfRegiste
 		}
 		stkbar = stkbar[stkbarPos:]
 	}
-	var g0_sched_sp uint64
+	var g0_sched_sp, stacklo uint64
 	systemstack := true
 	if g != nil {
 		systemstack = g.SystemStack
+		stacklo = g.stacklo
 		g0var, _ := g.variable.fieldVariable("m").structMember("g0")
 		if g0var != nil {
 			g0, _ := g0var.parseG()
@@ -207,7 +222,7 @@ func newStackIterator(bi *BinaryInfo, mem MemoryReadWriter, regs op.DwarfRegiste
 			}
 		}
 	}
-	return &stackIterator{pc: regs.PC(), regs: regs, top: true, bi: bi, mem: mem, err: nil, atend: false, stackhi: stackhi, stackBarrierPC: stackBarrierPC, stkbar: stkbar, systemstack: systemstack, g: g, g0_sched_sp: g0_sched_sp}
+	return &stackIterator{pc: regs.PC(), regs: regs, top: true, bi: bi, mem: mem, err: nil, atend: false, stackhi: stackhi, stacklo: stacklo, stackBarrierPC: stackBarrierPC, stkbar: stkbar, systemstack: systemstack, g: g, g0_sched_sp: g0_sched_sp}
 }
 
 // Next points the iterator to the next stack frame.
@@ -228,6 +243,16 @@ func (it *stackIterator) Next() bool {
 		return true
 	}
 
+	if !it.systemstack && it.inGoroutineStack(it.regs.SP()) && !it.inGoroutineStack(uint64(it.regs.CFA)) {
+		// The caller's frame would be outside of the goroutine stack, the return
+		// address was read from garbage (for example because the stack is
+		// corrupted), stop here.
+		// Frames that are not on the goroutine stack, for example frames of a
+		// signal handler running on the signal stack, are not checked.
+		it.atend = true
+		return true
+	}
+
 	if it.frame.Ret <= 0 {
 		it.atend = true
 		return true
@@ -239,6 +264,13 @@ func (it *stackIterator) Next() bool {
 	return true
 }
 
+// inGoroutineStack returns true if addr is inside the stack of the
+// goroutine being unwound, always false if the bounds of the stack are not
+// known.
+func (it *stackIterator) inGoroutineStack(addr uint64) bool {
+	return it.stacklo != 0 && addr >= it.stacklo && addr <= it.stackhi
+}
+
 // asmcgocallSPOffsetSaveSlot is the offset from systemstack.SP where
 // (goroutine.SP - StackHi) is saved in runtime.asmcgocall after the stack
 // switch happens.
@@ -311,32 +343,44 @@ func (it *stackIterator) switchStack() bool {
 		it.systemstack = true
 		return true
 
-	case "runtime.goexit", "runtime.rt0_go", "runtime.mcall":
+	case "runtime.systemstack", "runtime.mcall", "runtime.morestack":
+		// These functions switch from the goroutine stack to the system stack
+		// (g0) and are the bottom of the system stack, the state of the
+		// goroutine before the switch is saved in g.sched.
+		// Note that runtime.mcall never returns and is therefore also the top
+		// of the goroutine stack when it's called on the goroutine stack.
+		if !it.systemstack || it.g == nil {
+			if it.frame.Current.Fn.Name == "runtime.mcall" {
+				it.atend = true
+				return true
+			}
+			return false
+		}
+		it.switchToGoroutineStack()
+		return true
+
+	case "runtime.goexit", "runtime.rt0_go", "runtime.mstart":
 		// Look for "top of stack" functions.
 		it.atend = true
 		return true
 
 	default:
-		if it.systemstack && it.top && it.g != nil && strings.HasPrefix(it.frame.Current.Fn.Name, "runtime.") {
-			// The runtime switches to the system stack in multiple places.
-			// This usually happens through a call to runtime.systemstack but there
-			// are functions that switch to the system stack manually (for example
-			// runtime.morestack).
-			// Since we are only interested in printing the system stack for cgo
-			// calls we switch directly to the goroutine stack if we detect that the
-			// function at the top of the stack is a runtime function.
-			it.systemstack = false
-			it.top = false
-			it.pc = it.g.PC
-			it.regs.Reg(it.regs.SPRegNum).Uint64Val = it.g.SP
-			it.regs.Reg(it.regs.BPRegNum).Uint64Val = it.g.BP
-			return true
-		}
-
 		return false
 	}
 }
 
+// switchToGoroutineStack resumes unwinding on the goroutine stack, from the
+// state saved in g.sched when the goroutine switched to the system stack.
+func (it *stackIterator) switchToGoroutineStack() {
+	it.systemstack = false
+	it.top = false
+	it.pc = it.g.PC
+	// the registers of frames unwound from the system stack may not include
+	// SP and BP.
+	it.regs.AddReg(it.regs.SPRegNum, op.DwarfRegisterFromUint64(it.g.SP))
+	it.regs.AddReg(it.regs.BPRegNum, op.DwarfRegisterFromUint64(it.g.BP))
+}
+
 // Frame returns the frame the iterator is pointing at.
 func (it *stackIterator) Frame() Stackframe {
 	it.frame.Bottom = it.atend
@@ -352,6 +396,10 @@ func (it *stackIterator) Err() error {
 // the current frame.
 func (it *stackIterator) frameBase(fn *Function) int64 {
 	rdr := fn.cu.image.dwarfReader
+	if rdr == nil {
+		// functions read from the Go symbol table have no DWARF entry
+		return 0
+	}
 	rdr.Seek(fn.offset)
 	e, err := rdr.Next()
 	if err != nil {
@@ -393,13 +441,17 @@ func (it *stackIterator) newStackframe(ret, retaddr uint64) Stackframe {
 	return r
 }
 
-func (it *stackIterator) stacktrace(depth int) ([]Stackframe, error) {
+func (it *stackIterator) stacktrace(depth int, includeInlined bool) ([]Stackframe, error) {
 	if depth < 0 {
 		return nil, errors.New("negative maximum stack depth")
 	}
 	frames := make([]Stackframe, 0, depth+1)
 	for it.Next() {
-		frames = it.appendInlineCalls(frames, it.Frame())
+		if includeInlined {
+			frames = it.appendInlineCalls(frames, it.Frame())
+		} else {
+			frames = append(frames, it.Frame())
+		}
 		if len(frames) >= depth+1 {
 			break
 		}
@@ -501,6 +553,7 @@ func (it *stackIterator) advanceRegs() (callFrameRegs op.DwarfRegisters, ret uin
 	// $GDB_SOURCE/dwarf2-frame.c
 	callFrameRegs.AddReg(uint64(amd64DwarfSPRegNum), cfareg)
 
+	retUndefined := false
 	for i, regRule := range framectx.Regs {
 		reg, err := it.executeFrameRegRule(i, regRule, it.regs.CFA)
 		callFrameRegs.AddReg(i, reg)
@@ -510,13 +563,19 @@ func (it *stackIterator) advanceRegs() (callFrameRegs op.DwarfRegisters, ret uin
 					err = fmt.Errorf("Undefined return address at %#x", it.pc)
 				}
 				it.err = err
-			} else {
-				ret = reg.Uint64Val
+				retUndefined = true
 			}
 			retaddr = uint64(it.regs.CFA + regRule.Offset)
 		}
 	}
 
+	if !retUndefined {
+		ret, err = it.bi.Arch.returnAddress(it.mem, &it.regs, &callFrameRegs)
+		if err != nil {
+			it.err = err
+		}
+	}
+
 	return callFrameRegs, ret, retaddr
 }
 
@@ -578,10 +637,11 @@ func (it *stackIterator) readRegisterAt(regnum uint64, addr uint64) (*op.DwarfRe
 
 // Defer represents one deferred call
 type Defer struct {
-	DeferredPC uint64 // Value of field _defer.fn.fn, the deferred function
-	DeferPC    uint64 // PC address of instruction that added this defer
-	SP         uint64 // Value of SP register when this function was deferred (this field gets adjusted when the stack is moved to match the new stack space)
-	link       *Defer // Next deferred function
+	DeferredPC uint64    // Value of field _defer.fn.fn, the deferred function
+	DeferredFn *Function // Function containing DeferredPC, nil if it could not be found (Defers resolves deferwrap closures to the function they call)
+	DeferPC    uint64    // PC address of instruction that added this defer
+	SP         uint64    // Value of SP register when this function was deferred (this field gets adjusted when the stack is moved to match the new stack space)
+	link       *Defer    // Next deferred function
 	argSz      int64
 
 	variable   *Variable
@@ -633,23 +693,33 @@ func (g *G) readDefers(frames []Stackframe) {
 }
 
 func (d *Defer) load() {
-	d.variable.loadValue(LoadConfig{false, 1, 0, 0, -1, 0})
+	d.variable.loadValue(LoadConfig{false, 1, 0, 0, -1, 0, false, false})
 	if d.variable.Unreadable != nil {
 		d.Unreadable = d.variable.Unreadable
 		return
 	}
 
-	fnvar := d.variable.fieldVariable("fn").maybeDereference()
-	if fnvar.Addr != 0 {
+	fnvar := d.variable.fieldVariable("fn")
+	if fnvar.Kind == reflect.Func {
+		// Go 1.18 and later: fn is a func() and has already been resolved by
+		// loadValue.
+		d.DeferredPC = uint64(fnvar.Base)
+	} else if fnvar = fnvar.maybeDereference(); fnvar.Addr != 0 {
 		fnvar = fnvar.loadFieldNamed("fn")
-		if fnvar.Unreadable == nil {
+		if fnvar != nil {
 			d.DeferredPC, _ = constant.Uint64Val(fnvar.Value)
 		}
 	}
+	if d.DeferredPC != 0 {
+		d.DeferredFn = d.variable.bi.PCToFunc(d.DeferredPC)
+	}
 
 	d.DeferPC, _ = constant.Uint64Val(d.variable.fieldVariable("pc").Value)
 	d.SP, _ = constant.Uint64Val(d.variable.fieldVariable("sp").Value)
-	d.argSz, _ = constant.Int64Val(d.variable.fieldVariable("siz").Value)
+	if sizvar := d.variable.fieldVariable("siz"); sizvar != nil {
+		// removed in Go 1.18, deferred calls no longer have arguments
+		d.argSz, _ = constant.Int64Val(sizvar.Value)
+	}
 
 	linkvar := d.variable.fieldVariable("link").maybeDereference()
 	if linkvar.Addr != 0 {
@@ -676,6 +746,128 @@ func (d *Defer) Next() *Defer {
 	return d.link
 }
 
+// maxDefers is the maximum number of deferred calls returned by Defers, a
+// longer _defer list is assumed to be corrupted.
+const maxDefers = 10000
+
+// Defers returns the deferred calls of goroutine gid that have not been
+// executed yet, the most recently deferred one first. If a defer in the
+// list can not be read it is returned, with its Unreadable field set, as
+// the last element.
+func Defers(dbp Process, gid int) ([]*Defer, error) {
+	g, err := FindGoroutine(dbp, gid)
+	if err != nil {
+		return nil, err
+	}
+	if g == nil {
+		return nil, fmt.Errorf("no goroutine %d", gid)
+	}
+	var r []*Defer
+	seen := make(map[uintptr]bool)
+	for d := g.Defer(); d != nil; d = d.Next() {
+		if seen[d.variable.Addr] {
+			r = append(r, &Defer{Unreadable: errors.New("corrupted defer list: loop")})
+			break
+		}
+		if len(r) >= maxDefers {
+			r = append(r, &Defer{Unreadable: fmt.Errorf("corrupted defer list: more than %d deferred calls", maxDefers)})
+			break
+		}
+		seen[d.variable.Addr] = true
+		d.DeferredFn = deferwrapTarget(dbp, d.DeferredFn)
+		r = append(r, d)
+		if d.Unreadable != nil {
+			break
+		}
+	}
+	return r, nil
+}
+
+// deferwrapTarget returns the function called by fn if fn is one of the
+// closures that, since Go 1.17, the compiler generates to wrap deferred
+// calls with arguments (for example main.f.deferwrap1), otherwise it
+// returns fn.
+func deferwrapTarget(dbp Process, fn *Function) *Function {
+	if fn == nil || (!strings.Contains(fn.Name, ".deferwrap") && !strings.Contains(fn.Name, "·dwrap·")) {
+		return fn
+	}
+	text, err := disassemble(dbp.CurrentThread(), nil, dbp.Breakpoints(), dbp.BinInfo(), fn.Entry, fn.End, false)
+	if err != nil {
+		return fn
+	}
+	for _, instr := range text {
+		if instr.IsCall() && instr.DestLoc != nil && instr.DestLoc.Fn != nil && !strings.HasPrefix(instr.DestLoc.Fn.Name, "runtime.") {
+			return instr.DestLoc.Fn
+		}
+	}
+	return fn
+}
+
+// Panic represents one active panic of a goroutine, read from
+// runtime._panic.
+type Panic struct {
+	Arg       *Variable // Argument of the call to panic
+	Recovered bool      // The panic was recovered
+	Aborted   bool      // The panic was aborted by a new panic (before Go 1.22)
+
+	Unreadable error
+}
+
+// PanicChain returns the list of active panics of goroutine gid, the most
+// recent one first: a goroutine can have more than one active panic if a
+// function deferred by a panicking goroutine panics in turn.
+func PanicChain(dbp Process, gid int) ([]*Panic, error) {
+	g, err := FindGoroutine(dbp, gid)
+	if err != nil {
+		return nil, err
+	}
+	if g == nil {
+		return nil, fmt.Errorf("no goroutine %d", gid)
+	}
+	if g.variable.Unreadable != nil {
+		return nil, g.variable.Unreadable
+	}
+	pvar := g.variable.fieldVariable("_panic")
+	if pvar == nil {
+		return nil, errors.New("could not find _panic field of runtime.g")
+	}
+	var r []*Panic
+	seen := make(map[uintptr]bool)
+	for pvar = pvar.maybeDereference(); pvar.Addr != 0; {
+		if seen[pvar.Addr] {
+			r = append(r, &Panic{Unreadable: errors.New("corrupted panic list: loop")})
+			break
+		}
+		seen[pvar.Addr] = true
+		p := &Panic{Arg: pvar.loadFieldNamed("arg")}
+		if p.Arg == nil {
+			p.Unreadable = fmt.Errorf("could not read panic at %#x", pvar.Addr)
+			r = append(r, p)
+			break
+		}
+		p.Recovered = panicFlag(pvar, "recovered")
+		p.Aborted = panicFlag(pvar, "aborted")
+		r = append(r, p)
+		link := pvar.loadFieldNamed("link")
+		if link == nil {
+			break
+		}
+		pvar = link.maybeDereference()
+	}
+	return r, nil
+}
+
+// panicFlag returns the value of the boolean field name of the
+// runtime._panic struct pvar, false if it can't be read or if this version
+// of the runtime doesn't have it (aborted was removed in Go 1.22).
+func panicFlag(pvar *Variable, name string) bool {
+	v := pvar.loadFieldNamed(name)
+	if v == nil || v.Value == nil || v.Value.Kind() != constant.Bool {
+		return false
+	}
+	return constant.BoolVal(v.Value)
+}
+
 // EvalScope returns an EvalScope relative to the argument frame of this deferred call.
 // The argument frame of a deferred call is stored in memory immediately
 // after the deferred header.
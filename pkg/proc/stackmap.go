@@ -0,0 +1,270 @@
+package proc
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"go/constant"
+	"sort"
+
+	"github.com/go-delve/delve/pkg/dwarf/godwarf"
+)
+
+// StackMapInfo describes which stack slots of a function hold pointers at
+// a given PC, as recorded by the compiler for the garbage collector (see
+// runtime.getStackMap in $GOROOT/src/runtime/stkframe.go).
+type StackMapInfo struct {
+	Function *Function
+	// Index is the stack map index of the PC in the function, the value of
+	// its PCDATA_StackMapIndex table.
+	Index int
+	// Locals[i] is true if the i-th pointer sized word of the locals area
+	// of the frame holds a pointer. The i-th word is at address
+	// CFA+LocalsOffset+i*ptrSize.
+	Locals       []bool
+	LocalsOffset int64
+	// Args[i] is true if the i-th pointer sized word of the arguments of
+	// the frame holds a pointer. The i-th word is at address CFA+i*ptrSize.
+	Args []bool
+}
+
+// Indexes of the stack map tables in the PCDATA and FUNCDATA of a
+// function, see $GOROOT/src/internal/abi/symtab.go.
+const (
+	pcdataStackMapIndex       = 1
+	funcdataArgsPointerMaps   = 0
+	funcdataLocalsPointerMaps = 1
+	funcdataNoOffset          = ^uint32(0)
+	functabEntrySize          = 8
+	stackMapHeaderSize        = 8
+)
+
+// StackMap returns the pointer bitmaps of the arguments and locals of the
+// function containing pc. Like the runtime does the PC of a call
+// instruction is looked up, so that for frames other than the topmost
+// one the return address of the frame must be passed.
+// The stack maps are read from the runtime.firstmoduledata of the target,
+// only executables built with Go 1.18 or later are supported.
+func StackMap(dbp Process, pc uint64) (*StackMapInfo, error) {
+	if _, err := dbp.Valid(); err != nil {
+		return nil, err
+	}
+	bi := dbp.BinInfo()
+	mem := dbp.CurrentThread()
+	fn := bi.PCToFunc(pc)
+	if fn == nil {
+		return nil, fmt.Errorf("could not find function containing %#x", pc)
+	}
+	scope := globalScope(bi, bi.Images[0], mem)
+
+	md := map[string]*Variable{}
+	for _, field := range []string{"text", "gofunc", "pctab", "pclntable", "ftab"} {
+		v, err := scope.EvalVariable("runtime.firstmoduledata."+field, loadSingleValue)
+		if err != nil {
+			return nil, fmt.Errorf("could not read runtime.firstmoduledata (stack maps need Go 1.18 or later): %v", err)
+		}
+		if v.Unreadable != nil {
+			return nil, v.Unreadable
+		}
+		md[field] = v
+	}
+	text, _ := constant.Uint64Val(md["text"].Value)
+	gofunc, _ := constant.Uint64Val(md["gofunc"].Value)
+	minLC := uint64(1)
+	if v, err := scope.EvalVariable("runtime.firstmoduledata.pcHeader.minLC", loadSingleValue); err == nil && v.Unreadable == nil {
+		minLC, _ = constant.Uint64Val(v.Value)
+	}
+
+	// find the _func describing fn in the function table, which is sorted
+	// by entry point and ends with an entry for the end of the text.
+	ftab := md["ftab"]
+	if ftab.Len < 2 {
+		return nil, errors.New("empty function table")
+	}
+	ftabData := make([]byte, ftab.Len*functabEntrySize)
+	if _, err := mem.ReadMemory(ftabData, ftab.Base); err != nil {
+		return nil, err
+	}
+	entryoff := func(i int) uint64 {
+		return uint64(binary.LittleEndian.Uint32(ftabData[i*functabEntrySize:]))
+	}
+	nfunc := int(ftab.Len) - 1
+	i := sort.Search(nfunc, func(i int) bool { return text+entryoff(i) >= fn.Entry })
+	if i >= nfunc || text+entryoff(i) != fn.Entry {
+		return nil, fmt.Errorf("could not find %s in the function table", fn.Name)
+	}
+	funcoff := binary.LittleEndian.Uint32(ftabData[i*functabEntrySize+4:])
+
+	f, err := readFuncInfo(bi, mem, md["pclntable"].Base+uintptr(funcoff))
+	if err != nil {
+		return nil, err
+	}
+
+	r := &StackMapInfo{Function: fn, Index: -1}
+	targetpc := pc
+	if targetpc != fn.Entry {
+		targetpc--
+	}
+	if off := f.pcdata(pcdataStackMapIndex); off != 0 {
+		r.Index, err = pcValue(mem, md["pctab"].Base+uintptr(off), fn.Entry, targetpc, minLC)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// at the entry point of a function the stack map index is -1, the
+	// runtime uses the first stack map in that case.
+	idx := r.Index
+	if idx < 0 {
+		idx = 0
+	}
+
+	ptrSize := int64(bi.Arch.PtrSize())
+	if off := f.funcdata(funcdataLocalsPointerMaps); off != funcdataNoOffset {
+		r.Locals, err = readStackMap(mem, uintptr(gofunc)+uintptr(off), idx)
+		if err != nil {
+			return nil, fmt.Errorf("could not read locals stack map of %s: %v", fn.Name, err)
+		}
+		// the locals end below the return address and the saved frame
+		// pointer.
+		r.LocalsOffset = -2*ptrSize - int64(len(r.Locals))*ptrSize
+	}
+	if off := f.funcdata(funcdataArgsPointerMaps); off != funcdataNoOffset {
+		r.Args, err = readStackMap(mem, uintptr(gofunc)+uintptr(off), idx)
+		if err != nil {
+			return nil, fmt.Errorf("could not read arguments stack map of %s: %v", fn.Name, err)
+		}
+	}
+	return r, nil
+}
+
+// funcInfo is the part of a runtime._func struct needed to read the PCDATA
+// and FUNCDATA of a function.
+type funcInfo struct {
+	npcdata, nfuncdata uint32
+	// tables are the pcdata offsets followed by the funcdata offsets.
+	tables []uint32
+}
+
+func (f *funcInfo) pcdata(i uint32) uint32 {
+	if i >= f.npcdata {
+		return 0
+	}
+	return f.tables[i]
+}
+
+func (f *funcInfo) funcdata(i uint32) uint32 {
+	if i >= f.nfuncdata {
+		return funcdataNoOffset
+	}
+	return f.tables[f.npcdata+i]
+}
+
+// readFuncInfo reads the runtime._func struct at addr, its layout is taken
+// from the debug info since it changes between versions of Go.
+func readFuncInfo(bi *BinaryInfo, mem MemoryReadWriter, addr uintptr) (*funcInfo, error) {
+	typ, err := bi.findType("runtime._func")
+	if err != nil {
+		return nil, err
+	}
+	styp, ok := resolveTypedef(typ).(*godwarf.StructType)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type of runtime._func %s", typ)
+	}
+	buf := make([]byte, styp.ByteSize)
+	if _, err := mem.ReadMemory(buf, addr); err != nil {
+		return nil, err
+	}
+	f := &funcInfo{}
+	found := 0
+	for _, field := range styp.Field {
+		switch field.Name {
+		case "npcdata":
+			f.npcdata = binary.LittleEndian.Uint32(buf[field.ByteOffset:])
+			found++
+		case "nfuncdata":
+			f.nfuncdata = uint32(buf[field.ByteOffset])
+			found++
+		}
+	}
+	if found != 2 {
+		return nil, errors.New("unsupported layout of runtime._func")
+	}
+	tables := make([]byte, 4*(f.npcdata+f.nfuncdata))
+	if _, err := mem.ReadMemory(tables, addr+uintptr(styp.ByteSize)); err != nil {
+		return nil, err
+	}
+	f.tables = make([]uint32, f.npcdata+f.nfuncdata)
+	for i := range f.tables {
+		f.tables[i] = binary.LittleEndian.Uint32(tables[4*i:])
+	}
+	return f, nil
+}
+
+// memoryReader reads the memory of the target sequentially starting at
+// addr.
+type memoryReader struct {
+	mem  MemoryReadWriter
+	addr uintptr
+}
+
+func (r *memoryReader) Read(buf []byte) (int, error) {
+	n, err := r.mem.ReadMemory(buf, r.addr)
+	r.addr += uintptr(n)
+	return n, err
+}
+
+// pcValue returns the value of the PC-value table at addr for targetpc,
+// see runtime.pcvalue in $GOROOT/src/runtime/symtab.go.
+func pcValue(mem MemoryReadWriter, addr uintptr, entry, targetpc, minLC uint64) (int, error) {
+	rd := bufio.NewReaderSize(&memoryReader{mem, addr}, 64)
+	val := int32(-1)
+	pc := entry
+	for first := true; ; first = false {
+		uvdelta, err := binary.ReadUvarint(rd)
+		if err != nil {
+			return 0, err
+		}
+		if uvdelta == 0 && !first {
+			break
+		}
+		if uvdelta&1 != 0 {
+			uvdelta = ^(uvdelta >> 1)
+		} else {
+			uvdelta >>= 1
+		}
+		pcdelta, err := binary.ReadUvarint(rd)
+		if err != nil {
+			return 0, err
+		}
+		pc += pcdelta * minLC
+		val += int32(uvdelta)
+		if targetpc < pc {
+			return int(val), nil
+		}
+	}
+	return 0, fmt.Errorf("PC %#x not covered by its PC-value table", targetpc)
+}
+
+// readStackMap reads the idx-th bitmap of the runtime.stackmap at addr.
+func readStackMap(mem MemoryReadWriter, addr uintptr, idx int) ([]bool, error) {
+	hdr := make([]byte, stackMapHeaderSize)
+	if _, err := mem.ReadMemory(hdr, addr); err != nil {
+		return nil, err
+	}
+	n := int(int32(binary.LittleEndian.Uint32(hdr)))
+	nbit := int(int32(binary.LittleEndian.Uint32(hdr[4:])))
+	if idx >= n {
+		return nil, fmt.Errorf("stack map index %d out of range [0, %d)", idx, n)
+	}
+	bytesPerMap := (nbit + 7) / 8
+	bitmap := make([]byte, bytesPerMap)
+	if _, err := mem.ReadMemory(bitmap, addr+stackMapHeaderSize+uintptr(idx*bytesPerMap)); err != nil {
+		return nil, err
+	}
+	r := make([]bool, nbit)
+	for i := range r {
+		r[i] = bitmap[i/8]&(1<<uint(i%8)) != 0
+	}
+	return r, nil
+}
@@ -75,6 +75,9 @@ const (
 	EnableDWZCompression
 	BuildModePIE
 	BuildModePlugin
+	// LinkStripDWARF enables '-ldflags="-w"', removing DWARF but not the
+	// Go symbol table.
+	LinkStripDWARF
 )
 
 // BuildFixture will compile the fixture 'name' using the provided build flags.
@@ -114,6 +117,9 @@ func BuildFixture(name string, flags BuildFlags) Fixture {
 	if flags&LinkStrip != 0 {
 		buildFlags = append(buildFlags, "-ldflags=-s")
 	}
+	if flags&LinkStripDWARF != 0 {
+		buildFlags = append(buildFlags, "-ldflags=-w")
+	}
 	gcflagsv := []string{}
 	if flags&EnableInlining == 0 {
 		gcflagsv = append(gcflagsv, "-l")
@@ -143,6 +149,11 @@ func BuildFixture(name string, flags BuildFlags) Fixture {
 
 	cmd := exec.Command("go", buildFlags...)
 	cmd.Dir = dir
+	if flags&EnableCGOOptimization == 0 {
+		// DWARF 5 line tables are not supported, newer versions of gcc
+		// default to them.
+		cmd.Env = append(os.Environ(), "CGO_CFLAGS="+os.Getenv("CGO_CFLAGS")+" -gdwarf-4")
+	}
 
 	// Build the test binary
 	if out, err := cmd.CombinedOutput(); err != nil {
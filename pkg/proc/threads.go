@@ -88,9 +88,9 @@ func topframe(g *G, thread Thread) (Stackframe, Stackframe, error) {
 		if thread.Blocked() {
 			return Stackframe{}, Stackframe{}, ErrThreadBlocked{}
 		}
-		frames, err = ThreadStacktrace(thread, 1)
+		frames, err = ThreadStacktrace(thread, 1, true)
 	} else {
-		frames, err = g.Stacktrace(1, true)
+		frames, err = g.Stacktrace(1, true, true)
 	}
 	if err != nil {
 		return Stackframe{}, Stackframe{}, err
@@ -299,23 +299,16 @@ func next(dbp Process, stepInto, inlinedStepOut bool) error {
 		// For inlined functions there is no need to do this, the set of PCs
 		// returned by the AllPCsBetween call above already cover all instructions
 		// of the containing function.
-		bp, err := dbp.SetBreakpoint(topframe.Ret, NextBreakpoint, retFrameCond)
-		if err != nil {
-			if _, isexists := err.(BreakpointExistsError); isexists {
-				if bp.Kind == NextBreakpoint {
-					// If the return address shares the same address with one of the lines
-					// of the function (because we are stepping through a recursive
-					// function) then the corresponding breakpoint should be active both on
-					// this frame and on the return frame.
-					bp.Cond = sameOrRetFrameCond
-				}
-			}
-			// Return address could be wrong, if we are unable to set a breakpoint
-			// there it's ok.
-		}
-		if bp != nil {
-			configureReturnBreakpoint(dbp.BinInfo(), bp, &topframe, retFrameCond)
+		bp, err := setReturnBreakpoint(dbp, &topframe, retFrameCond)
+		if _, isexists := err.(BreakpointExistsError); isexists && bp.Kind == NextBreakpoint {
+			// If the return address shares the same address with one of the lines
+			// of the function (because we are stepping through a recursive
+			// function) then the corresponding breakpoint should be active both on
+			// this frame and on the return frame.
+			bp.Cond = sameOrRetFrameCond
 		}
+		// Return address could be wrong, if we are unable to set a breakpoint
+		// there it's ok.
 	}
 
 	if bp := curthread.Breakpoint(); bp.Breakpoint == nil {
@@ -325,6 +318,27 @@ func next(dbp Process, stepInto, inlinedStepOut bool) error {
 	return nil
 }
 
+// setReturnBreakpoint sets a NextBreakpoint on the return address of
+// topframe, with condition cond (which should check that the goroutine
+// and frame are the ones of the caller), configured to collect the return
+// values of the function when it is hit.
+// If a breakpoint already exists at the return address it is configured
+// and returned together with the BreakpointExistsError.
+// The breakpoint is removed, like all the other internal breakpoints, by
+// ClearInternalBreakpoints.
+func setReturnBreakpoint(dbp Process, topframe *Stackframe, cond ast.Expr) (*Breakpoint, error) {
+	bp, err := dbp.SetBreakpoint(topframe.Ret, NextBreakpoint, cond)
+	if err != nil {
+		if _, isexists := err.(BreakpointExistsError); !isexists {
+			return nil, err
+		}
+	}
+	if bp != nil {
+		configureReturnBreakpoint(dbp.BinInfo(), bp, topframe, cond)
+	}
+	return bp, err
+}
+
 func findDeferReturnCalls(text []AsmInstruction) []uint64 {
 	const deferreturn = "runtime.deferreturn"
 	deferreturns := []uint64{}
@@ -388,9 +402,17 @@ func setStepIntoBreakpoint(dbp Process, text []AsmInstruction, cond ast.Expr) er
 
 	fn := instr.DestLoc.Fn
 
-	// Skip unexported runtime functions
-	if fn != nil && strings.HasPrefix(fn.Name, "runtime.") && !isExportedRuntime(fn.Name) {
-		return nil
+	if !dbp.Common().stepIntoHidden {
+		// Skip unexported runtime functions
+		if fn != nil && strings.HasPrefix(fn.Name, "runtime.") && !isExportedRuntime(fn.Name) {
+			return nil
+		}
+
+		// Skip code without line information, there would be no source line
+		// to stop at.
+		if fn == nil || instr.DestLoc.File == "" || instr.DestLoc.Line == 0 {
+			return nil
+		}
 	}
 
 	//TODO(aarzilli): if we want to let users hide functions
@@ -419,6 +441,65 @@ func setStepIntoBreakpoint(dbp Process, text []AsmInstruction, cond ast.Expr) er
 	return nil
 }
 
+// TLSBase returns the base address of the thread local storage of the
+// thread with the given ID (the value of FS_BASE on linux/amd64).
+func TLSBase(dbp Process, tid int) (uint64, error) {
+	thread, ok := dbp.FindThread(tid)
+	if !ok {
+		return 0, fmt.Errorf("thread %d does not exist", tid)
+	}
+	regs, err := thread.Registers(false)
+	if err != nil {
+		return 0, err
+	}
+	return regs.TLS(), nil
+}
+
+// ErrTLSBaseUnsupported is returned by SetTLSBase when the target does not
+// support changing the TLS base of its threads.
+var ErrTLSBaseUnsupported = errors.New("setting the TLS base is not supported by this backend")
+
+// tlsBaseSetter is implemented by the threads of targets that can change
+// the base address of their thread local storage.
+type tlsBaseSetter interface {
+	SetTLSBase(base uint64) error
+}
+
+// SetTLSBase sets the base address of the thread local storage of the
+// thread with the given ID, see TLSBase. Only the native backend on
+// linux/amd64 supports it, other targets return ErrTLSBaseUnsupported.
+func SetTLSBase(dbp Process, tid int, base uint64) error {
+	if _, err := dbp.Valid(); err != nil {
+		return err
+	}
+	thread, ok := dbp.FindThread(tid)
+	if !ok {
+		return fmt.Errorf("thread %d does not exist", tid)
+	}
+	setter, ok := thread.(tlsBaseSetter)
+	if !ok {
+		return ErrTLSBaseUnsupported
+	}
+	return setter.SetTLSBase(base)
+}
+
+// AllThreadLocations returns the current location of every thread of the
+// target, indexed by thread ID.
+func AllThreadLocations(dbp Process) (map[int]*Location, error) {
+	if _, err := dbp.Valid(); err != nil {
+		return nil, err
+	}
+	r := make(map[int]*Location)
+	for _, th := range dbp.ThreadList() {
+		loc, err := th.Location()
+		if err != nil {
+			return nil, fmt.Errorf("could not read location of thread %d: %v", th.ThreadID(), err)
+		}
+		r[th.ThreadID()] = loc
+	}
+	return r, nil
+}
+
 func getGVariable(thread Thread) (*Variable, error) {
 	regs, err := thread.Registers(false)
 	if err != nil {
@@ -518,7 +599,7 @@ func GetG(thread Thread) (*G, error) {
 
 // ThreadScope returns an EvalScope for this thread.
 func ThreadScope(thread Thread) (*EvalScope, error) {
-	locations, err := ThreadStacktrace(thread, 1)
+	locations, err := ThreadStacktrace(thread, 1, true)
 	if err != nil {
 		return nil, err
 	}
@@ -530,7 +611,7 @@ func ThreadScope(thread Thread) (*EvalScope, error) {
 
 // GoroutineScope returns an EvalScope for the goroutine running on this thread.
 func GoroutineScope(thread Thread) (*EvalScope, error) {
-	locations, err := ThreadStacktrace(thread, 1)
+	locations, err := ThreadStacktrace(thread, 1, true)
 	if err != nil {
 		return nil, err
 	}
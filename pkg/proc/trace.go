@@ -0,0 +1,215 @@
+package proc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Trace sets a tracepoint on the entry point of each function in funcs and
+// resumes the target, writing a line to w (timestamp, goroutine ID and
+// function name) every time one of them is called.
+// Trace returns when the target exits, in which case the returned error is
+// nil, or when ctx is cancelled, in which case the target is stopped, the
+// tracepoints are removed and ctx.Err() is returned.
+func Trace(ctx context.Context, dbp Process, funcs []string, w io.Writer) error {
+	if _, err := dbp.Valid(); err != nil {
+		return err
+	}
+
+	tracepoints := make(map[uint64]bool)
+	defer clearBreakpoints(dbp, tracepoints)
+	if err := setTracepoints(dbp, funcs, tracepoints); err != nil {
+		return err
+	}
+
+	if err := checkNotContinuingAsync(dbp); err != nil {
+		return err
+	}
+	// Stop requests made before the trace started are discarded, the one
+	// made when ctx is cancelled must stop the target even if it's made
+	// while the target is stopped, so continueTarget is used below.
+	dbp.CheckAndClearManualStopRequest()
+	done := make(chan struct{})
+	stopperDone := make(chan struct{})
+	go func() {
+		defer close(stopperDone)
+		select {
+		case <-ctx.Done():
+			dbp.RequestManualStop()
+		case <-done:
+		}
+	}()
+	defer func() {
+		close(done)
+		<-stopperDone
+		// don't leave the stop request behind for the next resume.
+		dbp.CheckAndClearManualStopRequest()
+	}()
+
+	for {
+		if err := continueTarget(dbp); err != nil {
+			if _, exited := err.(ErrProcessExited); exited {
+				return nil
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		for _, th := range dbp.ThreadList() {
+			bp := th.Breakpoint()
+			if bp.Breakpoint == nil || !bp.Active || !tracepoints[bp.Addr] {
+				continue
+			}
+			goid := 0
+			if g, _ := GetG(th); g != nil {
+				goid = g.ID
+			}
+			if _, err := fmt.Fprintf(w, "%s goroutine(%d) %s\n", time.Now().Format(time.RFC3339Nano), goid, bp.FunctionName); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// setTracepoints sets a tracepoint on the entry point of each function in
+// funcs, adding their addresses to tracepoints.
+func setTracepoints(dbp Process, funcs []string, tracepoints map[uint64]bool) error {
+	for _, fname := range funcs {
+		addrs, err := FindFunctionLocations(dbp, fname, true, 0)
+		if err != nil {
+			return err
+		}
+		for _, addr := range addrs {
+			bp, err := dbp.SetBreakpoint(addr, UserBreakpoint, nil)
+			if err != nil {
+				return err
+			}
+			bp.Flags |= BreakpointTracepoint
+			tracepoints[addr] = true
+		}
+	}
+	return nil
+}
+
+// clearBreakpoints clears the breakpoints at the addresses in bps, unless
+// the target has exited.
+func clearBreakpoints(dbp Process, bps map[uint64]bool) {
+	if _, err := dbp.Valid(); err != nil {
+		return
+	}
+	for addr := range bps {
+		dbp.ClearBreakpoint(addr)
+	}
+}
+
+// TraceEvent is an event of a trace file in the Chrome trace event
+// format, see:
+// https://docs.google.com/document/d/1CvAClvFfyA5R-PhYUmn5OOQtYMH4h6I0nSsKchNAySU
+type TraceEvent struct {
+	Name  string  `json:"name"`
+	Phase string  `json:"ph"`  // "B" for the entry of a function, "E" for its return
+	Time  float64 `json:"ts"`  // microseconds since the start of the trace
+	Pid   int     `json:"pid"` // process ID of the target
+	Tid   int     `json:"tid"` // goroutine ID
+}
+
+// pendingCall is a call to a traced function that hasn't returned yet.
+type pendingCall struct {
+	goid     int
+	frameoff int64 // frame offset of the caller
+	fname    string
+}
+
+// ExportTrace runs the target until it exits, tracing calls to the
+// functions in funcs, and writes the trace to the file at path in the
+// Chrome trace event format (that can be loaded by chrome://tracing).
+// The duration of each call is measured by setting a breakpoint on its
+// return address when the function is entered, calls that haven't
+// returned when the target exits only have a begin event.
+func ExportTrace(dbp Process, funcs []string, path string) error {
+	if _, err := dbp.Valid(); err != nil {
+		return err
+	}
+	fh, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	tracepoints := make(map[uint64]bool)
+	defer clearBreakpoints(dbp, tracepoints)
+	if err := setTracepoints(dbp, funcs, tracepoints); err != nil {
+		return err
+	}
+	// breakpoints set on return addresses
+	retbps := make(map[uint64]bool)
+	defer clearBreakpoints(dbp, retbps)
+	pending := make(map[uint64][]pendingCall)
+
+	var events []TraceEvent
+	start := time.Now()
+	event := func(name, phase string, goid int) {
+		events = append(events, TraceEvent{Name: name, Phase: phase, Time: float64(time.Since(start).Nanoseconds()) / 1000, Pid: dbp.Pid(), Tid: goid})
+	}
+
+	for {
+		if err := Continue(dbp); err != nil {
+			if _, exited := err.(ErrProcessExited); exited {
+				break
+			}
+			return err
+		}
+		for _, th := range dbp.ThreadList() {
+			bp := th.Breakpoint()
+			if bp.Breakpoint == nil || !bp.Active {
+				continue
+			}
+			g, _ := GetG(th)
+			goid := 0
+			if g != nil {
+				goid = g.ID
+			}
+			if calls := pending[bp.Addr]; len(calls) > 0 {
+				top, _, err := topframe(g, th)
+				if err != nil {
+					return err
+				}
+				for i := len(calls) - 1; i >= 0; i-- {
+					if calls[i].goid == goid && calls[i].frameoff == top.FrameOffset() {
+						event(calls[i].fname, "E", goid)
+						pending[bp.Addr] = append(calls[:i], calls[i+1:]...)
+						break
+					}
+				}
+			}
+			if !tracepoints[bp.Addr] {
+				continue
+			}
+			event(bp.FunctionName, "B", goid)
+			top, retframe, err := topframe(g, th)
+			if err != nil {
+				return err
+			}
+			ret := top.Ret
+			if !retbps[ret] && !tracepoints[ret] {
+				if _, err := dbp.SetBreakpoint(ret, UserBreakpoint, nil); err != nil {
+					if _, isexists := err.(BreakpointExistsError); !isexists {
+						return err
+					}
+				} else {
+					retbps[ret] = true
+				}
+			}
+			pending[ret] = append(pending[ret], pendingCall{goid, retframe.FrameOffset(), bp.FunctionName})
+		}
+	}
+
+	return json.NewEncoder(fh).Encode(struct {
+		TraceEvents []TraceEvent `json:"traceEvents"`
+	}{events})
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"go/ast"
 	"go/constant"
+	"go/parser"
 	"go/token"
 	"path/filepath"
 	"reflect"
@@ -42,6 +43,11 @@ const (
 	tflagUncommon  = 1 << 0
 	tflagExtraStar = 1 << 1
 	tflagNamed     = 1 << 2
+
+	// tflagDirectIface is set, in the TFlag field of internal/abi.Type, for
+	// types stored directly in interfaces by the versions of Go that no
+	// longer use kindDirectIface.
+	tflagDirectIface = 1 << 5
 )
 
 // These constants contain the names of the fields of runtime.interfacetype
@@ -64,6 +70,69 @@ func (bi *BinaryInfo) findType(name string) (godwarf.Type, error) {
 	return godwarf.ReadType(image.dwarf, ref.imageIndex, ref.offset, image.typeCache)
 }
 
+// TypeInfo describes a type of the target program.
+type TypeInfo struct {
+	Name string
+	Kind reflect.Kind
+	Size int64 // size of a value of the type, in bytes
+	// Fields are the fields of a struct type.
+	Fields []TypeField
+	// Elem is the name of the element type of pointers, arrays, slices,
+	// channels and maps.
+	Elem string
+	Key  string // name of the key type of maps
+	Len  int64  // length of arrays
+}
+
+// TypeField is a field of a struct type.
+type TypeField struct {
+	Name   string
+	Type   string
+	Offset int64 // offset of the field from the start of the struct
+	Size   int64
+}
+
+// TypeByName returns the description of the type called name, which can
+// be any type expression that can be used in a type cast (for example
+// main.Foo, *main.Foo or []main.Foo) or the verbatim name used in the
+// debug informations of the target.
+func (bi *BinaryInfo) TypeByName(name string) (*TypeInfo, error) {
+	var typ godwarf.Type
+	if expr, err := parser.ParseExpr(name); err == nil {
+		typ, err = bi.findTypeExpr(expr)
+		if err != nil {
+			return nil, err
+		}
+	} else if typ, err = bi.findType(name); err != nil {
+		return nil, err
+	}
+
+	rtyp := resolveTypedef(typ)
+	r := &TypeInfo{Name: typ.Common().Name, Kind: rtyp.Common().ReflectKind, Size: rtyp.Size()}
+	if r.Kind == reflect.Invalid {
+		r.Kind = typ.Common().ReflectKind
+	}
+	switch rtyp := rtyp.(type) {
+	case *godwarf.StructType:
+		for _, field := range rtyp.Field {
+			r.Fields = append(r.Fields, TypeField{Name: field.Name, Type: field.Type.Common().Name, Offset: field.ByteOffset, Size: field.Type.Size()})
+		}
+	case *godwarf.PtrType:
+		r.Elem = rtyp.Type.Common().Name
+	case *godwarf.ArrayType:
+		r.Elem = rtyp.Type.Common().Name
+		r.Len = rtyp.Count
+	case *godwarf.SliceType:
+		r.Elem = rtyp.ElemType.Common().Name
+	case *godwarf.ChanType:
+		r.Elem = rtyp.ElemType.Common().Name
+	case *godwarf.MapType:
+		r.Key = rtyp.KeyType.Common().Name
+		r.Elem = rtyp.ElemType.Common().Name
+	}
+	return r, nil
+}
+
 func pointerTo(typ godwarf.Type, arch Arch) godwarf.Type {
 	return &godwarf.PtrType{
 		CommonType: godwarf.CommonType{
@@ -590,9 +659,7 @@ func runtimeTypeToDIE(_type *Variable, dataAddr uintptr) (typ godwarf.Type, kind
 				return nil, 0, fmt.Errorf("invalid interface type: %v", err)
 			}
 			if rtdie.kind == -1 {
-				if kindField := _type.loadFieldNamed("kind"); kindField != nil && kindField.Value != nil {
-					rtdie.kind, _ = constant.Int64Val(kindField.Value)
-				}
+				rtdie.kind = runtimeTypeKind(_type)
 			}
 			return typ, rtdie.kind, nil
 		}
@@ -613,6 +680,28 @@ func runtimeTypeToDIE(_type *Variable, dataAddr uintptr) (typ godwarf.Type, kind
 	return typ, kind, nil
 }
 
+// runtimeTypeKind returns the value of the kind field of _type, or -1 if
+// it can't be read. Since Go 1.21 runtime._type is internal/abi.Type, whose
+// kind field is named Kind_, and newer versions of Go flag the types stored
+// directly in interfaces in TFlag instead, kindDirectIface is set in the
+// returned value for them.
+func runtimeTypeKind(_type *Variable) int64 {
+	kindField := _type.loadFieldNamed("kind")
+	if kindField == nil {
+		kindField = _type.loadFieldNamed("Kind_")
+	}
+	if kindField == nil || kindField.Value == nil {
+		return -1
+	}
+	kind, _ := constant.Int64Val(kindField.Value)
+	if tflagField := _type.loadFieldNamed("TFlag"); tflagField != nil && tflagField.Value != nil {
+		if tflag, _ := constant.Int64Val(tflagField.Value); tflag&tflagDirectIface != 0 {
+			kind |= kindDirectIface
+		}
+	}
+	return kind
+}
+
 type nameOfRuntimeTypeEntry struct {
 	typename string
 	kind     int64
@@ -863,7 +952,7 @@ func nameOfInterfaceRuntimeType(mds []moduleData, _type *Variable, kind, tflag i
 	buf.WriteString("interface {")
 
 	methods, _ := _type.structMember(interfacetypeFieldMhdr)
-	methods.loadArrayValues(0, LoadConfig{false, 1, 0, 4096, -1, 0})
+	methods.loadArrayValues(0, LoadConfig{false, 1, 0, 4096, -1, 0, false, false})
 	if methods.Unreadable != nil {
 		return "", nil
 	}
@@ -924,7 +1013,7 @@ func nameOfStructRuntimeType(mds []moduleData, _type *Variable, kind, tflag int6
 	buf.WriteString("struct {")
 
 	fields, _ := _type.structMember("fields")
-	fields.loadArrayValues(0, LoadConfig{false, 2, 0, 4096, -1, 0})
+	fields.loadArrayValues(0, LoadConfig{false, 2, 0, 4096, -1, 0, false, false})
 	if fields.Unreadable != nil {
 		return "", fields.Unreadable
 	}
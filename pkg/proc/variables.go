@@ -36,6 +36,8 @@ const (
 
 	maxFramePrefetchSize = 1 * 1024 * 1024 // Maximum prefetch size for a stack frame
 
+	maxRawBytes = 64 * 1024 // Maximum number of bytes of memory read into Variable.RawBytes
+
 	maxMapBucketsFactor = 100 // Maximum numbers of map buckets to read for every requested map entry when loading variables through (*EvalScope).LocalVariables and (*EvalScope).FunctionArguments.
 )
 
@@ -71,6 +73,10 @@ const (
 	VariableArgument
 	// VariableReturnArgument means this variable is a function return value
 	VariableReturnArgument
+	// VariableOptimizedOut means the compiler did not record the location of
+	// this variable at the current PC, its name and type are known but its
+	// value is not.
+	VariableOptimizedOut
 )
 
 // Variable represents a variable. It contains the address, name,
@@ -103,6 +109,10 @@ type Variable struct {
 	stride    int64
 	fieldType godwarf.Type
 
+	// position of bit fields of C structs inside the byte at Addr, bitSize
+	// is zero for variables that aren't bit fields
+	bitOffset, bitSize int64
+
 	// number of elements to skip when loading a map
 	mapSkip int
 
@@ -111,6 +121,16 @@ type Variable struct {
 	loaded     bool
 	Unreadable error
 
+	// RawBytes is the contents of the memory of the variable, read from the
+	// target, truncated to maxRawBytes. It is only set when
+	// LoadConfig.LoadRawBytes is set, on the variables returned by
+	// evaluation, not on their children.
+	RawBytes []byte
+
+	// ItabMethods are the names of the functions in the method table of a
+	// non-empty interface, only set when LoadConfig.LoadItabMethods is set.
+	ItabMethods []string
+
 	LocationExpr string // location expression
 	DeclLine     int64  // line number of this variable's declaration
 }
@@ -156,10 +176,18 @@ type LoadConfig struct {
 	// sparse map is in scope, but evaluating a single variable will still work
 	// correctly, even if the variable in question is a very sparse map.
 	MaxMapBuckets int
+
+	// LoadRawBytes requests the contents of the memory of the variable to be
+	// read into Variable.RawBytes.
+	LoadRawBytes bool
+
+	// LoadItabMethods requests the method table of non-empty interfaces to
+	// be read into Variable.ItabMethods.
+	LoadItabMethods bool
 }
 
-var loadSingleValue = LoadConfig{false, 0, 64, 0, 0, 0}
-var loadFullValue = LoadConfig{true, 1, 64, 64, -1, 0}
+var loadSingleValue = LoadConfig{false, 0, 64, 0, 0, 0, false, false}
+var loadFullValue = LoadConfig{true, 1, 64, 64, -1, 0, false, false}
 
 // G status, from: src/runtime/runtime2.go
 const (
@@ -172,8 +200,115 @@ const (
 	Gdead                         // 6
 	Genqueue                      // 7 Only the Gscanenqueue is used.
 	Gcopystack                    // 8 in this state when newstack is moving the stack
+	Gpreempted                    // 9 stopped itself for a suspendG preemption (go 1.14)
+	Gleaked                       // 10 leaked goroutine caught by the GC (go 1.26)
+	Gdeadextra                    // 11 dead goroutine attached to an extra M (go 1.26)
 )
 
+// gscan is the bit set in the status of goroutines whose stack is being
+// scanned by the garbage collector, from: src/runtime/runtime2.go
+const gscan uint64 = 0x1000
+
+var gstatusStrings = [...]string{
+	Gidle:           "idle",
+	Grunnable:       "runnable",
+	Grunning:        "running",
+	Gsyscall:        "syscall",
+	Gwaiting:        "waiting",
+	GmoribundUnused: "moribund",
+	Gdead:           "dead",
+	Genqueue:        "enqueue",
+	Gcopystack:      "copystack",
+	Gpreempted:      "preempted",
+	Gleaked:         "leaked",
+	Gdeadextra:      "deadextra",
+}
+
+// gstatusMinVersion is the version of go that introduced the G status
+// values added after Gcopystack, for older versions of go they are not
+// valid statuses.
+var gstatusMinVersion = map[uint64][2]int{
+	Gpreempted: {1, 14},
+	Gleaked:    {1, 26},
+	Gdeadextra: {1, 26},
+}
+
+// waitReasonStrings are the descriptions of the values of runtime.waitReason
+// indexed by the name of their constant, from: src/runtime/runtime2.go.
+// The values of the constants change between versions of go, their names
+// are read from the debug info of the target. Before go 1.11 g.waitreason
+// was a string.
+var waitReasonStrings = map[string]string{
+	"waitReasonChanReceive":           "chan receive",
+	"waitReasonChanReceiveNilChan":    "chan receive (nil chan)",
+	"waitReasonChanSend":              "chan send",
+	"waitReasonChanSendNilChan":       "chan send (nil chan)",
+	"waitReasonCleanupWait":           "cleanup wait",
+	"waitReasonCoroutine":             "coroutine",
+	"waitReasonDebugCall":             "debug call",
+	"waitReasonDumpingHeap":           "dumping heap",
+	"waitReasonFinalizerWait":         "finalizer wait",
+	"waitReasonFlushProcCaches":       "flushing proc caches",
+	"waitReasonForceGCIdle":           "force gc (idle)",
+	"waitReasonGCAssistMarking":       "GC assist marking",
+	"waitReasonGCAssistWait":          "GC assist wait",
+	"waitReasonGCMarkTermination":     "GC mark termination",
+	"waitReasonGCScavengeWait":        "GC scavenge wait",
+	"waitReasonGCSweepWait":           "GC sweep wait",
+	"waitReasonGCWeakToStrongWait":    "GC weak to strong wait",
+	"waitReasonGCWorkerActive":        "GC worker (active)",
+	"waitReasonGCWorkerIdle":          "GC worker (idle)",
+	"waitReasonGarbageCollection":     "garbage collection",
+	"waitReasonGarbageCollectionScan": "garbage collection scan",
+	"waitReasonIOWait":                "IO wait",
+	"waitReasonPageTraceFlush":        "page trace flush",
+	"waitReasonPanicWait":             "panicwait",
+	"waitReasonPreempted":             "preempted",
+	"waitReasonSelect":                "select",
+	"waitReasonSelectNoCases":         "select (no cases)",
+	"waitReasonSemacquire":            "semacquire",
+	"waitReasonSleep":                 "sleep",
+	"waitReasonStoppingTheWorld":      "stopping the world",
+	"waitReasonSyncCondWait":          "sync.Cond.Wait",
+	"waitReasonSyncMutexLock":         "sync.Mutex.Lock",
+	"waitReasonSyncRWMutexLock":       "sync.RWMutex.Lock",
+	"waitReasonSyncRWMutexRLock":      "sync.RWMutex.RLock",
+	"waitReasonSyncWaitGroupWait":     "sync.WaitGroup.Wait",
+	"waitReasonSynctestChanReceive":   "chan receive (durable)",
+	"waitReasonSynctestChanSend":      "chan send (durable)",
+	"waitReasonSynctestRun":           "synctest.Run",
+	"waitReasonSynctestSelect":        "select (durable)",
+	"waitReasonSynctestWait":          "synctest.Wait",
+	"waitReasonSynctestWaitGroupWait": "sync.WaitGroup.Wait (durable)",
+	"waitReasonTimerGoroutineIdle":    "timer goroutine (idle)",
+	"waitReasonTraceGoroutineStatus":  "trace goroutine status",
+	"waitReasonTraceProcStatus":       "trace proc status",
+	"waitReasonTraceReaderBlocked":    "trace reader (blocked)",
+	"waitReasonUpdateGOMAXPROCSIdle":  "GOMAXPROCS updater (idle)",
+	"waitReasonWaitForGCCycle":        "wait for GC cycle",
+	"waitReasonZero":                  "",
+}
+
+// waitReasonString returns the description of the runtime.waitReason value
+// in wrvar, or the name of its constant if the description isn't known.
+func waitReasonString(wrvar *Variable) string {
+	name := wrvar.ConstDescr()
+	if name == "" {
+		n, _ := constant.Uint64Val(wrvar.Value)
+		if n == 0 {
+			return ""
+		}
+		return fmt.Sprintf("waitreason(%d)", n)
+	}
+	if dot := strings.LastIndex(name, "."); dot >= 0 {
+		name = name[dot+1:]
+	}
+	if descr, ok := waitReasonStrings[name]; ok {
+		return descr
+	}
+	return name
+}
+
 // G represents a runtime G (goroutine) structure (at least the
 // fields that Delve is interested in).
 type G struct {
@@ -235,6 +370,16 @@ type EvalScope struct {
 	// The goroutine executing the expression evaluation shall signal that the
 	// evaluation is complete by closing the continueRequest channel.
 	callCtx *callContext
+
+	// locals, if not nil, caches the result of Locals, see EvalVariables.
+	locals *localsCache
+}
+
+// localsCache holds the local variables of an EvalScope, or the error
+// returned reading them.
+type localsCache struct {
+	vars []*Variable
+	err  error
 }
 
 // IsNilErr is returned when a variable is nil.
@@ -336,7 +481,7 @@ func newVariable(name string, addr uintptr, dwarfType godwarf.Type, bi *BinaryIn
 		v.stride = 0
 
 		if t.Count > 0 {
-			v.stride = t.ByteSize / t.Count
+			v.stride = t.Size() / t.Count
 		}
 	case *godwarf.ComplexType:
 		switch t.ByteSize {
@@ -349,6 +494,12 @@ func newVariable(name string, addr uintptr, dwarfType godwarf.Type, bi *BinaryIn
 		v.Kind = reflect.Int
 	case *godwarf.UintType:
 		v.Kind = reflect.Uint
+	case *godwarf.CharType:
+		// C char and signed char
+		v.Kind = reflect.Int8
+	case *godwarf.UcharType:
+		// C unsigned char
+		v.Kind = reflect.Uint8
 	case *godwarf.FloatType:
 		switch t.ByteSize {
 		case 4:
@@ -445,6 +596,12 @@ func (v *Variable) toField(field *godwarf.StructField) (*Variable, error) {
 			name = fmt.Sprintf("%s.%s", v.Name, field.Name)
 		}
 	}
+	if field.BitSize > 0 {
+		r := v.newVariable(name, uintptr(int64(v.Addr)+field.DataBitOffset/8), field.Type, v.mem)
+		r.bitOffset = field.DataBitOffset % 8
+		r.bitSize = field.BitSize
+		return r, nil
+	}
 	return v.newVariable(name, uintptr(int64(v.Addr)+field.ByteOffset), field.Type, v.mem), nil
 }
 
@@ -508,7 +665,7 @@ func (v *Variable) parseG() (*G, error) {
 		}
 		v = v.maybeDereference()
 	}
-	v.loadValue(LoadConfig{false, 2, 64, 0, -1, 0})
+	v.loadValue(LoadConfig{false, 2, 64, 0, -1, 0, false, false})
 	if v.Unreadable != nil {
 		return nil, v.Unreadable
 	}
@@ -523,14 +680,13 @@ func (v *Variable) parseG() (*G, error) {
 	gopc, _ := constant.Int64Val(v.fieldVariable("gopc").Value)
 	startpc, _ := constant.Int64Val(v.fieldVariable("startpc").Value)
 	waitReason := ""
-	if wrvar := v.fieldVariable("waitreason"); wrvar.Value != nil {
+	if wrvar := v.fieldVariable("waitreason"); wrvar != nil && wrvar.Value != nil {
 		switch wrvar.Kind {
 		case reflect.String:
 			waitReason = constant.StringVal(wrvar.Value)
-		case reflect.Uint:
-			waitReason = wrvar.ConstDescr()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			waitReason = waitReasonString(wrvar)
 		}
-
 	}
 	var stackhi, stacklo uint64
 	if stackVar := v.fieldVariable("stack"); stackVar != nil {
@@ -549,7 +705,15 @@ func (v *Variable) parseG() (*G, error) {
 		stkbarPos, _ = constant.Int64Val(stkbarVarPosFld.Value)
 	}
 
-	status, _ := constant.Int64Val(v.fieldVariable("atomicstatus").Value)
+	// since go 1.20 atomicstatus is a runtime/internal/atomic.Uint32
+	statusVar := v.fieldVariable("atomicstatus")
+	if statusVar != nil && statusVar.Kind == reflect.Struct {
+		statusVar = statusVar.fieldVariable("value")
+	}
+	if statusVar == nil {
+		return nil, errors.New("could not read goroutine status")
+	}
+	status, _ := constant.Int64Val(statusVar.Value)
 	f, l, fn := v.bi.PCToLine(uint64(pc))
 	g := &G{
 		ID:         int(id),
@@ -647,17 +811,85 @@ func (g *G) Go() Location {
 	return Location{PC: g.GoPC, File: f, Line: l, Fn: fn}
 }
 
+// StatusString returns a description of the status of the goroutine,
+// ignoring the gscan bit. Statuses that are not valid for the version of
+// go that built the target are described by their value.
+func (g *G) StatusString() string {
+	status := g.Status &^ gscan
+	if status >= uint64(len(gstatusStrings)) {
+		return fmt.Sprintf("status(%d)", g.Status)
+	}
+	if ver, ok := gstatusMinVersion[status]; ok && g.variable != nil {
+		if producer := g.variable.bi.Producer(); producer != "" && !goversion.ProducerAfterOrEqual(producer, ver[0], ver[1]) {
+			return fmt.Sprintf("status(%d)", g.Status)
+		}
+	}
+	return gstatusStrings[status]
+}
+
 // StartLoc returns the starting location of the goroutine.
 func (g *G) StartLoc() Location {
 	f, l, fn := g.variable.bi.PCToLine(g.StartPC)
 	return Location{PC: g.StartPC, File: f, Line: l, Fn: fn}
 }
 
+// Labels returns the profiler labels of the goroutine, set with
+// runtime/pprof.Do or runtime/pprof.SetGoroutineLabels, or nil if it
+// doesn't have any.
+func (g *G) Labels() map[string]string {
+	if g.variable == nil {
+		return nil
+	}
+	labelsVar := g.variable.fieldVariable("labels")
+	if labelsVar == nil || len(labelsVar.Children) != 1 || labelsVar.Children[0].Addr == 0 {
+		return nil
+	}
+	labelMapType, err := g.variable.bi.findType("runtime/pprof.labelMap")
+	if err != nil {
+		return nil
+	}
+	labelMap := newVariable("", labelsVar.Children[0].Addr, labelMapType, g.variable.bi, g.variable.mem)
+	labelMap.loadValue(LoadConfig{true, 4, 1024, 64, -1, 0, false, false})
+	if labelMap.Unreadable != nil {
+		return nil
+	}
+	labels := map[string]string{}
+	switch labelMap.Kind {
+	case reflect.Map:
+		// before Go 1.24 labelMap was a map[string]string
+		for i := 0; i+1 < len(labelMap.Children); i += 2 {
+			labels[constant.StringVal(labelMap.Children[i].Value)] = constant.StringVal(labelMap.Children[i+1].Value)
+		}
+	case reflect.Struct:
+		// labelMap is a struct embedding a struct with a list of key/value
+		// pairs.
+		list := labelMap
+		for list != nil && list.Kind == reflect.Struct && len(list.Children) > 0 {
+			list = &list.Children[0]
+		}
+		if list == nil || list.Kind != reflect.Slice {
+			return nil
+		}
+		for i := range list.Children {
+			label := &list.Children[i]
+			if len(label.Children) != 2 || label.Children[0].Value == nil || label.Children[1].Value == nil {
+				continue
+			}
+			labels[constant.StringVal(label.Children[0].Value)] = constant.StringVal(label.Children[1].Value)
+		}
+	}
+	if len(labels) == 0 {
+		return nil
+	}
+	return labels
+}
+
 var errTracebackAncestorsDisabled = errors.New("tracebackancestors is disabled")
 
 // Ancestors returns the list of ancestors for g.
 func (g *G) Ancestors(n int) ([]Ancestor, error) {
-	scope := globalScope(g.Thread.BinInfo(), g.Thread.BinInfo().Images[0], g.Thread)
+	bi := g.variable.bi
+	scope := globalScope(bi, bi.Images[0], g.variable.mem)
 	tbav, err := scope.EvalExpression("runtime.debug.tracebackancestors", loadSingleValue)
 	if err == nil && tbav.Unreadable == nil && tbav.Kind == reflect.Int {
 		tba, _ := constant.Int64Val(tbav.Value)
@@ -743,12 +975,50 @@ func (a *Ancestor) Stack(n int) ([]Stackframe, error) {
 	return r, nil
 }
 
+const (
+	// maxGoroutineAncestors is the maximum number of ancestors read by
+	// GoroutineAncestors.
+	maxGoroutineAncestors = 1000
+	// maxAncestorFrames is the maximum number of frames the runtime saves
+	// for the creation stack of an ancestor (runtime._TracebackMaxFrames).
+	maxAncestorFrames = 100
+)
+
+// GoroutineAncestors returns the stacks of the ancestors of goroutine gid
+// at the time they created their child, as recorded by the runtime when
+// GODEBUG=tracebackancestors=N is set. The first stack is the one of the
+// goroutine that created gid. Returns nil if ancestry tracking is disabled.
+func GoroutineAncestors(dbp Process, gid int) ([][]Stackframe, error) {
+	g, err := FindGoroutine(dbp, gid)
+	if err != nil {
+		return nil, err
+	}
+	if g == nil {
+		return nil, fmt.Errorf("unknown goroutine %d", gid)
+	}
+	ancestors, err := g.Ancestors(maxGoroutineAncestors)
+	if err != nil {
+		if err == errTracebackAncestorsDisabled {
+			return nil, nil
+		}
+		return nil, err
+	}
+	r := make([][]Stackframe, len(ancestors))
+	for i := range ancestors {
+		r[i], err = ancestors[i].Stack(maxAncestorFrames)
+		if err != nil {
+			return nil, fmt.Errorf("could not read stack of ancestor %d: %v", ancestors[i].ID, err)
+		}
+	}
+	return r, nil
+}
+
 // Returns the list of saved return addresses used by stack barriers
 func (g *G) stkbar() ([]savedLR, error) {
 	if g.stkbarVar == nil { // stack barriers were removed in Go 1.9
 		return nil, nil
 	}
-	g.stkbarVar.loadValue(LoadConfig{false, 1, 0, int(g.stkbarVar.Len), 3, 0})
+	g.stkbarVar.loadValue(LoadConfig{false, 1, 0, int(g.stkbarVar.Len), 3, 0, false, false})
 	if g.stkbarVar.Unreadable != nil {
 		return nil, fmt.Errorf("unreadable stkbar: %v", g.stkbarVar.Unreadable)
 	}
@@ -773,8 +1043,47 @@ func (scope *EvalScope) EvalVariable(name string, cfg LoadConfig) (*Variable, er
 	return scope.EvalExpression(name, cfg)
 }
 
+// maxBatchFrameCache is the maximum size of the stack frame that
+// EvalVariables reads in a single operation.
+const maxBatchFrameCache = 1 << 16
+
+// EvalVariables evaluates each expression of exprs, like EvalVariable, and
+// returns the results in the same order. Expressions that can not be
+// evaluated do not stop the batch, their result is a variable named after
+// the expression with the error in Unreadable. Function calls are not
+// allowed.
+// The local variables of the scope and the memory of its stack frame are
+// only read once for the whole batch.
+func (scope *EvalScope) EvalVariables(exprs []string, cfg LoadConfig) ([]*Variable, error) {
+	if !scope.BinInfo.HasDWARF() {
+		return nil, ErrNoDebugInfo
+	}
+	batch := *scope
+	batch.callCtx = nil
+	if sp, cfa := batch.Regs.SP(), uint64(batch.Regs.CFA); cfa > sp && cfa-sp <= maxBatchFrameCache {
+		batch.Mem = cacheMemory(batch.Mem, uintptr(sp), int(cfa-sp))
+	}
+	vars, err := batch.Locals()
+	batch.locals = &localsCache{vars, err}
+
+	r := make([]*Variable, len(exprs))
+	for i, expr := range exprs {
+		v, err := batch.EvalExpression(expr, cfg)
+		if err != nil {
+			v = batch.newVariable(expr, 0, nil, batch.Mem)
+			v.loaded = true
+			v.Unreadable = err
+		}
+		r[i] = v
+	}
+	return r, nil
+}
+
 // SetVariable sets the value of the named variable
 func (scope *EvalScope) SetVariable(name, value string) error {
+	if !scope.BinInfo.HasDWARF() {
+		return ErrNoDebugInfo
+	}
 	t, err := parser.ParseExpr(name)
 	if err != nil {
 		return err
@@ -803,6 +1112,12 @@ func (scope *EvalScope) SetVariable(name, value string) error {
 		return err
 	}
 
+	if xv.Kind == reflect.String && yv.Kind == reflect.String && yv.Unreadable == nil {
+		if err := allocString(scope, yv); err != nil {
+			return err
+		}
+	}
+
 	return xv.setValue(yv, value)
 }
 
@@ -829,6 +1144,22 @@ func (scope *EvalScope) FunctionArguments(cfg LoadConfig) ([]*Variable, error) {
 	vars = filterVariables(vars, func(v *Variable) bool {
 		return (v.Flags & (VariableArgument | VariableReturnArgument)) != 0
 	})
+	if scope.Fn != nil && scope.PC == scope.Fn.Entry && scope.BinInfo.usesRegabi() {
+		// At the entry point of the function, before the prologue, the
+		// arguments are still in the registers assigned by the register ABI
+		// and haven't been spilled to the stack yet.
+		args := filterVariables(vars, func(v *Variable) bool {
+			return (v.Flags & VariableArgument) != 0
+		})
+		args = regabiValues(scope.BinInfo, scope.Mem, scope.Regs, args)
+		j := 0
+		for i := range vars {
+			if vars[i].Flags&VariableArgument != 0 {
+				vars[i] = args[j]
+				j++
+			}
+		}
+	}
 	cfg.MaxMapBuckets = maxMapBucketsFactor * cfg.MaxArrayValues
 	loadValues(vars, cfg)
 	return vars, nil
@@ -846,6 +1177,9 @@ func filterVariables(vars []*Variable, pred func(v *Variable) bool) []*Variable
 
 // PackageVariables returns the name, value, and type of all package variables in the application.
 func (scope *EvalScope) PackageVariables(cfg LoadConfig) ([]*Variable, error) {
+	if !scope.BinInfo.HasDWARF() {
+		return nil, ErrNoDebugInfo
+	}
 	var vars []*Variable
 	for _, image := range scope.BinInfo.Images {
 		if image.loadErr != nil {
@@ -881,18 +1215,170 @@ func (scope *EvalScope) PackageVariables(cfg LoadConfig) ([]*Variable, error) {
 	return vars, nil
 }
 
-func (scope *EvalScope) findGlobal(name string) (*Variable, error) {
-	for _, pkgvar := range scope.BinInfo.packageVars {
-		if pkgvar.name == name || strings.HasSuffix(pkgvar.name, "/"+name) {
-			reader := pkgvar.cu.image.dwarfReader
-			reader.Seek(pkgvar.offset)
-			entry, err := reader.Next()
+// EvalConstant returns the value of the constant with the given name.
+// Constants do not occupy memory in the target, their value is read from
+// the DW_AT_const_value attribute of their debug_info entry. Integer,
+// floating point and string constants are supported.
+func (scope *EvalScope) EvalConstant(name string) (*Variable, error) {
+	if !scope.BinInfo.HasDWARF() {
+		return nil, ErrNoDebugInfo
+	}
+	for _, image := range scope.BinInfo.Images {
+		if image.loadErr != nil {
+			continue
+		}
+		rdr := image.DwarfReader()
+		isgo := false
+		for entry, err := rdr.Next(); entry != nil; entry, err = rdr.Next() {
+			if err != nil {
+				return nil, err
+			}
+			switch entry.Tag {
+			case dwarf.TagCompileUnit:
+				lang, _ := entry.Val(dwarf.AttrLanguage).(int64)
+				isgo = lang == dwarfGoLanguage
+				continue
+			case dwarf.TagConstant:
+				// ok
+			default:
+				rdr.SkipChildren()
+				continue
+			}
+			cname, _ := entry.Val(dwarf.AttrName).(string)
+			if !isgo {
+				cname = "C." + cname
+			}
+			if cname != name && !strings.HasSuffix(cname, "/"+name) {
+				continue
+			}
+			typoff, ok := entry.Val(dwarf.AttrType).(dwarf.Offset)
+			if !ok {
+				return nil, fmt.Errorf("constant %s has no type", name)
+			}
+			t, err := image.Type(typoff)
 			if err != nil {
 				return nil, err
 			}
-			return scope.globalFor(pkgvar.cu.image).extractVarInfoFromEntry(entry)
+			v := scope.globalFor(image).newVariable(name, 0x0, t, scope.Mem)
+			v.Value, err = constValueAttr(v.Kind, v.RealType.Size(), entry.Val(dwarf.AttrConstValue))
+			if err != nil {
+				return nil, fmt.Errorf("constant %s: %v", name, err)
+			}
+			if v.Kind == reflect.String {
+				v.Len = int64(len(constant.StringVal(v.Value)))
+			}
+			v.Flags |= VariableConstant
+			v.loaded = true
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("could not find constant %s", name)
+}
+
+// constValueAttr converts the value of a DW_AT_const_value attribute to a
+// constant of the specified kind and size. The attribute is either an
+// integer, a string or a block containing the target representation of the
+// value.
+func constValueAttr(kind reflect.Kind, size int64, attr interface{}) (constant.Value, error) {
+	switch attr := attr.(type) {
+	case int64:
+		switch kind {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return constant.MakeInt64(attr), nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return constant.MakeUint64(uint64(attr)), nil
+		case reflect.Bool:
+			return constant.MakeBool(attr != 0), nil
+		}
+	case string:
+		if kind == reflect.String {
+			return constant.MakeString(attr), nil
+		}
+	case []byte:
+		switch kind {
+		case reflect.Float32:
+			if len(attr) == 4 {
+				return constant.MakeFloat64(float64(math.Float32frombits(binary.LittleEndian.Uint32(attr)))), nil
+			}
+		case reflect.Float64:
+			if len(attr) == 8 {
+				return constant.MakeFloat64(math.Float64frombits(binary.LittleEndian.Uint64(attr))), nil
+			}
+		case reflect.String:
+			return constant.MakeString(string(bytes.TrimRight(attr, "\x00"))), nil
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if int64(len(attr)) == size && size <= 8 {
+				buf := make([]byte, 8)
+				copy(buf, attr)
+				n := int64(binary.LittleEndian.Uint64(buf))
+				n = n << uint(64-8*size) >> uint(64-8*size)
+				return constant.MakeInt64(n), nil
+			}
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			if int64(len(attr)) == size && size <= 8 {
+				buf := make([]byte, 8)
+				copy(buf, attr)
+				return constant.MakeUint64(binary.LittleEndian.Uint64(buf)), nil
+			}
+		}
+	case nil:
+		return nil, errors.New("no value")
+	}
+	return nil, fmt.Errorf("unsupported constant kind %v", kind)
+}
+
+// EvalGlobal returns the value of the package variable with the given
+// fully qualified name, for example "os.Args" or
+// "github.com/go-delve/delve/pkg/proc.ErrNoDebugInfo", the package path can
+// be abbreviated to its last elements. The variables of all packages, in
+// all images, are searched.
+func (scope *EvalScope) EvalGlobal(name string, cfg LoadConfig) (*Variable, error) {
+	if !scope.BinInfo.HasDWARF() {
+		return nil, ErrNoDebugInfo
+	}
+	pkgvar := scope.BinInfo.findPackageVar(name)
+	if pkgvar == nil {
+		return nil, fmt.Errorf("could not find package variable %s", name)
+	}
+	v, err := scope.packageVarVariable(pkgvar)
+	if err != nil {
+		return nil, err
+	}
+	v.loadValue(cfg)
+	return v, nil
+}
+
+// findPackageVar returns the package variable with the given name, a
+// variable whose fully qualified name is name is preferred to one whose
+// package path only ends with the package path of name.
+func (bi *BinaryInfo) findPackageVar(name string) *packageVar {
+	var r *packageVar
+	for i := range bi.packageVars {
+		pkgvar := &bi.packageVars[i]
+		if pkgvar.name == name {
+			return pkgvar
+		}
+		if r == nil && strings.HasSuffix(pkgvar.name, "/"+name) {
+			r = pkgvar
 		}
 	}
+	return r
+}
+
+func (scope *EvalScope) packageVarVariable(pkgvar *packageVar) (*Variable, error) {
+	reader := pkgvar.cu.image.dwarfReader
+	reader.Seek(pkgvar.offset)
+	entry, err := reader.Next()
+	if err != nil {
+		return nil, err
+	}
+	return scope.globalFor(pkgvar.cu.image).extractVarInfoFromEntry(entry)
+}
+
+func (scope *EvalScope) findGlobal(name string) (*Variable, error) {
+	if pkgvar := scope.BinInfo.findPackageVar(name); pkgvar != nil {
+		return scope.packageVarVariable(pkgvar)
+	}
 	for _, fn := range scope.BinInfo.Functions {
 		if fn.Name == name || strings.HasSuffix(fn.Name, "/"+name) {
 			//TODO(aarzilli): convert function entry into a function type?
@@ -1051,6 +1537,9 @@ func (scope *EvalScope) extractVarInfoFromEntry(varEntry *dwarf.Entry) (*Variabl
 	v.DeclLine, _ = entry.Val(dwarf.AttrDeclLine).(int64)
 	if err != nil {
 		v.Unreadable = err
+		if _, nolocation := err.(*noLocationError); nolocation {
+			v.Flags |= VariableOptimizedOut
+		}
 	}
 	return v, nil
 }
@@ -1088,6 +1577,27 @@ func loadValues(vars []*Variable, cfg LoadConfig) {
 // Extracts the value of the variable at the given address.
 func (v *Variable) loadValue(cfg LoadConfig) {
 	v.loadValueInternal(0, cfg)
+	if cfg.LoadRawBytes {
+		v.loadRawBytes()
+	}
+}
+
+func (v *Variable) loadRawBytes() {
+	if v.Unreadable != nil || v.RawBytes != nil || v.Addr == 0 || v.RealType == nil {
+		return
+	}
+	sz := v.RealType.Size()
+	if sz <= 0 {
+		return
+	}
+	if sz > maxRawBytes {
+		sz = maxRawBytes
+	}
+	buf := make([]byte, sz)
+	if _, err := v.mem.ReadMemory(buf, v.Addr); err != nil {
+		return
+	}
+	v.RawBytes = buf
 }
 
 func (v *Variable) loadValueInternal(recurseLevel int, cfg LoadConfig) {
@@ -1096,18 +1606,28 @@ func (v *Variable) loadValueInternal(recurseLevel int, cfg LoadConfig) {
 	}
 
 	v.loaded = true
+	if v.bitSize > 0 {
+		v.loadBitField()
+		return
+	}
 	switch v.Kind {
 	case reflect.Ptr, reflect.UnsafePointer:
 		v.Len = 1
 		v.Children = []Variable{*v.maybeDereference()}
 		if cfg.FollowPointers {
 			// Don't increase the recursion level when dereferencing pointers
-			// unless this is a pointer to interface (which could cause an infinite loop)
+			// unless this is a pointer to interface or a pointer to pointer
+			// (which could cause an infinite loop, for example with type T *T)
 			nextLvl := recurseLevel
-			if v.Children[0].Kind == reflect.Interface {
+			switch v.Children[0].Kind {
+			case reflect.Interface, reflect.Ptr:
 				nextLvl++
 			}
-			v.Children[0].loadValueInternal(nextLvl, cfg)
+			if v.Children[0].Kind == reflect.Ptr && nextLvl > cfg.MaxVariableRecurse {
+				v.Children[0].OnlyAddr = true
+			} else {
+				v.Children[0].loadValueInternal(nextLvl, cfg)
+			}
 		} else {
 			v.Children[0].OnlyAddr = true
 		}
@@ -1158,16 +1678,19 @@ func (v *Variable) loadValueInternal(recurseLevel int, cfg LoadConfig) {
 
 	case reflect.Interface:
 		v.loadInterface(recurseLevel, true, cfg)
+		if cfg.LoadItabMethods && v.Unreadable == nil {
+			v.ItabMethods, _ = v.readItabMethods()
+		}
 
 	case reflect.Complex64, reflect.Complex128:
 		v.readComplex(v.RealType.(*godwarf.ComplexType).ByteSize)
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		var val int64
-		val, v.Unreadable = readIntRaw(v.mem, v.Addr, v.RealType.(*godwarf.IntType).ByteSize)
+		val, v.Unreadable = readIntRaw(v.mem, v.Addr, v.RealType.Size())
 		v.Value = constant.MakeInt64(val)
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
 		var val uint64
-		val, v.Unreadable = readUintRaw(v.mem, v.Addr, v.RealType.(*godwarf.UintType).ByteSize)
+		val, v.Unreadable = readUintRaw(v.mem, v.Addr, v.RealType.Size())
 		v.Value = constant.MakeUint64(val)
 
 	case reflect.Bool:
@@ -1191,6 +1714,9 @@ func (v *Variable) loadValueInternal(recurseLevel int, cfg LoadConfig) {
 		}
 	case reflect.Func:
 		v.readFunctionPtr()
+		if v.Unreadable == nil && recurseLevel <= cfg.MaxVariableRecurse {
+			v.loadClosureVars(recurseLevel, cfg)
+		}
 	default:
 		v.Unreadable = fmt.Errorf("unknown or unsupported kind: \"%s\"", v.Kind.String())
 	}
@@ -1209,6 +1735,9 @@ func (v *Variable) loadValueInternal(recurseLevel int, cfg LoadConfig) {
 // * If srcv and dstv have the same type and are both addressable then the
 //   contents of srcv are copied byte-by-byte into dstv
 func (v *Variable) setValue(srcv *Variable, srcExpr string) error {
+	if v.bitSize > 0 {
+		return fmt.Errorf("can not set bit field %s (not implemented)", v.Name)
+	}
 	srcv.loadValue(loadSingleValue)
 
 	typerr := srcv.isType(v.RealType, v.Kind)
@@ -1253,6 +1782,12 @@ func (v *Variable) setValue(srcv *Variable, srcExpr string) error {
 		return v.writeZero()
 	}
 
+	// string assignment, the bytes of the string must already be stored in
+	// the memory of the target (see allocString)
+	if srcv.Kind == reflect.String && srcv.Base != 0 {
+		return v.writeString(uint64(srcv.Len), uint64(srcv.Base))
+	}
+
 	// slice assignment (this is not handled by the writeCopy below so that
 	// results of a reslice operation can be used here).
 	if srcv.Kind == reflect.Slice {
@@ -1601,6 +2136,41 @@ func readUintRaw(mem MemoryReadWriter, addr uintptr, size int64) (uint64, error)
 	return n, nil
 }
 
+// loadBitField loads the value of a bit field of a C struct, only integer
+// and boolean bit fields are supported.
+func (v *Variable) loadBitField() {
+	switch v.Kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+	case reflect.Bool:
+	default:
+		v.Unreadable = fmt.Errorf("bit fields of type %s are not supported", v.TypeString())
+		return
+	}
+	n := (v.bitOffset + v.bitSize + 7) / 8
+	if n > 8 {
+		v.Unreadable = fmt.Errorf("bit field of %d bits at bit offset %d is not supported", v.bitSize, v.bitOffset)
+		return
+	}
+	buf := make([]byte, 8)
+	if _, err := v.mem.ReadMemory(buf[:n], v.Addr); err != nil {
+		v.Unreadable = err
+		return
+	}
+	x := binary.LittleEndian.Uint64(buf) >> uint(v.bitOffset)
+	x &= (1 << uint(v.bitSize)) - 1
+	switch v.Kind {
+	case reflect.Bool:
+		v.Value = constant.MakeBool(x != 0)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		v.Value = constant.MakeUint64(x)
+	default:
+		// sign extension
+		shift := uint(64 - v.bitSize)
+		v.Value = constant.MakeInt64(int64(x<<shift) >> shift)
+	}
+}
+
 func (v *Variable) readFloatRaw(size int64) (float64, error) {
 	val := make([]byte, int(size))
 	_, err := v.mem.ReadMemory(val, v.Addr)
@@ -1663,6 +2233,13 @@ func (v *Variable) writeEmptyInterface(typeAddr uint64, data *Variable) error {
 	return nil
 }
 
+func (v *Variable) writeString(len, base uint64) error {
+	if err := writePointer(v.bi, v.mem, uint64(v.Addr), base); err != nil {
+		return err
+	}
+	return writePointer(v.bi, v.mem, uint64(v.Addr)+uint64(v.bi.Arch.PtrSize()), len)
+}
+
 func (v *Variable) writeSlice(len, cap int64, base uintptr) error {
 	for _, f := range v.RealType.(*godwarf.SliceType).Field {
 		switch f.Name {
@@ -1725,6 +2302,75 @@ func (v *Variable) readFunctionPtr() {
 	v.Value = constant.MakeString(fn.Name)
 }
 
+// loadClosureVars loads the variables captured by the closure v as its
+// children. This is only possible if the compiler describes the layout of
+// the closure struct in the debug_info of the closure function (Go 1.23
+// and later).
+func (v *Variable) loadClosureVars(recurseLevel int, cfg LoadConfig) {
+	if v.Base == 0 {
+		return
+	}
+	fn := v.bi.PCToFunc(uint64(v.Base))
+	if fn == nil {
+		return
+	}
+	closureAddr := v.funcvalAddr()
+	if v.Unreadable != nil || closureAddr == 0 {
+		return
+	}
+
+	image := fn.cu.image
+	rdr := image.DwarfReader()
+	rdr.Seek(fn.offset)
+	entry, err := rdr.Next()
+	if err != nil || entry == nil || !entry.Children {
+		return
+	}
+	var closureVars []*Variable
+	for {
+		entry, err = rdr.Next()
+		if err != nil || entry == nil || entry.Tag == 0 {
+			break
+		}
+		if entry.Tag != dwarf.TagVariable {
+			if entry.Children {
+				rdr.SkipChildren()
+			}
+			continue
+		}
+		off, ok := entry.Val(godwarf.AttrGoClosureOffset).(int64)
+		if !ok {
+			continue
+		}
+		name, _ := entry.Val(dwarf.AttrName).(string)
+		typeOff, ok := entry.Val(dwarf.AttrType).(dwarf.Offset)
+		if !ok {
+			continue
+		}
+		typ, err := image.Type(typeOff)
+		if err != nil {
+			continue
+		}
+		cv := newVariable(name, uintptr(closureAddr+uint64(off)), typ, v.bi, v.mem)
+		closureVars = append(closureVars, cv)
+	}
+
+	// list captured variables in the order they appear in the closure struct
+	sort.Slice(closureVars, func(i, j int) bool { return closureVars[i].Addr < closureVars[j].Addr })
+
+	for _, cv := range closureVars {
+		if strings.HasPrefix(cv.Name, "&") {
+			// captured by reference, the closure struct contains a pointer to
+			// the variable
+			name := cv.Name[1:]
+			cv = cv.maybeDereference()
+			cv.Name = name
+		}
+		cv.loadValueInternal(recurseLevel+1, cfg)
+		v.Children = append(v.Children, *cv)
+	}
+}
+
 // funcvalAddr reads the address of the funcval contained in a function variable.
 func (v *Variable) funcvalAddr() uint64 {
 	val := make([]byte, v.bi.Arch.PtrSize())
@@ -2153,6 +2799,128 @@ func (v *Variable) ConstDescr() string {
 	return ""
 }
 
+// memoryRegionDescriber is implemented by the threads of targets that can
+// describe the memory mapping containing an address.
+type memoryRegionDescriber interface {
+	MemoryRegion(addr uint64) string
+}
+
+// PointerDescr describes the address a pointer points to: with the name of
+// the global variable or function at that address or, if the target can
+// list its memory mappings, with the memory region containing it.
+// Returns an empty string for nil pointers and unknown addresses.
+func (v *Variable) PointerDescr() string {
+	if v.bi == nil || (v.Kind != reflect.Ptr && v.Kind != reflect.UnsafePointer) || len(v.Children) != 1 {
+		return ""
+	}
+	addr := uint64(v.Children[0].Addr)
+	if addr == 0 {
+		return ""
+	}
+	if name, off, ok := v.bi.packageVarAt(addr); ok {
+		if off != 0 {
+			return fmt.Sprintf("&%s+%#x", name, off)
+		}
+		return "&" + name
+	}
+	if fn := v.bi.PCToFunc(addr); fn != nil && fn.Entry == addr {
+		return fn.Name
+	}
+	mem := v.mem
+	for {
+		switch m := mem.(type) {
+		case *memCache:
+			mem = m.mem
+			continue
+		case *compositeMemory:
+			mem = m.realmem
+			continue
+		case memoryRegionDescriber:
+			return m.MemoryRegion(addr)
+		}
+		return ""
+	}
+}
+
+// readItabMethods returns the names of the functions in the method table of
+// the non-empty interface v, in the order of the methods of the interface
+// type: they are the methods of the concrete type that implement it.
+// Returns nil for nil interfaces and empty interfaces.
+// The method table is only read when LoadConfig.LoadItabMethods is set
+// because reading it is expensive.
+func (v *Variable) readItabMethods() ([]string, error) {
+	ityp, ok := v.RealType.(*godwarf.InterfaceType)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an interface", v.Name)
+	}
+	var tab *Variable
+	for _, f := range resolveTypedef(&ityp.TypedefType).(*godwarf.StructType).Field {
+		if f.Name == "tab" {
+			var err error
+			if tab, err = v.toField(f); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if tab == nil {
+		// empty interfaces have no method table
+		return nil, nil
+	}
+	tab = tab.maybeDereference()
+	if tab.Unreadable != nil {
+		return nil, tab.Unreadable
+	}
+	if tab.Addr == 0 {
+		return nil, nil
+	}
+
+	// the fields of runtime.itab were renamed when it moved to
+	// internal/abi.ITab in go1.22.
+	inter, err := structMemberAny(tab, "inter", "Inter")
+	if err != nil {
+		return nil, err
+	}
+	methods, err := structMemberAny(inter.maybeDereference(), "mhdr", "Methods")
+	if err != nil {
+		return nil, err
+	}
+	methods.loadValue(LoadConfig{false, 0, 0, 0, 0, 0, false, false})
+	if methods.Unreadable != nil {
+		return nil, methods.Unreadable
+	}
+	fun, err := structMemberAny(tab, "fun", "Fun")
+	if err != nil {
+		return nil, err
+	}
+
+	ptrSize := int64(v.bi.Arch.PtrSize())
+	r := make([]string, 0, methods.Len)
+	for i := int64(0); i < methods.Len; i++ {
+		pc, err := readUintRaw(v.mem, fun.Addr+uintptr(i*ptrSize), ptrSize)
+		if err != nil {
+			return nil, err
+		}
+		if fn := v.bi.PCToFunc(pc); fn != nil {
+			r = append(r, fn.Name)
+		} else {
+			r = append(r, fmt.Sprintf("%#x", pc))
+		}
+	}
+	return r, nil
+}
+
+// structMemberAny returns the first member of v named like one of names.
+func structMemberAny(v *Variable, names ...string) (*Variable, error) {
+	var err error
+	for _, name := range names {
+		var field *Variable
+		if field, err = v.structMember(name); err == nil {
+			return field, nil
+		}
+	}
+	return nil, err
+}
+
 // popcnt is the number of bits set to 1 in x.
 // It's the same as math/bits.OnesCount64, copied here so that we can build
 // on versions of go that don't have math/bits.
@@ -2237,6 +3005,21 @@ func (v *variablesByDepth) Swap(i int, j int) {
 
 // Locals fetches all variables of a specific type in the current function scope.
 func (scope *EvalScope) Locals() ([]*Variable, error) {
+	if !scope.BinInfo.HasDWARF() {
+		return nil, ErrNoDebugInfo
+	}
+	if scope.locals != nil {
+		if scope.locals.err != nil {
+			return nil, scope.locals.err
+		}
+		// callers can modify the variables, for example loading them
+		vars := make([]*Variable, len(scope.locals.vars))
+		for i := range vars {
+			v := *scope.locals.vars[i]
+			vars[i] = &v
+		}
+		return vars, nil
+	}
 	if scope.Fn == nil {
 		return nil, errors.New("unable to find function context")
 	}
@@ -86,10 +86,10 @@ var (
 	// * Follows pointers
 	// * Loads more array values
 	// * Does not limit struct fields
-	LongLoadConfig = api.LoadConfig{true, 1, 64, 64, -1}
+	LongLoadConfig = api.LoadConfig{true, 1, 64, 64, -1, false}
 	// ShortLoadConfig loads less information, not following pointers
 	// and limiting struct fields loaded to 3.
-	ShortLoadConfig = api.LoadConfig{false, 0, 64, 0, 3}
+	ShortLoadConfig = api.LoadConfig{false, 0, 64, 0, 3, false}
 )
 
 // ByFirstAlias will sort by the first
@@ -191,7 +191,9 @@ Called with more arguments it will execute a command on the specified goroutine.
 		{aliases: []string{"breakpoints", "bp"}, cmdFn: breakpoints, helpMsg: "Print out info for active breakpoints."},
 		{aliases: []string{"print", "p"}, allowedPrefixes: onPrefix | deferredPrefix, cmdFn: printVar, helpMsg: `Evaluate an expression.
 
-	[goroutine <n>] [frame <m>] print <expression>
+	[goroutine <n>] [frame <m>] print [-v] <expression>
+
+With -v the functions in the method table of non-empty interfaces are also printed.
 
 See $GOPATH/src/github.com/go-delve/delve/Documentation/cli/expr.md for a description of supported expressions.`},
 		{aliases: []string{"whatis"}, cmdFn: whatisCommand, helpMsg: `Prints type of an expression.
@@ -305,7 +307,9 @@ Executes the specified command (print, args, locals) in the context of the n-th
 If no argument is specified the function being executed in the selected stack frame will be executed.
 
 	-a <start> <end>	disassembles the specified address range
-	-l <locspec>		disassembles the specified function`},
+	-l <locspec>		disassembles the specified function
+
+The assembly syntax (intel, gnu or go) can be changed with the disassemble-flavor configuration option.`},
 		{aliases: []string{"on"}, cmdFn: c.onCmd, helpMsg: `Executes a command when a breakpoint is hit.
 
 	on <breakpoint name or id> <command>.
@@ -521,10 +525,15 @@ func threads(t *Term, ctx callContext, args string) error {
 	if err != nil {
 		return err
 	}
+	printThreads(threads, state.CurrentThread)
+	return nil
+}
+
+func printThreads(threads []*api.Thread, curthread *api.Thread) {
 	sort.Sort(byThreadID(threads))
 	for _, th := range threads {
 		prefix := "  "
-		if state.CurrentThread != nil && state.CurrentThread.ID == th.ID {
+		if curthread != nil && curthread.ID == th.ID {
 			prefix = "* "
 		}
 		if th.Function != nil {
@@ -535,7 +544,6 @@ func threads(t *Term, ctx callContext, args string) error {
 			fmt.Printf("%sThread %s\n", prefix, formatThread(th))
 		}
 	}
-	return nil
 }
 
 func thread(t *Term, ctx callContext, args string) error {
@@ -916,6 +924,9 @@ func (c *Commands) cont(t *Term, ctx callContext, args string) error {
 		}
 		printcontext(t, state)
 	}
+	if t.conf != nil && t.conf.ShowAllThreads {
+		printThreads(state.Threads, state.CurrentThread)
+	}
 	printfile(t, state.CurrentThread.File, state.CurrentThread.Line, true)
 	return nil
 }
@@ -1233,12 +1244,27 @@ func printVar(t *Term, ctx callContext, args string) error {
 		ctx.Breakpoint.Variables = append(ctx.Breakpoint.Variables, args)
 		return nil
 	}
-	val, err := t.client.EvalVariable(ctx.Scope, args, t.loadConfig())
+	cfg := t.loadConfig()
+	if strings.HasPrefix(args, "-v ") {
+		args = strings.TrimSpace(args[len("-v "):])
+		cfg.LoadItabMethods = true
+	}
+	val, err := t.client.EvalVariable(ctx.Scope, args, cfg)
 	if err != nil {
 		return err
 	}
 
-	fmt.Println(val.MultilineString(""))
+	if val.PointerDescr != "" {
+		fmt.Printf("%s (%s)\n", val.MultilineString(""), val.PointerDescr)
+	} else {
+		fmt.Println(val.MultilineString(""))
+	}
+	if len(val.ItabMethods) > 0 {
+		fmt.Println("Methods:")
+		for _, fn := range val.ItabMethods {
+			fmt.Printf("\t%s\n", fn)
+		}
+	}
 	return nil
 }
 
@@ -1592,7 +1618,7 @@ func disassCommand(t *Term, ctx callContext, args string) error {
 		if err != nil {
 			return err
 		}
-		disasm, disasmErr = t.client.DisassemblePC(ctx.Scope, locs[0].PC, api.IntelFlavour)
+		disasm, disasmErr = t.client.DisassemblePC(ctx.Scope, locs[0].PC, t.disassembleFlavour())
 	case "-a":
 		v := strings.SplitN(rest, " ", 2)
 		if len(v) != 2 {
@@ -1606,7 +1632,7 @@ func disassCommand(t *Term, ctx callContext, args string) error {
 		if err != nil {
 			return fmt.Errorf("wrong argument: %s is not a number", v[1])
 		}
-		disasm, disasmErr = t.client.DisassembleRange(ctx.Scope, uint64(startpc), uint64(endpc), api.IntelFlavour)
+		disasm, disasmErr = t.client.DisassembleRange(ctx.Scope, uint64(startpc), uint64(endpc), t.disassembleFlavour())
 	case "-l":
 		locs, err := t.client.FindLocation(ctx.Scope, rest)
 		if err != nil {
@@ -1615,7 +1641,7 @@ func disassCommand(t *Term, ctx callContext, args string) error {
 		if len(locs) != 1 {
 			return errors.New("expression specifies multiple locations")
 		}
-		disasm, disasmErr = t.client.DisassemblePC(ctx.Scope, locs[0].PC, api.IntelFlavour)
+		disasm, disasmErr = t.client.DisassemblePC(ctx.Scope, locs[0].PC, t.disassembleFlavour())
 	default:
 		return disasmUsageError
 	}
@@ -1672,7 +1698,14 @@ func printStack(stack []api.Stackframe, ind string, offsets bool) {
 			fmt.Printf("%serror: %s\n", s, stack[i].Err)
 			continue
 		}
-		fmt.Printf(fmtstr, ind, i, stack[i].PC, stack[i].Function.Name())
+		fname := stack[i].Function.Name()
+		switch {
+		case stack[i].Function == nil:
+			fname = "(unknown function)"
+		case stack[i].C:
+			fname += " (C)"
+		}
+		fmt.Printf(fmtstr, ind, i, stack[i].PC, fname)
 		fmt.Printf("%sat %s:%d\n", s, ShortenFilePath(stack[i].File), stack[i].Line)
 
 		if offsets {
@@ -227,7 +227,7 @@ func TestExecuteFile(t *testing.T) {
 
 func TestIssue354(t *testing.T) {
 	printStack([]api.Stackframe{}, "", false)
-	printStack([]api.Stackframe{{api.Location{PC: 0, File: "irrelevant.go", Line: 10, Function: nil}, nil, nil, 0, 0, nil, true, ""}}, "", false)
+	printStack([]api.Stackframe{{api.Location{PC: 0, File: "irrelevant.go", Line: 10, Function: nil}, nil, nil, 0, 0, nil, true, false, ""}}, "", false)
 }
 
 func TestIssue411(t *testing.T) {
@@ -364,10 +364,12 @@ func TestScopePrefix(t *testing.T) {
 
 		term.MustExec("frame 2")
 		term.AssertExec("print n", "2\n")
+		term.AssertExec("args", "n = 2\n")
 		term.MustExec("frame 4")
 		term.AssertExec("print n", "0\n")
 		term.MustExec("down")
 		term.AssertExec("print n", "1\n")
+		term.AssertExec("args", "n = 1\n")
 		term.MustExec("down 2")
 		term.AssertExec("print n", "3\n")
 		term.AssertExecError("down 2", "Invalid frame -1")
@@ -729,6 +731,14 @@ func TestConfig(t *testing.T) {
 	if findCmdName(term.cmds, "blah", noPrefix) != "" {
 		t.Fatalf("new alias found after delete")
 	}
+
+	err = configureCmd(&term, callContext{}, "disassemble-flavor gnu")
+	if err != nil {
+		t.Fatalf("error executing configureCmd(disassemble-flavor gnu): %v", err)
+	}
+	if term.conf.DisassembleFlavor == nil || *term.conf.DisassembleFlavor != "gnu" {
+		t.Fatalf("unexpected DisassembleFlavor %v", term.conf.DisassembleFlavor)
+	}
 }
 
 func TestDisassembleAutogenerated(t *testing.T) {
@@ -743,6 +753,49 @@ func TestDisassembleAutogenerated(t *testing.T) {
 	})
 }
 
+func TestDisassembleFlavor(t *testing.T) {
+	withTestTerminal("math", t, func(term *FakeTerminal) {
+		term.MustExec("break main.main")
+		term.MustExec("continue")
+
+		intel := term.MustExec("disassemble")
+		if strings.Contains(intel, "%") {
+			t.Fatalf("AT&T register prefix in Intel syntax output %q", intel)
+		}
+
+		gnu := "gnu"
+		term.conf.DisassembleFlavor = &gnu
+		att := term.MustExec("disassemble")
+		if !strings.Contains(att, "%rsp") {
+			t.Fatalf("AT&T register prefix missing from gnu syntax output %q", att)
+		}
+
+		if strings.Count(intel, "\n") != strings.Count(att, "\n") {
+			t.Fatalf("different number of instructions:\n%s\n%s", intel, att)
+		}
+	})
+}
+
+func TestShowAllThreads(t *testing.T) {
+	withTestTerminal("goroutinestackprog", t, func(term *FakeTerminal) {
+		term.MustExec("break main.stacktraceme")
+		term.conf.ShowAllThreads = true
+		out := term.MustExec("continue")
+		state, err := term.client.GetState()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, th := range state.Threads {
+			if !strings.Contains(out, fmt.Sprintf("Thread %d at ", th.ID)) {
+				t.Errorf("thread %d missing from output of continue:\n%s", th.ID, out)
+			}
+		}
+		if !strings.Contains(out, fmt.Sprintf("* Thread %d at ", state.CurrentThread.ID)) {
+			t.Errorf("current thread not marked in output of continue:\n%s", out)
+		}
+	})
+}
+
 func TestIssue1090(t *testing.T) {
 	// Exit while executing 'next' should report the "Process exited" error
 	// message instead of crashing.
@@ -831,6 +884,21 @@ func TestOptimizationCheck(t *testing.T) {
 	}
 }
 
+func TestStackCFrames(t *testing.T) {
+	withTestTerminal("cgostacktest/", t, func(term *FakeTerminal) {
+		term.MustExec("continue") // runtime.Breakpoint in main.main
+		term.MustExec("break hello.c:13")
+		term.MustExec("continue")
+		out := term.MustExec("stack")
+		if !strings.Contains(out, " in C.helloworld (C)\n") {
+			t.Fatalf("C frame not labeled in %q", out)
+		}
+		if strings.Contains(out, " in main.main (C)\n") {
+			t.Fatalf("Go frame labeled as C in %q", out)
+		}
+	})
+}
+
 func TestTruncateStacktrace(t *testing.T) {
 	withTestTerminal("stacktraceprog", t, func(term *FakeTerminal) {
 		term.MustExec("break main.stacktraceme")
@@ -863,3 +931,28 @@ func TestIssue1493(t *testing.T) {
 		}
 	})
 }
+
+func TestPrintPointerDescr(t *testing.T) {
+	// The print command describes the address of unsafe pointers.
+	withTestTerminal("testvariables2", t, func(term *FakeTerminal) {
+		term.MustExec("continue")
+		out := term.MustExec("print upglobal1")
+		if !strings.HasPrefix(out, "unsafe.Pointer(0x") || !strings.HasSuffix(out, " (&main.global1)\n") {
+			t.Fatalf("wrong output of print upglobal1: %q", out)
+		}
+	})
+}
+
+func TestPrintItabMethods(t *testing.T) {
+	withTestTerminal("testvariables2", t, func(term *FakeTerminal) {
+		term.MustExec("continue")
+		out := term.MustExec("print err1")
+		if strings.Contains(out, "Methods:") {
+			t.Fatalf("method table printed without -v: %q", out)
+		}
+		out = term.MustExec("print -v err1")
+		if !strings.HasSuffix(out, "\nMethods:\n\tmain.(*astruct).Error\n") {
+			t.Fatalf("wrong output of print -v err1: %q", out)
+		}
+	})
+}
@@ -378,7 +378,7 @@ func (t *Term) handleExit() (int, error) {
 // loadConfig returns an api.LoadConfig with the parameterss specified in
 // the configuration file.
 func (t *Term) loadConfig() api.LoadConfig {
-	r := api.LoadConfig{true, 1, 64, 64, -1}
+	r := api.LoadConfig{true, 1, 64, 64, -1, false}
 
 	if t.conf != nil && t.conf.MaxStringLen != nil {
 		r.MaxStringLen = *t.conf.MaxStringLen
@@ -389,3 +389,19 @@ func (t *Term) loadConfig() api.LoadConfig {
 
 	return r
 }
+
+// disassembleFlavour returns the assembly syntax specified in the
+// configuration file, Intel syntax is used by default.
+func (t *Term) disassembleFlavour() api.AssemblyFlavour {
+	if t.conf == nil || t.conf.DisassembleFlavor == nil {
+		return api.IntelFlavour
+	}
+	switch *t.conf.DisassembleFlavor {
+	case "gnu":
+		return api.GNUFlavour
+	case "go":
+		return api.GoFlavour
+	default:
+		return api.IntelFlavour
+	}
+}
@@ -23,14 +23,16 @@ func ConvertBreakpoint(bp *proc.Breakpoint) *Breakpoint {
 		File:          bp.File,
 		Line:          bp.Line,
 		Addr:          bp.Addr,
-		Tracepoint:    bp.Tracepoint,
-		TraceReturn:   bp.TraceReturn,
+		Tracepoint:    bp.Flags&proc.BreakpointTracepoint != 0,
+		TraceReturn:   bp.Flags&proc.BreakpointTraceReturn != 0,
 		Stacktrace:    bp.Stacktrace,
 		Goroutine:     bp.Goroutine,
 		Variables:     bp.Variables,
 		LoadArgs:      LoadConfigFromProc(bp.LoadArgs),
 		LoadLocals:    LoadConfigFromProc(bp.LoadLocals),
 		TotalHitCount: bp.TotalHitCount,
+		IgnoreCount:   bp.IgnoreCount,
+		Internal:      !bp.IsUser(),
 	}
 
 	b.HitCount = map[string]uint64{}
@@ -124,6 +126,7 @@ func ConvertVar(v *proc.Variable) *Variable {
 		Flags:    VariableFlags(v.Flags),
 		Base:     v.Base,
 
+		ItabMethods:  v.ItabMethods,
 		LocationExpr: v.LocationExpr,
 		DeclLine:     v.DeclLine,
 	}
@@ -131,6 +134,11 @@ func ConvertVar(v *proc.Variable) *Variable {
 	r.Type = prettyTypeName(v.DwarfType)
 	r.RealType = prettyTypeName(v.RealType)
 
+	if v.Flags&proc.VariableOptimizedOut != 0 {
+		r.Value = "<optimized out>"
+		return &r
+	}
+
 	if v.Unreadable != nil {
 		r.Unreadable = v.Unreadable.Error()
 	}
@@ -152,6 +160,10 @@ func ConvertVar(v *proc.Variable) *Variable {
 		}
 	}
 
+	if (v.Kind == reflect.Ptr && len(v.Children) == 1 && v.Children[0].OnlyAddr) || v.Kind == reflect.UnsafePointer {
+		r.PointerDescr = v.PointerDescr()
+	}
+
 	switch v.Kind {
 	case reflect.Complex64:
 		r.Children = make([]Variable, 2)
@@ -240,6 +252,11 @@ func ConvertGoroutine(g *proc.G) *Goroutine {
 		GoStatementLoc: ConvertLocation(g.Go()),
 		StartLoc:       ConvertLocation(g.StartLoc()),
 		ThreadID:       tid,
+		Status:         g.StatusString(),
+		Labels:         g.Labels(),
+	}
+	if r.Status == "waiting" {
+		r.WaitReason = g.WaitReason
 	}
 	if g.Unreadable != nil {
 		r.Unreadable = g.Unreadable.Error()
@@ -286,6 +303,8 @@ func LoadConfigToProc(cfg *LoadConfig) *proc.LoadConfig {
 		cfg.MaxArrayValues,
 		cfg.MaxStructFields,
 		0, // MaxMapBuckets is set internally by pkg/proc, read its documentation for an explanation.
+		false,
+		cfg.LoadItabMethods,
 	}
 }
 
@@ -300,6 +319,7 @@ func LoadConfigFromProc(cfg *proc.LoadConfig) *LoadConfig {
 		cfg.MaxStringLen,
 		cfg.MaxArrayValues,
 		cfg.MaxStructFields,
+		cfg.LoadItabMethods,
 	}
 }
 
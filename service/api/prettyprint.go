@@ -2,10 +2,14 @@ package api
 
 import (
 	"bytes"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"unicode"
 )
 
 const (
@@ -29,12 +33,54 @@ func (v *Variable) MultilineString(indent string) string {
 	return buf.String()
 }
 
+// SortMapEntries sorts the entries of all the maps contained in v by the
+// representation of their keys, and by the representation of their values
+// for equal keys, so that rendering the same map always produces the same
+// output. Maps are otherwise rendered in the order their entries were
+// loaded, which depends on the buckets of the map.
+func (v *Variable) SortMapEntries() {
+	for i := range v.Children {
+		v.Children[i].SortMapEntries()
+	}
+	if v.Kind != reflect.Map || len(v.Children) < 4 {
+		return
+	}
+	type entry struct {
+		key, value Variable
+		keystr     string
+		valuestr   string
+	}
+	entries := make([]entry, len(v.Children)/2)
+	for i := range entries {
+		e := &entries[i]
+		e.key, e.value = v.Children[2*i], v.Children[2*i+1]
+		var buf bytes.Buffer
+		e.key.writeMapKeyTo(&buf, "")
+		e.keystr = buf.String()
+		e.valuestr = e.value.SinglelineString()
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].keystr != entries[j].keystr {
+			return entries[i].keystr < entries[j].keystr
+		}
+		return entries[i].valuestr < entries[j].valuestr
+	})
+	for i := range entries {
+		v.Children[2*i], v.Children[2*i+1] = entries[i].key, entries[i].value
+	}
+}
+
 func (v *Variable) writeTo(buf io.Writer, top, newlines, includeType bool, indent string) {
 	if v.Unreadable != "" {
 		fmt.Fprintf(buf, "(unreadable %s)", v.Unreadable)
 		return
 	}
 
+	if v.Flags&VariableOptimizedOut != 0 {
+		fmt.Fprint(buf, v.Value)
+		return
+	}
+
 	if !top && v.Addr == 0 && v.Value == "" {
 		if includeType && v.Type != "void" {
 			fmt.Fprintf(buf, "%s nil", v.Type)
@@ -44,6 +90,15 @@ func (v *Variable) writeTo(buf io.Writer, top, newlines, includeType bool, inden
 		return
 	}
 
+	if s, ok := v.prettyPrint(); ok {
+		if includeType && v.Kind == reflect.Struct {
+			fmt.Fprintf(buf, "%s(%s)", v.Type, s)
+		} else {
+			fmt.Fprint(buf, s)
+		}
+		return
+	}
+
 	switch v.Kind {
 	case reflect.Slice:
 		v.writeSliceTo(buf, newlines, includeType, indent)
@@ -78,6 +133,7 @@ func (v *Variable) writeTo(buf io.Writer, top, newlines, includeType bool, inden
 				fmt.Fprintf(buf, "%s nil", v.Type)
 			} else {
 				fmt.Fprintf(buf, "%s %s/%s", v.Type, v.Children[0].Value, v.Children[1].Value)
+				v.writeChanWaitersTo(buf)
 			}
 		}
 	case reflect.Struct:
@@ -89,6 +145,20 @@ func (v *Variable) writeTo(buf io.Writer, top, newlines, includeType bool, inden
 			fmt.Fprintf(buf, "nil")
 			return
 		}
+		data := v.Children[0]
+		if data.Kind == reflect.Ptr && len(data.Children) > 0 && data.Children[0].Addr == 0 {
+			// a non-nil interface containing a nil pointer
+			typename := data.Type
+			if strings.Contains(typename, "/") {
+				typename = strconv.Quote(typename)
+			}
+			if includeType {
+				fmt.Fprintf(buf, "%s((%s)(nil))", v.Type, typename)
+			} else {
+				fmt.Fprintf(buf, "(%s)(nil)", typename)
+			}
+			return
+		}
 		if includeType {
 			if v.Children[0].Kind == reflect.Invalid {
 				fmt.Fprintf(buf, "%s ", v.Type)
@@ -100,12 +170,9 @@ func (v *Variable) writeTo(buf io.Writer, top, newlines, includeType bool, inden
 				fmt.Fprintf(buf, "%s(%s) ", v.Type, v.Children[0].Type)
 			}
 		}
-		data := v.Children[0]
 		if data.Kind == reflect.Ptr {
 			if len(data.Children) == 0 {
 				fmt.Fprint(buf, "...")
-			} else if data.Children[0].Addr == 0 {
-				fmt.Fprint(buf, "nil")
 			} else if data.Children[0].OnlyAddr {
 				fmt.Fprintf(buf, "0x%x", v.Children[0].Addr)
 			} else {
@@ -127,11 +194,27 @@ func (v *Variable) writeTo(buf io.Writer, top, newlines, includeType bool, inden
 			fmt.Fprint(buf, "nil")
 		} else {
 			fmt.Fprintf(buf, "%s", v.Value)
+			if len(v.Children) > 0 {
+				// variables captured by the closure
+				fmt.Fprint(buf, " {")
+				for i := range v.Children {
+					if i != 0 {
+						fmt.Fprint(buf, ", ")
+					}
+					fmt.Fprintf(buf, "%s: ", v.Children[i].Name)
+					v.Children[i].writeTo(buf, false, false, true, indent)
+				}
+				fmt.Fprint(buf, "}")
+			}
 		}
 	case reflect.Complex64, reflect.Complex128:
 		fmt.Fprintf(buf, "(%s + %si)", v.Children[0].Value, v.Children[1].Value)
 	default:
-		if v.Value != "" {
+		if n, err := strconv.ParseInt(v.Value, 10, 32); top && v.Kind == reflect.Int && v.RealType == "int32" && err == nil && unicode.IsPrint(rune(n)) {
+			// int32 is also the type of runes, show the character along with
+			// its value
+			fmt.Fprintf(buf, "%q (%d)", rune(n), n)
+		} else if v.Value != "" {
 			buf.Write([]byte(v.Value))
 		} else {
 			fmt.Fprintf(buf, "(unknown %s)", v.Kind)
@@ -155,9 +238,46 @@ func (v *Variable) writeSliceTo(buf io.Writer, newlines, includeType bool, inden
 		fmt.Fprintf(buf, "nil")
 		return
 	}
+	if newlines && v.isByteSlice() {
+		v.writeHexDumpTo(buf, indent)
+		return
+	}
 	v.writeSliceOrArrayTo(buf, newlines, indent)
 }
 
+// isByteSlice returns true if v is a slice of bytes whose contents have
+// been loaded. The Kind of all unsigned integers is reflect.Uint, bytes are
+// recognized by the name of their type.
+func (v *Variable) isByteSlice() bool {
+	if len(v.Children) == 0 {
+		return false
+	}
+	for i := range v.Children {
+		if v.Children[i].Kind != reflect.Uint || v.Children[i].RealType != "uint8" || v.Children[i].Unreadable != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// writeHexDumpTo writes the contents of a byte slice as a hex dump, with
+// an ASCII column on the right side.
+func (v *Variable) writeHexDumpTo(buf io.Writer, indent string) {
+	data := make([]byte, len(v.Children))
+	for i := range v.Children {
+		n, _ := strconv.ParseUint(v.Children[i].Value, 10, 8)
+		data[i] = byte(n)
+	}
+	fmt.Fprint(buf, "[")
+	for _, line := range strings.Split(strings.TrimSuffix(hex.Dump(data), "\n"), "\n") {
+		fmt.Fprintf(buf, "\n%s%s%s", indent, indentString, line)
+	}
+	if len(v.Children) != int(v.Len) {
+		fmt.Fprintf(buf, "\n%s%s...+%d more", indent, indentString, int(v.Len)-len(v.Children))
+	}
+	fmt.Fprintf(buf, "\n%s]", indent)
+}
+
 func (v *Variable) writeArrayTo(buf io.Writer, newlines, includeType bool, indent string) {
 	if includeType {
 		fmt.Fprintf(buf, "%s ", v.Type)
@@ -165,6 +285,37 @@ func (v *Variable) writeArrayTo(buf io.Writer, newlines, includeType bool, inden
 	v.writeSliceOrArrayTo(buf, newlines, indent)
 }
 
+// writeChanWaitersTo writes a note listing the goroutines blocked on the
+// channel, if any, by looking at the recvq and sendq fields of hchan.
+func (v *Variable) writeChanWaitersTo(buf io.Writer) {
+	var waiters []string
+	if v.chanHasWaiters("recvq") {
+		waiters = append(waiters, "receivers waiting")
+	}
+	if v.chanHasWaiters("sendq") {
+		waiters = append(waiters, "senders waiting")
+	}
+	if len(waiters) > 0 {
+		fmt.Fprintf(buf, " (%s)", strings.Join(waiters, ", "))
+	}
+}
+
+// chanHasWaiters returns true if the wait queue called name of a channel
+// variable is not empty.
+func (v *Variable) chanHasWaiters(name string) bool {
+	for i := range v.Children {
+		if v.Children[i].Name != name {
+			continue
+		}
+		for _, field := range v.Children[i].Children {
+			if field.Name == "first" && field.Kind == reflect.Ptr && len(field.Children) > 0 {
+				return field.Children[0].Addr != 0
+			}
+		}
+	}
+	return false
+}
+
 func (v *Variable) writeStructTo(buf io.Writer, newlines, includeType bool, indent string) {
 	if int(v.Len) != len(v.Children) && len(v.Children) == 0 {
 		if strings.Contains(v.Type, "/") {
@@ -209,6 +360,58 @@ func (v *Variable) writeStructTo(buf io.Writer, newlines, includeType bool, inde
 	fmt.Fprint(buf, "}")
 }
 
+// writeMapKeyTo writes the key of a map entry on a single line. Struct keys
+// are written field by field, structs whose fields were not loaded because
+// of the depth limit are written as {...} since their address, inside the
+// buckets of the map, means nothing to the user. Pointer keys are written
+// as the address they point to, which is what identifies them in the map,
+// followed by the value they point to if it was loaded.
+func (v *Variable) writeMapKeyTo(buf io.Writer, indent string) {
+	if v.Unreadable != "" {
+		v.writeTo(buf, false, false, false, indent)
+		return
+	}
+	if _, ok := v.prettyPrint(); ok {
+		v.writeTo(buf, false, false, false, indent)
+		return
+	}
+	switch v.Kind {
+	case reflect.Struct:
+		if len(v.Children) == 0 && v.Len > 0 {
+			fmt.Fprint(buf, "{...}")
+			return
+		}
+		fmt.Fprint(buf, "{")
+		for i := range v.Children {
+			if i != 0 {
+				fmt.Fprint(buf, ", ")
+			}
+			fmt.Fprintf(buf, "%s: ", v.Children[i].Name)
+			v.Children[i].writeMapKeyTo(buf, indent)
+		}
+		if len(v.Children) != int(v.Len) {
+			fmt.Fprintf(buf, ",...+%d more", int(v.Len)-len(v.Children))
+		}
+		fmt.Fprint(buf, "}")
+	case reflect.Ptr:
+		if v.Type == "" || len(v.Children) == 0 || v.Children[0].Addr == 0 {
+			fmt.Fprint(buf, "nil")
+			return
+		}
+		if strings.Contains(v.Type, "/") {
+			fmt.Fprintf(buf, "(%q)(%#x)", v.Type, v.Children[0].Addr)
+		} else {
+			fmt.Fprintf(buf, "(%s)(%#x)", v.Type, v.Children[0].Addr)
+		}
+		if !v.Children[0].OnlyAddr {
+			fmt.Fprint(buf, " *")
+			v.Children[0].writeMapKeyTo(buf, indent)
+		}
+	default:
+		v.writeTo(buf, false, false, false, indent)
+	}
+}
+
 func (v *Variable) writeMapTo(buf io.Writer, newlines, includeType bool, indent string) {
 	if includeType {
 		fmt.Fprintf(buf, "%s ", v.Type)
@@ -230,7 +433,7 @@ func (v *Variable) writeMapTo(buf io.Writer, newlines, includeType bool, indent
 			fmt.Fprintf(buf, "\n%s%s", indent, indentString)
 		}
 
-		key.writeTo(buf, false, false, false, indent+indentString)
+		key.writeMapKeyTo(buf, indent+indentString)
 		fmt.Fprint(buf, ": ")
 		value.writeTo(buf, false, nl, false, indent+indentString)
 		if i != len(v.Children)-1 || nl {
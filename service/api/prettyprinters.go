@@ -0,0 +1,230 @@
+package api
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PrettyPrinter returns a human readable representation of v, if v can not
+// be rendered (for example because some of its fields were not loaded) it
+// should return false and v will be printed normally.
+type PrettyPrinter func(v *Variable) (string, bool)
+
+var prettyPrinters = map[string]PrettyPrinter{
+	"time.Time":     prettyPrintTime,
+	"time.Duration": prettyPrintDuration,
+
+	"sync.Mutex":     prettyPrintMutex,
+	"sync.WaitGroup": prettyPrintWaitGroup,
+	"sync.Once":      prettyPrintOnce,
+}
+
+// RegisterPrettyPrinter registers fn as the pretty printer for variables
+// whose type is typename (a fully qualified type name, like "time.Time").
+// Registering a nil function removes the pretty printer for typename.
+func RegisterPrettyPrinter(typename string, fn PrettyPrinter) {
+	if fn == nil {
+		delete(prettyPrinters, typename)
+		return
+	}
+	prettyPrinters[typename] = fn
+}
+
+func (v *Variable) prettyPrint() (string, bool) {
+	fn := prettyPrinters[v.Type]
+	if fn == nil {
+		return "", false
+	}
+	return fn(v)
+}
+
+func (v *Variable) fieldNamed(name string) *Variable {
+	for i := range v.Children {
+		if v.Children[i].Name == name {
+			return &v.Children[i]
+		}
+	}
+	return nil
+}
+
+// intFieldValue returns the value of the integer or boolean field name of
+// v. Fields of type sync/atomic.Int32, sync/atomic.Uint64, etc are
+// unwrapped.
+func (v *Variable) intFieldValue(name string) (uint64, bool) {
+	f := v.fieldNamed(name)
+	if f == nil {
+		return 0, false
+	}
+	if f.Kind == reflect.Struct && strings.HasPrefix(f.Type, "sync/atomic.") {
+		f = f.fieldNamed("v")
+		if f == nil {
+			return 0, false
+		}
+	}
+	switch f.Kind {
+	case reflect.Bool:
+		switch f.Value {
+		case "true":
+			return 1, true
+		case "false":
+			return 0, true
+		}
+		return 0, false
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(f.Value, 10, 64)
+		return uint64(n), err == nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(f.Value, 10, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// Constants used to decode time.Time, from: $GOROOT/src/time/time.go
+const (
+	timeHasMonotonic = 1 << 63
+	timeNsecMask     = 1<<30 - 1
+	timeNsecShift    = 30
+	// seconds between January 1, year 1 and January 1, 1885
+	timeWallToInternal int64 = (1884*365 + 1884/4 - 1884/100 + 1884/400) * 24 * 60 * 60
+	// seconds between January 1, year 1 and January 1, 1970
+	timeInternalToUnix int64 = -(1969*365 + 1969/4 - 1969/100 + 1969/400) * 24 * 60 * 60
+)
+
+// prettyPrintTime renders a time.Time value (in the layout used by go 1.9
+// and later) as a RFC3339 string.
+func prettyPrintTime(v *Variable) (string, bool) {
+	if v.Kind != reflect.Struct {
+		return "", false
+	}
+	wallvar, extvar, locvar := v.fieldNamed("wall"), v.fieldNamed("ext"), v.fieldNamed("loc")
+	if wallvar == nil || extvar == nil || locvar == nil {
+		return "", false
+	}
+	wall, err := strconv.ParseUint(wallvar.Value, 10, 64)
+	if err != nil {
+		return "", false
+	}
+	ext, err := strconv.ParseInt(extvar.Value, 10, 64)
+	if err != nil {
+		return "", false
+	}
+
+	nsec := int64(wall & timeNsecMask)
+	var sec int64
+	if wall&timeHasMonotonic != 0 {
+		sec = timeWallToInternal + int64(wall<<1>>(timeNsecShift+1))
+	} else {
+		sec = ext
+	}
+
+	loc := time.UTC
+	if len(locvar.Children) > 0 && locvar.Children[0].Addr != 0 {
+		namevar := locvar.Children[0].fieldNamed("name")
+		if namevar == nil {
+			return "", false
+		}
+		switch name := namevar.Value; name {
+		case "", "UTC":
+		case "Local":
+			loc = time.Local
+		default:
+			if l, err := time.LoadLocation(name); err == nil {
+				loc = l
+			}
+		}
+	}
+
+	return time.Unix(sec+timeInternalToUnix, nsec).In(loc).Format(time.RFC3339Nano), true
+}
+
+// prettyPrintDuration renders a time.Duration value the same way
+// time.Duration.String does.
+func prettyPrintDuration(v *Variable) (string, bool) {
+	// the Kind of all signed integers is reflect.Int, the printer is only
+	// called for variables of type time.Duration.
+	if v.Kind != reflect.Int {
+		return "", false
+	}
+	n, err := strconv.ParseInt(v.Value, 10, 64)
+	if err != nil {
+		return "", false
+	}
+	return time.Duration(n).String(), true
+}
+
+// Constants used to decode sync.Mutex, from: $GOROOT/src/internal/sync/mutex.go
+const (
+	mutexLocked      = 1
+	mutexStarving    = 4
+	mutexWaiterShift = 3
+)
+
+// prettyPrintMutex renders the state of a sync.Mutex. Since go 1.24 the
+// state of sync.Mutex is stored in an internal/sync.Mutex field named mu.
+func prettyPrintMutex(v *Variable) (string, bool) {
+	if v.Kind != reflect.Struct {
+		return "", false
+	}
+	if mu := v.fieldNamed("mu"); mu != nil {
+		v = mu
+	}
+	state, ok := v.intFieldValue("state")
+	if !ok {
+		return "", false
+	}
+	s := "unlocked"
+	if state&mutexLocked != 0 {
+		s = "locked"
+	}
+	if state&mutexStarving != 0 {
+		s += ", starving"
+	}
+	if waiters := uint32(state) >> mutexWaiterShift; waiters != 0 {
+		s += fmt.Sprintf(", %d waiters", waiters)
+	}
+	return s, true
+}
+
+// prettyPrintWaitGroup renders the counter and the number of waiters of a
+// sync.WaitGroup, the counter is stored in the high 32 bits of the state
+// and the waiters in the low 32 bits (go 1.18 and later). Before go 1.20 the
+// state was stored in a field named state1.
+// The state of go 1.17 and earlier depends on the alignment of the
+// WaitGroup and isn't supported.
+func prettyPrintWaitGroup(v *Variable) (string, bool) {
+	if v.Kind != reflect.Struct {
+		return "", false
+	}
+	state, ok := v.intFieldValue("state")
+	if !ok {
+		if state1 := v.fieldNamed("state1"); state1 == nil || state1.Kind != reflect.Uint {
+			return "", false
+		}
+		state, ok = v.intFieldValue("state1")
+		if !ok {
+			return "", false
+		}
+	}
+	// Since go 1.25 bit 31 is used to mark WaitGroups that belong to a
+	// synctest bubble.
+	return fmt.Sprintf("counter %d, waiters %d", int32(state>>32), uint32(state)&^(1<<31)), true
+}
+
+// prettyPrintOnce renders whether the function of a sync.Once was called.
+func prettyPrintOnce(v *Variable) (string, bool) {
+	if v.Kind != reflect.Struct {
+		return "", false
+	}
+	done, ok := v.intFieldValue("done")
+	if !ok {
+		return "", false
+	}
+	if done != 0 {
+		return "done", true
+	}
+	return "not done", true
+}
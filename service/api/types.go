@@ -35,10 +35,46 @@ type DebuggerState struct {
 	ExitStatus int  `json:"exitStatus"`
 	// When contains a description of the current position in a recording
 	When string
+	// LastStop describes why the target stopped after the last command
+	// that resumed it, it is nil if the target was not resumed yet.
+	LastStop *StopReason `json:"lastStop,omitempty"`
 	// Filled by RPCClient.Continue, indicates an error
 	Err error `json:"-"`
 }
 
+// StopKind is the cause of a stop of the target.
+type StopKind string
+
+const (
+	// StopBreakpoint is the kind of stops at a user breakpoint.
+	StopBreakpoint StopKind = "breakpoint"
+	// StopStep is the kind of stops at the end of a next, step, stepout or
+	// step-instruction command.
+	StopStep StopKind = "step"
+	// StopManual is the kind of stops requested with a halt command.
+	StopManual StopKind = "manual"
+	// StopExited is the kind of stops caused by the exit of the target.
+	StopExited StopKind = "exited"
+	// StopOther is the kind of all other stops, for example at a call to
+	// runtime.Breakpoint, because of a signal or at the end of an injected
+	// function call.
+	StopOther StopKind = "other"
+)
+
+// StopReason describes why the target stopped.
+type StopReason struct {
+	Kind StopKind `json:"kind"`
+	// Breakpoint is the breakpoint that was hit, for stops of kind
+	// StopBreakpoint.
+	Breakpoint *Breakpoint `json:"breakpoint,omitempty"`
+	// ThreadID is the thread that caused the stop, it is the current thread
+	// when the target stopped.
+	ThreadID int `json:"threadID"`
+	// Location is the location of ThreadID when the target stopped, it is
+	// nil for stops of kind StopExited.
+	Location *Location `json:"location,omitempty"`
+}
+
 // Breakpoint addresses a location at which process execution may be
 // suspended.
 type Breakpoint struct {
@@ -78,6 +114,12 @@ type Breakpoint struct {
 	HitCount map[string]uint64 `json:"hitCount"`
 	// number of times a breakpoint has been reached
 	TotalHitCount uint64 `json:"totalHitCount"`
+	// number of times the breakpoint will be reached without stopping
+	IgnoreCount int `json:"ignoreCount,omitempty"`
+	// Internal is true if the breakpoint was set by the debugger to
+	// implement a command (for example next or stepout) instead of by the
+	// user, internal breakpoints are only listed on request.
+	Internal bool `json:"internal,omitempty"`
 }
 
 // ValidBreakpointName returns an error if
@@ -143,6 +185,7 @@ type Stackframe struct {
 	Defers []Defer
 
 	Bottom bool `json:"Bottom,omitempty"` // Bottom is true if this is the bottom frame of the stack
+	C      bool `json:"C,omitempty"`      // C is true if the function of this frame was compiled from C code (cgo)
 
 	Err string
 }
@@ -214,6 +257,10 @@ const (
 
 	// VariableReturnArgument means this variable is a function return value
 	VariableReturnArgument
+
+	// VariableOptimizedOut means the location of this variable is not known
+	// at the current PC, its value is reported as "<optimized out>"
+	VariableOptimizedOut
 )
 
 // Variable describes a variable.
@@ -258,6 +305,15 @@ type Variable struct {
 	// Unreadable addresses will have this field set
 	Unreadable string `json:"unreadable"`
 
+	// PointerDescr describes the address of pointers whose value is not
+	// loaded and of unsafe pointers: the name of the global variable or
+	// function it points to or the memory region containing it.
+	PointerDescr string `json:"pointerDescr,omitempty"`
+
+	// ItabMethods are the functions in the method table of non-empty
+	// interfaces, only set when LoadConfig.LoadItabMethods is set.
+	ItabMethods []string `json:"itabMethods,omitempty"`
+
 	// LocationExpr describes the location expression of this variable's address
 	LocationExpr string
 	// DeclLine is the line number of this variable's declaration
@@ -276,6 +332,9 @@ type LoadConfig struct {
 	MaxArrayValues int
 	// MaxStructFields is the maximum number of fields read from a struct, -1 will read all fields.
 	MaxStructFields int
+	// LoadItabMethods requests the method table of non-empty interfaces to
+	// be returned in Variable.ItabMethods.
+	LoadItabMethods bool
 }
 
 // Goroutine represents the information relevant to Delve from the runtime's
@@ -292,8 +351,14 @@ type Goroutine struct {
 	// Location of the starting function
 	StartLoc Location `json:"startLoc"`
 	// ID of the associated thread for running goroutines
-	ThreadID   int    `json:"threadID"`
-	Unreadable string `json:"unreadable"`
+	ThreadID int `json:"threadID"`
+	// Status of the goroutine (idle, runnable, running, waiting...)
+	Status string `json:"status"`
+	// Reason the goroutine is parked, only set for waiting goroutines
+	WaitReason string `json:"waitReason,omitempty"`
+	// Profiler labels of the goroutine, set with runtime/pprof.Do
+	Labels     map[string]string `json:"labels,omitempty"`
+	Unreadable string            `json:"unreadable"`
 }
 
 // DebuggerCommand is a command which changes the debugger's execution state.
@@ -377,6 +442,8 @@ const (
 	GNUFlavour = AssemblyFlavour(proc.GNUFlavour)
 	// IntelFlavour will disassemble using Intel assembly syntax.
 	IntelFlavour = AssemblyFlavour(proc.IntelFlavour)
+	// GoFlavour will disassemble using Go assembly syntax.
+	GoFlavour = AssemblyFlavour(proc.GoFlavour)
 )
 
 // AsmInstruction represents one assembly instruction at some address
@@ -58,6 +58,9 @@ type Client interface {
 	CreateBreakpoint(*api.Breakpoint) (*api.Breakpoint, error)
 	// ListBreakpoints gets all breakpoints.
 	ListBreakpoints() ([]*api.Breakpoint, error)
+	// ListAllBreakpoints gets all breakpoints, including the internal
+	// breakpoints set by the debugger.
+	ListAllBreakpoints() ([]*api.Breakpoint, error)
 	// ClearBreakpoint deletes a breakpoint by ID.
 	ClearBreakpoint(id int) (*api.Breakpoint, error)
 	// ClearBreakpointByName deletes a breakpoint by name
@@ -118,6 +121,11 @@ type Client interface {
 	// * *<address> returns the location corresponding to the specified address
 	// NOTE: this function does not actually set breakpoints.
 	FindLocation(scope api.EvalScope, loc string) ([]api.Location, error)
+	// ResolveLocation returns the location where a breakpoint described
+	// by the location expression loc would be set, loc must describe a
+	// single location.
+	// NOTE: this function does not actually set breakpoints.
+	ResolveLocation(scope api.EvalScope, loc string) (api.Location, error)
 
 	// Disassemble code between startPC and endPC
 	DisassembleRange(scope api.EvalScope, startPC, endPC uint64, flavour api.AssemblyFlavour) (api.AsmInstructions, error)
@@ -44,6 +44,10 @@ type Config struct {
 	// versions.
 	CheckGoVersion bool
 
+	// StopAtMain is true if a newly launched process should be continued
+	// until main.main instead of stopping at its entry point.
+	StopAtMain bool
+
 	// DisconnectChan will be closed by the server when the client disconnects
 	DisconnectChan chan<- struct{}
 }
@@ -4,7 +4,6 @@ import (
 	"debug/dwarf"
 	"errors"
 	"fmt"
-	"go/parser"
 	"path/filepath"
 	"regexp"
 	"runtime"
@@ -39,8 +38,20 @@ type Debugger struct {
 	target       proc.Process
 	log          *logrus.Entry
 
+	// bpLocations records the location specification used to create each
+	// user breakpoint, indexed by breakpoint ID, so that breakpoints can be
+	// re-resolved when the target is restarted.
+	bpLocations map[int]breakpointLocation
+
 	running      bool
 	runningMutex sync.Mutex
+	// halted is set when a halt command is received while the target is
+	// running, it's protected by runningMutex.
+	halted bool
+
+	// lastStop is the reason the target stopped after the last command that
+	// resumed it.
+	lastStop *api.StopReason
 }
 
 // Config provides the configuration to start a Debugger.
@@ -73,6 +84,10 @@ type Config struct {
 	// used to compile the executable and refuse to work on incompatible
 	// versions.
 	CheckGoVersion bool
+
+	// StopAtMain is true if a newly launched process should be continued
+	// until main.main instead of stopping at its entry point.
+	StopAtMain bool
 }
 
 // New creates a new Debugger. ProcessArgs specify the commandline arguments for the
@@ -83,6 +98,7 @@ func New(config *Config, processArgs []string) (*Debugger, error) {
 		config:      config,
 		processArgs: processArgs,
 		log:         logger,
+		bpLocations: make(map[int]breakpointLocation),
 	}
 
 	// Create the process by either attaching or launching.
@@ -125,7 +141,7 @@ func New(config *Config, processArgs []string) (*Debugger, error) {
 		d.log.Infof("launching process with args: %v", d.processArgs)
 		p, err := d.Launch(d.processArgs, d.config.WorkingDir)
 		if err != nil {
-			if err != proc.ErrNotExecutable && err != proc.ErrUnsupportedLinuxArch && err != proc.ErrUnsupportedWindowsArch && err != proc.ErrUnsupportedDarwinArch {
+			if err != proc.ErrNotExecutable && err != proc.ErrNotGoBinary && err != proc.ErrUnsupportedLinuxArch && err != proc.ErrUnsupportedWindowsArch && err != proc.ErrUnsupportedDarwinArch {
 				err = go11DecodeErrorCheck(err)
 				err = fmt.Errorf("could not launch process: %s", err)
 			}
@@ -136,10 +152,34 @@ func New(config *Config, processArgs []string) (*Debugger, error) {
 			d.target.Detach(true)
 			return nil, err
 		}
+		if err := d.stopAtMain(); err != nil {
+			d.target.Detach(true)
+			return nil, fmt.Errorf("could not continue to main.main: %v", err)
+		}
 	}
 	return d, nil
 }
 
+// stopAtMain continues a newly launched target to the entry point of
+// main.main, using a temporary breakpoint, if StopAtMain is set.
+func (d *Debugger) stopAtMain() error {
+	if !d.config.StopAtMain {
+		return nil
+	}
+	addr, err := proc.FindFunctionLocation(d.target, "main.main", true, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := d.target.SetBreakpoint(addr, proc.NextBreakpoint, nil); err != nil {
+		return err
+	}
+	// The breakpoint on main.main is left behind if the target can not be
+	// continued or stops somewhere else first, for example at a user
+	// breakpoint restored by Restart.
+	defer d.target.ClearInternalBreakpoints()
+	return proc.Continue(d.target)
+}
+
 func (d *Debugger) checkGoVersion() error {
 	if !d.config.CheckGoVersion {
 		return nil
@@ -277,27 +317,43 @@ func (d *Debugger) Restart(pos string, resetArgs bool, newArgs []string) ([]api.
 		return nil, fmt.Errorf("could not launch process: %s", err)
 	}
 	discarded := []api.DiscardedBreakpoint{}
-	for _, oldBp := range d.breakpoints() {
+	bpLocations := make(map[int]breakpointLocation)
+	for _, oldBp := range d.breakpoints(false) {
 		if oldBp.ID < 0 {
 			continue
 		}
-		if len(oldBp.File) > 0 {
+		loc, hasLoc := d.bpLocations[oldBp.ID]
+		if !hasLoc && len(oldBp.File) > 0 {
+			loc, hasLoc = breakpointLocation{File: oldBp.File, Line: oldBp.Line}, true
+		}
+		addr := oldBp.Addr
+		if hasLoc {
+			// The executable could have been rebuilt, resolve the breakpoint
+			// again instead of reusing the old address.
 			var err error
-			oldBp.Addr, err = proc.FindFileLocation(p, oldBp.File, oldBp.Line)
+			addr, err = loc.resolve(p)
 			if err != nil {
 				discarded = append(discarded, api.DiscardedBreakpoint{Breakpoint: oldBp, Reason: err.Error()})
 				continue
 			}
 		}
-		newBp, err := p.SetBreakpoint(oldBp.Addr, proc.UserBreakpoint, nil)
+		newBp, err := p.SetBreakpoint(addr, proc.UserBreakpoint, nil)
 		if err != nil {
 			return nil, err
 		}
 		if err := copyBreakpointInfo(newBp, oldBp); err != nil {
 			return nil, err
 		}
+		if hasLoc {
+			bpLocations[newBp.ID] = loc
+		}
 	}
+	d.bpLocations = bpLocations
 	d.target = p
+	d.lastStop = nil
+	if err := d.stopAtMain(); err != nil {
+		return nil, fmt.Errorf("could not continue to main.main: %v", err)
+	}
 	return discarded, nil
 }
 
@@ -338,6 +394,10 @@ func (d *Debugger) state(retLoadCfg *proc.LoadConfig) (*api.DebuggerState, error
 
 	for _, thread := range d.target.ThreadList() {
 		th := api.ConvertThread(thread)
+		if th.Breakpoint != nil && th.Breakpoint.Internal {
+			// internal breakpoints are not shown to the user
+			th.Breakpoint = nil
+		}
 
 		if retLoadCfg != nil {
 			th.ReturnValues = convertVars(thread.Common().ReturnValues(*retLoadCfg))
@@ -350,6 +410,7 @@ func (d *Debugger) state(retLoadCfg *proc.LoadConfig) (*api.DebuggerState, error
 	}
 
 	state.NextInProgress = d.target.Breakpoints().HasInternalBreakpoints()
+	state.LastStop = d.lastStop
 
 	if recorded, _ := d.target.Recorded(); recorded {
 		state.When, _ = d.target.When()
@@ -358,6 +419,21 @@ func (d *Debugger) state(retLoadCfg *proc.LoadConfig) (*api.DebuggerState, error
 	return state, nil
 }
 
+// BreakAtCurrentFileLine creates a breakpoint at the specified line of the
+// file where the current thread is stopped.
+func (d *Debugger) BreakAtCurrentFileLine(line int) (*api.Breakpoint, error) {
+	d.processMutex.Lock()
+	loc, err := d.target.CurrentThread().Location()
+	d.processMutex.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("could not determine current location: %v", err)
+	}
+	if loc.File == "" {
+		return nil, fmt.Errorf("could not determine current file (stopped at %#x)", loc.PC)
+	}
+	return d.CreateBreakpoint(&api.Breakpoint{File: loc.File, Line: line})
+}
+
 // CreateBreakpoint creates a breakpoint.
 func (d *Debugger) CreateBreakpoint(requestedBp *api.Breakpoint) (*api.Breakpoint, error) {
 	d.processMutex.Lock()
@@ -365,6 +441,7 @@ func (d *Debugger) CreateBreakpoint(requestedBp *api.Breakpoint) (*api.Breakpoin
 
 	var (
 		createdBp *api.Breakpoint
+		loc       breakpointLocation
 		addr      uint64
 		err       error
 	)
@@ -381,25 +458,9 @@ func (d *Debugger) CreateBreakpoint(requestedBp *api.Breakpoint) (*api.Breakpoin
 	switch {
 	case requestedBp.TraceReturn:
 		addr = requestedBp.Addr
-	case len(requestedBp.File) > 0:
-		fileName := requestedBp.File
-		if runtime.GOOS == "windows" {
-			// Accept fileName which is case-insensitive and slash-insensitive match
-			fileNameNormalized := strings.ToLower(filepath.ToSlash(fileName))
-			for _, symFile := range d.target.BinInfo().Sources {
-				if fileNameNormalized == strings.ToLower(filepath.ToSlash(symFile)) {
-					fileName = symFile
-					break
-				}
-			}
-		}
-		addr, err = proc.FindFileLocation(d.target, fileName, requestedBp.Line)
-	case len(requestedBp.FunctionName) > 0:
-		if requestedBp.Line >= 0 {
-			addr, err = proc.FindFunctionLocation(d.target, requestedBp.FunctionName, false, requestedBp.Line)
-		} else {
-			addr, err = proc.FindFunctionLocation(d.target, requestedBp.FunctionName, true, 0)
-		}
+	case len(requestedBp.File) > 0 || len(requestedBp.FunctionName) > 0:
+		loc = breakpointLocation{FunctionName: requestedBp.FunctionName, File: requestedBp.File, Line: requestedBp.Line}
+		addr, err = loc.resolve(d.target)
 	default:
 		addr = requestedBp.Addr
 	}
@@ -418,6 +479,9 @@ func (d *Debugger) CreateBreakpoint(requestedBp *api.Breakpoint) (*api.Breakpoin
 		}
 		return nil, err
 	}
+	if loc != (breakpointLocation{}) {
+		d.bpLocations[bp.ID] = loc
+	}
 	createdBp = api.ConvertBreakpoint(bp)
 	d.log.Infof("created breakpoint: %#v", createdBp)
 	return createdBp, nil
@@ -444,20 +508,54 @@ func (d *Debugger) CancelNext() error {
 	return d.target.ClearInternalBreakpoints()
 }
 
-func copyBreakpointInfo(bp *proc.Breakpoint, requested *api.Breakpoint) (err error) {
+// breakpointLocation is the location specification a user breakpoint was
+// created with, either a function name (with an optional line offset) or a
+// file:line pair.
+type breakpointLocation struct {
+	FunctionName string
+	File         string
+	Line         int
+}
+
+// resolve returns the address of loc in p.
+func (loc breakpointLocation) resolve(p proc.Process) (uint64, error) {
+	if len(loc.File) > 0 {
+		fileName := loc.File
+		if runtime.GOOS == "windows" {
+			// Accept fileName which is case-insensitive and slash-insensitive match
+			fileNameNormalized := strings.ToLower(filepath.ToSlash(fileName))
+			for _, symFile := range p.BinInfo().Sources {
+				if fileNameNormalized == strings.ToLower(filepath.ToSlash(symFile)) {
+					fileName = symFile
+					break
+				}
+			}
+		}
+		return proc.FindFileLocation(p, fileName, loc.Line)
+	}
+	if loc.Line >= 0 {
+		return proc.FindFunctionLocation(p, loc.FunctionName, false, loc.Line)
+	}
+	return proc.FindFunctionLocation(p, loc.FunctionName, true, 0)
+}
+
+func copyBreakpointInfo(bp *proc.Breakpoint, requested *api.Breakpoint) error {
 	bp.Name = requested.Name
-	bp.Tracepoint = requested.Tracepoint
-	bp.TraceReturn = requested.TraceReturn
+	bp.Flags &^= proc.BreakpointTracepoint | proc.BreakpointTraceReturn
+	if requested.Tracepoint {
+		bp.Flags |= proc.BreakpointTracepoint
+	}
+	if requested.TraceReturn {
+		bp.Flags |= proc.BreakpointTraceReturn
+	}
 	bp.Goroutine = requested.Goroutine
 	bp.Stacktrace = requested.Stacktrace
 	bp.Variables = requested.Variables
 	bp.LoadArgs = api.LoadConfigToProc(requested.LoadArgs)
 	bp.LoadLocals = api.LoadConfigToProc(requested.LoadLocals)
+	bp.IgnoreCount = requested.IgnoreCount
 	bp.Cond = nil
-	if requested.Cond != "" {
-		bp.Cond, err = parser.ParseExpr(requested.Cond)
-	}
-	return err
+	return bp.SetCondition(requested.Cond)
 }
 
 // ClearBreakpoint clears a breakpoint.
@@ -470,22 +568,25 @@ func (d *Debugger) ClearBreakpoint(requestedBp *api.Breakpoint) (*api.Breakpoint
 	if err != nil {
 		return nil, fmt.Errorf("Can't clear breakpoint @%x: %s", requestedBp.Addr, err)
 	}
+	delete(d.bpLocations, bp.ID)
 	clearedBp = api.ConvertBreakpoint(bp)
 	d.log.Infof("cleared breakpoint: %#v", clearedBp)
 	return clearedBp, err
 }
 
 // Breakpoints returns the list of current breakpoints.
-func (d *Debugger) Breakpoints() []*api.Breakpoint {
+func (d *Debugger) Breakpoints(all bool) []*api.Breakpoint {
 	d.processMutex.Lock()
 	defer d.processMutex.Unlock()
-	return d.breakpoints()
+	return d.breakpoints(all)
 }
 
-func (d *Debugger) breakpoints() []*api.Breakpoint {
+// breakpoints returns the breakpoints set by the user, if all is true
+// internal breakpoints are also returned.
+func (d *Debugger) breakpoints(all bool) []*api.Breakpoint {
 	bps := []*api.Breakpoint{}
 	for _, bp := range d.target.Breakpoints().M {
-		if bp.IsUser() {
+		if all || bp.IsUser() {
 			bps = append(bps, api.ConvertBreakpoint(bp))
 		}
 	}
@@ -521,7 +622,7 @@ func (d *Debugger) FindBreakpointByName(name string) *api.Breakpoint {
 }
 
 func (d *Debugger) findBreakpointByName(name string) *api.Breakpoint {
-	for _, bp := range d.breakpoints() {
+	for _, bp := range d.breakpoints(false) {
 		if bp.Name == name {
 			return bp
 		}
@@ -565,9 +666,20 @@ func (d *Debugger) FindThread(id int) (*api.Thread, error) {
 func (d *Debugger) setRunning(running bool) {
 	d.runningMutex.Lock()
 	d.running = running
+	d.halted = false
 	d.runningMutex.Unlock()
 }
 
+// setHalted records that a halt command was received, it returns the
+// value of d.halted before the call.
+func (d *Debugger) setHalted(halted bool) bool {
+	d.runningMutex.Lock()
+	defer d.runningMutex.Unlock()
+	r := d.halted
+	d.halted = halted && d.running
+	return r
+}
+
 func (d *Debugger) isRunning() bool {
 	d.runningMutex.Lock()
 	defer d.runningMutex.Unlock()
@@ -582,10 +694,12 @@ func (d *Debugger) Command(command *api.DebuggerCommand) (*api.DebuggerState, er
 		// RequestManualStop does not invoke any ptrace syscalls, so it's safe to
 		// access the process directly.
 		d.log.Debug("halting")
+		d.setHalted(true)
 		err = d.target.RequestManualStop()
 	}
 
 	withBreakpointInfo := true
+	resumed := true
 
 	d.processMutex.Lock()
 	defer d.processMutex.Unlock()
@@ -628,25 +742,33 @@ func (d *Debugger) Command(command *api.DebuggerCommand) (*api.DebuggerState, er
 		d.log.Debugf("switching to thread %d", command.ThreadID)
 		err = d.target.SwitchThread(command.ThreadID)
 		withBreakpointInfo = false
+		resumed = false
 	case api.SwitchGoroutine:
 		d.log.Debugf("switching to goroutine %d", command.GoroutineID)
 		err = d.target.SwitchGoroutine(command.GoroutineID)
 		withBreakpointInfo = false
+		resumed = false
 	case api.Halt:
 		// RequestManualStop already called
 		withBreakpointInfo = false
+		resumed = false
 	}
 
 	if err != nil {
 		if exitedErr, exited := err.(proc.ErrProcessExited); command.Name != api.SwitchGoroutine && command.Name != api.SwitchThread && exited {
+			d.lastStop = &api.StopReason{Kind: api.StopExited}
 			state := &api.DebuggerState{}
 			state.Exited = true
 			state.ExitStatus = exitedErr.Status
 			state.Err = errors.New(exitedErr.Error())
+			state.LastStop = d.lastStop
 			return state, nil
 		}
 		return nil, err
 	}
+	if resumed {
+		d.lastStop = d.stopReason(command.Name, d.setHalted(false))
+	}
 	state, stateErr := d.state(api.LoadConfigToProc(command.ReturnInfoLoadConfig))
 	if stateErr != nil {
 		return state, stateErr
@@ -666,6 +788,33 @@ func (d *Debugger) Command(command *api.DebuggerCommand) (*api.DebuggerState, er
 	return state, err
 }
 
+// stopReason returns the reason the target stopped after being resumed by
+// the command cmd, halted is true if a halt command was received while the
+// target was running.
+func (d *Debugger) stopReason(cmd string, halted bool) *api.StopReason {
+	thread := d.target.CurrentThread()
+	r := &api.StopReason{Kind: api.StopOther, ThreadID: thread.ThreadID()}
+	if loc, err := thread.Location(); err == nil {
+		apiloc := api.ConvertLocation(*loc)
+		r.Location = &apiloc
+	}
+	bp := thread.Breakpoint()
+	switch {
+	case bp.Breakpoint != nil && bp.Active && bp.IsUser():
+		r.Kind = api.StopBreakpoint
+		r.Breakpoint = api.ConvertBreakpoint(bp.Breakpoint)
+	case halted:
+		r.Kind = api.StopManual
+	case cmd == api.Next || cmd == api.Step || cmd == api.StepOut || cmd == api.StepInstruction:
+		r.Kind = api.StopStep
+	case bp.Breakpoint != nil && bp.Internal:
+		// a continue that completed a next, step or stepout command
+		// interrupted by a breakpoint.
+		r.Kind = api.StopStep
+	}
+	return r
+}
+
 func (d *Debugger) collectBreakpointInformation(state *api.DebuggerState) error {
 	if state == nil {
 		return nil
@@ -689,7 +838,7 @@ func (d *Debugger) collectBreakpointInformation(state *api.DebuggerState) error
 		}
 
 		if bp.Stacktrace > 0 {
-			rawlocs, err := proc.ThreadStacktrace(d.target.CurrentThread(), bp.Stacktrace)
+			rawlocs, err := proc.ThreadStacktrace(d.target.CurrentThread(), bp.Stacktrace, true)
 			if err != nil {
 				return err
 			}
@@ -963,9 +1112,9 @@ func (d *Debugger) Stacktrace(goroutineID, depth int, readDefers bool, cfg *proc
 	}
 
 	if g == nil {
-		rawlocs, err = proc.ThreadStacktrace(d.target.CurrentThread(), depth)
+		rawlocs, err = proc.ThreadStacktrace(d.target.CurrentThread(), depth, true)
 	} else {
-		rawlocs, err = g.Stacktrace(depth, readDefers)
+		rawlocs, err = g.Stacktrace(depth, readDefers, true)
 	}
 	if err != nil {
 		return nil, err
@@ -1028,6 +1177,7 @@ func (d *Debugger) convertStacktrace(rawlocs []proc.Stackframe, cfg *proc.LoadCo
 			Defers: d.convertDefers(rawlocs[i].Defers),
 
 			Bottom: rawlocs[i].Bottom,
+			C:      rawlocs[i].IsC(),
 		}
 		if rawlocs[i].Err != nil {
 			frame.Err = rawlocs[i].Err.Error()
@@ -1109,6 +1259,20 @@ func (d *Debugger) FindLocation(scope api.EvalScope, locStr string) ([]api.Locat
 	return locs, err
 }
 
+// ResolveLocation returns the location where a breakpoint on locStr would
+// be set, without setting it. LocStr has the same syntax accepted by
+// FindLocation but it must describe a single location.
+func (d *Debugger) ResolveLocation(scope api.EvalScope, locStr string) (api.Location, error) {
+	locs, err := d.FindLocation(scope, locStr)
+	if err != nil {
+		return api.Location{}, err
+	}
+	if len(locs) != 1 {
+		return api.Location{}, fmt.Errorf("location %q does not describe a single location, it matches %d locations", locStr, len(locs))
+	}
+	return locs[0], nil
+}
+
 // Disassemble code between startPC and endPC
 // if endPC == 0 it will find the function containing startPC and disassemble the whole function
 func (d *Debugger) Disassemble(scope api.EvalScope, startPC, endPC uint64, flavour api.AssemblyFlavour) (api.AsmInstructions, error) {
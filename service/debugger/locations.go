@@ -250,9 +250,11 @@ func (loc *RegexLocationSpec) Find(d *Debugger, scope *proc.EvalScope, locStr st
 	}
 	r := make([]api.Location, 0, len(matches))
 	for i := range matches {
-		addr, err := proc.FindFunctionLocation(d.target, matches[i], true, 0)
+		addrs, err := proc.FindFunctionLocations(d.target, matches[i], true, 0)
 		if err == nil {
-			r = append(r, api.Location{PC: addr})
+			for _, addr := range addrs {
+				r = append(r, api.Location{PC: addr})
+			}
 		}
 	}
 	return r, nil
@@ -266,7 +268,7 @@ func (loc *AddrLocationSpec) Find(d *Debugger, scope *proc.EvalScope, locStr str
 		}
 		return []api.Location{{PC: uint64(addr)}}, nil
 	} else {
-		v, err := scope.EvalExpression(loc.AddrExpr, proc.LoadConfig{true, 0, 0, 0, 0, 0})
+		v, err := scope.EvalExpression(loc.AddrExpr, proc.LoadConfig{true, 0, 0, 0, 0, 0, false, false})
 		if err != nil {
 			return nil, err
 		}
@@ -377,25 +379,33 @@ func (loc *NormalLocationSpec) Find(d *Debugger, scope *proc.EvalScope, locStr s
 	}
 
 	// len(candidateFiles) + len(candidateFuncs) == 1
-	var addr uint64
-	var err error
+	var addrs []uint64
 	if len(candidateFiles) == 1 {
 		if loc.LineOffset < 0 {
 			return nil, fmt.Errorf("Malformed breakpoint location, no line offset specified")
 		}
-		addr, err = proc.FindFileLocation(d.target, candidateFiles[0], loc.LineOffset)
+		addr, err := proc.FindFileLocation(d.target, candidateFiles[0], loc.LineOffset)
+		if err != nil {
+			return nil, err
+		}
+		addrs = []uint64{addr}
 	} else { // len(candidateFUncs) == 1
+		var err error
 		if loc.LineOffset < 0 {
-			addr, err = proc.FindFunctionLocation(d.target, candidateFuncs[0], true, 0)
+			addrs, err = proc.FindFunctionLocations(d.target, candidateFuncs[0], true, 0)
 		} else {
-			addr, err = proc.FindFunctionLocation(d.target, candidateFuncs[0], false, loc.LineOffset)
+			addrs, err = proc.FindFunctionLocations(d.target, candidateFuncs[0], false, loc.LineOffset)
+		}
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	if err != nil {
-		return nil, err
+	r := make([]api.Location, len(addrs))
+	for i := range addrs {
+		r[i] = api.Location{PC: addrs[i]}
 	}
-	return []api.Location{{PC: addr}}, nil
+	return r, nil
 }
 
 func (loc *OffsetLocationSpec) Find(d *Debugger, scope *proc.EvalScope, locStr string) ([]api.Location, error) {
@@ -10,7 +10,7 @@ import (
 	"github.com/go-delve/delve/service/debugger"
 )
 
-var defaultLoadConfig = proc.LoadConfig{true, 1, 64, 64, -1, 0}
+var defaultLoadConfig = proc.LoadConfig{true, 1, 64, 64, -1, 0, false, false}
 
 type RPCServer struct {
 	// config is all the information necessary to start the debugger and server.
@@ -96,7 +96,7 @@ func (s *RPCServer) StacktraceGoroutine(args *StacktraceGoroutineArgs, locations
 }
 
 func (s *RPCServer) ListBreakpoints(arg interface{}, breakpoints *[]*api.Breakpoint) error {
-	*breakpoints = s.debugger.Breakpoints()
+	*breakpoints = s.debugger.Breakpoints(false)
 	return nil
 }
 
@@ -210,6 +210,12 @@ func (c *RPCClient) ListBreakpoints() ([]*api.Breakpoint, error) {
 	return out.Breakpoints, err
 }
 
+func (c *RPCClient) ListAllBreakpoints() ([]*api.Breakpoint, error) {
+	var out ListBreakpointsOut
+	err := c.call("ListBreakpoints", ListBreakpointsIn{All: true}, &out)
+	return out.Breakpoints, err
+}
+
 func (c *RPCClient) ClearBreakpoint(id int) (*api.Breakpoint, error) {
 	var out ClearBreakpointOut
 	err := c.call("ClearBreakpoint", ClearBreakpointIn{id, ""}, &out)
@@ -328,6 +334,12 @@ func (c *RPCClient) FindLocation(scope api.EvalScope, loc string) ([]api.Locatio
 	return out.Locations, err
 }
 
+func (c *RPCClient) ResolveLocation(scope api.EvalScope, loc string) (api.Location, error) {
+	var out ResolveLocationOut
+	err := c.call("ResolveLocation", ResolveLocationIn{scope, loc}, &out)
+	return out.Location, err
+}
+
 // Disassemble code between startPC and endPC
 func (c *RPCClient) DisassembleRange(scope api.EvalScope, startPC, endPC uint64, flavour api.AssemblyFlavour) (api.AsmInstructions, error) {
 	var out DisassembleOut
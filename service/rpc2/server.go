@@ -170,7 +170,7 @@ type StacktraceOut struct {
 func (s *RPCServer) Stacktrace(arg StacktraceIn, out *StacktraceOut) error {
 	cfg := arg.Cfg
 	if cfg == nil && arg.Full {
-		cfg = &api.LoadConfig{true, 1, 64, 64, -1}
+		cfg = &api.LoadConfig{true, 1, 64, 64, -1, false}
 	}
 	var err error
 	out.Locations, err = s.debugger.Stacktrace(arg.Id, arg.Depth, arg.Defers, api.LoadConfigToProc(cfg))
@@ -195,15 +195,19 @@ func (s *RPCServer) Ancestors(arg AncestorsIn, out *AncestorsOut) error {
 }
 
 type ListBreakpointsIn struct {
+	// All requests the internal breakpoints set by the debugger, as well
+	// as the ones set by the user.
+	All bool
 }
 
 type ListBreakpointsOut struct {
 	Breakpoints []*api.Breakpoint
 }
 
-// ListBreakpoints gets all breakpoints.
+// ListBreakpoints gets all breakpoints set by the user, or all the
+// breakpoints, including internal ones, if arg.All is set.
 func (s *RPCServer) ListBreakpoints(arg ListBreakpointsIn, out *ListBreakpointsOut) error {
-	out.Breakpoints = s.debugger.Breakpoints()
+	out.Breakpoints = s.debugger.Breakpoints(arg.All)
 	return nil
 }
 
@@ -442,7 +446,7 @@ type EvalOut struct {
 func (s *RPCServer) Eval(arg EvalIn, out *EvalOut) error {
 	cfg := arg.Cfg
 	if cfg == nil {
-		cfg = &api.LoadConfig{true, 1, 64, 64, -1}
+		cfg = &api.LoadConfig{true, 1, 64, 64, -1, false}
 	}
 	v, err := s.debugger.EvalVariableInScope(arg.Scope, arg.Expr, *api.LoadConfigToProc(cfg))
 	if err != nil {
@@ -590,6 +594,26 @@ func (c *RPCServer) FindLocation(arg FindLocationIn, out *FindLocationOut) error
 	return err
 }
 
+type ResolveLocationIn struct {
+	Scope api.EvalScope
+	Loc   string
+}
+
+type ResolveLocationOut struct {
+	Location api.Location
+}
+
+// ResolveLocation returns the location where a breakpoint described by
+// the location expression Loc would be set, see FindLocation for the
+// syntax of Loc. Loc must describe a single location.
+//
+// NOTE: this function does not actually set breakpoints.
+func (c *RPCServer) ResolveLocation(arg ResolveLocationIn, out *ResolveLocationOut) error {
+	var err error
+	out.Location, err = c.debugger.ResolveLocation(arg.Scope, arg.Loc)
+	return err
+}
+
 type DisassembleIn struct {
 	Scope          api.EvalScope
 	StartPC, EndPC uint64
@@ -20,11 +20,12 @@ import (
 	"github.com/go-delve/delve/pkg/logflags"
 	"github.com/go-delve/delve/service"
 	"github.com/go-delve/delve/service/api"
+	"github.com/go-delve/delve/service/debugger"
 	"github.com/go-delve/delve/service/rpc2"
 	"github.com/go-delve/delve/service/rpccommon"
 )
 
-var normalLoadConfig = api.LoadConfig{true, 1, 64, 64, -1}
+var normalLoadConfig = api.LoadConfig{true, 1, 64, 64, -1, false}
 var testBackend, buildMode string
 
 func TestMain(m *testing.M) {
@@ -242,6 +243,39 @@ func TestClientServer_step(t *testing.T) {
 	})
 }
 
+func TestClientServer_lastStop(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestClient2("testprog", t, func(c service.Client) {
+		bp, err := c.CreateBreakpoint(&api.Breakpoint{FunctionName: "main.helloworld", Line: -1})
+		assertNoError(err, t, "CreateBreakpoint()")
+
+		state := <-c.Continue()
+		assertNoError(state.Err, t, "Continue()")
+		stop := state.LastStop
+		if stop == nil || stop.Kind != api.StopBreakpoint || stop.Breakpoint == nil || stop.Breakpoint.ID != bp.ID {
+			t.Fatalf("wrong stop reason after continue %#v", stop)
+		}
+		if stop.ThreadID != state.CurrentThread.ID || stop.Location == nil || stop.Location.Function == nil || stop.Location.Function.Name() != "main.helloworld" {
+			t.Fatalf("wrong location of the stop %#v", stop)
+		}
+
+		_, err = c.Next()
+		assertNoError(err, t, "Next()")
+		state, err = c.GetState()
+		assertNoError(err, t, "GetState()")
+		if state.LastStop == nil || state.LastStop.Kind != api.StopStep || state.LastStop.Breakpoint != nil {
+			t.Fatalf("wrong stop reason after next %#v", state.LastStop)
+		}
+
+		_, err = c.ClearBreakpoint(bp.ID)
+		assertNoError(err, t, "ClearBreakpoint()")
+		state = <-c.Continue()
+		if !state.Exited || state.LastStop == nil || state.LastStop.Kind != api.StopExited {
+			t.Fatalf("wrong stop reason after exit %#v", state.LastStop)
+		}
+	})
+}
+
 func TestClientServer_stepout(t *testing.T) {
 	protest.AllowRecording(t)
 	withTestClient2("testnextprog", t, func(c service.Client) {
@@ -724,6 +758,36 @@ func TestClientServer_FindLocations(t *testing.T) {
 	})
 }
 
+func TestClientServer_ResolveLocation(t *testing.T) {
+	withTestClient2("locationsprog", t, func(c service.Client) {
+		bps, err := c.ListBreakpoints()
+		assertNoError(err, t, "ListBreakpoints()")
+		nbp := len(bps)
+
+		scope := api.EvalScope{GoroutineID: -1}
+		for _, locstr := range []string{"locationsprog.go:26", "main.anotherFunction", "anotherFunction:1"} {
+			addr := findLocationHelper(t, c, locstr, false, 1, 0)[0]
+			loc, err := c.ResolveLocation(scope, locstr)
+			assertNoError(err, t, fmt.Sprintf("ResolveLocation(%q)", locstr))
+			if loc.PC != addr {
+				t.Fatalf("wrong location for %q: %#x, expected %#x", locstr, loc.PC, addr)
+			}
+		}
+
+		for _, locstr := range []string{"", "main.nonexistent", "locationsprog.go:1000", "/^main.*Type.*String$/"} {
+			if _, err := c.ResolveLocation(scope, locstr); err == nil {
+				t.Fatalf("ResolveLocation(%q) did not return an error", locstr)
+			}
+		}
+
+		bps, err = c.ListBreakpoints()
+		assertNoError(err, t, "ListBreakpoints()")
+		if len(bps) != nbp {
+			t.Fatalf("ResolveLocation set breakpoints: %d, expected %d", len(bps), nbp)
+		}
+	})
+}
+
 func TestClientServer_FindLocationsAddr(t *testing.T) {
 	withTestClient2("locationsprog2", t, func(c service.Client) {
 		<-c.Continue()
@@ -1299,6 +1363,88 @@ func TestClientServer_RestartBreakpointPosition(t *testing.T) {
 	})
 }
 
+func TestNextLeavesNoInternalBreakpoints(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestClient2("testnextprog", t, func(c service.Client) {
+		_, err := c.CreateBreakpoint(&api.Breakpoint{FunctionName: "main.helloworld", Line: -1})
+		assertNoError(err, t, "CreateBreakpoint()")
+		state := <-c.Continue()
+		assertNoError(state.Err, t, "Continue()")
+		state, err = c.Next()
+		assertNoError(err, t, "Next()")
+		if state.NextInProgress {
+			t.Fatal("next still in progress")
+		}
+		if state.CurrentThread.Breakpoint != nil && state.CurrentThread.Breakpoint.Internal {
+			t.Fatalf("internal breakpoint reported in state: %#v", state.CurrentThread.Breakpoint)
+		}
+
+		bps, err := c.ListBreakpoints()
+		assertNoError(err, t, "ListBreakpoints()")
+		allbps, err := c.ListAllBreakpoints()
+		assertNoError(err, t, "ListAllBreakpoints()")
+		for _, bp := range append(bps, allbps...) {
+			if bp.Internal {
+				t.Fatalf("internal breakpoint left behind by next: %#v", bp)
+			}
+		}
+		if len(bps) != len(allbps) {
+			t.Fatalf("mismatched number of breakpoints %d %d", len(bps), len(allbps))
+		}
+	})
+}
+
+func TestClientServer_RestartBreakpointReresolution(t *testing.T) {
+	// Breakpoints set by function name or file:line must be re-resolved
+	// against the executable after a restart.
+	protest.AllowRecording(t)
+	withTestClient2("locationsprog2", t, func(c service.Client) {
+		fp := protest.BuildFixture("locationsprog2", 0).Source
+		_, err := c.CreateBreakpoint(&api.Breakpoint{FunctionName: "main.afunction", Line: -1, Name: "byfunc"})
+		assertNoError(err, t, "CreateBreakpoint(main.afunction)")
+		_, err = c.CreateBreakpoint(&api.Breakpoint{File: fp, Line: 17, Name: "byline"})
+		assertNoError(err, t, "CreateBreakpoint(file:line)")
+
+		discarded, err := c.Restart()
+		assertNoError(err, t, "Restart")
+		if len(discarded) != 0 {
+			t.Fatalf("breakpoints discarded after restart: %#v", discarded)
+		}
+
+		bps, err := c.ListBreakpoints()
+		assertNoError(err, t, "ListBreakpoints")
+		for _, tgt := range []struct{ name, loc string }{{"byfunc", "main.afunction"}, {"byline", fmt.Sprintf("%s:17", fp)}} {
+			locs, err := c.FindLocation(api.EvalScope{-1, 0, 0}, tgt.loc)
+			assertNoError(err, t, fmt.Sprintf("FindLocation(%s)", tgt.loc))
+			found := false
+			for _, bp := range bps {
+				if bp.Name != tgt.name {
+					continue
+				}
+				found = true
+				if bp.Addr != locs[0].PC {
+					t.Errorf("breakpoint %s at %#x after restart, expected %#x", tgt.name, bp.Addr, locs[0].PC)
+				}
+			}
+			if !found {
+				t.Errorf("breakpoint %s not found after restart", tgt.name)
+			}
+		}
+
+		// locationsprog2 calls runtime.Breakpoint before main.afunction
+		state := <-c.Continue()
+		assertNoError(state.Err, t, "Continue")
+		if state.CurrentThread.Breakpoint != nil {
+			t.Fatalf("expected manual stop at runtime.Breakpoint, got %#v", state.CurrentThread.Breakpoint)
+		}
+		state = <-c.Continue()
+		assertNoError(state.Err, t, "Continue")
+		if state.CurrentThread.Breakpoint == nil || state.CurrentThread.Breakpoint.Name != "byfunc" {
+			t.Fatalf("wrong breakpoint after restart: %#v", state.CurrentThread.Breakpoint)
+		}
+	})
+}
+
 func TestClientServer_SelectedGoroutineLoc(t *testing.T) {
 	// CurrentLocation of SelectedGoroutine should reflect what's happening on
 	// the thread running the goroutine, not the position the goroutine was in
@@ -1527,6 +1673,86 @@ func TestAcceptMulticlient(t *testing.T) {
 	<-serverDone
 }
 
+func TestStopAtMain(t *testing.T) {
+	// With StopAtMain set the target should be stopped at main.main after
+	// launching and after restarting.
+	if testBackend == "rr" {
+		t.Skip("StopAtMain is not used when replaying a recording")
+	}
+	listener, clientConn := service.ListenerPipe()
+	defer listener.Close()
+	fixture := protest.BuildFixture("continuetestprog", 0)
+	server := rpccommon.NewServer(&service.Config{
+		Listener:    listener,
+		ProcessArgs: []string{fixture.Path},
+		Backend:     testBackend,
+		StopAtMain:  true,
+	})
+	if err := server.Run(); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc2.NewClientFromConn(clientConn)
+	defer client.Detach(true)
+
+	checkStopped := func(when string) {
+		state, err := client.GetState()
+		assertNoError(err, t, "GetState()")
+		if state.CurrentThread == nil || state.CurrentThread.Function == nil || state.CurrentThread.Function.Name() != "main.main" {
+			t.Fatalf("not stopped at main.main %s: %#v", when, state.CurrentThread)
+		}
+		if state.CurrentThread.Breakpoint != nil {
+			t.Fatalf("stopped at breakpoint %s: %#v", when, state.CurrentThread.Breakpoint)
+		}
+	}
+
+	checkStopped("after launch")
+	_, err := client.Restart()
+	assertNoError(err, t, "Restart()")
+	checkStopped("after restart")
+
+	// If the target stops at a breakpoint before reaching main.main the
+	// breakpoint on main.main must not stop it later.
+	_, err = client.CreateBreakpoint(&api.Breakpoint{FunctionName: "runtime.main"})
+	assertNoError(err, t, "CreateBreakpoint(runtime.main)")
+	_, err = client.Restart()
+	assertNoError(err, t, "Restart()")
+	state, err := client.GetState()
+	assertNoError(err, t, "GetState()")
+	if state.CurrentThread == nil || state.CurrentThread.Function == nil || state.CurrentThread.Function.Name() != "runtime.main" {
+		t.Fatalf("not stopped at runtime.main after restart: %#v", state.CurrentThread)
+	}
+	if state = <-client.Continue(); !state.Exited {
+		t.Fatalf("target did not exit: %#v", state.CurrentThread)
+	}
+}
+
+func TestBreakAtCurrentFileLine(t *testing.T) {
+	protest.AllowRecording(t)
+	fixture := protest.BuildFixture("testnextprog", 0)
+	d, err := debugger.New(&debugger.Config{Backend: testBackend}, []string{fixture.Path})
+	assertNoError(err, t, "debugger.New()")
+	defer d.Detach(true)
+
+	_, err = d.CreateBreakpoint(&api.Breakpoint{FunctionName: "main.helloworld"})
+	assertNoError(err, t, "CreateBreakpoint()")
+	state, err := d.Command(&api.DebuggerCommand{Name: api.Continue})
+	assertNoError(err, t, "Continue()")
+	if state.CurrentThread.Function == nil || state.CurrentThread.Function.Name() != "main.helloworld" {
+		t.Fatalf("not stopped in main.helloworld: %#v", state.CurrentThread)
+	}
+
+	bp, err := d.BreakAtCurrentFileLine(42)
+	assertNoError(err, t, "BreakAtCurrentFileLine()")
+	if bp.File != fixture.Source || bp.Line != 42 {
+		t.Fatalf("wrong breakpoint location %s:%d", bp.File, bp.Line)
+	}
+	state, err = d.Command(&api.DebuggerCommand{Name: api.Continue})
+	assertNoError(err, t, "Continue()")
+	if state.CurrentThread.Breakpoint == nil || state.CurrentThread.Breakpoint.ID != bp.ID || state.CurrentThread.Line != 42 {
+		t.Fatalf("not stopped at the new breakpoint: %#v", state.CurrentThread)
+	}
+}
+
 func mustHaveDebugCalls(t *testing.T, c service.Client) {
 	locs, err := c.FindLocation(api.EvalScope{-1, 0, 0}, "runtime.debugCallV1")
 	if len(locs) == 0 || err != nil {
@@ -1622,7 +1848,7 @@ func TestClientServerFunctionCallStacktrace(t *testing.T) {
 	protest.MustSupportFunctionCalls(t, testBackend)
 	withTestClient2("fncall", t, func(c service.Client) {
 		mustHaveDebugCalls(t, c)
-		c.SetReturnValuesLoadConfig(&api.LoadConfig{false, 0, 2048, 0, 0})
+		c.SetReturnValuesLoadConfig(&api.LoadConfig{false, 0, 2048, 0, 0, false})
 		state := <-c.Continue()
 		assertNoError(state.Err, t, "Continue()")
 		state, err := c.Call("callstacktrace()", false)
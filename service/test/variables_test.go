@@ -18,8 +18,8 @@ import (
 	protest "github.com/go-delve/delve/pkg/proc/test"
 )
 
-var pnormalLoadConfig = proc.LoadConfig{true, 1, 64, 64, -1, 0}
-var pshortLoadConfig = proc.LoadConfig{false, 0, 64, 0, 3, 0}
+var pnormalLoadConfig = proc.LoadConfig{true, 1, 64, 64, -1, 0, false, false}
+var pshortLoadConfig = proc.LoadConfig{false, 0, 64, 0, 3, 0, false, false}
 
 type varTest struct {
 	name         string
@@ -59,7 +59,7 @@ func assertVariable(t *testing.T, variable *proc.Variable, expected varTest) {
 }
 
 func findFirstNonRuntimeFrame(p proc.Process) (proc.Stackframe, error) {
-	frames, err := proc.ThreadStacktrace(p.CurrentThread(), 10)
+	frames, err := proc.ThreadStacktrace(p.CurrentThread(), 10, true)
 	if err != nil {
 		return proc.Stackframe{}, err
 	}
@@ -224,6 +224,82 @@ func TestVariableEvaluation(t *testing.T) {
 	})
 }
 
+func TestEvalVariables(t *testing.T) {
+	testcases := []varTest{
+		{"a1", true, "\"foofoofoofoofoofoo\"", "", "string", nil},
+		{"NonExistent", true, "", "", "", fmt.Errorf("could not find symbol value for NonExistent")},
+		{"a6.Baz", true, "8", "", "int", nil},
+		{"a9.Baz", true, "", "", "", fmt.Errorf("a9 is nil")},
+		{"a6", true, "main.FooBar {Baz: 8, Bur: \"word\"}", "", "main.FooBar", nil},
+		{"a2 +", true, "", "", "", fmt.Errorf("1:5: expected operand, found 'EOF'")},
+		{"a2", true, "6", "", "int", nil},
+	}
+
+	protest.AllowRecording(t)
+	withTestProcess("testvariables", t, func(p proc.Process, fixture protest.Fixture) {
+		assertNoError(proc.Continue(p), t, "Continue() returned an error")
+		scope, err := evalScope(p)
+		assertNoError(err, t, "evalScope")
+
+		exprs := make([]string, len(testcases))
+		for i := range testcases {
+			exprs[i] = testcases[i].name
+		}
+		vars, err := scope.EvalVariables(exprs, pnormalLoadConfig)
+		assertNoError(err, t, "EvalVariables")
+		if len(vars) != len(testcases) {
+			t.Fatalf("wrong number of results %d", len(vars))
+		}
+		for i, tc := range testcases {
+			if tc.err == nil {
+				if vars[i].Unreadable != nil {
+					t.Fatalf("%s: unexpected error %v", tc.name, vars[i].Unreadable)
+				}
+				assertVariable(t, vars[i], tc)
+				continue
+			}
+			if vars[i].Name != tc.name {
+				t.Fatalf("%s: wrong name %q", tc.name, vars[i].Name)
+			}
+			if vars[i].Unreadable == nil || vars[i].Unreadable.Error() != tc.err.Error() {
+				t.Fatalf("%s: expected error %q, got %v", tc.name, tc.err, vars[i].Unreadable)
+			}
+		}
+	})
+}
+
+func TestItabMethods(t *testing.T) {
+	testcases := []struct {
+		name    string
+		methods []string
+	}{
+		{"err1", []string{"main.(*astruct).Error"}},
+		{"err2", []string{"main.(*bstruct).Error"}},
+		{"errnil", nil},
+		{"iface1", nil},
+	}
+
+	protest.AllowRecording(t)
+	withTestProcess("testvariables2", t, func(p proc.Process, fixture protest.Fixture) {
+		assertNoError(proc.Continue(p), t, "Continue() returned an error")
+		for _, tc := range testcases {
+			v, err := evalVariable(p, tc.name, pnormalLoadConfig)
+			assertNoError(err, t, fmt.Sprintf("EvalVariable(%s)", tc.name))
+			if v.ItabMethods != nil {
+				t.Errorf("%s: method table loaded without LoadItabMethods: %v", tc.name, v.ItabMethods)
+			}
+
+			cfg := pnormalLoadConfig
+			cfg.LoadItabMethods = true
+			v, err = evalVariable(p, tc.name, cfg)
+			assertNoError(err, t, fmt.Sprintf("EvalVariable(%s)", tc.name))
+			if fmt.Sprint(v.ItabMethods) != fmt.Sprint(tc.methods) {
+				t.Errorf("%s: got methods %v expected %v", tc.name, v.ItabMethods, tc.methods)
+			}
+		}
+	})
+}
+
 func TestSetVariable(t *testing.T) {
 	var testcases = []struct {
 		name     string
@@ -388,6 +464,35 @@ func TestMultilineVariableEvaluation(t *testing.T) {
 	})
 }
 
+func TestByteSliceHexDump(t *testing.T) {
+	testcases := []struct {
+		name  string
+		cfg   proc.LoadConfig
+		value string
+	}{
+		{"byteslice", pnormalLoadConfig, `[]uint8 len: 5, cap: 5, [
+	00000000  74 c3 a8 73 74                                    |t..st|
+]`},
+		{"byteslice", proc.LoadConfig{true, 1, 64, 3, -1, 0, false, false}, `[]uint8 len: 5, cap: 5, [
+	00000000  74 c3 a8                                          |t..|
+	...+2 more
+]`},
+		{"runeslice", pnormalLoadConfig, "[]int32 len: 4, cap: 4, [116,232,115,116]"},
+	}
+
+	protest.AllowRecording(t)
+	withTestProcess("testvariables2", t, func(p proc.Process, fixture protest.Fixture) {
+		assertNoError(proc.Continue(p), t, "Continue() returned an error")
+		for _, tc := range testcases {
+			variable, err := evalVariable(p, tc.name, tc.cfg)
+			assertNoError(err, t, fmt.Sprintf("EvalVariable(%s)", tc.name))
+			if ms := api.ConvertVar(variable).MultilineString(""); ms != tc.value {
+				t.Errorf("Expected %s got %s (variable %s)\n", tc.value, ms, tc.name)
+			}
+		}
+	})
+}
+
 type varArray []*proc.Variable
 
 // Len is part of sort.Interface.
@@ -494,6 +599,11 @@ func TestEmbeddedStruct(t *testing.T) {
 			{"b.C.s", true, "\"hello\"", "\"hello\"", "string", nil},
 			{"b.s", true, "\"hello\"", "\"hello\"", "string", nil},
 			{"b2", true, "main.B {A: main.A {val: 42}, C: *main.C nil, a: main.A {val: 47}, ptr: *main.A nil}", "main.B {A: (*main.A)(0x…", "main.B", nil},
+			{"d1.x", true, "3", "3", "int", nil},
+			{"d1.val", true, "42", "42", "int", nil},
+			{"d1.B.A.val", true, "42", "42", "int", nil},
+			{"d1.a.val", true, "47", "47", "int", nil},
+			{"d1", true, "main.E {B: main.B {A: (*main.A)(0x…", "main.E {B: (*main.B)(0x…", "main.E", nil},
 		}
 		assertNoError(proc.Continue(p), t, "Continue()")
 
@@ -501,9 +611,13 @@ func TestEmbeddedStruct(t *testing.T) {
 		if ver.Major >= 0 && !ver.AfterOrEqual(goversion.GoVersion{1, 9, -1, 0, 0, ""}) {
 			// on go < 1.9 embedded fields had different names
 			for i := range testcases {
-				if testcases[i].name == "b2" {
+				switch testcases[i].name {
+				case "b2":
 					testcases[i].value = "main.B {main.A: main.A {val: 42}, *main.C: *main.C nil, a: main.A {val: 47}, ptr: *main.A nil}"
 					testcases[i].alternate = "main.B {main.A: (*main.A)(0x…"
+				case "d1":
+					testcases[i].value = "main.E {main.B: main.B {main.A: (*main.A)(0x…"
+					testcases[i].alternate = "main.E {main.B: (*main.B)(0x…"
 				}
 			}
 		}
@@ -606,6 +720,7 @@ func TestEvalExpression(t *testing.T) {
 		{"err1", true, "error(*main.astruct) *{A: 1, B: 2}", "error(*main.astruct) 0x…", "error", nil},
 		{"err2", true, "error(*main.bstruct) *{a: main.astruct {A: 1, B: 2}}", "error(*main.bstruct) 0x…", "error", nil},
 		{"errnil", true, "error nil", "error nil", "error", nil},
+		{"errtypednil", true, "error((*main.astruct)(nil))", "error((*main.astruct)(nil))", "error", nil},
 		{"iface1", true, "interface {}(*main.astruct) *{A: 1, B: 2}", "interface {}(*main.astruct) 0x…", "interface {}", nil},
 		{"iface1.A", false, "1", "1", "int", nil},
 		{"iface1.B", false, "2", "2", "int", nil},
@@ -788,6 +903,9 @@ func TestEvalExpression(t *testing.T) {
 		{"[]byte(string(runeslice))", false, `[]uint8 len: 5, cap: 5, [116,195,168,115,116]`, `[]uint8 len: 0, cap: 0, nil`, "[]uint8", nil},
 		{"*(*[5]byte)(uintptr(&byteslice[0]))", false, `[5]uint8 [116,195,168,115,116]`, `[5]uint8 [...]`, "[5]uint8", nil},
 		{"string(bytearray)", false, `"tèst"`, `""`, "string", nil},
+		{"boolvar", true, "true", "true", "bool", nil},
+		{"runevar", true, "'A' (65)", "'A' (65)", "int32", nil},
+		{"ni32", true, "-5", "-5", "int32", nil},
 		{"string(runearray)", false, `"tèst"`, `""`, "string", nil},
 		{"string(str1)", false, `"01234567890"`, `"01234567890"`, "string", nil},
 
@@ -803,6 +921,7 @@ func TestEvalExpression(t *testing.T) {
 
 		{"afunc", true, `main.afunc`, `main.afunc`, `func()`, nil},
 		{"main.afunc2", true, `main.afunc2`, `main.afunc2`, `func()`, nil},
+		{"closurevar", true, `main.main.func1 {capturedInt: 10, capturedStr: "captured"}`, `main.main.func1 {capturedInt: 10, capturedStr: "captured"}`, `func() int`, nil},
 
 		{"s2[0].Error", false, "main.(*astruct).Error", "main.(*astruct).Error", "func() string", nil},
 		{"s2[0].NonPointerRecieverMethod", false, "main.astruct.NonPointerRecieverMethod", "main.astruct.NonPointerRecieverMethod", "func()", nil},
@@ -813,6 +932,15 @@ func TestEvalExpression(t *testing.T) {
 	}
 
 	ver, _ := goversion.Parse(runtime.Version())
+	if ver.Major >= 0 && !ver.AfterOrEqual(goversion.GoVersion{1, 23, -1, 0, 0, ""}) {
+		// the layout of closures is described in debug_info starting with Go 1.23
+		for i := range testcases {
+			if testcases[i].name == "closurevar" {
+				testcases[i].value = "main.main.func1"
+				testcases[i].alternate = "main.main.func1"
+			}
+		}
+	}
 	if ver.Major >= 0 && !ver.AfterOrEqual(goversion.GoVersion{1, 7, -1, 0, 0, ""}) {
 		for i := range testcases {
 			if testcases[i].name == "iface3" {
@@ -912,6 +1040,67 @@ func TestMapEvaluation(t *testing.T) {
 	})
 }
 
+func TestSortMapEntries(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcess("testvariables2", t, func(p proc.Process, fixture protest.Fixture) {
+		assertNoError(proc.Continue(p), t, "Continue() returned an error")
+		load := func() *api.Variable {
+			m1v, err := evalVariable(p, "m1", pnormalLoadConfig)
+			assertNoError(err, t, "EvalVariable()")
+			return api.ConvertVar(m1v)
+		}
+
+		m1 := load()
+		m1.SortMapEntries()
+		out1 := m1.MultilineString("")
+
+		// the order the entries were loaded in doesn't matter
+		m1rev := load()
+		for i, j := 0, len(m1rev.Children)-2; i < j; i, j = i+2, j-2 {
+			m1rev.Children[i], m1rev.Children[j] = m1rev.Children[j], m1rev.Children[i]
+			m1rev.Children[i+1], m1rev.Children[j+1] = m1rev.Children[j+1], m1rev.Children[i+1]
+		}
+		m1rev.SortMapEntries()
+		if out2 := m1rev.MultilineString(""); out1 != out2 {
+			t.Fatalf("different output after sorting:\n%s\n%s", out1, out2)
+		}
+
+		for i := 2; i < len(m1.Children); i += 2 {
+			if m1.Children[i-2].Value > m1.Children[i].Value {
+				t.Fatalf("keys not sorted: %q before %q", m1.Children[i-2].Value, m1.Children[i].Value)
+			}
+		}
+	})
+}
+
+func TestMapKeys(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcess("mapkeys", t, func(p proc.Process, fixture protest.Fixture) {
+		assertNoError(proc.Continue(p), t, "Continue() returned an error")
+		testcases := []struct {
+			varTest
+			cfg proc.LoadConfig
+		}{
+			{varTest{"m1", true, "map[main.point]int [{X: 1, Y: 2}: 42, ]", "", "map[main.point]int", nil}, pnormalLoadConfig},
+			// the fields of struct keys past the depth limit are not loaded.
+			{varTest{"m3", true, "map[main.segment]bool [{A: {...}, B: {...}}: true, ]", "", "map[main.segment]bool", nil}, pnormalLoadConfig},
+			{varTest{"m3", true, "map[main.segment]bool [{A: {X: 1, Y: 2}, B: {X: 3, Y: 4}}: true, ]", "", "map[main.segment]bool", nil}, proc.LoadConfig{true, 2, 64, 64, -1, 0, false, false}},
+		}
+		for _, tc := range testcases {
+			variable, err := evalVariable(p, tc.name, tc.cfg)
+			assertNoError(err, t, fmt.Sprintf("EvalVariable(%s)", tc.name))
+			assertVariable(t, variable, tc.varTest)
+		}
+
+		// pointer keys are written as the address they point to.
+		pv, err := evalVariable(p, "p", pnormalLoadConfig)
+		assertNoError(err, t, "EvalVariable(p)")
+		m2, err := evalVariable(p, "m2", pnormalLoadConfig)
+		assertNoError(err, t, "EvalVariable(m2)")
+		assertVariable(t, m2, varTest{"m2", true, fmt.Sprintf("map[*main.point]string [(*main.point)(%#x) *{X: 3, Y: 4}: \"p\", ]", pv.Children[0].Addr), "", "map[*main.point]string", nil})
+	})
+}
+
 func TestUnsafePointer(t *testing.T) {
 	protest.AllowRecording(t)
 	withTestProcess("testvariables2", t, func(p proc.Process, fixture protest.Fixture) {
@@ -925,6 +1114,22 @@ func TestUnsafePointer(t *testing.T) {
 	})
 }
 
+func TestPointerDescr(t *testing.T) {
+	protest.AllowRecording(t)
+	withTestProcess("testvariables2", t, func(p proc.Process, fixture protest.Fixture) {
+		assertNoError(proc.Continue(p), t, "Continue() returned an error")
+		for _, name := range []string{"pglobal1", "upglobal1"} {
+			// pointers are only described when the value they point to is
+			// not loaded, otherwise the value is shown.
+			v, err := evalVariable(p, name, pshortLoadConfig)
+			assertNoError(err, t, fmt.Sprintf("EvalVariable(%s)", name))
+			if descr := api.ConvertVar(v).PointerDescr; descr != "&main.global1" {
+				t.Errorf("wrong description for %s: %q", name, descr)
+			}
+		}
+	})
+}
+
 type issue426TestCase struct {
 	name string
 	typ  string
@@ -1040,6 +1245,7 @@ func TestConstants(t *testing.T) {
 		{"d", true, "33", "", "main.BitFieldType", nil},
 		{"e", true, "10", "", "main.ConstType", nil},
 		{"f", true, "0", "", "main.BitFieldType", nil},
+		{"g", true, "[]main.ConstType len: 3, cap: 3, [constOne (1),7,constThree (3)]", "", "[]main.ConstType", nil},
 		{"bitZero", true, "1", "", "main.BitFieldType", nil},
 		{"bitOne", true, "2", "", "main.BitFieldType", nil},
 		{"constTwo", true, "2", "", "main.ConstType", nil},
@@ -1060,6 +1266,90 @@ func TestConstants(t *testing.T) {
 	})
 }
 
+func TestEvalConstant(t *testing.T) {
+	testcases := []varTest{
+		{"pkg.SomeConst", true, "2", "", "int", nil},
+		{"main.constThree", true, "3", "", "main.ConstType", nil},
+	}
+	ver, _ := goversion.Parse(runtime.Version())
+	if ver.Major > 0 && !ver.AfterOrEqual(goversion.GoVersion{1, 10, -1, 0, 0, ""}) {
+		// Not supported on 1.9 or earlier
+		t.Skip("constants added in go 1.10")
+	}
+	withTestProcess("consts", t, func(p proc.Process, fixture protest.Fixture) {
+		assertNoError(proc.Continue(p), t, "Continue")
+		scope, err := evalScope(p)
+		assertNoError(err, t, "evalScope")
+		for _, testcase := range testcases {
+			variable, err := scope.EvalConstant(testcase.name)
+			assertNoError(err, t, fmt.Sprintf("EvalConstant(%s)", testcase.name))
+			if variable.Flags&proc.VariableConstant == 0 {
+				t.Errorf("%s: not flagged as constant", testcase.name)
+			}
+			assertVariable(t, variable, testcase)
+		}
+		if _, err := scope.EvalConstant("main.a"); err == nil {
+			t.Error("EvalConstant(main.a) did not return an error for a variable")
+		}
+	})
+}
+
+func TestTimePrettyPrint(t *testing.T) {
+	testcases := []varTest{
+		{"tm", true, "time.Time(2009-11-10T23:00:00Z)", "", "time.Time", nil},
+		{"tmptr", true, "*time.Time(2009-11-10T23:00:00Z)", "", "*time.Time", nil},
+		{"d", true, "1m30s", "", "time.Duration", nil},
+	}
+	protest.AllowRecording(t)
+	withTestProcess("timevars", t, func(p proc.Process, fixture protest.Fixture) {
+		assertNoError(proc.Continue(p), t, "Continue")
+		for _, testcase := range testcases {
+			variable, err := evalVariable(p, testcase.name, pnormalLoadConfig)
+			assertNoError(err, t, fmt.Sprintf("EvalVariable(%s)", testcase.name))
+			assertVariable(t, variable, testcase)
+		}
+	})
+}
+
+func TestSyncPrettyPrint(t *testing.T) {
+	testcases := []varTest{
+		{"mu1", true, "sync.Mutex(locked)", "", "sync.Mutex", nil},
+		{"mu2", true, "sync.Mutex(unlocked)", "", "sync.Mutex", nil},
+		{"wg", true, "sync.WaitGroup(counter 2, waiters 0)", "", "sync.WaitGroup", nil},
+		{"once1", true, "sync.Once(done)", "", "sync.Once", nil},
+		{"once2", true, "sync.Once(not done)", "", "sync.Once", nil},
+	}
+	protest.AllowRecording(t)
+	withTestProcess("syncvars", t, func(p proc.Process, fixture protest.Fixture) {
+		assertNoError(proc.Continue(p), t, "Continue")
+		for _, testcase := range testcases {
+			variable, err := evalVariable(p, testcase.name, pnormalLoadConfig)
+			assertNoError(err, t, fmt.Sprintf("EvalVariable(%s)", testcase.name))
+			assertVariable(t, variable, testcase)
+		}
+	})
+}
+
+func TestChanWaiters(t *testing.T) {
+	testcases := []varTest{
+		{"chbuf", true, "chan int 2/5", "", "chan int", nil},
+		{"chbuf.qcount", true, "2", "", "uint", nil},
+		{"chbuf.dataqsiz", true, "5", "", "uint", nil},
+		{"chbuf.buf", true, "*[5]int [1,2,0,0,0]", "", "*[5]int", nil},
+		{"chsend", true, "chan int 0/0 (senders waiting)", "", "chan int", nil},
+		{"chrecv", true, "chan int 0/0 (receivers waiting)", "", "chan int", nil},
+	}
+	protest.AllowRecording(t)
+	withTestProcess("chanwaiters", t, func(p proc.Process, fixture protest.Fixture) {
+		assertNoError(proc.Continue(p), t, "Continue")
+		for _, testcase := range testcases {
+			variable, err := evalVariable(p, testcase.name, pnormalLoadConfig)
+			assertNoError(err, t, fmt.Sprintf("EvalVariable(%s)", testcase.name))
+			assertVariable(t, variable, testcase)
+		}
+	})
+}
+
 func setFunctionBreakpoint(p proc.Process, fname string) (*proc.Breakpoint, error) {
 	addr, err := proc.FindFunctionLocation(p, fname, true, 0)
 	if err != nil {
@@ -1212,6 +1502,40 @@ func TestCallFunction(t *testing.T) {
 	})
 }
 
+func TestSetStringWithCalls(t *testing.T) {
+	protest.MustSupportFunctionCalls(t, testBackend)
+	withTestProcess("fncall", t, func(p proc.Process, fixture protest.Fixture) {
+		_, err := proc.FindFunctionLocation(p, "runtime.debugCallV1", true, 0)
+		if err != nil {
+			t.Skip("function calls not supported on this version of go")
+		}
+		assertNoError(proc.Continue(p), t, "Continue()")
+
+		scope, err := proc.GoroutineScope(p.CurrentThread())
+		assertNoError(err, t, "GoroutineScope()")
+		if err := scope.SetVariable("comma", `"a new string"`); err == nil {
+			t.Fatal("string allocated without function calls")
+		}
+
+		assertNoError(proc.SetVariableWithCalls(p, "comma", `"a new string"`, true), t, "SetVariableWithCalls()")
+		v, err := evalVariable(p, "comma", pnormalLoadConfig)
+		assertNoError(err, t, "EvalVariable(comma)")
+		if s := constant.StringVal(v.Value); s != "a new string" {
+			t.Fatalf("wrong value for comma after assignment: %q", s)
+		}
+
+		// strings already in memory are assigned without calls
+		scope, err = proc.GoroutineScope(p.CurrentThread())
+		assertNoError(err, t, "GoroutineScope()")
+		assertNoError(scope.SetVariable("comma", "stringslice[1]"), t, "SetVariable()")
+		v, err = evalVariable(p, "comma", pnormalLoadConfig)
+		assertNoError(err, t, "EvalVariable(comma)")
+		if s := constant.StringVal(v.Value); s != "two" {
+			t.Fatalf("wrong value for comma after assignment: %q", s)
+		}
+	})
+}
+
 func TestIssue1531(t *testing.T) {
 	// Go 1.12 introduced a change to the map representation where empty cells can be marked with 1 instead of just 0.
 	withTestProcess("issue1531", t, func(p proc.Process, fixture protest.Fixture) {